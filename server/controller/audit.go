@@ -0,0 +1,62 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/crazyfrankie/zdocker-web/service"
+)
+
+// SetAuditLog 设置审计日志
+func (ctl *Controller) SetAuditLog(audit *service.AuditLog) {
+	ctl.audit = audit
+}
+
+// ListAuditEntries 查询审计日志，从新到旧返回。
+// 查询参数 user、action、target、result 过滤记录，action=container 匹配所有容器操作；
+// since、until 为 RFC3339 时间；limit 默认 100，最多 1000
+func (ctl *Controller) ListAuditEntries(c *gin.Context) {
+	filter := service.AuditFilter{
+		User:   c.Query("user"),
+		Action: c.Query("action"),
+		Target: c.Query("target"),
+		Result: c.Query("result"),
+	}
+	for name, dst := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if s := c.Query(name); s != "" {
+			t, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": "无效的 " + name + ": " + s,
+				})
+				return
+			}
+			*dst = t
+		}
+	}
+	if s := c.Query("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "无效的 limit: " + s,
+			})
+			return
+		}
+		filter.Limit = n
+	}
+
+	entries, err := ctl.audit.Query(filter)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{
+			"error": "查询审计日志失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": entries,
+	})
+}
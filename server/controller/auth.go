@@ -0,0 +1,155 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/crazyfrankie/zdocker-web/middleware"
+	"github.com/crazyfrankie/zdocker-web/service"
+)
+
+// LoginRequest 登录请求
+type LoginRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// RefreshRequest 刷新令牌请求
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// ChangePasswordRequest 修改密码请求
+type ChangePasswordRequest struct {
+	OldPassword string `json:"old_password" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+// SetSessions 设置签发和校验登录令牌的会话管理器
+func (ctl *Controller) SetSessions(sessions *service.SessionManager) {
+	ctl.sessions = sessions
+}
+
+// Login 校验用户名和密码，返回访问令牌和刷新令牌
+func (ctl *Controller) Login(c *gin.Context) {
+	var req LoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	tokens, user, err := ctl.sessions.Login(req.Username, req.Password)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"tokens": tokens,
+			"user":   user.Info(),
+		},
+	})
+}
+
+// RefreshToken 使用刷新令牌换取新的令牌，旧的刷新令牌随即失效
+func (ctl *Controller) RefreshToken(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	tokens, err := ctl.sessions.Refresh(req.RefreshToken)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"tokens": tokens,
+		},
+	})
+}
+
+// Logout 注销当前会话
+func (ctl *Controller) Logout(c *gin.Context) {
+	if p, ok := middleware.CurrentPrincipal(c); ok {
+		ctl.sessions.Logout(p.SessionID)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "已退出登录",
+	})
+}
+
+// SetAuthorizer 设置根据角色计算权限的授权器
+func (ctl *Controller) SetAuthorizer(authz *service.Authorizer) {
+	ctl.authz = authz
+}
+
+// GetCurrentUser 获取当前登录的用户及其权限，前端据此隐藏没有权限的操作
+func (ctl *Controller) GetCurrentUser(c *gin.Context) {
+	p, _ := middleware.CurrentPrincipal(c)
+	user, err := ctl.sessions.Users().Get(p.Username)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{
+			"error": "获取用户信息失败: " + err.Error(),
+		})
+		return
+	}
+	access, err := ctl.authz.Access(p)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{
+			"error": "获取用户权限失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"user":        user.Info(),
+			"permissions": access.Permissions(),
+			"roles":       access.Roles,
+		},
+	})
+}
+
+// ListRoles 获取内置角色和配置文件中的自定义角色
+func (ctl *Controller) ListRoles(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"data": ctl.authz.Roles().List(),
+	})
+}
+
+// ChangePassword 修改当前用户的密码，该用户的其他会话会被注销
+func (ctl *Controller) ChangePassword(c *gin.Context) {
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	p, _ := middleware.CurrentPrincipal(c)
+	if err := ctl.sessions.ChangePassword(p, req.OldPassword, req.NewPassword); err != nil {
+		c.JSON(errorStatus(err), gin.H{
+			"error": "修改密码失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "密码修改成功",
+	})
+}
@@ -0,0 +1,38 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/crazyfrankie/zdocker-web/service"
+)
+
+// GetContainerChanges 获取容器文件系统相对镜像新增、修改和删除的路径。
+// 查询参数 path 只返回该路径及其下的变化；limit 为最多返回的条目数，默认 1000，-1 表示不限制，统计值始终包含全部变化
+func (ctl *Controller) GetContainerChanges(c *gin.Context) {
+	opts := service.ChangesOptions{Prefix: c.Query("path")}
+	if s := c.Query("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n == 0 || n < -1 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "无效的 limit: " + s,
+			})
+			return
+		}
+		opts.Limit = n
+	}
+
+	changes, err := ctl.runtime.ContainerChanges(c.Param("id"), opts)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{
+			"error": "获取容器文件变化失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": changes,
+	})
+}
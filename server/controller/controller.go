@@ -1,32 +1,120 @@
 package controller
 
 import (
+	"errors"
 	"net/http"
-	"os/exec"
-	"strings"
 
 	"github.com/gin-gonic/gin"
 
+	"github.com/crazyfrankie/zdocker-web/middleware"
 	"github.com/crazyfrankie/zdocker-web/service"
 )
 
-// ListContainers 获取容器列表
-func ListContainers(c *gin.Context) {
-	containers, err := service.GetContainerList()
+// Controller HTTP 处理器，通过 Runtime 接口操作容器
+type Controller struct {
+	runtime    service.Runtime
+	reconciler *service.Reconciler
+	events     *service.EventBus
+	logs       *service.LogTracker
+	metrics    *service.MetricStore
+	// allowedOrigins 允许建立 WebSocket 连接的来源
+	allowedOrigins []string
+	// sessions 登录会话
+	sessions *service.SessionManager
+	// authz 根据角色计算权限
+	authz *service.Authorizer
+	// tokens 用于自动化调用的 API 令牌
+	tokens *service.APITokenStore
+	// audit 修改操作的审计日志
+	audit *service.AuditLog
+}
+
+// NewController 创建处理器
+func NewController(runtime service.Runtime, reconciler *service.Reconciler, events *service.EventBus, logs *service.LogTracker, metrics *service.MetricStore) *Controller {
+	return &Controller{
+		runtime:    runtime,
+		reconciler: reconciler,
+		events:     events,
+		logs:       logs,
+		metrics:    metrics,
+	}
+}
+
+// errorStatus 根据运行时返回的类型化错误选择HTTP状态码
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrContainerNotFound),
+		errors.Is(err, service.ErrNetworkNotFound),
+		errors.Is(err, service.ErrImageNotFound),
+		errors.Is(err, service.ErrFileNotFound),
+		errors.Is(err, service.ErrTokenNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrContainerExists),
+		errors.Is(err, service.ErrContainerRunning),
+		errors.Is(err, service.ErrContainerNotRunning),
+		errors.Is(err, service.ErrNetworkExists),
+		errors.Is(err, service.ErrImageExists),
+		errors.Is(err, service.ErrImageInUse):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrInvalidArgument):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrUnauthenticated):
+		return http.StatusUnauthorized
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// respondValidationError 以 422 返回字段级的校验错误，供前端表单定位到具体输入
+func respondValidationError(c *gin.Context, err error) {
+	var verr *service.ValidationError
+	if !errors.As(err, &verr) {
+		c.JSON(errorStatus(err), gin.H{
+			"error": "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusUnprocessableEntity, gin.H{
+		"error":  "请求参数校验失败: " + verr.Error(),
+		"errors": verr.Errors,
+	})
+}
+
+// visibleContainers 过滤掉调用方的角色范围之外的容器
+func visibleContainers(c *gin.Context, containers []service.Container) []service.Container {
+	access, _ := middleware.CurrentAccess(c)
+	visible := make([]service.Container, 0, len(containers))
+	for _, ct := range containers {
+		if access.CanContainer(service.PermContainersRead, ct.Name, ct.Labels) {
+			visible = append(visible, ct)
+		}
+	}
+	return visible
+}
+
+// ListContainers 获取容器列表，支持 status、name、image 查询参数过滤，只返回调用方有权查看的容器
+func (ctl *Controller) ListContainers(c *gin.Context) {
+	containers, err := ctl.runtime.ListContainers()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "获取容器列表失败: " + err.Error(),
 		})
 		return
 	}
+	containers = visibleContainers(c, containers)
 
+	filter := service.ContainerFilter{
+		Status: c.Query("status"),
+		Name:   c.Query("name"),
+		Image:  c.Query("image"),
+	}
 	c.JSON(http.StatusOK, gin.H{
-		"data": containers,
+		"data": service.FilterContainers(containers, filter),
 	})
 }
 
 // CreateContainer 创建容器
-func CreateContainer(c *gin.Context) {
+func (ctl *Controller) CreateContainer(c *gin.Context) {
 	var req service.CreateContainerRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -35,13 +123,37 @@ func CreateContainer(c *gin.Context) {
 		return
 	}
 
-	result, err := service.CreateContainer(req)
+	// 角色限定了容器范围时，只能创建名称和标签在范围内的容器
+	access, _ := middleware.CurrentAccess(c)
+	if !access.CanContainer(service.PermContainersWrite, req.Name, req.Labels) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":      "权限不足: 容器名称或标签不在角色允许的范围内",
+			"permission": service.PermContainersWrite,
+		})
+		return
+	}
+	// 挂载宿主机目录可以读写宿主机上的任意文件，与在容器中执行命令一样需要 containers:exec
+	if req.Volume != "" && !access.CanContainer(service.PermContainersExec, req.Name, req.Labels) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":      "权限不足: 挂载数据卷需要执行命令的权限",
+			"permission": service.PermContainersExec,
+		})
+		return
+	}
+
+	if err := service.ValidateCreateContainer(ctl.runtime, req); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+
+	result, err := ctl.runtime.CreateContainer(req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
+		c.JSON(errorStatus(err), gin.H{
 			"error": "创建容器失败: " + err.Error(),
 		})
 		return
 	}
+	middleware.SetAuditTarget(c, result.Name)
 
 	c.JSON(http.StatusOK, gin.H{
 		"data": result,
@@ -49,7 +161,7 @@ func CreateContainer(c *gin.Context) {
 }
 
 // GetContainer 获取单个容器信息
-func GetContainer(c *gin.Context) {
+func (ctl *Controller) GetContainer(c *gin.Context) {
 	containerId := c.Param("id")
 	if containerId == "" {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -58,9 +170,9 @@ func GetContainer(c *gin.Context) {
 		return
 	}
 
-	container, err := service.GetContainerById(containerId)
+	container, err := ctl.runtime.GetContainer(containerId)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
+		c.JSON(errorStatus(err), gin.H{
 			"error": "容器不存在: " + err.Error(),
 		})
 		return
@@ -71,8 +183,29 @@ func GetContainer(c *gin.Context) {
 	})
 }
 
+// InspectContainer 获取容器的完整信息，包括进程、资源限制、网络、端口映射和命名空间。
+// 没有执行命令权限的调用方只能看到环境变量的名称
+func (ctl *Controller) InspectContainer(c *gin.Context) {
+	inspect, err := ctl.runtime.InspectContainer(c.Param("id"))
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{
+			"error": "获取容器详情失败: " + err.Error(),
+		})
+		return
+	}
+	// 环境变量中常有连接串等凭据，只有能在容器中执行命令的调用方才能查看变量的值
+	access, _ := middleware.CurrentAccess(c)
+	if ct, err := ctl.runtime.GetContainer(inspect.Name); err != nil || !access.CanContainer(service.PermContainersExec, ct.Name, ct.Labels) {
+		inspect.HideEnv()
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": inspect,
+	})
+}
+
 // StartContainer 启动容器
-func StartContainer(c *gin.Context) {
+func (ctl *Controller) StartContainer(c *gin.Context) {
 	containerId := c.Param("id")
 	if containerId == "" {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -81,9 +214,9 @@ func StartContainer(c *gin.Context) {
 		return
 	}
 
-	err := service.StartContainer(containerId)
+	err := ctl.runtime.StartContainer(containerId)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
+		c.JSON(errorStatus(err), gin.H{
 			"error": "启动容器失败: " + err.Error(),
 		})
 		return
@@ -95,7 +228,7 @@ func StartContainer(c *gin.Context) {
 }
 
 // StopContainer 停止容器
-func StopContainer(c *gin.Context) {
+func (ctl *Controller) StopContainer(c *gin.Context) {
 	containerName := c.Param("name")
 	if containerName == "" {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -104,9 +237,9 @@ func StopContainer(c *gin.Context) {
 		return
 	}
 
-	err := service.StopContainer(containerName)
+	err := ctl.runtime.StopContainer(containerName)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
+		c.JSON(errorStatus(err), gin.H{
 			"error": "停止容器失败: " + err.Error(),
 		})
 		return
@@ -118,7 +251,7 @@ func StopContainer(c *gin.Context) {
 }
 
 // RemoveContainer 删除容器
-func RemoveContainer(c *gin.Context) {
+func (ctl *Controller) RemoveContainer(c *gin.Context) {
 	containerName := c.Param("name")
 	if containerName == "" {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -127,9 +260,9 @@ func RemoveContainer(c *gin.Context) {
 		return
 	}
 
-	err := service.RemoveContainer(containerName)
+	err := ctl.runtime.RemoveContainer(containerName)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
+		c.JSON(errorStatus(err), gin.H{
 			"error": "删除容器失败: " + err.Error(),
 		})
 		return
@@ -140,31 +273,8 @@ func RemoveContainer(c *gin.Context) {
 	})
 }
 
-// GetContainerLogs 获取容器日志
-func GetContainerLogs(c *gin.Context) {
-	containerName := c.Param("name")
-	if containerName == "" {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "容器ID不能为空",
-		})
-		return
-	}
-
-	logs, err := service.GetContainerLogs(containerName)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "获取容器日志失败: " + err.Error(),
-		})
-		return
-	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"data": logs,
-	})
-}
-
 // ExecContainer 在容器中执行命令
-func ExecContainer(c *gin.Context) {
+func (ctl *Controller) ExecContainer(c *gin.Context) {
 	containerId := c.Param("id")
 	if containerId == "" {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -181,9 +291,9 @@ func ExecContainer(c *gin.Context) {
 		return
 	}
 
-	result, err := service.ExecContainer(containerId, req)
+	result, err := ctl.runtime.ExecContainer(containerId, req.Command)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
+		c.JSON(errorStatus(err), gin.H{
 			"error": "执行命令失败: " + err.Error(),
 		})
 		return
@@ -194,34 +304,11 @@ func ExecContainer(c *gin.Context) {
 	})
 }
 
-// ListImages 获取镜像列表
-func ListImages(c *gin.Context) {
-	// 由于zdocker没有专门的镜像管理，这里简单返回空列表
-	c.JSON(http.StatusOK, gin.H{
-		"data": []interface{}{},
-	})
-}
-
-// RemoveImage 删除镜像
-func RemoveImage(c *gin.Context) {
-	imageId := c.Param("id")
-	if imageId == "" {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "镜像ID不能为空",
-		})
-		return
-	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"message": "镜像删除成功",
-	})
-}
-
 // ListNetworks 获取网络列表
-func ListNetworks(c *gin.Context) {
-	networks, err := service.GetNetworkList()
+func (ctl *Controller) ListNetworks(c *gin.Context) {
+	networks, err := ctl.runtime.ListNetworks()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
+		c.JSON(errorStatus(err), gin.H{
 			"error": "获取网络列表失败: " + err.Error(),
 		})
 		return
@@ -233,7 +320,7 @@ func ListNetworks(c *gin.Context) {
 }
 
 // CreateNetwork 创建网络
-func CreateNetwork(c *gin.Context) {
+func (ctl *Controller) CreateNetwork(c *gin.Context) {
 	var req service.CreateNetworkRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -242,9 +329,9 @@ func CreateNetwork(c *gin.Context) {
 		return
 	}
 
-	result, err := service.CreateNetwork(req)
+	result, err := ctl.runtime.CreateNetwork(req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
+		c.JSON(errorStatus(err), gin.H{
 			"error": "创建网络失败: " + err.Error(),
 		})
 		return
@@ -256,7 +343,7 @@ func CreateNetwork(c *gin.Context) {
 }
 
 // RemoveNetwork 删除网络
-func RemoveNetwork(c *gin.Context) {
+func (ctl *Controller) RemoveNetwork(c *gin.Context) {
 	networkId := c.Param("id")
 	if networkId == "" {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -265,9 +352,9 @@ func RemoveNetwork(c *gin.Context) {
 		return
 	}
 
-	err := service.RemoveNetwork(networkId)
+	err := ctl.runtime.RemoveNetwork(networkId)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
+		c.JSON(errorStatus(err), gin.H{
 			"error": "删除网络失败: " + err.Error(),
 		})
 		return
@@ -279,7 +366,7 @@ func RemoveNetwork(c *gin.Context) {
 }
 
 // GetSystemInfo 获取系统信息
-func GetSystemInfo(c *gin.Context) {
+func (ctl *Controller) GetSystemInfo(c *gin.Context) {
 	info, err := service.GetSystemInfo()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -293,14 +380,26 @@ func GetSystemInfo(c *gin.Context) {
 	})
 }
 
-// GetVersion 获取版本信息
-func GetVersion(c *gin.Context) {
-	cmd := exec.Command("zdocker", "--version")
-	output, err := cmd.CombinedOutput()
+// Reconcile 立即校正容器状态
+func (ctl *Controller) Reconcile(c *gin.Context) {
+	result, err := ctl.reconciler.Reconcile()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "校正容器状态失败: " + err.Error(),
+		})
+		return
+	}
 
-	version := "unknown"
-	if err == nil {
-		version = strings.TrimSpace(string(output))
+	c.JSON(http.StatusOK, gin.H{
+		"data": result,
+	})
+}
+
+// GetVersion 获取版本信息
+func (ctl *Controller) GetVersion(c *gin.Context) {
+	version, err := ctl.runtime.Version()
+	if err != nil {
+		version = "unknown"
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -0,0 +1,262 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/bytedance/sonic"
+	"github.com/gin-gonic/gin"
+
+	"github.com/crazyfrankie/zdocker-web/middleware"
+	"github.com/crazyfrankie/zdocker-web/service"
+)
+
+var (
+	adminAccess = service.Access{
+		Username: "admin",
+		Roles:    []service.Role{{Name: service.RoleAdmin, Permissions: []service.Permission{"*"}}},
+	}
+	operatorAccess = service.Access{
+		Username: "operator",
+		Roles: []service.Role{{
+			Name:        service.RoleOperator,
+			Permissions: []service.Permission{service.PermContainersRead, service.PermContainersWrite},
+		}},
+	}
+)
+
+// newTestRouter 注册容器路由，跳过认证，由 access 作为调用方的权限
+func newTestRouter(t *testing.T, access service.Access) *gin.Engine {
+	// FakeRuntime 在临时目录下保存日志和根文件系统，测试结束后删除
+	t.Setenv("TMPDIR", t.TempDir())
+	gin.SetMode(gin.TestMode)
+	ctl := NewController(service.NewFakeRuntime(), nil, nil, nil, nil)
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set(middleware.AccessKey, access)
+	})
+	r.POST("/containers", ctl.CreateContainer)
+	r.GET("/containers/:id", ctl.GetContainer)
+	r.GET("/containers/:id/inspect", ctl.InspectContainer)
+	r.GET("/images/:id/download", ctl.DownloadImage)
+	r.POST("/containers/:id/start", ctl.StartContainer)
+	r.POST("/containers/stop/:name", ctl.StopContainer)
+	r.DELETE("/containers/:name", ctl.RemoveContainer)
+	return r
+}
+
+// doRequest 发送请求并返回响应
+func doRequest(r *gin.Engine, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestContainerLifecycle(t *testing.T) {
+	r := newTestRouter(t, adminAccess)
+
+	steps := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{"create", http.MethodPost, "/containers", `{"image":"busybox","name":"web","command":"sleep 100","detach":true}`, http.StatusOK},
+		{"create duplicate", http.MethodPost, "/containers", `{"image":"busybox","name":"web","command":"sleep 100"}`, http.StatusUnprocessableEntity},
+		{"get", http.MethodGet, "/containers/web", "", http.StatusOK},
+		{"start running", http.MethodPost, "/containers/web/start", "", http.StatusConflict},
+		{"remove running", http.MethodDelete, "/containers/web", "", http.StatusConflict},
+		{"stop", http.MethodPost, "/containers/stop/web", "", http.StatusOK},
+		{"start", http.MethodPost, "/containers/web/start", "", http.StatusOK},
+		{"stop again", http.MethodPost, "/containers/stop/web", "", http.StatusOK},
+		{"remove", http.MethodDelete, "/containers/web", "", http.StatusOK},
+		{"get removed", http.MethodGet, "/containers/web", "", http.StatusNotFound},
+		{"stop missing", http.MethodPost, "/containers/stop/web", "", http.StatusNotFound},
+		{"start missing", http.MethodPost, "/containers/web/start", "", http.StatusNotFound},
+		{"remove missing", http.MethodDelete, "/containers/web", "", http.StatusNotFound},
+	}
+	for _, step := range steps {
+		w := doRequest(r, step.method, step.path, step.body)
+		if w.Code != step.status {
+			t.Fatalf("%s: status = %d, want %d, body %s", step.name, w.Code, step.status, w.Body.String())
+		}
+	}
+}
+
+func TestCreateContainerResponse(t *testing.T) {
+	r := newTestRouter(t, adminAccess)
+
+	w := doRequest(r, http.MethodPost, "/containers", `{"image":"busybox","name":"web","command":["sh","-c","echo hi"]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data service.Container `json:"data"`
+	}
+	if err := sonic.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Data.Name != "web" || resp.Data.Image != "busybox" || resp.Data.Status != "running" {
+		t.Errorf("container = %+v", resp.Data)
+	}
+	if want := "sh -c 'echo hi'"; resp.Data.Command != want {
+		t.Errorf("command = %q, want %q", resp.Data.Command, want)
+	}
+}
+
+func TestCreateContainerValidation(t *testing.T) {
+	r := newTestRouter(t, adminAccess)
+
+	w := doRequest(r, http.MethodPost, "/containers", `{"image":"missing","name":"-bad","memory":"1x"}`)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Errors []service.FieldError `json:"errors"`
+	}
+	if err := sonic.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	fields := map[string]string{}
+	for _, fe := range resp.Errors {
+		fields[fe.Field] = fe.Code
+	}
+	want := map[string]string{
+		"name":    service.ValidationInvalid,
+		"image":   service.ValidationNotFound,
+		"command": service.ValidationRequired,
+		"memory":  service.ValidationInvalid,
+	}
+	for field, code := range want {
+		if fields[field] != code {
+			t.Errorf("field %s: code = %q, want %q (errors %v)", field, fields[field], code, resp.Errors)
+		}
+	}
+
+	w = doRequest(r, http.MethodPost, "/containers", `{"image":`)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("malformed body: status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestCreateContainerVolumeRequiresExec(t *testing.T) {
+	body := fmt.Sprintf(`{"image":"busybox","name":"web","command":"sleep 100","volume":"%s:/data"}`, t.TempDir())
+
+	w := doRequest(newTestRouter(t, operatorAccess), http.MethodPost, "/containers", body)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("operator: status = %d, want %d, body %s", w.Code, http.StatusForbidden, w.Body.String())
+	}
+	w = doRequest(newTestRouter(t, operatorAccess), http.MethodPost, "/containers", `{"image":"busybox","name":"web","command":"sleep 100"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("operator without volume: status = %d, body %s", w.Code, w.Body.String())
+	}
+	w = doRequest(newTestRouter(t, adminAccess), http.MethodPost, "/containers", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("admin: status = %d, body %s", w.Code, w.Body.String())
+	}
+}
+
+func TestInspectContainerEnv(t *testing.T) {
+	const body = `{"image":"busybox","name":"web","command":"run --db-password=hunter2 --port=80","environment":{"APP_ENV":"prod","DB_PASSWORD":"hunter2","DATABASE_URL":"postgres://u:p@db"}}`
+
+	tests := []struct {
+		name     string
+		access   service.Access
+		wantEnv  []string
+		wantArgs []string
+	}{
+		{
+			name:     "exec permission",
+			access:   adminAccess,
+			wantEnv:  []string{"APP_ENV=prod", "DATABASE_URL=postgres://u:p@db", "DB_PASSWORD=***"},
+			wantArgs: []string{"run", "--db-password=***", "--port=80"},
+		},
+		{
+			name:     "read only",
+			access:   operatorAccess,
+			wantEnv:  []string{"APP_ENV=***", "DATABASE_URL=***", "DB_PASSWORD=***"},
+			wantArgs: []string{"run", "--db-password=***", "--port=80"},
+		},
+	}
+	for _, tt := range tests {
+		r := newTestRouter(t, tt.access)
+		if w := doRequest(r, http.MethodPost, "/containers", body); w.Code != http.StatusOK {
+			t.Fatalf("%s: create: status = %d, body %s", tt.name, w.Code, w.Body.String())
+		}
+		w := doRequest(r, http.MethodGet, "/containers/web/inspect", "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, body %s", tt.name, w.Code, w.Body.String())
+		}
+		var resp struct {
+			Data service.ContainerInspect `json:"data"`
+		}
+		if err := sonic.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(resp.Data.Env, tt.wantEnv) {
+			t.Errorf("%s: env = %q, want %q", tt.name, resp.Data.Env, tt.wantEnv)
+		}
+		if !slices.Equal(resp.Data.Args, tt.wantArgs) {
+			t.Errorf("%s: args = %q, want %q", tt.name, resp.Data.Args, tt.wantArgs)
+		}
+	}
+}
+
+func TestDownloadImage(t *testing.T) {
+	r := newTestRouter(t, adminAccess)
+
+	w := doRequest(r, http.MethodGet, "/images/busybox/download", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body.String())
+	}
+	disposition, params, err := mime.ParseMediaType(w.Header().Get("Content-Disposition"))
+	if err != nil {
+		t.Fatalf("parse Content-Disposition %q: %v", w.Header().Get("Content-Disposition"), err)
+	}
+	if disposition != "attachment" || params["filename"] != "busybox.tar" {
+		t.Errorf("Content-Disposition = %q, params %v", disposition, params)
+	}
+
+	if w := doRequest(r, http.MethodGet, "/images/missing/download", ""); w.Code != http.StatusNotFound {
+		t.Errorf("missing image: status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestErrorStatus(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{fmt.Errorf("%w: web", service.ErrContainerNotFound), http.StatusNotFound},
+		{fmt.Errorf("%w: bridge", service.ErrNetworkNotFound), http.StatusNotFound},
+		{fmt.Errorf("%w: busybox", service.ErrImageNotFound), http.StatusNotFound},
+		{fmt.Errorf("%w: /etc/passwd", service.ErrFileNotFound), http.StatusNotFound},
+		{fmt.Errorf("%w: abc", service.ErrTokenNotFound), http.StatusNotFound},
+		{fmt.Errorf("%w: web", service.ErrContainerExists), http.StatusConflict},
+		{fmt.Errorf("%w: web", service.ErrContainerRunning), http.StatusConflict},
+		{fmt.Errorf("%w: web", service.ErrContainerNotRunning), http.StatusConflict},
+		{fmt.Errorf("%w: bridge", service.ErrNetworkExists), http.StatusConflict},
+		{fmt.Errorf("%w: busybox", service.ErrImageExists), http.StatusConflict},
+		{fmt.Errorf("%w: busybox", service.ErrImageInUse), http.StatusConflict},
+		{fmt.Errorf("%w: 命令不能为空", service.ErrInvalidArgument), http.StatusBadRequest},
+		{&service.ValidationError{}, http.StatusBadRequest},
+		{fmt.Errorf("%w: 令牌已过期", service.ErrUnauthenticated), http.StatusUnauthorized},
+		{fmt.Errorf("wrapped twice: %w", fmt.Errorf("%w: web", service.ErrContainerNotFound)), http.StatusNotFound},
+		{errors.New("exit status 1"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		if got := errorStatus(tt.err); got != tt.want {
+			t.Errorf("errorStatus(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
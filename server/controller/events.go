@@ -0,0 +1,138 @@
+package controller
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/gin-gonic/gin"
+
+	"github.com/crazyfrankie/zdocker-web/middleware"
+	"github.com/crazyfrankie/zdocker-web/service"
+)
+
+const (
+	// sseHeartbeat SSE 心跳间隔，防止代理因空闲断开连接
+	sseHeartbeat = 15 * time.Second
+	// sseEventResync 无法补发历史事件时推送的事件类型
+	sseEventResync = "resync"
+)
+
+// startSSE 写入 SSE 响应头
+func startSSE(c *gin.Context) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	// 关闭 nginx 等反向代理的响应缓冲
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+}
+
+// writeSSE 写入一条 SSE 消息并立即刷新，id 为空时不写 id 字段
+func writeSSE(w io.Writer, id string, event string, data any) error {
+	payload, err := sonic.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	if id != "" {
+		fmt.Fprintf(&b, "id: %s\n", id)
+	}
+	if event != "" {
+		fmt.Fprintf(&b, "event: %s\n", event)
+	}
+	fmt.Fprintf(&b, "data: %s\n\n", payload)
+
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return err
+	}
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+// writeSSEComment 写入 SSE 注释行，用作心跳
+func writeSSEComment(w io.Writer, comment string) error {
+	if _, err := io.WriteString(w, ": "+comment+"\n\n"); err != nil {
+		return err
+	}
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+// StreamEvents 以 SSE 推送容器和网络生命周期事件。
+// 支持 type（逗号分隔，可用 container / network 匹配一类事件）和 container 查询参数过滤，
+// 重连时通过 Last-Event-ID 请求头或 last_event_id 查询参数补发历史事件。
+// 无法补发时（服务已重启或历史事件已被丢弃）先推送 resync 事件，客户端收到后应重新加载全部状态
+func (ctl *Controller) StreamEvents(c *gin.Context) {
+	var filter service.EventFilter
+	if types := c.Query("type"); types != "" {
+		for _, t := range strings.Split(types, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				filter.Types = append(filter.Types, t)
+			}
+		}
+	}
+	filter.Container = c.Query("container")
+
+	lastEventId := c.GetHeader("Last-Event-ID")
+	if lastEventId == "" {
+		lastEventId = c.Query("last_event_id")
+	}
+
+	// 容器事件只推送调用方有权查看的容器，网络和镜像事件不受容器范围限制
+	access, _ := middleware.CurrentAccess(c)
+	visible := func(e service.Event) bool {
+		return e.ContainerName == "" || ctl.containerVisible(access, e.ContainerName)
+	}
+
+	backlog, resync, ch, cancel := ctl.events.Subscribe(filter, lastEventId)
+	defer cancel()
+
+	startSSE(c)
+	if resync != nil {
+		if err := writeSSE(c.Writer, resync.ID, sseEventResync, resync); err != nil {
+			return
+		}
+	}
+	for _, e := range backlog {
+		if !visible(e) {
+			continue
+		}
+		if err := writeSSE(c.Writer, e.ID, e.Type, e); err != nil {
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-heartbeat.C:
+			if err := writeSSEComment(c.Writer, "ping"); err != nil {
+				return
+			}
+		case e, ok := <-ch:
+			if !ok {
+				// 消费过慢被取消订阅，客户端会带着 Last-Event-ID 重连
+				return
+			}
+			if !visible(e) {
+				continue
+			}
+			if err := writeSSE(c.Writer, e.ID, e.Type, e); err != nil {
+				return
+			}
+		}
+	}
+}
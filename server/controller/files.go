@@ -0,0 +1,163 @@
+package controller
+
+import (
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/crazyfrankie/zdocker-web/service"
+)
+
+// ListContainerFiles 列出容器内目录的内容，查询参数 path 默认为根目录
+func (ctl *Controller) ListContainerFiles(c *gin.Context) {
+	fsys, err := ctl.runtime.ContainerFS(c.Param("id"))
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{
+			"error": "获取容器文件列表失败: " + err.Error(),
+		})
+		return
+	}
+
+	files, err := fsys.List(c.DefaultQuery("path", "/"))
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{
+			"error": "获取容器文件列表失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": files,
+	})
+}
+
+// StatContainerFile 获取容器内路径的元数据，路径是符号链接时返回链接本身及其目标
+func (ctl *Controller) StatContainerFile(c *gin.Context) {
+	fsys, err := ctl.runtime.ContainerFS(c.Param("id"))
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{
+			"error": "获取容器文件信息失败: " + err.Error(),
+		})
+		return
+	}
+
+	info, err := fsys.Stat(c.DefaultQuery("path", "/"))
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{
+			"error": "获取容器文件信息失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": info,
+	})
+}
+
+// DownloadContainerFile 下载容器内的文件，内容按原始字节返回；目录打包为 tar 包，此时没有 Content-Length
+func (ctl *Controller) DownloadContainerFile(c *gin.Context) {
+	containerId := c.Param("id")
+	fsys, err := ctl.runtime.ContainerFS(containerId)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{
+			"error": "下载容器文件失败: " + err.Error(),
+		})
+		return
+	}
+
+	p := c.Query("path")
+	if p == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "缺少 path 参数",
+		})
+		return
+	}
+	reader, info, err := fsys.Open(p)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{
+			"error": "下载容器文件失败: " + err.Error(),
+		})
+		return
+	}
+	defer reader.Close()
+
+	header := c.Writer.Header()
+	filename := info.Name
+	if info.Type == service.FileTypeDir {
+		if info.Path == "/" {
+			filename = containerId
+		}
+		filename += ".tar"
+		header.Set("Content-Type", "application/x-tar")
+	} else {
+		header.Set("Content-Type", "application/octet-stream")
+		header.Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	}
+	header.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	c.Status(http.StatusOK)
+
+	if _, err := io.Copy(c.Writer, reader); err != nil {
+		// 响应头已发送，只能直接关闭连接，避免客户端误以为下载完整
+		log.Printf("下载容器 %s 的文件 %s 失败: %v", containerId, info.Path, err)
+		if conn, _, err := c.Writer.Hijack(); err == nil {
+			conn.Close()
+		}
+	}
+}
+
+// UploadContainerFile 将请求体写入容器内 path 指定的文件，上级目录必须存在，已有文件被原子替换。
+// 查询参数 mode 为八进制权限，owner 为 用户[:组]，可以是数字 ID 或容器内的名称；未指定时保留已有文件的权限和属主
+func (ctl *Controller) UploadContainerFile(c *gin.Context) {
+	fsys, err := ctl.runtime.ContainerFS(c.Param("id"))
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{
+			"error": "上传容器文件失败: " + err.Error(),
+		})
+		return
+	}
+
+	p := c.Query("path")
+	if p == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "缺少 path 参数",
+		})
+		return
+	}
+	var opts service.WriteFileOptions
+	if s := c.Query("mode"); s != "" {
+		mode, err := service.ParseFileMode(s)
+		if err != nil {
+			c.JSON(errorStatus(err), gin.H{
+				"error": "上传容器文件失败: " + err.Error(),
+			})
+			return
+		}
+		opts.Mode = &mode
+	}
+	if s := c.Query("owner"); s != "" {
+		owner, err := fsys.ParseOwner(s)
+		if err != nil {
+			c.JSON(errorStatus(err), gin.H{
+				"error": "上传容器文件失败: " + err.Error(),
+			})
+			return
+		}
+		opts.Owner = &owner
+	}
+
+	info, err := fsys.WriteFile(p, c.Request.Body, opts)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{
+			"error": "上传容器文件失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": info,
+	})
+}
@@ -0,0 +1,265 @@
+package controller
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/crazyfrankie/zdocker-web/service"
+)
+
+// imageChecksumTrailer 下载打包的镜像目录时在响应末尾附带的 sha256 校验和
+const imageChecksumTrailer = "X-Checksum-Sha256"
+
+// maxImageFieldSize 上传表单中 name、sha256 等文本字段的最大长度
+const maxImageFieldSize = 1024
+
+// ListImages 获取镜像列表
+func (ctl *Controller) ListImages(c *gin.Context) {
+	images, err := ctl.runtime.ListImages()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "获取镜像列表失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": images,
+	})
+}
+
+// GetImage 获取镜像详情
+func (ctl *Controller) GetImage(c *gin.Context) {
+	image, err := ctl.runtime.GetImage(c.Param("id"))
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{
+			"error": "获取镜像失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": image,
+	})
+}
+
+// RemoveImage 删除镜像，被容器使用的镜像需要 force=true
+func (ctl *Controller) RemoveImage(c *gin.Context) {
+	imageId := c.Param("id")
+	if imageId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "镜像ID不能为空",
+		})
+		return
+	}
+
+	if err := ctl.runtime.RemoveImage(imageId, c.Query("force") == "true"); err != nil {
+		c.JSON(errorStatus(err), gin.H{
+			"error": "删除镜像失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "镜像删除成功",
+	})
+}
+
+// UploadImage 以 multipart/form-data 上传 tar 包作为新镜像，文件内容边读取边写入磁盘。
+// name 和可选的 sha256 可以作为查询参数，也可以作为表单字段，表单字段必须位于 file 字段之前
+func (ctl *Controller) UploadImage(c *gin.Context) {
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	name := c.Query("name")
+	checksum := c.Query("sha256")
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "缺少 file 字段",
+			})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "读取上传内容失败: " + err.Error(),
+			})
+			return
+		}
+
+		switch part.FormName() {
+		case "name":
+			name, err = readFormField(part)
+		case "sha256":
+			checksum, err = readFormField(part)
+		case "file":
+			if name == "" {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": "缺少镜像名称，name 必须位于 file 字段之前",
+				})
+				return
+			}
+			image, err := ctl.runtime.ImportImage(name, part, checksum)
+			if err != nil {
+				c.JSON(errorStatus(err), gin.H{
+					"error": "上传镜像失败: " + err.Error(),
+				})
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{
+				"data": image,
+			})
+			return
+		}
+		part.Close()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "请求参数错误: " + err.Error(),
+			})
+			return
+		}
+	}
+}
+
+// readFormField 读取 multipart 文本字段
+func readFormField(part *multipart.Part) (string, error) {
+	data, err := io.ReadAll(io.LimitReader(part, maxImageFieldSize+1))
+	if err != nil {
+		return "", err
+	}
+	if len(data) > maxImageFieldSize {
+		return "", errors.New(part.FormName() + " 字段过长")
+	}
+	return string(data), nil
+}
+
+// DownloadImage 以 tar 包下载镜像。只有解压目录的镜像在下载时打包，
+// 此时没有 Content-Length，改为在分块响应末尾以 X-Checksum-Sha256 trailer 给出发送内容的 sha256
+func (ctl *Controller) DownloadImage(c *gin.Context) {
+	name := c.Param("id")
+	reader, size, err := ctl.runtime.OpenImage(name)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{
+			"error": "下载镜像失败: " + err.Error(),
+		})
+		return
+	}
+	defer reader.Close()
+
+	header := c.Writer.Header()
+	header.Set("Content-Type", "application/x-tar")
+	header.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name + ".tar"}))
+	if size >= 0 {
+		header.Set("Content-Length", strconv.FormatInt(size, 10))
+	} else {
+		header.Set("Trailer", imageChecksumTrailer)
+	}
+	c.Status(http.StatusOK)
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(c.Writer, hash), reader); err != nil {
+		// 响应头已发送，只能直接关闭连接，避免分块响应正常结束让客户端误以为下载完整
+		log.Printf("下载镜像 %s 失败: %v", name, err)
+		if conn, _, err := c.Writer.Hijack(); err == nil {
+			conn.Close()
+		}
+		return
+	}
+	if size < 0 {
+		header.Set(imageChecksumTrailer, hex.EncodeToString(hash.Sum(nil)))
+	}
+}
+
+// commitProgressInterval 推送提交进度的最小间隔
+const commitProgressInterval = 200 * time.Millisecond
+
+// CommitContainer 将容器的文件系统提交为新镜像，请求体为 {"image": 名称, "pause": 是否暂停容器}。
+// Accept 为 text/event-stream 时以 SSE 推送 progress 事件，完成后发送 done 或 error 事件；否则等待完成后返回镜像信息
+func (ctl *Controller) CommitContainer(c *gin.Context) {
+	containerId := c.Param("id")
+	var opts service.CommitOptions
+	if err := c.ShouldBindJSON(&opts); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	if !strings.Contains(c.GetHeader("Accept"), "text/event-stream") {
+		image, err := ctl.runtime.CommitContainer(containerId, opts, nil)
+		if err != nil {
+			c.JSON(errorStatus(err), gin.H{
+				"error": "提交容器失败: " + err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"data": image,
+		})
+		return
+	}
+
+	// 进度在打包协程中产生，只保留最新一次，由当前协程按间隔推送
+	var mu sync.Mutex
+	var latest *service.CommitProgress
+	type commitResult struct {
+		image service.Image
+		err   error
+	}
+	done := make(chan commitResult, 1)
+	go func() {
+		image, err := ctl.runtime.CommitContainer(containerId, opts, func(p service.CommitProgress) {
+			mu.Lock()
+			latest = &p
+			mu.Unlock()
+		})
+		done <- commitResult{image, err}
+	}()
+
+	startSSE(c)
+	sendProgress := func() {
+		mu.Lock()
+		p := latest
+		latest = nil
+		mu.Unlock()
+		if p != nil {
+			writeSSE(c.Writer, "", "progress", p)
+		}
+	}
+
+	// 客户端断开后提交仍在后台完成，不中途放弃已冻结的容器
+	ticker := time.NewTicker(commitProgressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			sendProgress()
+		case result := <-done:
+			sendProgress()
+			if result.err != nil {
+				writeSSE(c.Writer, "", "error", gin.H{"error": "提交容器失败: " + result.err.Error()})
+				return
+			}
+			writeSSE(c.Writer, "", "done", result.image)
+			return
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package controller
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/crazyfrankie/zdocker-web/service"
+)
+
+// parseLogTime 解析 since/until：RFC3339 时间、Unix 时间戳（秒，可带小数）或相对当前的时长如 10m
+func parseLogTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	if secs, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.Unix(0, int64(secs*float64(time.Second))), nil
+	}
+	if d, err := time.ParseDuration(s); err == nil && d >= 0 {
+		return time.Now().Add(-d), nil
+	}
+	return time.Time{}, errors.New("无效的时间: " + s)
+}
+
+// parseLogOptions 解析 tail、since、until 查询参数
+func parseLogOptions(c *gin.Context) (service.LogOptions, error) {
+	opts := service.LogOptions{Tail: -1}
+
+	if tail := c.Query("tail"); tail != "" && tail != "all" {
+		n, err := strconv.Atoi(tail)
+		if err != nil || n < 0 {
+			return opts, errors.New("无效的 tail: " + tail)
+		}
+		opts.Tail = n
+	}
+	if since := c.Query("since"); since != "" {
+		t, err := parseLogTime(since)
+		if err != nil {
+			return opts, err
+		}
+		opts.Since = t
+	}
+	if until := c.Query("until"); until != "" {
+		t, err := parseLogTime(until)
+		if err != nil {
+			return opts, err
+		}
+		opts.Until = t
+	}
+	return opts, nil
+}
+
+// GetContainerLogs 获取容器日志。
+// 支持 tail=N、since/until 和 timestamps=true；follow=true 时持续推送新日志，
+// 请求头 Accept 为 text/event-stream 时使用 SSE，否则使用分块传输的纯文本，
+// 日志文件被截断时从头继续，容器被删除后结束
+func (ctl *Controller) GetContainerLogs(c *gin.Context) {
+	containerName := c.Param("name")
+	if containerName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "容器ID不能为空",
+		})
+		return
+	}
+
+	follow := c.Query("follow") == "true"
+	timestamps := c.Query("timestamps") == "true"
+	if !follow && !timestamps && c.Query("tail") == "" && c.Query("since") == "" && c.Query("until") == "" {
+		logs, err := ctl.runtime.ContainerLogs(containerName)
+		if err != nil {
+			c.JSON(errorStatus(err), gin.H{
+				"error": "获取容器日志失败: " + err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"data": logs,
+		})
+		return
+	}
+
+	opts, err := parseLogOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "获取容器日志失败: " + err.Error(),
+		})
+		return
+	}
+
+	sse := strings.Contains(c.GetHeader("Accept"), "text/event-stream")
+	// SSE 重连时从上次的偏移继续，不再按 tail 截取
+	if lastEventId := c.GetHeader("Last-Event-ID"); sse && follow && lastEventId != "" {
+		offset, err := strconv.ParseInt(lastEventId, 10, 64)
+		if err != nil || offset < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "无效的 Last-Event-ID: " + lastEventId,
+			})
+			return
+		}
+		opts.Offset = offset
+		opts.Tail = -1
+	}
+
+	lines, offset, err := ctl.logs.Read(containerName, opts, !follow)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{
+			"error": "获取容器日志失败: " + err.Error(),
+		})
+		return
+	}
+
+	if !follow {
+		var b strings.Builder
+		for _, line := range lines {
+			b.WriteString(line.Format(timestamps))
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"data": b.String(),
+		})
+		return
+	}
+
+	var sink logSink
+	if sse {
+		startSSE(c)
+		sink = &sseLogSink{w: c.Writer}
+	} else {
+		c.Header("Content-Type", "text/plain; charset=utf-8")
+		c.Header("X-Content-Type-Options", "nosniff")
+		c.Status(http.StatusOK)
+		c.Writer.Flush()
+		sink = &textLogSink{w: c.Writer, timestamps: timestamps}
+	}
+
+	for _, line := range lines {
+		if err := sink.WriteLine(line); err != nil {
+			return
+		}
+	}
+
+	err = ctl.logs.Follow(c.Request.Context(), containerName, offset, opts, sink)
+	reason := "until"
+	switch {
+	case c.Request.Context().Err() != nil:
+		return
+	case errors.Is(err, service.ErrContainerNotFound):
+		reason = "removed"
+	case err != nil:
+		reason = err.Error()
+	}
+	sink.End(reason)
+}
+
+// logSink 跟随模式的输出格式
+type logSink interface {
+	service.LogSink
+	// End 日志流结束
+	End(reason string)
+}
+
+// sseLogSink 以 SSE 输出日志，事件ID为该行结束处的偏移，用于断线续传
+type sseLogSink struct {
+	w io.Writer
+}
+
+// WriteLine 输出一行日志
+func (s *sseLogSink) WriteLine(line service.LogLine) error {
+	return writeSSE(s.w, strconv.FormatInt(line.Offset, 10), "log", line)
+}
+
+// Truncated 通知客户端日志文件被截断
+func (s *sseLogSink) Truncated() error {
+	return writeSSE(s.w, "0", "truncated", gin.H{"time": time.Now()})
+}
+
+// End 通知客户端日志流结束，客户端收到后不应重连
+func (s *sseLogSink) End(reason string) {
+	writeSSE(s.w, "", "end", gin.H{"reason": reason})
+}
+
+// textLogSink 以分块传输的纯文本输出日志
+type textLogSink struct {
+	w          io.Writer
+	timestamps bool
+}
+
+// WriteLine 输出一行日志
+func (s *textLogSink) WriteLine(line service.LogLine) error {
+	if _, err := io.WriteString(s.w, line.Format(s.timestamps)); err != nil {
+		return err
+	}
+	if f, ok := s.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+// Truncated 纯文本无法区分提示和日志内容，截断后直接从头继续输出
+func (s *textLogSink) Truncated() error {
+	return nil
+}
+
+// End 纯文本在连接关闭时即结束
+func (s *textLogSink) End(string) {}
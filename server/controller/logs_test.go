@@ -0,0 +1,65 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseLogOptions(t *testing.T) {
+	fixed := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		query     string
+		wantTail  int
+		wantSince time.Time
+		wantUntil time.Time
+		// wantRelative since 相对当前时间的时长，不为 0 时不比较 wantSince
+		wantRelative time.Duration
+		wantErr      bool
+	}{
+		{query: "", wantTail: -1},
+		{query: "tail=all", wantTail: -1},
+		{query: "tail=0", wantTail: 0},
+		{query: "tail=100", wantTail: 100},
+		{query: "tail=-1", wantErr: true},
+		{query: "tail=abc", wantErr: true},
+		{query: "since=2026-10-01T12:00:00Z", wantTail: -1, wantSince: fixed},
+		{query: "since=2026-10-01T20:00:00%2B08:00", wantTail: -1, wantSince: fixed},
+		{query: "until=1790856000", wantTail: -1, wantUntil: fixed},
+		{query: "until=1790856000.5", wantTail: -1, wantUntil: fixed.Add(500 * time.Millisecond)},
+		{query: "since=10m", wantTail: -1, wantRelative: 10 * time.Minute},
+		{query: "since=-10m", wantErr: true},
+		{query: "since=yesterday", wantErr: true},
+		{query: "until=2026-10-01", wantErr: true},
+	}
+	gin.SetMode(gin.TestMode)
+	for _, tt := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/logs?"+tt.query, nil)
+		opts, err := parseLogOptions(c)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: parseLogOptions = %+v, want error", tt.query, opts)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.query, err)
+			continue
+		}
+		if opts.Tail != tt.wantTail || !opts.Until.Equal(tt.wantUntil) {
+			t.Errorf("%s: parseLogOptions = %+v", tt.query, opts)
+		}
+		if tt.wantRelative != 0 {
+			if d := time.Since(opts.Since) - tt.wantRelative; d < 0 || d > time.Minute {
+				t.Errorf("%s: since = %v, want %v ago", tt.query, opts.Since, tt.wantRelative)
+			}
+		} else if !opts.Since.Equal(tt.wantSince) {
+			t.Errorf("%s: since = %v, want %v", tt.query, opts.Since, tt.wantSince)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package controller
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/crazyfrankie/zdocker-web/middleware"
+	"github.com/crazyfrankie/zdocker-web/service"
+)
+
+const (
+	// defaultMetricsRange 未指定 range 时的查询范围
+	defaultMetricsRange = time.Hour
+	// maxMetricsRange 历史指标的最长保留时间
+	maxMetricsRange = 7 * 24 * time.Hour
+)
+
+// QueryMetrics 查询历史指标。
+// 查询参数：metric 指标名称；container 容器选择器，逗号分隔的名称或通配符模式，默认所有容器；
+// range 查询范围，默认 1h，最长 7 天；end 结束时间，默认当前时间；step 数据点间隔，默认自动选择
+func (ctl *Controller) QueryMetrics(c *gin.Context) {
+	metric := c.Query("metric")
+	if metric == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "缺少 metric 参数",
+			"metrics": service.MetricNames(),
+		})
+		return
+	}
+
+	queryRange := defaultMetricsRange
+	if s := c.Query("range"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 || d > maxMetricsRange {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "无效的查询范围: " + s + "，最长为 " + maxMetricsRange.String(),
+			})
+			return
+		}
+		queryRange = d
+	}
+
+	end := time.Now()
+	if s := c.Query("end"); s != "" {
+		t, err := parseLogTime(s)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		end = t
+	}
+
+	var step time.Duration
+	if s := c.Query("step"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d < time.Second {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "无效的数据点间隔: " + s + "，最小为 1s",
+			})
+			return
+		}
+		step = d
+	}
+
+	result, err := ctl.metrics.Query(service.MetricQuery{
+		Metric:   metric,
+		Selector: c.Query("container"),
+		Start:    end.Add(-queryRange),
+		End:      end,
+		Step:     step,
+	})
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{
+			"error": "查询指标失败: " + err.Error(),
+		})
+		return
+	}
+
+	// 只返回调用方有权查看的容器的序列，主机指标不受容器范围限制
+	access, _ := middleware.CurrentAccess(c)
+	series := result.Series[:0]
+	for _, s := range result.Series {
+		if s.Target == service.HostTarget || ctl.containerVisible(access, s.Target) {
+			series = append(series, s)
+		}
+	}
+	result.Series = series
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": result,
+	})
+}
+
+// containerVisible 判断容器是否在调用方的查看范围内，已删除的容器只按名称判断
+func (ctl *Controller) containerVisible(access service.Access, name string) bool {
+	var labels map[string]string
+	if ct, err := ctl.runtime.GetContainer(name); err == nil {
+		labels = ct.Labels
+	}
+	return access.CanContainer(service.PermContainersRead, name, labels)
+}
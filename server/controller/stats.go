@@ -0,0 +1,144 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/crazyfrankie/zdocker-web/service"
+	"github.com/crazyfrankie/zdocker/container"
+)
+
+const (
+	// defaultStatsInterval 流式统计的默认采样间隔
+	defaultStatsInterval = time.Second
+	// minStatsInterval 流式统计允许的最小采样间隔
+	minStatsInterval = 250 * time.Millisecond
+	// overviewSampleWindow 汇总所有容器时两次采样的间隔
+	overviewSampleWindow = 500 * time.Millisecond
+)
+
+// GetContainerStats 获取容器资源使用情况。
+// 默认返回单次采样，不含 CPU 使用率；stream=true 时以 SSE 按 interval（默认 1s）持续推送，
+// 从第二次采样起包含两次采样之间的 CPU 使用率，容器停止或删除后结束
+func (ctl *Controller) GetContainerStats(c *gin.Context) {
+	containerId := c.Param("id")
+
+	if c.Query("stream") != "true" {
+		stats, err := ctl.runtime.ContainerStats(containerId)
+		if err != nil {
+			c.JSON(errorStatus(err), gin.H{
+				"error": "获取容器资源使用情况失败: " + err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"data": stats,
+		})
+		return
+	}
+
+	interval := defaultStatsInterval
+	if s := c.Query("interval"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d < minStatsInterval {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "无效的采样间隔: " + s + "，最小为 " + minStatsInterval.String(),
+			})
+			return
+		}
+		interval = d
+	}
+
+	prev, err := ctl.runtime.ContainerStats(containerId)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{
+			"error": "获取容器资源使用情况失败: " + err.Error(),
+		})
+		return
+	}
+
+	startSSE(c)
+	if err := writeSSE(c.Writer, "", "stats", prev); err != nil {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-ticker.C:
+		}
+
+		stats, err := ctl.runtime.ContainerStats(containerId)
+		if err != nil {
+			reason := err.Error()
+			switch {
+			case errors.Is(err, service.ErrContainerNotFound):
+				reason = "removed"
+			case errors.Is(err, service.ErrContainerNotRunning):
+				reason = "stopped"
+			}
+			writeSSE(c.Writer, "", "end", gin.H{"reason": reason})
+			return
+		}
+		stats.CalculateCPUPercent(prev)
+		prev = stats
+		if err := writeSSE(c.Writer, "", "stats", stats); err != nil {
+			return
+		}
+	}
+}
+
+// ListContainerStats 获取所有运行中容器的资源使用情况，按 CPU 使用率从高到低排序
+func (ctl *Controller) ListContainerStats(c *gin.Context) {
+	containers, err := ctl.runtime.ListContainers()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "获取容器列表失败: " + err.Error(),
+		})
+		return
+	}
+
+	prev := make(map[string]service.ContainerStats)
+	for _, ct := range visibleContainers(c, containers) {
+		if ct.Status != container.RUNNING {
+			continue
+		}
+		if stats, err := ctl.runtime.ContainerStats(ct.Name); err == nil {
+			prev[ct.Name] = stats
+		}
+	}
+
+	time.Sleep(overviewSampleWindow)
+
+	result := make([]service.ContainerStats, 0, len(prev))
+	for name, p := range prev {
+		stats, err := ctl.runtime.ContainerStats(name)
+		if err != nil {
+			continue
+		}
+		stats.CalculateCPUPercent(p)
+		result = append(result, stats)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return cpuPercent(result[i]) > cpuPercent(result[j])
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": result,
+	})
+}
+
+// cpuPercent 返回 CPU 使用率，未计算时为 0
+func cpuPercent(stats service.ContainerStats) float64 {
+	if stats.CPU.Percent == nil {
+		return 0
+	}
+	return *stats.CPU.Percent
+}
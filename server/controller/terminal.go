@@ -0,0 +1,188 @@
+package controller
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// terminalPingInterval 终端连接的心跳间隔，超过两个间隔没有响应视为断开
+	terminalPingInterval = 30 * time.Second
+	// terminalWriteTimeout 单次写入 WebSocket 的超时时间
+	terminalWriteTimeout = 10 * time.Second
+	// defaultTerminalRows/defaultTerminalCols 客户端未指定时的终端大小
+	defaultTerminalRows = 24
+	defaultTerminalCols = 80
+)
+
+// defaultTerminalCommand 未指定命令时启动的 shell
+var defaultTerminalCommand = []string{"/bin/sh"}
+
+// terminalMessage 终端的文本控制消息。客户端发送 input / resize，服务端在进程结束时发送 exit；
+// 二进制消息为原始的终端输入输出
+type terminalMessage struct {
+	Type     string `json:"type"`
+	Data     string `json:"data,omitempty"`
+	Rows     uint16 `json:"rows,omitempty"`
+	Cols     uint16 `json:"cols,omitempty"`
+	ExitCode *int   `json:"exit_code,omitempty"`
+}
+
+// SetAllowedOrigins 设置允许建立 WebSocket 连接的来源，应与 CORS 配置一致
+func (ctl *Controller) SetAllowedOrigins(origins []string) {
+	ctl.allowedOrigins = origins
+}
+
+// checkOrigin 校验 WebSocket 请求来源，没有 Origin 的请求来自非浏览器客户端
+func (ctl *Controller) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if slices.Contains(ctl.allowedOrigins, origin) {
+		return true
+	}
+	return origin == "http://"+r.Host || origin == "https://"+r.Host
+}
+
+// parseTerminalSize 解析 rows/cols 查询参数
+func parseTerminalSize(c *gin.Context) (uint16, uint16) {
+	rows, cols := uint16(defaultTerminalRows), uint16(defaultTerminalCols)
+	if n, err := strconv.ParseUint(c.Query("rows"), 10, 16); err == nil && n > 0 {
+		rows = uint16(n)
+	}
+	if n, err := strconv.ParseUint(c.Query("cols"), 10, 16); err == nil && n > 0 {
+		cols = uint16(n)
+	}
+	return rows, cols
+}
+
+// ExecTerminal 通过 WebSocket 在容器中打开交互式终端。
+// 查询参数 command 可重复指定命令及参数，默认 /bin/sh；rows/cols 为初始终端大小。
+// 进程结束时发送 exit 消息并关闭连接，连接断开时结束进程
+func (ctl *Controller) ExecTerminal(c *gin.Context) {
+	containerId := c.Param("id")
+	command := c.QueryArray("command")
+	if len(command) == 0 {
+		command = defaultTerminalCommand
+	}
+
+	process, err := ctl.runtime.ExecInteractive(containerId, command)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{
+			"error": "执行命令失败: " + err.Error(),
+		})
+		return
+	}
+
+	upgrader := websocket.Upgrader{CheckOrigin: ctl.checkOrigin}
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// Upgrade 已向客户端返回错误
+		return
+	}
+	defer conn.Close()
+
+	rows, cols := parseTerminalSize(c)
+	ptmx, err := process.StartPTY(rows, cols)
+	if err != nil {
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseInternalServerErr, err.Error()))
+		return
+	}
+
+	// gorilla/websocket 不允许并发写
+	var writeMu sync.Mutex
+	write := func(messageType int, data []byte) error {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		conn.SetWriteDeadline(time.Now().Add(terminalWriteTimeout))
+		return conn.WriteMessage(messageType, data)
+	}
+
+	// 客户端输入和控制消息；连接断开时结束进程
+	go func() {
+		defer process.Kill()
+
+		conn.SetReadDeadline(time.Now().Add(2 * terminalPingInterval))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(2 * terminalPingInterval))
+		})
+		for {
+			messageType, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if messageType == websocket.BinaryMessage {
+				if _, err := ptmx.Write(data); err != nil {
+					return
+				}
+				continue
+			}
+
+			var msg terminalMessage
+			if err := sonic.Unmarshal(data, &msg); err != nil {
+				continue
+			}
+			switch msg.Type {
+			case "input":
+				if _, err := ptmx.Write([]byte(msg.Data)); err != nil {
+					return
+				}
+			case "resize":
+				if msg.Rows > 0 && msg.Cols > 0 {
+					process.Resize(msg.Rows, msg.Cols)
+				}
+			}
+		}
+	}()
+
+	// 心跳
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(terminalPingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := write(websocket.PingMessage, nil); err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	// 终端输出，进程结束后读取返回错误
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := ptmx.Read(buf)
+		if n > 0 {
+			if werr := write(websocket.BinaryMessage, buf[:n]); werr != nil {
+				process.Kill()
+				break
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	exitCode, err := process.Wait()
+	if err != nil {
+		write(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseInternalServerErr, err.Error()))
+		return
+	}
+	if msg, err := sonic.Marshal(terminalMessage{Type: "exit", ExitCode: &exitCode}); err == nil {
+		write(websocket.TextMessage, msg)
+	}
+	write(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "exit "+strconv.Itoa(exitCode)))
+}
@@ -0,0 +1,59 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCheckOrigin(t *testing.T) {
+	ctl := &Controller{}
+	ctl.SetAllowedOrigins([]string{"http://localhost:5173"})
+
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{origin: "", want: true},
+		{origin: "http://localhost:5173", want: true},
+		{origin: "http://zdocker.example:8080", want: true},
+		{origin: "https://zdocker.example:8080", want: true},
+		{origin: "http://zdocker.example", want: false},
+		{origin: "http://localhost:5174", want: false},
+		{origin: "https://evil.example", want: false},
+		{origin: "null", want: false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "http://zdocker.example:8080/api/v1/containers/web/terminal", nil)
+		if tt.origin != "" {
+			req.Header.Set("Origin", tt.origin)
+		}
+		if got := ctl.checkOrigin(req); got != tt.want {
+			t.Errorf("checkOrigin(%q) = %v, want %v", tt.origin, got, tt.want)
+		}
+	}
+}
+
+func TestParseTerminalSize(t *testing.T) {
+	tests := []struct {
+		query      string
+		rows, cols uint16
+	}{
+		{query: "", rows: defaultTerminalRows, cols: defaultTerminalCols},
+		{query: "rows=40&cols=120", rows: 40, cols: 120},
+		{query: "rows=40", rows: 40, cols: defaultTerminalCols},
+		{query: "rows=0&cols=0", rows: defaultTerminalRows, cols: defaultTerminalCols},
+		{query: "rows=-1&cols=abc", rows: defaultTerminalRows, cols: defaultTerminalCols},
+		{query: "rows=65536&cols=65535", rows: defaultTerminalRows, cols: 65535},
+	}
+	gin.SetMode(gin.TestMode)
+	for _, tt := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/terminal?"+tt.query, nil)
+		if rows, cols := parseTerminalSize(c); rows != tt.rows || cols != tt.cols {
+			t.Errorf("%s: parseTerminalSize = %d, %d, want %d, %d", tt.query, rows, cols, tt.rows, tt.cols)
+		}
+	}
+}
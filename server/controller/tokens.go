@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/crazyfrankie/zdocker-web/middleware"
+	"github.com/crazyfrankie/zdocker-web/service"
+)
+
+// SetAPITokens 设置 API 令牌存储
+func (ctl *Controller) SetAPITokens(tokens *service.APITokenStore) {
+	ctl.tokens = tokens
+}
+
+// ListAPITokens 获取当前用户的 API 令牌，不包含令牌本身
+func (ctl *Controller) ListAPITokens(c *gin.Context) {
+	p, _ := middleware.CurrentPrincipal(c)
+	c.JSON(http.StatusOK, gin.H{
+		"data": ctl.tokens.List(p.Username),
+	})
+}
+
+// CreateAPIToken 为当前用户创建 API 令牌，明文令牌只在响应中返回这一次
+func (ctl *Controller) CreateAPIToken(c *gin.Context) {
+	var req service.CreateAPITokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	p, _ := middleware.CurrentPrincipal(c)
+	token, info, err := ctl.tokens.Create(p.Username, req)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{
+			"error": "创建令牌失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"token": token,
+			"info":  info,
+		},
+		"message": "令牌创建成功，请立即保存，之后无法再次查看",
+	})
+}
+
+// RevokeAPIToken 撤销当前用户的 API 令牌
+func (ctl *Controller) RevokeAPIToken(c *gin.Context) {
+	p, _ := middleware.CurrentPrincipal(c)
+	if err := ctl.tokens.Revoke(p.Username, c.Param("id")); err != nil {
+		c.JSON(errorStatus(err), gin.H{
+			"error": "撤销令牌失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "令牌已撤销",
+	})
+}
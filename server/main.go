@@ -1,17 +1,44 @@
 package main
 
 import (
+	"bufio"
+	"flag"
+	"fmt"
 	"log"
 	"os"
+	"strings"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	"github.com/crazyfrankie/zdocker-web/controller"
 	"github.com/crazyfrankie/zdocker-web/middleware"
+	"github.com/crazyfrankie/zdocker-web/service"
 )
 
 func main() {
+	// 原生运行时通过 /proc/self/exe 重新执行自身来创建容器和进入容器
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "init":
+			if err := service.RunInitProcess(); err != nil {
+				log.Fatal("容器初始化失败:", err)
+			}
+			return
+		case "exec":
+			// 命令已由 nsenter 在进入容器命名空间后执行，正常情况下不会到达这里
+			return
+		case "passwd":
+			// 设置本地用户的密码，用户不存在时创建，用于找回管理员密码
+			if err := setPassword(os.Args[2:]); err != nil {
+				log.Fatal("设置密码失败:", err)
+			}
+			return
+		}
+	}
+
 	// 设置日志格式
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 
@@ -21,12 +48,79 @@ func main() {
 		port = "8080"
 	}
 
-	// 创建gin路由
-	r := gin.Default()
+	// 创建容器运行时：cli(默认) / native / fake
+	runtime, err := service.NewRuntime(os.Getenv("ZDOCKER_RUNTIME"))
+	if err != nil {
+		log.Fatal("创建容器运行时失败:", err)
+	}
+
+	// 构建内存容器索引，通过 inotify 跟踪容器目录变化；fake 运行时不读取容器目录
+	if _, ok := runtime.(*service.FakeRuntime); !ok {
+		service.StartContainerIndex()
+	}
+
+	// 容器和网络生命周期事件
+	events := service.NewEventBus(0)
+
+	// 后台校正容器状态，将进程已退出的容器标记为 exit
+	reconciler := service.NewReconciler(runtime, 0, events)
+	reconciler.Start()
+
+	// 按重启策略自动重启退出的容器
+	supervisor := service.NewSupervisor(reconciler, events)
+	supervisor.Start()
+
+	// 记录日志文件增长，为日志提供时间戳
+	logs := service.NewLogTracker(runtime)
+	logs.Start()
+
+	// 定期采集容器和主机指标，保存多精度的历史时间序列
+	metrics := service.NewMetricStore()
+	service.NewMetricsCollector(runtime, metrics).Start()
+
+	// 本地用户和登录会话，首次启动时创建管理员
+	users, err := service.NewUserStore(service.UsersFile())
+	if err != nil {
+		log.Fatal("加载用户失败:", err)
+	}
+	if password, err := users.Bootstrap(); err != nil {
+		log.Fatal("创建管理员失败:", err)
+	} else if password != "" {
+		log.Printf("已创建管理员 %s，初始密码: %s，请登录后修改", service.DefaultAdminUser, password)
+	}
+	// 初始密码只在创建管理员时使用，之后不再保留在进程环境中
+	os.Unsetenv("ZDOCKER_ADMIN_PASSWORD")
+	sessions, err := service.NewSessionManager(users, 0, 0)
+	if err != nil {
+		log.Fatal("创建会话管理器失败:", err)
+	}
+
+	// 内置角色和配置文件中的自定义角色
+	roles, err := service.NewRoleStore(service.RolesFile())
+	if err != nil {
+		log.Fatal("加载角色配置失败:", err)
+	}
+	authz := service.NewAuthorizer(users, roles)
+
+	// 用于 CI 等自动化调用的长期 API 令牌
+	tokens, err := service.NewAPITokenStore(service.TokensFile(), users)
+	if err != nil {
+		log.Fatal("加载 API 令牌失败:", err)
+	}
+
+	// 修改操作的审计日志
+	audit, err := service.NewAuditLog(service.AuditFile(), 0, 0)
+	if err != nil {
+		log.Fatal("打开审计日志失败:", err)
+	}
+
+	// 创建gin路由，不使用 gin 自带的日志中间件，它会原样记录查询参数中的访问令牌
+	r := gin.New()
 
 	// 配置CORS
 	config := cors.DefaultConfig()
-	config.AllowOrigins = []string{"http://localhost:5173", "http://localhost:3000"}
+	allowOrigins := []string{"http://localhost:5173", "http://localhost:3000"}
+	config.AllowOrigins = allowOrigins
 	config.AllowMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
 	config.AllowHeaders = []string{"Origin", "Content-Type", "Accept", "Authorization"}
 	r.Use(cors.New(config))
@@ -35,8 +129,20 @@ func main() {
 	r.Use(middleware.Logger())
 	r.Use(gin.Recovery())
 
+	// 经过 supervisor 和事件总线的运行时，处理器和 Prometheus 都通过它读取容器，才能得到重启次数
+	rt := service.NewEventRuntime(supervisor, events)
+
+	// Prometheus 抓取时读取容器状态和资源使用情况
+	prometheus.MustRegister(service.NewPrometheusCollector(rt))
+
 	// 注册路由
-	setupRoutes(r)
+	ctl := controller.NewController(rt, reconciler, events, logs, metrics)
+	ctl.SetAllowedOrigins(allowOrigins)
+	ctl.SetSessions(sessions)
+	ctl.SetAuthorizer(authz)
+	ctl.SetAPITokens(tokens)
+	ctl.SetAuditLog(audit)
+	setupRoutes(r, ctl, middleware.Auth(sessions, tokens), middleware.NewGuard(authz, rt.GetContainer), middleware.NewAuditor(audit))
 
 	log.Printf("服务器启动在端口 %s", port)
 	if err := r.Run(":" + port); err != nil {
@@ -44,45 +150,141 @@ func main() {
 	}
 }
 
-func setupRoutes(r *gin.Engine) {
+func setupRoutes(r *gin.Engine, ctl *controller.Controller, auth gin.HandlerFunc, guard *middleware.Guard, auditor *middleware.Auditor) {
 	// 健康检查
 	r.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{"status": "ok"})
 	})
 
+	// 权限检查：can 只检查权限，容器列表等接口由处理器按角色范围过滤；
+	// canContainer 还要求路由参数指定的容器在角色范围内
+	can := guard.Require
+	canContainer := guard.Container
+
+	// 审计：记录修改操作的调用方、对象、请求和结果，放在权限检查之前，被拒绝的请求同样记录
+	audit := auditor.Record
+
+	// Prometheus 指标，抓取时使用有 system:read 权限的 API 令牌作为 bearer token
+	r.GET("/metrics", auth, can(service.PermSystemRead), gin.WrapH(promhttp.Handler()))
+
 	// API路由组
 	api := r.Group("/api/v1")
 	{
+		// 登录和刷新令牌不需要认证
+		api.POST("/auth/login", ctl.Login)
+		api.POST("/auth/refresh", ctl.RefreshToken)
+
+		// 其余接口都需要认证，只对之后注册的路由生效
+		api.Use(auth)
+		api.POST("/auth/logout", ctl.Logout)
+		api.GET("/auth/me", ctl.GetCurrentUser)
+		api.PUT("/auth/password", audit("auth.password", ""), middleware.SessionOnly(), ctl.ChangePassword)
+		api.GET("/roles", can(service.PermSystemRead), ctl.ListRoles)
+
+		// 当前用户的 API 令牌，只能在登录后管理
+		tokens := api.Group("/tokens", middleware.SessionOnly())
+		{
+			tokens.GET("", ctl.ListAPITokens)
+			tokens.POST("", audit("token.create", ""), ctl.CreateAPIToken)
+			tokens.DELETE("/:id", audit("token.revoke", "id"), ctl.RevokeAPIToken)
+		}
+
 		// 容器相关路由
 		containers := api.Group("/containers")
 		{
-			containers.GET("", controller.ListContainers)
-			containers.POST("", controller.CreateContainer)
-			containers.GET("/logs/:name", controller.GetContainerLogs)
-			containers.GET("/:id", controller.GetContainer)
-			containers.POST("/:id/start", controller.StartContainer)
-			containers.POST("/stop/:name", controller.StopContainer)
-			containers.DELETE("/:name", controller.RemoveContainer)
-			containers.POST("/:id/exec", controller.ExecContainer)
+			containers.GET("", can(service.PermContainersRead), ctl.ListContainers)
+			containers.POST("", audit("container.create", ""), can(service.PermContainersWrite), ctl.CreateContainer)
+			containers.GET("/stats", can(service.PermContainersRead), ctl.ListContainerStats)
+			containers.GET("/logs/:name", canContainer(service.PermContainersRead, "name"), ctl.GetContainerLogs)
+			containers.GET("/:id", canContainer(service.PermContainersRead, "id"), ctl.GetContainer)
+			containers.GET("/:id/inspect", canContainer(service.PermContainersRead, "id"), ctl.InspectContainer)
+			containers.POST("/:id/start", audit("container.start", "id"), canContainer(service.PermContainersWrite, "id"), ctl.StartContainer)
+			containers.POST("/stop/:name", audit("container.stop", "name"), canContainer(service.PermContainersWrite, "name"), ctl.StopContainer)
+			containers.DELETE("/:name", audit("container.remove", "name"), canContainer(service.PermContainersDelete, "name"), ctl.RemoveContainer)
+			containers.POST("/:id/exec", audit("container.exec", "id"), canContainer(service.PermContainersExec, "id"), ctl.ExecContainer)
+			containers.GET("/:id/exec/ws", audit("container.exec.terminal", "id"), canContainer(service.PermContainersExec, "id"), ctl.ExecTerminal)
+			containers.GET("/:id/stats", canContainer(service.PermContainersRead, "id"), ctl.GetContainerStats)
+			containers.GET("/:id/changes", canContainer(service.PermContainersRead, "id"), ctl.GetContainerChanges)
+			containers.POST("/:id/commit", audit("container.commit", "id"), canContainer(service.PermContainersRead, "id"), can(service.PermImagesWrite), ctl.CommitContainer)
+			containers.GET("/:id/files", canContainer(service.PermContainersRead, "id"), ctl.ListContainerFiles)
+			containers.GET("/:id/files/stat", canContainer(service.PermContainersRead, "id"), ctl.StatContainerFile)
+			containers.GET("/:id/files/download", canContainer(service.PermContainersRead, "id"), ctl.DownloadContainerFile)
+			containers.PUT("/:id/files", audit("container.file.upload", "id"), canContainer(service.PermContainersExec, "id"), ctl.UploadContainerFile)
 		}
 
 		// 镜像相关路由
 		images := api.Group("/images")
 		{
-			images.GET("", controller.ListImages)
-			images.DELETE("/:id", controller.RemoveImage)
+			images.GET("", can(service.PermImagesRead), ctl.ListImages)
+			images.POST("", audit("image.upload", ""), can(service.PermImagesWrite), ctl.UploadImage)
+			images.GET("/:id", can(service.PermImagesRead), ctl.GetImage)
+			images.GET("/:id/tar", can(service.PermImagesRead), ctl.DownloadImage)
+			images.DELETE("/:id", audit("image.remove", "id"), can(service.PermImagesWrite), ctl.RemoveImage)
 		}
 
 		// 网络相关路由
 		networks := api.Group("/networks")
 		{
-			networks.GET("", controller.ListNetworks)
-			networks.POST("", controller.CreateNetwork)
-			networks.DELETE("/:id", controller.RemoveNetwork)
+			networks.GET("", can(service.PermNetworksRead), ctl.ListNetworks)
+			networks.POST("", audit("network.create", ""), can(service.PermNetworksWrite), ctl.CreateNetwork)
+			networks.DELETE("/:id", audit("network.remove", "id"), can(service.PermNetworksWrite), ctl.RemoveNetwork)
 		}
 
+		// 生命周期事件流，按角色范围过滤容器事件
+		api.GET("/events", can(service.PermContainersRead), ctl.StreamEvents)
+
+		// 历史指标，按角色范围过滤容器序列
+		api.GET("/metrics/query", can(service.PermSystemRead), ctl.QueryMetrics)
+
 		// 系统信息
-		api.GET("/system/info", controller.GetSystemInfo)
-		api.GET("/system/version", controller.GetVersion)
+		api.GET("/system/info", can(service.PermSystemRead), ctl.GetSystemInfo)
+		api.GET("/system/version", can(service.PermSystemRead), ctl.GetVersion)
+		api.POST("/system/reconcile", audit("system.reconcile", ""), can(service.PermSystemWrite), ctl.Reconcile)
+
+		// 审计日志
+		api.GET("/audit", can(service.PermAuditRead), ctl.ListAuditEntries)
+	}
+}
+
+// setPassword 处理 passwd 子命令：zdocker-web passwd [-roles viewer,operator] <用户名>，从标准输入读取新密码。
+// 未指定 -roles 时保留已有用户的角色，新用户为 viewer
+func setPassword(args []string) error {
+	flags := flag.NewFlagSet("passwd", flag.ContinueOnError)
+	rolesFlag := flags.String("roles", "", "逗号分隔的角色")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	args = flags.Args()
+	if len(args) != 1 {
+		return fmt.Errorf("用法: %s passwd [-roles viewer,operator] <用户名>", os.Args[0])
+	}
+	var roles []string
+	if *rolesFlag != "" {
+		roleStore, err := service.NewRoleStore(service.RolesFile())
+		if err != nil {
+			return err
+		}
+		for _, name := range strings.Split(*rolesFlag, ",") {
+			name = strings.TrimSpace(name)
+			if _, ok := roleStore.Get(name); !ok {
+				return fmt.Errorf("角色 %s 不存在", name)
+			}
+			roles = append(roles, name)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "请输入用户 %s 的新密码: ", args[0])
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && password == "" {
+		return fmt.Errorf("读取密码失败: %v", err)
+	}
+
+	users, err := service.NewUserStore(service.UsersFile())
+	if err != nil {
+		return err
+	}
+	if err := users.SetPassword(args[0], strings.TrimRight(password, "\r\n"), roles); err != nil {
+		return err
 	}
+	fmt.Fprintf(os.Stderr, "已更新用户 %s 的密码\n", args[0])
+	return nil
 }
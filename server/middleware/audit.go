@@ -0,0 +1,154 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/gin-gonic/gin"
+
+	"github.com/crazyfrankie/zdocker-web/service"
+)
+
+const (
+	// auditTargetKey 处理器通过 SetAuditTarget 设置的操作对象
+	auditTargetKey = "audit_target"
+	// maxAuditBodySize 记录的 JSON 请求体最大长度，更长的请求体只记录大小
+	maxAuditBodySize = 64 << 10
+	// maxAuditErrorSize 为提取错误信息而保留的响应体最大长度
+	maxAuditErrorSize = 4 << 10
+)
+
+// Auditor 审计中间件，将修改操作写入审计日志。需要放在 Auth 之后、权限检查之前，
+// 被拒绝的请求同样会被记录
+type Auditor struct {
+	log *service.AuditLog
+}
+
+// NewAuditor 创建审计中间件
+func NewAuditor(log *service.AuditLog) *Auditor {
+	return &Auditor{log: log}
+}
+
+// Record 记录操作 action，操作对象取自路由参数 param，为空或参数不存在时取请求体或查询参数的 name 字段，
+// 处理器可以用 SetAuditTarget 覆盖（如创建容器时自动生成的名称）
+func (a *Auditor) Record(action string, param string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		body, request := readAuditBody(c)
+		writer := &auditWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+
+		c.Next()
+
+		entry := service.AuditEntry{
+			Time:       start,
+			ClientIP:   c.ClientIP(),
+			Method:     c.Request.Method,
+			Route:      c.FullPath(),
+			Path:       c.Request.URL.Path,
+			Action:     action,
+			Target:     auditTarget(c, param, body),
+			Request:    request,
+			Status:     writer.Status(),
+			Result:     service.AuditResultSuccess,
+			DurationMs: time.Since(start).Milliseconds(),
+		}
+		if p, ok := CurrentPrincipal(c); ok {
+			entry.User, entry.TokenID = p.Username, p.TokenID
+		}
+		if entry.Status >= http.StatusBadRequest {
+			entry.Result = service.AuditResultFailure
+			entry.Error = writer.errorMessage()
+		}
+		if err := a.log.Write(entry); err != nil {
+			log.Printf("记录审计日志失败: %v", err)
+		}
+	}
+}
+
+// SetAuditTarget 设置审计记录的操作对象
+func SetAuditTarget(c *gin.Context, target string) {
+	c.Set(auditTargetKey, target)
+}
+
+// auditTarget 返回操作对象
+func auditTarget(c *gin.Context, param string, body []byte) string {
+	if target := c.GetString(auditTargetKey); target != "" {
+		return target
+	}
+	if param != "" {
+		if target := c.Param(param); target != "" {
+			return target
+		}
+	}
+	if len(body) > 0 {
+		var req struct {
+			Name string `json:"name"`
+		}
+		if sonic.Unmarshal(body, &req) == nil && req.Name != "" {
+			return req.Name
+		}
+	}
+	return c.Query("name")
+}
+
+// readAuditBody 读取 JSON 请求体并还原，返回原始内容和隐藏敏感信息后的内容。
+// 文件上传等其他请求体只记录类型和大小，不读取内容
+func readAuditBody(c *gin.Context) ([]byte, any) {
+	r := c.Request
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") || r.ContentLength > maxAuditBodySize {
+		return nil, gin.H{
+			"content_type": r.Header.Get("Content-Type"),
+			"size":         r.ContentLength,
+		}
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxAuditBodySize+1))
+	r.Body = readCloser{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+	if err != nil || len(body) > maxAuditBodySize {
+		return nil, gin.H{
+			"content_type": r.Header.Get("Content-Type"),
+			"size":         r.ContentLength,
+		}
+	}
+	return body, service.MaskSecrets(body)
+}
+
+// readCloser 读取已缓存的请求体后继续读取剩余部分，关闭时关闭原请求体
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// auditWriter 保留错误响应的开头部分，用于在审计记录中填写错误信息
+type auditWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+// Write 写入响应，状态码表示失败时同时保留响应内容
+func (w *auditWriter) Write(data []byte) (int, error) {
+	if w.Status() >= http.StatusBadRequest && w.body.Len() < maxAuditErrorSize {
+		w.body.Write(data[:min(len(data), maxAuditErrorSize-w.body.Len())])
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// errorMessage 返回错误响应中的 error 字段
+func (w *auditWriter) errorMessage() string {
+	var resp struct {
+		Error string `json:"error"`
+	}
+	if sonic.Unmarshal(w.body.Bytes(), &resp) != nil {
+		return http.StatusText(w.Status())
+	}
+	return resp.Error
+}
@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/crazyfrankie/zdocker-web/service"
+)
+
+const (
+	// PrincipalKey gin 上下文中保存认证调用方的键
+	PrincipalKey = "principal"
+	// tokenQueryParam 浏览器的 EventSource、WebSocket 和下载链接无法设置请求头，通过该查询参数传递访问令牌
+	tokenQueryParam = "access_token"
+)
+
+// Auth 认证中间件，从 Authorization: Bearer 请求头或 access_token 查询参数读取访问令牌，
+// zdw_ 开头的按 API 令牌校验，其余按会话令牌校验，校验通过后将调用方保存到上下文中
+func Auth(sessions *service.SessionManager, tokens *service.APITokenStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := bearerToken(c.Request)
+		if token == "" {
+			c.Header("WWW-Authenticate", `Bearer realm="zdocker-web"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "认证失败: 缺少访问令牌",
+			})
+			return
+		}
+
+		var principal service.Principal
+		var err error
+		if service.IsAPIToken(token) {
+			principal, err = tokens.Verify(token)
+		} else {
+			principal, err = sessions.Verify(token)
+		}
+		if err != nil {
+			c.Header("WWW-Authenticate", `Bearer realm="zdocker-web", error="invalid_token"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.Set(PrincipalKey, principal)
+		c.Next()
+	}
+}
+
+// SessionOnly 只允许通过登录会话认证的调用方，API 令牌不能用于修改密码和管理令牌，
+// 避免泄露的令牌被用来创建不会过期的新令牌
+func SessionOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if p, ok := CurrentPrincipal(c); ok && p.TokenID != "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "权限不足: API 令牌不能用于该操作，请登录后操作",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// CurrentPrincipal 返回认证中间件保存的调用方
+func CurrentPrincipal(c *gin.Context) (service.Principal, bool) {
+	v, ok := c.Get(PrincipalKey)
+	if !ok {
+		return service.Principal{}, false
+	}
+	p, ok := v.(service.Principal)
+	return p, ok
+}
+
+// bearerToken 读取请求中的访问令牌
+func bearerToken(r *http.Request) string {
+	if scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " "); ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+	return r.URL.Query().Get(tokenQueryParam)
+}
+
+// redactQuery 隐藏查询参数中的访问令牌，避免写入日志
+func redactQuery(raw string) string {
+	if !strings.Contains(raw, tokenQueryParam+"=") {
+		return raw
+	}
+	params := strings.Split(raw, "&")
+	for i, param := range params {
+		if strings.HasPrefix(param, tokenQueryParam+"=") {
+			params[i] = tokenQueryParam + "=***"
+		}
+	}
+	return strings.Join(params, "&")
+}
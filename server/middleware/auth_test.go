@@ -0,0 +1,138 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/crazyfrankie/zdocker-web/service"
+)
+
+// newAuthRouter 返回使用认证中间件的路由，/me 返回调用方的用户名，/tokens 只允许登录会话；
+// 同时返回 alice 登录后的令牌和 alice 的 API 令牌
+func newAuthRouter(t *testing.T) (*gin.Engine, service.TokenPair, string) {
+	dir := t.TempDir()
+	users, err := service.NewUserStore(filepath.Join(dir, "users.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := users.SetPassword("alice", "password", []string{service.RoleAdmin}); err != nil {
+		t.Fatal(err)
+	}
+	sessions, err := service.NewSessionManager(users, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := service.NewAPITokenStore(filepath.Join(dir, "tokens.json"), users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pair, _, err := sessions.Login("alice", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	apiToken, _, err := tokens.Create("alice", service.CreateAPITokenRequest{Name: "ci", Scopes: []service.Permission{"*"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Auth(sessions, tokens))
+	r.GET("/me", func(c *gin.Context) {
+		p, _ := CurrentPrincipal(c)
+		c.String(http.StatusOK, p.Username)
+	})
+	r.GET("/tokens", SessionOnly(), func(c *gin.Context) {
+		c.String(http.StatusOK, "tokens")
+	})
+	return r, pair, apiToken
+}
+
+func TestAuth(t *testing.T) {
+	r, pair, apiToken := newAuthRouter(t)
+
+	tests := []struct {
+		name          string
+		header        string
+		query         string
+		status        int
+		wantChallenge string
+	}{
+		{name: "bearer", header: "Bearer " + pair.AccessToken, status: http.StatusOK},
+		{name: "lowercase scheme", header: "bearer " + pair.AccessToken, status: http.StatusOK},
+		{name: "query parameter", query: "access_token=" + pair.AccessToken, status: http.StatusOK},
+		{name: "header takes precedence", header: "Bearer " + pair.AccessToken, query: "access_token=invalid", status: http.StatusOK},
+		{name: "missing", status: http.StatusUnauthorized, wantChallenge: `Bearer realm="zdocker-web"`},
+		{name: "basic scheme", header: "Basic YWxpY2U6cGFzc3dvcmQ=", status: http.StatusUnauthorized, wantChallenge: `Bearer realm="zdocker-web"`},
+		{name: "invalid token", header: "Bearer invalid", status: http.StatusUnauthorized, wantChallenge: `Bearer realm="zdocker-web", error="invalid_token"`},
+		{name: "refresh token", header: "Bearer " + pair.RefreshToken, status: http.StatusUnauthorized, wantChallenge: `Bearer realm="zdocker-web", error="invalid_token"`},
+		{name: "api token", header: "Bearer " + apiToken, status: http.StatusOK},
+		{name: "api token in query", query: "access_token=" + apiToken, status: http.StatusOK},
+		{name: "unknown api token", header: "Bearer " + service.APITokenPrefix + "0123", status: http.StatusUnauthorized, wantChallenge: `Bearer realm="zdocker-web", error="invalid_token"`},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/me?"+tt.query, nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d, body %s", tt.name, w.Code, tt.status, w.Body.String())
+			continue
+		}
+		if tt.status == http.StatusOK && w.Body.String() != "alice" {
+			t.Errorf("%s: principal = %q, want alice", tt.name, w.Body.String())
+		}
+		if got := w.Header().Get("WWW-Authenticate"); got != tt.wantChallenge {
+			t.Errorf("%s: WWW-Authenticate = %q, want %q", tt.name, got, tt.wantChallenge)
+		}
+	}
+}
+
+func TestSessionOnly(t *testing.T) {
+	r, pair, apiToken := newAuthRouter(t)
+
+	tests := []struct {
+		name   string
+		token  string
+		status int
+	}{
+		{name: "session", token: pair.AccessToken, status: http.StatusOK},
+		{name: "api token", token: apiToken, status: http.StatusForbidden},
+		{name: "unauthenticated", token: "", status: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/tokens", nil)
+		if tt.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d, body %s", tt.name, w.Code, tt.status, w.Body.String())
+		}
+	}
+}
+
+func TestRedactQuery(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: "", want: ""},
+		{in: "tail=100", want: "tail=100"},
+		{in: "access_token=abc", want: "access_token=***"},
+		{in: "follow=1&access_token=abc&tail=10", want: "follow=1&access_token=***&tail=10"},
+		{in: "my_access_token=abc", want: "my_access_token=abc"},
+	}
+	for _, tt := range tests {
+		if got := redactQuery(tt.in); got != tt.want {
+			t.Errorf("redactQuery(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
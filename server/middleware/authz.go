@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/crazyfrankie/zdocker-web/service"
+)
+
+// AccessKey gin 上下文中保存调用方访问权限的键
+const AccessKey = "access"
+
+// ContainerLookup 根据ID或名称查找容器，用于判断容器是否在角色的范围内
+type ContainerLookup func(containerId string) (service.Container, error)
+
+// Guard 按路由检查权限的中间件，需要放在 Auth 之后
+type Guard struct {
+	authz  *service.Authorizer
+	lookup ContainerLookup
+}
+
+// NewGuard 创建权限检查中间件
+func NewGuard(authz *service.Authorizer, lookup ContainerLookup) *Guard {
+	return &Guard{authz: authz, lookup: lookup}
+}
+
+// Require 要求调用方有任一角色包含权限。对容器列表等接口，处理器还需按 CurrentAccess 过滤结果
+func (g *Guard) Require(perm service.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		access, ok := g.access(c)
+		if !ok {
+			return
+		}
+		if !access.Can(perm) {
+			forbid(c, perm)
+			return
+		}
+		c.Next()
+	}
+}
+
+// Container 要求调用方对路由参数 param 指定的容器有权限。
+// 容器不存在时交给处理器返回 404，但只对有该权限的调用方暴露容器是否存在
+func (g *Guard) Container(perm service.Permission, param string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		access, ok := g.access(c)
+		if !ok {
+			return
+		}
+		if !access.Can(perm) {
+			forbid(c, perm)
+			return
+		}
+		ct, err := g.lookup(c.Param(param))
+		if err != nil {
+			c.Next()
+			return
+		}
+		if !access.CanContainer(perm, ct.Name, ct.Labels) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error":      "权限不足: 没有操作容器 " + ct.Name + " 的 " + string(perm) + " 权限",
+				"permission": perm,
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// access 计算并缓存调用方的访问权限，失败时中止请求
+func (g *Guard) access(c *gin.Context) (service.Access, bool) {
+	if access, ok := CurrentAccess(c); ok {
+		return access, true
+	}
+	principal, ok := CurrentPrincipal(c)
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error": "认证失败: 缺少访问令牌",
+		})
+		return service.Access{}, false
+	}
+	access, err := g.authz.Access(principal)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error": err.Error(),
+		})
+		return service.Access{}, false
+	}
+	c.Set(AccessKey, access)
+	return access, true
+}
+
+// CurrentAccess 返回权限中间件计算的访问权限
+func CurrentAccess(c *gin.Context) (service.Access, bool) {
+	v, ok := c.Get(AccessKey)
+	if !ok {
+		return service.Access{}, false
+	}
+	access, ok := v.(service.Access)
+	return access, ok
+}
+
+// forbid 以 403 拒绝请求
+func forbid(c *gin.Context, perm service.Permission) {
+	c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+		"error":      "权限不足: 需要 " + string(perm) + " 权限",
+		"permission": perm,
+	})
+}
@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	// httpRequests 按路由、方法和状态码统计的请求数
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "zdocker",
+		Name:      "http_requests_total",
+		Help:      "HTTP 请求数，按路由、方法和状态码区分",
+	}, []string{"method", "route", "status"})
+
+	// httpDuration 按路由和方法统计的请求耗时，流式接口的耗时为连接持续时间
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "zdocker",
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP 请求耗时，按路由和方法区分",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+)
+
+// observeRequest 记录一次请求。route 为路由模板，未匹配任何路由时为 unmatched，避免标签基数随路径增长
+func observeRequest(method, route string, status int, latency time.Duration) {
+	if route == "" {
+		route = "unmatched"
+	}
+	httpRequests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+	httpDuration.WithLabelValues(method, route).Observe(latency.Seconds())
+}
@@ -0,0 +1,289 @@
+package service
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bytedance/sonic"
+)
+
+const (
+	// APITokenPrefix API 令牌的前缀，用于和会话令牌区分，也便于在代码仓库中扫描泄露的令牌
+	APITokenPrefix = "zdw_"
+	// tokensFileName API 令牌文件名
+	tokensFileName = "tokens.json"
+	// apiTokenDisplayLength 列表中展示的令牌开头长度，便于用户辨认令牌
+	apiTokenDisplayLength = len(APITokenPrefix) + 8
+	// maxTokenNameLength 令牌名称最大长度
+	maxTokenNameLength = 64
+	// lastUsedFlushInterval 最近使用时间写回文件的最小间隔，避免每个请求都写文件
+	lastUsedFlushInterval = time.Minute
+)
+
+// TokensFile 返回 API 令牌文件路径
+func TokensFile() string {
+	return filepath.Join(DataDir(), tokensFileName)
+}
+
+// APIToken 用于自动化调用的长期令牌，只保存令牌的 SHA-256 哈希
+type APIToken struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Username string `json:"username"`
+	Hash     string `json:"hash"`
+	// Prefix 令牌的开头部分，只用于展示
+	Prefix string `json:"prefix"`
+	// Scopes 令牌的权限范围，实际权限为用户角色和范围的交集
+	Scopes     []Permission `json:"scopes"`
+	CreatedAt  time.Time    `json:"created_at"`
+	ExpiresAt  *time.Time   `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time   `json:"last_used_at,omitempty"`
+}
+
+// APITokenInfo 接口返回的令牌信息，不包含哈希
+type APITokenInfo struct {
+	ID         string       `json:"id"`
+	Name       string       `json:"name"`
+	Username   string       `json:"username"`
+	Prefix     string       `json:"prefix"`
+	Scopes     []Permission `json:"scopes"`
+	CreatedAt  time.Time    `json:"created_at"`
+	ExpiresAt  *time.Time   `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time   `json:"last_used_at,omitempty"`
+	Expired    bool         `json:"expired"`
+}
+
+// Info 返回可以对外展示的令牌信息
+func (t APIToken) Info() APITokenInfo {
+	return APITokenInfo{
+		ID:         t.ID,
+		Name:       t.Name,
+		Username:   t.Username,
+		Prefix:     t.Prefix,
+		Scopes:     t.Scopes,
+		CreatedAt:  t.CreatedAt,
+		ExpiresAt:  t.ExpiresAt,
+		LastUsedAt: t.LastUsedAt,
+		Expired:    t.expired(time.Now()),
+	}
+}
+
+// expired 判断令牌是否已过期
+func (t APIToken) expired(now time.Time) bool {
+	return t.ExpiresAt != nil && !now.Before(*t.ExpiresAt)
+}
+
+// CreateAPITokenRequest 创建 API 令牌请求
+type CreateAPITokenRequest struct {
+	Name   string       `json:"name"`
+	Scopes []Permission `json:"scopes"`
+	// ExpiresAt 过期时间，为空时永不过期
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// tokensFile API 令牌文件的结构
+type tokensFile struct {
+	Tokens []APIToken `json:"tokens"`
+}
+
+// APITokenStore 保存在 JSON 文件中的 API 令牌。令牌只能通过接口创建和撤销，
+// 最近使用时间先记录在内存中，最多每分钟写回一次文件
+type APITokenStore struct {
+	path  string
+	users *UserStore
+
+	mu     sync.Mutex
+	tokens map[string]*APIToken
+	// flushed 每个令牌的最近使用时间上一次写回文件的时间
+	flushed map[string]time.Time
+}
+
+// NewAPITokenStore 打开 API 令牌文件，文件不存在时从空列表开始
+func NewAPITokenStore(path string, users *UserStore) (*APITokenStore, error) {
+	s := &APITokenStore{path: path, users: users, tokens: map[string]*APIToken{}, flushed: map[string]time.Time{}}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取令牌文件失败: %v", err)
+	}
+	var file tokensFile
+	if err := sonic.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("解析令牌文件 %s 失败: %v", path, err)
+	}
+	for i := range file.Tokens {
+		t := file.Tokens[i]
+		s.tokens[t.ID] = &t
+	}
+	return s, nil
+}
+
+// save 写回令牌文件，调用方需持有锁
+func (s *APITokenStore) save() error {
+	file := tokensFile{Tokens: make([]APIToken, 0, len(s.tokens))}
+	for _, t := range s.tokens {
+		file.Tokens = append(file.Tokens, *t)
+	}
+	sort.Slice(file.Tokens, func(i, j int) bool { return file.Tokens[i].CreatedAt.Before(file.Tokens[j].CreatedAt) })
+
+	data, err := sonic.ConfigStd.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), dataDirPerm); err != nil {
+		return fmt.Errorf("创建数据目录失败: %v", err)
+	}
+	if err := writeFileAtomic(s.path, data, authFilePerm); err != nil {
+		return fmt.Errorf("保存令牌文件失败: %v", err)
+	}
+	return nil
+}
+
+// Create 为用户创建令牌，返回只展示这一次的明文令牌
+func (s *APITokenStore) Create(username string, req CreateAPITokenRequest) (string, APITokenInfo, error) {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || utf8.RuneCountInString(req.Name) > maxTokenNameLength {
+		return "", APITokenInfo{}, fmt.Errorf("%w: 令牌名称不能为空，且不能超过 %d 个字符", ErrInvalidArgument, maxTokenNameLength)
+	}
+	if len(req.Scopes) == 0 {
+		return "", APITokenInfo{}, fmt.Errorf("%w: 至少需要一个权限范围", ErrInvalidArgument)
+	}
+	scopes := make([]Permission, 0, len(req.Scopes))
+	seen := map[Permission]bool{}
+	for _, p := range req.Scopes {
+		if !validPermission(p) {
+			return "", APITokenInfo{}, fmt.Errorf("%w: 权限范围 %q 无效", ErrInvalidArgument, p)
+		}
+		if !seen[p] {
+			seen[p] = true
+			scopes = append(scopes, p)
+		}
+	}
+	now := time.Now()
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(now) {
+		return "", APITokenInfo{}, fmt.Errorf("%w: 过期时间必须晚于当前时间", ErrInvalidArgument)
+	}
+
+	id, err := randomHex(8)
+	if err != nil {
+		return "", APITokenInfo{}, err
+	}
+	secret, err := randomHex(32)
+	if err != nil {
+		return "", APITokenInfo{}, err
+	}
+	token := APITokenPrefix + secret
+	t := &APIToken{
+		ID:        id,
+		Name:      req.Name,
+		Username:  username,
+		Hash:      hashAPIToken(token),
+		Prefix:    token[:apiTokenDisplayLength],
+		Scopes:    scopes,
+		CreatedAt: now,
+		ExpiresAt: req.ExpiresAt,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[id] = t
+	if err := s.save(); err != nil {
+		delete(s.tokens, id)
+		return "", APITokenInfo{}, err
+	}
+	return token, t.Info(), nil
+}
+
+// List 返回用户的令牌，按创建时间排序
+func (s *APITokenStore) List(username string) []APITokenInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := []APITokenInfo{}
+	for _, t := range s.tokens {
+		if t.Username == username {
+			list = append(list, t.Info())
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list
+}
+
+// Revoke 撤销用户的令牌，其他用户的令牌按不存在处理
+func (s *APITokenStore) Revoke(username, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tokens[id]
+	if !ok || t.Username != username {
+		return fmt.Errorf("%w: %s", ErrTokenNotFound, id)
+	}
+	delete(s.tokens, id)
+	if err := s.save(); err != nil {
+		s.tokens[id] = t
+		return err
+	}
+	delete(s.flushed, id)
+	return nil
+}
+
+// Verify 校验 API 令牌，返回令牌对应的调用方，并记录最近使用时间
+func (s *APITokenStore) Verify(token string) (Principal, error) {
+	hash := hashAPIToken(token)
+	now := time.Now()
+
+	s.mu.Lock()
+	var found *APIToken
+	for _, t := range s.tokens {
+		if subtle.ConstantTimeCompare([]byte(t.Hash), []byte(hash)) == 1 {
+			found = t
+			break
+		}
+	}
+	if found == nil {
+		s.mu.Unlock()
+		return Principal{}, fmt.Errorf("%w: API 令牌无效", ErrUnauthenticated)
+	}
+	if found.expired(now) {
+		s.mu.Unlock()
+		return Principal{}, fmt.Errorf("%w: API 令牌已过期", ErrUnauthenticated)
+	}
+	found.LastUsedAt = &now
+	if now.Sub(s.flushed[found.ID]) >= lastUsedFlushInterval {
+		if err := s.save(); err != nil {
+			log.Printf("记录令牌 %s 的使用时间失败: %v", found.ID, err)
+		}
+		s.flushed[found.ID] = now
+	}
+	p := Principal{Username: found.Username, TokenID: found.ID, Scopes: found.Scopes}
+	s.mu.Unlock()
+
+	u, err := s.users.Get(p.Username)
+	if err != nil {
+		return Principal{}, err
+	}
+	if u.Disabled {
+		return Principal{}, fmt.Errorf("%w: 用户 %s 已被禁用", ErrUnauthenticated, p.Username)
+	}
+	return p, nil
+}
+
+// IsAPIToken 判断令牌是否为 API 令牌，其余令牌按会话令牌校验
+func IsAPIToken(token string) bool {
+	return strings.HasPrefix(token, APITokenPrefix)
+}
+
+// hashAPIToken 计算令牌的 SHA-256。令牌是 32 字节随机数，不需要加盐和慢哈希
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,201 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestTokens 返回临时目录中的 API 令牌存储，用户为 newTestUsers 的用户
+func newTestTokens(t *testing.T) *APITokenStore {
+	users := newTestUsers(t)
+	s, err := NewAPITokenStore(filepath.Join(filepath.Dir(users.path), tokensFileName), users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestAPITokenCreate(t *testing.T) {
+	s := newTestTokens(t)
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name       string
+		req        CreateAPITokenRequest
+		wantScopes []Permission
+		wantErr    bool
+	}{
+		{name: "valid", req: CreateAPITokenRequest{Name: "ci", Scopes: []Permission{PermContainersRead}}, wantScopes: []Permission{PermContainersRead}},
+		{name: "trimmed name and duplicate scopes", req: CreateAPITokenRequest{Name: " ci ", Scopes: []Permission{"containers:*", PermImagesRead, "containers:*"}}, wantScopes: []Permission{"containers:*", PermImagesRead}},
+		{name: "with expiry", req: CreateAPITokenRequest{Name: "ci", Scopes: []Permission{"*"}, ExpiresAt: &future}, wantScopes: []Permission{"*"}},
+		{name: "empty name", req: CreateAPITokenRequest{Name: "  ", Scopes: []Permission{"*"}}, wantErr: true},
+		{name: "name too long", req: CreateAPITokenRequest{Name: strings.Repeat("令", maxTokenNameLength+1), Scopes: []Permission{"*"}}, wantErr: true},
+		{name: "no scopes", req: CreateAPITokenRequest{Name: "ci"}, wantErr: true},
+		{name: "invalid scope", req: CreateAPITokenRequest{Name: "ci", Scopes: []Permission{"volumes:*"}}, wantErr: true},
+		{name: "expired", req: CreateAPITokenRequest{Name: "ci", Scopes: []Permission{"*"}, ExpiresAt: &past}, wantErr: true},
+	}
+	for _, tt := range tests {
+		token, info, err := s.Create("alice", tt.req)
+		if tt.wantErr {
+			if !errors.Is(err, ErrInvalidArgument) {
+				t.Errorf("%s: error = %v, want ErrInvalidArgument", tt.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !IsAPIToken(token) || !strings.HasPrefix(token, info.Prefix) || len(info.Prefix) != apiTokenDisplayLength {
+			t.Errorf("%s: token %q, prefix %q", tt.name, token, info.Prefix)
+		}
+		if info.Name != strings.TrimSpace(tt.req.Name) || info.Username != "alice" || !reflect.DeepEqual(info.Scopes, tt.wantScopes) {
+			t.Errorf("%s: info = %+v", tt.name, info)
+		}
+	}
+}
+
+func TestAPITokenVerify(t *testing.T) {
+	s := newTestTokens(t)
+	scopes := []Permission{PermContainersRead, PermContainersExec}
+
+	tests := []struct {
+		name string
+		// setup 创建令牌后修改状态，返回用于校验的令牌
+		setup func(t *testing.T, token string, info APITokenInfo) string
+		want  bool
+	}{
+		{name: "valid", setup: func(t *testing.T, token string, info APITokenInfo) string { return token }, want: true},
+		{name: "wrong secret", setup: func(t *testing.T, token string, info APITokenInfo) string { return token[:len(token)-1] + "x" }},
+		{name: "session token", setup: func(t *testing.T, token string, info APITokenInfo) string {
+			return strings.TrimPrefix(token, APITokenPrefix)
+		}},
+		{
+			name: "expired",
+			setup: func(t *testing.T, token string, info APITokenInfo) string {
+				expired := time.Now().Add(-time.Second)
+				s.mu.Lock()
+				s.tokens[info.ID].ExpiresAt = &expired
+				s.mu.Unlock()
+				return token
+			},
+		},
+		{
+			name: "revoked",
+			setup: func(t *testing.T, token string, info APITokenInfo) string {
+				if err := s.Revoke("alice", info.ID); err != nil {
+					t.Fatal(err)
+				}
+				return token
+			},
+		},
+		{
+			name: "user disabled",
+			setup: func(t *testing.T, token string, info APITokenInfo) string {
+				setDisabled(t, s.users, "alice", true)
+				t.Cleanup(func() { setDisabled(t, s.users, "alice", false) })
+				return token
+			},
+		},
+		{
+			name: "user deleted",
+			setup: func(t *testing.T, token string, info APITokenInfo) string {
+				s.users.mu.Lock()
+				u := s.users.users["alice"]
+				delete(s.users.users, "alice")
+				s.users.mu.Unlock()
+				t.Cleanup(func() {
+					s.users.mu.Lock()
+					s.users.users["alice"] = u
+					s.users.mu.Unlock()
+				})
+				return token
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, info, err := s.Create("alice", CreateAPITokenRequest{Name: tt.name, Scopes: scopes})
+			if err != nil {
+				t.Fatal(err)
+			}
+			p, err := s.Verify(tt.setup(t, token, info))
+			if !tt.want {
+				if !errors.Is(err, ErrUnauthenticated) {
+					t.Errorf("Verify = %+v, %v, want ErrUnauthenticated", p, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := Principal{Username: "alice", TokenID: info.ID, Scopes: scopes}
+			if !reflect.DeepEqual(p, want) {
+				t.Errorf("Verify = %+v, want %+v", p, want)
+			}
+		})
+	}
+}
+
+func TestAPITokenRevokeAndPersist(t *testing.T) {
+	s := newTestTokens(t)
+	aliceToken, alice, err := s.Create("alice", CreateAPITokenRequest{Name: "ci", Scopes: []Permission{"*"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bobToken, bob, err := s.Create("bob", CreateAPITokenRequest{Name: "ci", Scopes: []Permission{"*"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 只能列出和撤销自己的令牌
+	if list := s.List("alice"); len(list) != 1 || list[0].ID != alice.ID {
+		t.Errorf("List(alice) = %+v", list)
+	}
+	if err := s.Revoke("alice", bob.ID); !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("revoke other user's token: error = %v, want ErrTokenNotFound", err)
+	}
+	if err := s.Revoke("alice", "missing"); !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("revoke missing token: error = %v, want ErrTokenNotFound", err)
+	}
+	if _, err := s.Verify(bobToken); err != nil {
+		t.Errorf("bob's token after failed revoke: %v", err)
+	}
+
+	// 文件只保存哈希，重新打开后令牌仍然有效，撤销的令牌不再有效
+	if err := s.Revoke("alice", alice.ID); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), aliceToken) || strings.Contains(string(data), bobToken) {
+		t.Error("tokens file contains a plaintext token")
+	}
+	if info, err := os.Stat(s.path); err != nil {
+		t.Error(err)
+	} else if info.Mode().Perm() != authFilePerm {
+		t.Errorf("tokens file mode = %04o, want %04o", info.Mode().Perm(), authFilePerm)
+	}
+
+	reopened, err := NewAPITokenStore(s.path, s.users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reopened.Verify(aliceToken); !errors.Is(err, ErrUnauthenticated) {
+		t.Errorf("revoked token after reopen: error = %v, want ErrUnauthenticated", err)
+	}
+	if p, err := reopened.Verify(bobToken); err != nil || p.Username != "bob" {
+		t.Errorf("bob's token after reopen: %+v, %v", p, err)
+	}
+	if list := reopened.List("bob"); len(list) != 1 || list[0].LastUsedAt == nil {
+		t.Errorf("List(bob) after use = %+v, want last used time", list)
+	}
+}
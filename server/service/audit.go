@@ -0,0 +1,343 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bytedance/sonic"
+)
+
+const (
+	// auditFileName 审计日志文件名，轮转后的文件依次为 audit.log.1、audit.log.2 ...
+	auditFileName = "audit.log"
+	// DefaultAuditMaxSize 审计日志文件超过该大小后轮转
+	DefaultAuditMaxSize = 10 << 20
+	// DefaultAuditMaxBackups 保留的轮转文件个数，更早的文件被删除
+	DefaultAuditMaxBackups = 5
+	// DefaultAuditQueryLimit/MaxAuditQueryLimit 查询默认和最多返回的条数
+	DefaultAuditQueryLimit = 100
+	MaxAuditQueryLimit     = 1000
+	// auditReadChunk 查询时从文件末尾向前每次读取的大小
+	auditReadChunk = 64 << 10
+
+	// AuditResultSuccess/AuditResultFailure 操作结果，按响应状态码区分
+	AuditResultSuccess = "success"
+	AuditResultFailure = "failure"
+
+	// maskedValue 替换敏感字段的值
+	maskedValue = "***"
+)
+
+// secretKeyPattern 名称中包含这些词的字段或环境变量视为敏感信息
+var secretKeyPattern = regexp.MustCompile(`(?i)(passw|secret|token|api[_-]?key|private[_-]?key|credential|access[_-]?key)`)
+
+// secretAssignPattern 字符串中 KEY=VALUE 或 --key=value 形式的敏感参数
+var secretAssignPattern = regexp.MustCompile(`(?i)((?:--?)?[a-z0-9_.-]*(?:passw|secret|token|api[_-]?key|private[_-]?key|credential|access[_-]?key)[a-z0-9_.-]*=)[^\s'"]+`)
+
+// AuditFile 返回审计日志文件路径
+func AuditFile() string {
+	return filepath.Join(DataDir(), auditFileName)
+}
+
+// AuditEntry 一条审计记录，对应一次修改操作的请求
+type AuditEntry struct {
+	Time     time.Time `json:"time"`
+	User     string    `json:"user"`
+	TokenID  string    `json:"token_id,omitempty"`
+	ClientIP string    `json:"client_ip"`
+	Method   string    `json:"method"`
+	// Route 路由模板，Path 实际请求路径
+	Route  string `json:"route"`
+	Path   string `json:"path"`
+	Action string `json:"action"`
+	Target string `json:"target,omitempty"`
+	// Request 请求体，敏感字段已被替换为 ***
+	Request    any    `json:"request,omitempty"`
+	Status     int    `json:"status"`
+	Result     string `json:"result"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// AuditFilter 审计日志的查询条件，零值表示不限制
+type AuditFilter struct {
+	User string
+	// Action 操作，container 匹配 container.create、container.start 等所有容器操作
+	Action string
+	Target string
+	Result string
+	Since  time.Time
+	Until  time.Time
+	Limit  int
+}
+
+// Match 判断记录是否满足查询条件
+func (f AuditFilter) Match(e AuditEntry) bool {
+	if f.User != "" && e.User != f.User {
+		return false
+	}
+	if f.Action != "" && e.Action != f.Action && !strings.HasPrefix(e.Action, f.Action+".") {
+		return false
+	}
+	if f.Target != "" && e.Target != f.Target {
+		return false
+	}
+	if f.Result != "" && e.Result != f.Result {
+		return false
+	}
+	if !f.Since.IsZero() && e.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !e.Time.Before(f.Until) {
+		return false
+	}
+	return true
+}
+
+// AuditLog 追加写入的 JSON Lines 审计日志，文件超过大小限制后轮转
+type AuditLog struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// NewAuditLog 打开审计日志，maxSize、maxBackups 为 0 时使用默认值
+func NewAuditLog(path string, maxSize int64, maxBackups int) (*AuditLog, error) {
+	if maxSize <= 0 {
+		maxSize = DefaultAuditMaxSize
+	}
+	if maxBackups <= 0 {
+		maxBackups = DefaultAuditMaxBackups
+	}
+	l := &AuditLog{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := os.MkdirAll(filepath.Dir(path), dataDirPerm); err != nil {
+		return nil, fmt.Errorf("创建数据目录失败: %v", err)
+	}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// open 以追加方式打开当前日志文件，调用方需持有锁（构造时除外）
+func (l *AuditLog) open() error {
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, authFilePerm)
+	if err != nil {
+		return fmt.Errorf("打开审计日志失败: %v", err)
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("打开审计日志失败: %v", err)
+	}
+	l.file, l.size = f, st.Size()
+	return nil
+}
+
+// Write 追加一条审计记录
+func (l *AuditLog) Write(e AuditEntry) error {
+	line, err := sonic.Marshal(e)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.size > 0 && l.size+int64(len(line)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			// 轮转失败时继续写入当前文件，不能丢失审计记录
+			log.Printf("轮转审计日志失败: %v", err)
+		}
+	}
+	n, err := l.file.Write(line)
+	l.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("写入审计日志失败: %v", err)
+	}
+	return nil
+}
+
+// rotate 将 audit.log.N 依次改名为 audit.log.N+1，当前文件改名为 audit.log.1 后重新打开，调用方需持有锁
+func (l *AuditLog) rotate() error {
+	if err := os.Remove(l.backupPath(l.maxBackups)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for i := l.maxBackups - 1; i >= 1; i-- {
+		if err := os.Rename(l.backupPath(i), l.backupPath(i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(l.path, l.backupPath(1)); err != nil {
+		return err
+	}
+	l.file.Close()
+	return l.open()
+}
+
+// backupPath 返回第 i 个轮转文件的路径，i 越大越旧
+func (l *AuditLog) backupPath(i int) string {
+	return l.path + "." + strconv.Itoa(i)
+}
+
+// Query 按条件查询审计记录，从新到旧返回，最多返回 filter.Limit 条。
+// 只在打开文件时持有锁，从文件末尾向前读取，不阻塞写入
+func (l *AuditLog) Query(filter AuditFilter) ([]AuditEntry, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = DefaultAuditQueryLimit
+	}
+	if filter.Limit > MaxAuditQueryLimit {
+		filter.Limit = MaxAuditQueryLimit
+	}
+
+	files, err := l.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+
+	entries := []AuditEntry{}
+	for _, f := range files {
+		err := scanLinesReverse(f, f.size, func(line []byte) bool {
+			var e AuditEntry
+			if err := sonic.Unmarshal(line, &e); err != nil {
+				return true
+			}
+			if filter.Match(e) {
+				entries = append(entries, e)
+			}
+			return len(entries) < filter.Limit
+		})
+		if err != nil {
+			return nil, fmt.Errorf("读取审计日志 %s 失败: %v", f.Name(), err)
+		}
+		if len(entries) >= filter.Limit {
+			break
+		}
+	}
+	return entries, nil
+}
+
+// auditSnapshotFile 查询开始时打开的审计日志文件，只读取打开时已写入的 size 字节
+type auditSnapshotFile struct {
+	*os.File
+	size int64
+}
+
+// snapshot 在锁内打开当前文件和所有轮转文件并记录大小，从新到旧排列。
+// 之后读取不需要持有锁：轮转只改名不影响已打开的文件，新写入的内容在 size 之后
+func (l *AuditLog) snapshot() ([]auditSnapshotFile, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var files []auditSnapshotFile
+	fail := func(err error) ([]auditSnapshotFile, error) {
+		for _, f := range files {
+			f.Close()
+		}
+		return nil, fmt.Errorf("读取审计日志失败: %v", err)
+	}
+	for i := 0; i <= l.maxBackups; i++ {
+		path := l.path
+		if i > 0 {
+			path = l.backupPath(i)
+		}
+		f, err := os.Open(path)
+		if os.IsNotExist(err) {
+			break
+		}
+		if err != nil {
+			return fail(err)
+		}
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return fail(err)
+		}
+		files = append(files, auditSnapshotFile{File: f, size: info.Size()})
+	}
+	return files, nil
+}
+
+// scanLinesReverse 从 size 处按块向前读取，从后往前对每个非空行调用 fn，fn 返回 false 时停止
+func scanLinesReverse(r io.ReaderAt, size int64, fn func(line []byte) bool) error {
+	buf := make([]byte, auditReadChunk)
+	// partial 块开头尚未遇到换行的部分行，与前一块的末尾拼接成完整的行
+	var partial []byte
+	for off := size; off > 0; {
+		n := min(off, int64(len(buf)))
+		off -= n
+		if _, err := r.ReadAt(buf[:n], off); err != nil && err != io.EOF {
+			return err
+		}
+		// 每块复制到新的切片，fn 得到的行在返回后仍然有效
+		chunk := make([]byte, 0, n+int64(len(partial)))
+		chunk = append(append(chunk, buf[:n]...), partial...)
+		for {
+			i := bytes.LastIndexByte(chunk, '\n')
+			if i < 0 {
+				break
+			}
+			if line := chunk[i+1:]; len(line) > 0 && !fn(line) {
+				return nil
+			}
+			chunk = chunk[:i]
+		}
+		partial = chunk
+	}
+	if len(partial) > 0 {
+		fn(partial)
+	}
+	return nil
+}
+
+// MaskSecrets 解析 JSON 请求体，将名称像密码、令牌、密钥的字段和环境变量的值替换为 ***，
+// 字符串中 KEY=VALUE 和 --key=value 形式的敏感参数同样替换。无法解析时返回 nil
+func MaskSecrets(body []byte) any {
+	var v any
+	if err := sonic.Unmarshal(body, &v); err != nil {
+		return nil
+	}
+	return maskValue(v)
+}
+
+// maskValue 递归替换敏感信息
+func maskValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if secretKeyPattern.MatchString(key) {
+				v[key] = maskedValue
+			} else {
+				v[key] = maskValue(value)
+			}
+		}
+		return v
+	case []any:
+		for i, value := range v {
+			v[i] = maskValue(value)
+		}
+		return v
+	case string:
+		return secretAssignPattern.ReplaceAllString(v, "${1}"+maskedValue)
+	default:
+		return v
+	}
+}
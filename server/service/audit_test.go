@@ -0,0 +1,236 @@
+package service
+
+import (
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bytedance/sonic"
+)
+
+func TestMaskSecrets(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "secret fields",
+			in:   `{"username":"admin","password":"p@ss","new_password":"x","api_key":"k","apiKey":"k","client_secret":"s","token":"t"}`,
+			want: `{"username":"admin","password":"***","new_password":"***","api_key":"***","apiKey":"***","client_secret":"***","token":"***"}`,
+		},
+		{
+			name: "environment variables",
+			in:   `{"image":"busybox","environment":{"PATH":"/bin","DB_PASSWORD":"hunter2","AWS_ACCESS_KEY_ID":"AKIA","GITHUB_TOKEN":"ghp"}}`,
+			want: `{"image":"busybox","environment":{"PATH":"/bin","DB_PASSWORD":"***","AWS_ACCESS_KEY_ID":"***","GITHUB_TOKEN":"***"}}`,
+		},
+		{
+			name: "assignments in strings",
+			in:   `{"command":["sh","-c","mysql --password=hunter2 -u root"],"entrypoint":"env API_TOKEN=abc PORT=80 ./run"}`,
+			want: `{"command":["sh","-c","mysql --password=*** -u root"],"entrypoint":"env API_TOKEN=*** PORT=80 ./run"}`,
+		},
+		{
+			name: "nested objects",
+			in:   `{"items":[{"name":"a","secret":{"value":"x"}},{"name":"b","note":"private_key=abc"}]}`,
+			want: `{"items":[{"name":"a","secret":"***"},{"name":"b","note":"private_key=***"}]}`,
+		},
+		{
+			name: "non-string values",
+			in:   `{"count":3,"detach":true,"labels":null}`,
+			want: `{"count":3,"detach":true,"labels":null}`,
+		},
+		{
+			name: "no secrets",
+			in:   `{"name":"web","command":"echo tokenizer"}`,
+			want: `{"name":"web","command":"echo tokenizer"}`,
+		},
+	}
+	for _, tt := range tests {
+		var want any
+		if err := sonic.Unmarshal([]byte(tt.want), &want); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := MaskSecrets([]byte(tt.in)); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: MaskSecrets = %v, want %v", tt.name, got, want)
+		}
+	}
+
+	for _, body := range []string{"", "not json", `{"password":`} {
+		if got := MaskSecrets([]byte(body)); got != nil {
+			t.Errorf("MaskSecrets(%q) = %v, want nil", body, got)
+		}
+	}
+}
+
+func TestAuditFilterMatch(t *testing.T) {
+	base := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	entry := AuditEntry{
+		Time:   base,
+		User:   "alice",
+		Action: "container.exec.terminal",
+		Target: "web",
+		Result: AuditResultSuccess,
+	}
+
+	tests := []struct {
+		name   string
+		filter AuditFilter
+		want   bool
+	}{
+		{name: "empty filter", filter: AuditFilter{}, want: true},
+		{name: "user", filter: AuditFilter{User: "alice"}, want: true},
+		{name: "other user", filter: AuditFilter{User: "bob"}, want: false},
+		{name: "exact action", filter: AuditFilter{Action: "container.exec.terminal"}, want: true},
+		{name: "action prefix", filter: AuditFilter{Action: "container"}, want: true},
+		{name: "nested action prefix", filter: AuditFilter{Action: "container.exec"}, want: true},
+		{name: "partial word is not a prefix", filter: AuditFilter{Action: "contain"}, want: false},
+		{name: "other action", filter: AuditFilter{Action: "image"}, want: false},
+		{name: "target", filter: AuditFilter{Target: "web"}, want: true},
+		{name: "other target", filter: AuditFilter{Target: "db"}, want: false},
+		{name: "result", filter: AuditFilter{Result: AuditResultFailure}, want: false},
+		{name: "since inclusive", filter: AuditFilter{Since: base}, want: true},
+		{name: "since later", filter: AuditFilter{Since: base.Add(time.Second)}, want: false},
+		{name: "until exclusive", filter: AuditFilter{Until: base}, want: false},
+		{name: "until later", filter: AuditFilter{Until: base.Add(time.Second)}, want: true},
+		{name: "all conditions", filter: AuditFilter{User: "alice", Action: "container", Target: "web", Result: AuditResultSuccess, Since: base.Add(-time.Hour), Until: base.Add(time.Hour)}, want: true},
+		{name: "one condition fails", filter: AuditFilter{User: "alice", Action: "container", Target: "db"}, want: false},
+	}
+	for _, tt := range tests {
+		if got := tt.filter.Match(entry); got != tt.want {
+			t.Errorf("%s: Match = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAuditLogRotateAndQuery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), auditFileName)
+	// 每条记录约 150 字节，1KB 轮转一次，最多保留 2 个轮转文件
+	l, err := NewAuditLog(path, 1024, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base := time.Now()
+	for i := 0; i < 40; i++ {
+		action := "container.start"
+		if i%2 == 1 {
+			action = "image.remove"
+		}
+		if err := l.Write(AuditEntry{Time: base.Add(time.Duration(i) * time.Second), User: "alice", Action: action, Target: strconv.Itoa(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	all, err := l.Query(AuditFilter{Limit: MaxAuditQueryLimit})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) == 0 || len(all) >= 40 {
+		t.Fatalf("query returned %d entries, want older entries to be rotated out", len(all))
+	}
+	for i, e := range all {
+		if i > 0 && !e.Time.Before(all[i-1].Time) {
+			t.Fatalf("entries not ordered newest first at %d", i)
+		}
+	}
+	if all[0].Target != "39" {
+		t.Errorf("newest entry target = %s, want 39", all[0].Target)
+	}
+
+	limited, err := l.Query(AuditFilter{Action: "image", Limit: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var targets []string
+	for _, e := range limited {
+		targets = append(targets, e.Target)
+	}
+	if want := []string{"39", "37", "35"}; !reflect.DeepEqual(targets, want) {
+		t.Errorf("filtered targets = %v, want %v", targets, want)
+	}
+}
+
+func TestScanLinesReverse(t *testing.T) {
+	long := strings.Repeat("x", auditReadChunk+100)
+	tests := []struct {
+		name string
+		data string
+		want []string
+	}{
+		{name: "empty", data: "", want: nil},
+		{name: "single line", data: "a\n", want: []string{"a"}},
+		{name: "no trailing newline", data: "a\nb", want: []string{"b", "a"}},
+		{name: "empty lines", data: "\na\n\n\nb\n", want: []string{"b", "a"}},
+		{name: "line across chunks", data: "a\n" + long + "\nb\n", want: []string{"b", long, "a"}},
+		{name: "newline at chunk boundary", data: strings.Repeat("y", auditReadChunk-1) + "\n" + "z\n", want: []string{"z", strings.Repeat("y", auditReadChunk-1)}},
+	}
+	for _, tt := range tests {
+		var got []string
+		if err := scanLinesReverse(strings.NewReader(tt.data), int64(len(tt.data)), func(line []byte) bool {
+			got = append(got, string(line))
+			return true
+		}); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: lines = %d %.20q, want %d %.20q", tt.name, len(got), got, len(tt.want), tt.want)
+		}
+	}
+
+	// fn 返回 false 时停止；只读取 size 之前的内容
+	var got []string
+	data := "a\nb\nc\nd\n"
+	if err := scanLinesReverse(strings.NewReader(data), 6, func(line []byte) bool {
+		got = append(got, string(line))
+		return len(got) < 2
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"c", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("lines = %q, want %q", got, want)
+	}
+}
+
+func TestAuditLogQueryDoesNotBlockWrites(t *testing.T) {
+	path := filepath.Join(t.TempDir(), auditFileName)
+	l, err := NewAuditLog(path, 1024, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 查询期间并发写入并轮转，查询结果仍然从新到旧且没有重复
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			if err := l.Write(AuditEntry{Time: time.Now(), User: "alice", Action: "container.start", Target: strconv.Itoa(i)}); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		entries, err := l.Query(AuditFilter{Limit: MaxAuditQueryLimit})
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen := make(map[string]bool)
+		for i, e := range entries {
+			if seen[e.Target] {
+				t.Fatalf("duplicate entry %s", e.Target)
+			}
+			seen[e.Target] = true
+			if i > 0 && e.Time.After(entries[i-1].Time) {
+				t.Fatalf("entries not ordered newest first at %d", i)
+			}
+		}
+	}
+}
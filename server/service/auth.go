@@ -0,0 +1,283 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// defaultDataDir 保存用户、令牌和审计日志的默认目录
+	defaultDataDir = "/var/lib/zdocker-web"
+	// dataDirPerm 数据目录权限，其中的文件包含密码哈希
+	dataDirPerm = 0700
+	// authFilePerm 用户文件权限，只允许属主读写
+	authFilePerm = 0600
+	// usersFileName 用户文件名
+	usersFileName = "users.json"
+
+	// DefaultAdminUser 没有任何用户时自动创建的管理员
+	DefaultAdminUser = "admin"
+	// minPasswordLength 密码最短长度
+	minPasswordLength = 8
+	// bcryptCost 密码哈希的计算强度
+	bcryptCost = 12
+)
+
+// usernamePattern 用户名只允许字母、数字和 _ . -
+var usernamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]{0,63}$`)
+
+// dummyPasswordHash 用户不存在时用于比较的哈希，使响应时间与用户存在时一致，避免枚举用户名。
+// 延迟到第一次使用时计算，容器 init 等子命令不需要付出 bcrypt 的开销
+var dummyPasswordHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("zdocker-web"), bcryptCost)
+	return hash
+})
+
+// DataDir 返回保存用户、令牌和审计日志的目录，可通过 ZDOCKER_WEB_DATA 修改
+func DataDir() string {
+	if dir := os.Getenv("ZDOCKER_WEB_DATA"); dir != "" {
+		return dir
+	}
+	return defaultDataDir
+}
+
+// UsersFile 返回用户文件路径
+func UsersFile() string {
+	return filepath.Join(DataDir(), usersFileName)
+}
+
+// User 本地用户，密码只保存 bcrypt 哈希
+type User struct {
+	Username     string `json:"username"`
+	PasswordHash string `json:"password_hash"`
+	Disabled     bool   `json:"disabled,omitempty"`
+	// Roles 用户的角色。没有该字段的用户来自引入角色之前的用户文件，当时所有用户都有全部权限，按 admin 处理
+	Roles []string `json:"roles"`
+	// PasswordChangedAt 修改密码时会注销该用户的其他会话
+	PasswordChangedAt time.Time `json:"password_changed_at"`
+	CreatedAt         time.Time `json:"created_at"`
+}
+
+// UserInfo 接口返回的用户信息，不包含密码哈希
+type UserInfo struct {
+	Username  string    `json:"username"`
+	Roles     []string  `json:"roles"`
+	Disabled  bool      `json:"disabled"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Info 返回可以对外展示的用户信息
+func (u User) Info() UserInfo {
+	return UserInfo{Username: u.Username, Roles: u.RoleNames(), Disabled: u.Disabled, CreatedAt: u.CreatedAt}
+}
+
+// RoleNames 返回用户的角色名称
+func (u User) RoleNames() []string {
+	if u.Roles == nil {
+		return []string{RoleAdmin}
+	}
+	return u.Roles
+}
+
+// usersFile 用户文件的结构
+type usersFile struct {
+	Users []User `json:"users"`
+}
+
+// UserStore 保存在 JSON 文件中的本地用户。文件被外部修改（如 passwd 子命令）后会在下次访问时重新加载
+type UserStore struct {
+	path string
+
+	mu      sync.Mutex
+	users   map[string]User
+	modTime time.Time
+}
+
+// NewUserStore 打开用户文件，文件不存在时从空用户列表开始
+func NewUserStore(path string) (*UserStore, error) {
+	s := &UserStore{path: path, users: map[string]User{}}
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// reload 在文件修改时间变化时重新读取用户文件，调用方需持有锁（构造时除外）
+func (s *UserStore) reload() error {
+	st, err := os.Stat(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("读取用户文件失败: %v", err)
+	}
+	if st.ModTime().Equal(s.modTime) {
+		return nil
+	}
+	if st.Mode().Perm()&0077 != 0 {
+		log.Printf("用户文件 %s 的权限为 %04o，建议改为 0600", s.path, st.Mode().Perm())
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return fmt.Errorf("读取用户文件失败: %v", err)
+	}
+	var file usersFile
+	if err := sonic.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("解析用户文件 %s 失败: %v", s.path, err)
+	}
+	users := make(map[string]User, len(file.Users))
+	for _, u := range file.Users {
+		users[u.Username] = u
+	}
+	s.users = users
+	s.modTime = st.ModTime()
+	return nil
+}
+
+// save 写回用户文件，调用方需持有锁
+func (s *UserStore) save() error {
+	file := usersFile{Users: make([]User, 0, len(s.users))}
+	for _, u := range s.users {
+		file.Users = append(file.Users, u)
+	}
+	sort.Slice(file.Users, func(i, j int) bool { return file.Users[i].Username < file.Users[j].Username })
+
+	data, err := sonic.ConfigStd.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), dataDirPerm); err != nil {
+		return fmt.Errorf("创建数据目录失败: %v", err)
+	}
+	if err := writeFileAtomic(s.path, data, authFilePerm); err != nil {
+		return fmt.Errorf("保存用户文件失败: %v", err)
+	}
+	if st, err := os.Stat(s.path); err == nil {
+		s.modTime = st.ModTime()
+	}
+	return nil
+}
+
+// Bootstrap 没有任何用户时创建管理员 admin，密码取自 ZDOCKER_ADMIN_PASSWORD，
+// 未设置时随机生成并返回，由调用方打印到日志。已有用户时返回空字符串
+func (s *UserStore) Bootstrap() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.reload(); err != nil {
+		return "", err
+	}
+	if len(s.users) > 0 {
+		return "", nil
+	}
+
+	password, generated := os.Getenv("ZDOCKER_ADMIN_PASSWORD"), false
+	if password == "" {
+		buf := make([]byte, 12)
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		password, generated = base64.RawURLEncoding.EncodeToString(buf), true
+	}
+	if err := s.setPassword(DefaultAdminUser, password, []string{RoleAdmin}); err != nil {
+		return "", err
+	}
+	if !generated {
+		return "", nil
+	}
+	return password, nil
+}
+
+// Authenticate 校验用户名和密码，失败时统一返回 ErrUnauthenticated，不区分用户不存在和密码错误
+func (s *UserStore) Authenticate(username, password string) (User, error) {
+	u, err := s.Get(username)
+	if err != nil {
+		bcrypt.CompareHashAndPassword(dummyPasswordHash(), []byte(password))
+		return User{}, fmt.Errorf("%w: 用户名或密码错误", ErrUnauthenticated)
+	}
+	if bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)) != nil {
+		return User{}, fmt.Errorf("%w: 用户名或密码错误", ErrUnauthenticated)
+	}
+	if u.Disabled {
+		return User{}, fmt.Errorf("%w: 用户 %s 已被禁用", ErrUnauthenticated, username)
+	}
+	return u, nil
+}
+
+// Get 根据用户名获取用户
+func (s *UserStore) Get(username string) (User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.reload(); err != nil {
+		return User{}, err
+	}
+	u, ok := s.users[username]
+	if !ok {
+		return User{}, fmt.Errorf("%w: 用户 %s 不存在", ErrUnauthenticated, username)
+	}
+	return u, nil
+}
+
+// ChangePassword 校验旧密码后修改密码
+func (s *UserStore) ChangePassword(username, oldPassword, newPassword string) error {
+	if _, err := s.Authenticate(username, oldPassword); err != nil {
+		return fmt.Errorf("%w: 原密码错误", ErrInvalidArgument)
+	}
+	return s.SetPassword(username, newPassword, nil)
+}
+
+// SetPassword 设置用户密码，用户不存在时创建。roles 不为 nil 时同时设置角色，
+// 为 nil 时保留已有用户的角色，新用户为 viewer
+func (s *UserStore) SetPassword(username, password string, roles []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.reload(); err != nil {
+		return err
+	}
+	return s.setPassword(username, password, roles)
+}
+
+// setPassword 设置密码和角色并保存，调用方需持有锁
+func (s *UserStore) setPassword(username, password string, roles []string) error {
+	if !usernamePattern.MatchString(username) {
+		return fmt.Errorf("%w: 用户名只能包含字母、数字、_、. 和 -，以字母或数字开头，最长 64 个字符", ErrInvalidArgument)
+	}
+	if len(password) < minPasswordLength {
+		return fmt.Errorf("%w: 密码不能少于 %d 个字符", ErrInvalidArgument, minPasswordLength)
+	}
+	// bcrypt 只使用前 72 个字节，更长的密码会被静默截断
+	if len(password) > 72 {
+		return fmt.Errorf("%w: 密码不能超过 72 个字节", ErrInvalidArgument)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcryptCost)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	u, ok := s.users[username]
+	if !ok {
+		u = User{Username: username, Roles: []string{RoleViewer}, CreatedAt: now}
+	}
+	if roles != nil {
+		u.Roles = roles
+	}
+	u.PasswordHash = string(hash)
+	u.PasswordChangedAt = now
+	s.users[username] = u
+	return s.save()
+}
@@ -0,0 +1,223 @@
+package service
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/crazyfrankie/zdocker/container"
+)
+
+// 文件变化类型
+const (
+	ChangeAdded    = "added"
+	ChangeModified = "modified"
+	ChangeDeleted  = "deleted"
+)
+
+// overlayOpaqueXattr 标记 overlay 不透明目录的扩展属性，下层同名目录的内容被整体隐藏
+const overlayOpaqueXattr = "trusted.overlay.opaque"
+
+// defaultChangesLimit 默认最多返回的变化条目数，统计值不受限制
+const defaultChangesLimit = 1000
+
+// FileChange 容器文件系统相对镜像的一处变化
+type FileChange struct {
+	// Path 容器内的绝对路径
+	Path  string `json:"path"`
+	Kind  string `json:"kind"`
+	IsDir bool   `json:"is_dir"`
+	// Size 新增或修改的文件在可写层中的大小，删除的文件在镜像中的大小
+	Size int64 `json:"size"`
+}
+
+// ChangesOptions 文件变化查询参数
+type ChangesOptions struct {
+	// Prefix 只返回该路径及其下的变化，空表示全部
+	Prefix string
+	// Limit 最多返回的条目数，0 表示使用默认值，小于 0 表示不限制
+	Limit int
+}
+
+// ContainerChanges 容器可写层相对镜像的所有变化
+type ContainerChanges struct {
+	Changes []FileChange `json:"changes"`
+	// Truncated 变化条目超过 Limit 被截断，统计值仍包含全部变化
+	Truncated bool `json:"truncated"`
+
+	Added         int   `json:"added"`
+	Modified      int   `json:"modified"`
+	Deleted       int   `json:"deleted"`
+	AddedBytes    int64 `json:"added_bytes"`
+	ModifiedBytes int64 `json:"modified_bytes"`
+	DeletedBytes  int64 `json:"deleted_bytes"`
+}
+
+// add 记录一处变化并更新统计
+func (c *ContainerChanges) add(change FileChange, limit int) {
+	switch change.Kind {
+	case ChangeAdded:
+		c.Added++
+		c.AddedBytes += change.Size
+	case ChangeModified:
+		c.Modified++
+		c.ModifiedBytes += change.Size
+	case ChangeDeleted:
+		c.Deleted++
+		c.DeletedBytes += change.Size
+	}
+	if limit >= 0 && len(c.Changes) >= limit {
+		c.Truncated = true
+		return
+	}
+	c.Changes = append(c.Changes, change)
+}
+
+// containerChanges 遍历容器的 overlay 可写层，与镜像目录比较得到新增、修改和删除的路径。
+// 字符设备 0/0 是 overlay 的删除标记；不透明目录中存在于镜像但不在可写层的条目同样视为删除；
+// 与 docker diff 一致，因子项变化而被复制到可写层的目录记为修改
+func containerChanges(containerName string, opts ChangesOptions) (ContainerChanges, error) {
+	name, err := lookupContainerName(containerName)
+	if err != nil {
+		return ContainerChanges{}, err
+	}
+	image := containerImage(name)
+	if image == "" {
+		return ContainerChanges{}, fmt.Errorf("%w: 无法确定容器 %s 的镜像", ErrImageNotFound, name)
+	}
+	upper := fmt.Sprintf(container.WriteLayerUrl, name)
+	lower := fmt.Sprintf(container.OverlayLower, image)
+	if _, err := os.Stat(upper); err != nil {
+		return ContainerChanges{}, fmt.Errorf("读取容器可写层失败: %v", err)
+	}
+	return layerChanges(upper, lower, opts)
+}
+
+// layerChanges 比较 overlay 可写层 upper 与只读层 lower，返回可写层中的变化
+func layerChanges(upper, lower string, opts ChangesOptions) (ContainerChanges, error) {
+	limit := opts.Limit
+	if limit == 0 {
+		limit = defaultChangesLimit
+	}
+	prefix := path.Clean("/" + opts.Prefix)
+
+	result := ContainerChanges{Changes: []FileChange{}}
+	err := filepath.WalkDir(upper, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(upper, file)
+		if err != nil {
+			return err
+		}
+		if rel == "." || slices.Contains(internalFiles, rel) {
+			return nil
+		}
+		p := "/" + filepath.ToSlash(rel)
+		if !pathRelated(p, prefix) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		inPrefix := hasPathPrefix(p, prefix)
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		lowerFile := filepath.Join(lower, rel)
+		lowerInfo, lowerErr := os.Lstat(lowerFile)
+
+		if isWhiteout(info) {
+			if inPrefix && lowerErr == nil {
+				result.add(deletedChange(p, lowerFile, lowerInfo), limit)
+			}
+			return nil
+		}
+
+		if inPrefix {
+			change := FileChange{Path: p, Kind: ChangeAdded, IsDir: d.IsDir()}
+			if lowerErr == nil {
+				change.Kind = ChangeModified
+			}
+			if info.Mode().IsRegular() {
+				change.Size = info.Size()
+			}
+			result.add(change, limit)
+		}
+
+		// 不透明目录隐藏了镜像中同名目录的全部内容，未被重新创建的条目都已删除
+		if d.IsDir() && lowerErr == nil && lowerInfo.IsDir() && isOpaqueDir(file) {
+			entries, err := os.ReadDir(lowerFile)
+			if err != nil {
+				return nil
+			}
+			for _, entry := range entries {
+				child := path.Join(p, entry.Name())
+				if !hasPathPrefix(child, prefix) {
+					continue
+				}
+				if _, err := os.Lstat(filepath.Join(file, entry.Name())); err == nil {
+					continue
+				}
+				if childInfo, err := entry.Info(); err == nil {
+					result.add(deletedChange(child, filepath.Join(lowerFile, entry.Name()), childInfo), limit)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return ContainerChanges{}, fmt.Errorf("遍历容器可写层失败: %v", err)
+	}
+
+	sort.Slice(result.Changes, func(i, j int) bool {
+		return result.Changes[i].Path < result.Changes[j].Path
+	})
+	return result, nil
+}
+
+// deletedChange 构造删除记录，目录的大小为其在镜像中的全部文件大小
+func deletedChange(p, lowerFile string, lowerInfo os.FileInfo) FileChange {
+	change := FileChange{Path: p, Kind: ChangeDeleted, IsDir: lowerInfo.IsDir()}
+	switch {
+	case lowerInfo.IsDir():
+		change.Size = dirSize(lowerFile)
+	case lowerInfo.Mode().IsRegular():
+		change.Size = lowerInfo.Size()
+	}
+	return change
+}
+
+// isWhiteout 判断是否为 overlay 的删除标记，即设备号为 0/0 的字符设备
+func isWhiteout(info os.FileInfo) bool {
+	if info.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	return ok && stat.Rdev == 0
+}
+
+// isOpaqueDir 判断可写层中的目录是否为不透明目录
+func isOpaqueDir(dir string) bool {
+	buf := make([]byte, 1)
+	n, err := syscall.Getxattr(dir, overlayOpaqueXattr, buf)
+	return err == nil && n == 1 && buf[0] == 'y'
+}
+
+// hasPathPrefix 判断 p 是否为 prefix 本身或位于其下
+func hasPathPrefix(p, prefix string) bool {
+	return prefix == "/" || p == prefix || strings.HasPrefix(p, prefix+"/")
+}
+
+// pathRelated 判断遍历到 p 时是否需要继续：p 位于 prefix 之下，或是 prefix 的上级目录
+func pathRelated(p, prefix string) bool {
+	return hasPathPrefix(p, prefix) || hasPathPrefix(prefix, p)
+}
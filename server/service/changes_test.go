@@ -0,0 +1,148 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// newTestLayers 在临时目录中创建 overlay 的只读层和可写层，返回两者的路径。
+// 删除标记和不透明目录需要 root 权限，无法创建时跳过测试
+func newTestLayers(t *testing.T) (upper, lower string) {
+	base := t.TempDir()
+	upper = filepath.Join(base, "upper")
+	lower = filepath.Join(base, "lower")
+
+	writeFiles := func(root string, files map[string]string) {
+		for name, content := range files {
+			file := filepath.Join(root, name)
+			if strings.HasSuffix(name, "/") {
+				if err := os.MkdirAll(file, 0755); err != nil {
+					t.Fatal(err)
+				}
+				continue
+			}
+			if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	writeFiles(lower, map[string]string{
+		"etc/passwd":   "root",
+		"etc/hosts":    "hosts",
+		"usr/lib/a":    "aa",
+		"usr/lib/b":    "bbb",
+		"var/log/x":    "x",
+		"var/log/y.gz": "yy",
+	})
+	writeFiles(upper, map[string]string{
+		"etc/passwd":     "root:x",
+		"app/main":       "main",
+		"app/data/":      "",
+		"usr/lib/b":      "b",
+		launcherName:     "#!/bin/sh",
+		exitCodeFileName: "0",
+	})
+
+	for _, name := range []string{"etc/hosts", "var"} {
+		if err := syscall.Mknod(filepath.Join(upper, name), syscall.S_IFCHR|0644, 0); err != nil {
+			t.Skipf("create whiteout: %v", err)
+		}
+	}
+	if err := syscall.Setxattr(filepath.Join(upper, "usr/lib"), overlayOpaqueXattr, []byte("y"), 0); err != nil {
+		t.Skipf("set opaque xattr: %v", err)
+	}
+	return upper, lower
+}
+
+func TestLayerChanges(t *testing.T) {
+	upper, lower := newTestLayers(t)
+
+	all := []FileChange{
+		{Path: "/app", Kind: ChangeAdded, IsDir: true},
+		{Path: "/app/data", Kind: ChangeAdded, IsDir: true},
+		{Path: "/app/main", Kind: ChangeAdded, Size: 4},
+		{Path: "/etc", Kind: ChangeModified, IsDir: true},
+		{Path: "/etc/hosts", Kind: ChangeDeleted, Size: 5},
+		{Path: "/etc/passwd", Kind: ChangeModified, Size: 6},
+		{Path: "/usr", Kind: ChangeModified, IsDir: true},
+		{Path: "/usr/lib", Kind: ChangeModified, IsDir: true},
+		{Path: "/usr/lib/a", Kind: ChangeDeleted, Size: 2},
+		{Path: "/usr/lib/b", Kind: ChangeModified, Size: 1},
+		{Path: "/var", Kind: ChangeDeleted, IsDir: true, Size: 3},
+	}
+
+	tests := []struct {
+		name string
+		opts ChangesOptions
+		want []FileChange
+	}{
+		{name: "all", want: all},
+		{name: "root prefix", opts: ChangesOptions{Prefix: "/"}, want: all},
+		{name: "prefix", opts: ChangesOptions{Prefix: "/etc"}, want: all[3:6]},
+		{name: "prefix without leading slash", opts: ChangesOptions{Prefix: "usr/lib/"}, want: all[7:10]},
+		{name: "opaque child prefix", opts: ChangesOptions{Prefix: "/usr/lib/a"}, want: all[8:9]},
+		{name: "file prefix", opts: ChangesOptions{Prefix: "/app/main"}, want: all[2:3]},
+		{name: "sibling with same prefix", opts: ChangesOptions{Prefix: "/ap"}, want: []FileChange{}},
+		{name: "inside deleted directory", opts: ChangesOptions{Prefix: "/var/log"}, want: []FileChange{}},
+	}
+	for _, tt := range tests {
+		got, err := layerChanges(upper, lower, tt.opts)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got.Changes, tt.want) {
+			t.Errorf("%s: changes = %+v, want %+v", tt.name, got.Changes, tt.want)
+		}
+	}
+
+	// 截断时统计值仍包含全部变化
+	got, err := layerChanges(upper, lower, ChangesOptions{Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ContainerChanges{
+		Changes:   all[:2],
+		Truncated: true,
+		Added:     3, AddedBytes: 4,
+		Modified: 5, ModifiedBytes: 7,
+		Deleted: 3, DeletedBytes: 10,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("limited changes = %+v, want %+v", got, want)
+	}
+	if got, _ := layerChanges(upper, lower, ChangesOptions{Limit: -1}); got.Truncated || len(got.Changes) != len(all) {
+		t.Errorf("unlimited changes = %d entries, truncated %v", len(got.Changes), got.Truncated)
+	}
+}
+
+func TestHasPathPrefix(t *testing.T) {
+	tests := []struct {
+		p, prefix   string
+		wantPrefix  bool
+		wantRelated bool
+	}{
+		{p: "/etc", prefix: "/", wantPrefix: true, wantRelated: true},
+		{p: "/etc", prefix: "/etc", wantPrefix: true, wantRelated: true},
+		{p: "/etc/passwd", prefix: "/etc", wantPrefix: true, wantRelated: true},
+		{p: "/etc", prefix: "/etc/passwd", wantRelated: true},
+		{p: "/etcd", prefix: "/etc"},
+		{p: "/etc", prefix: "/etcd"},
+		{p: "/usr/lib", prefix: "/etc"},
+	}
+	for _, tt := range tests {
+		if got := hasPathPrefix(tt.p, tt.prefix); got != tt.wantPrefix {
+			t.Errorf("hasPathPrefix(%s, %s) = %v, want %v", tt.p, tt.prefix, got, tt.wantPrefix)
+		}
+		if got := pathRelated(tt.p, tt.prefix); got != tt.wantRelated {
+			t.Errorf("pathRelated(%s, %s) = %v, want %v", tt.p, tt.prefix, got, tt.wantRelated)
+		}
+	}
+}
@@ -0,0 +1,399 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/crazyfrankie/zdocker/container"
+)
+
+// launcherName CLI 运行时写入容器根目录的启动脚本，用于传递包含空白的参数和工作目录，并记录退出码
+const launcherName = ".zdocker-cmd"
+
+// CLIRuntime 通过调用 zdocker 命令行实现的运行时
+type CLIRuntime struct {
+	// Binary zdocker 可执行文件路径
+	Binary string
+}
+
+// NewCLIRuntime 创建 CLI 运行时，binary 为空时从 PATH 中查找 zdocker
+func NewCLIRuntime(binary string) *CLIRuntime {
+	if binary == "" {
+		binary = "zdocker"
+	}
+	return &CLIRuntime{Binary: binary}
+}
+
+// command 构建 zdocker 子命令。zdocker 会把自身的环境变量传给容器，因此只传最小环境
+func (r *CLIRuntime) command(args ...string) *exec.Cmd {
+	cmd := exec.Command(r.Binary, args...)
+	cmd.Env = minimalEnv()
+	return cmd
+}
+
+// combinedOutput 执行 zdocker 子命令并返回标准输出和标准错误，同时记录调用次数和耗时
+func (r *CLIRuntime) combinedOutput(args ...string) ([]byte, error) {
+	start := time.Now()
+	output, err := r.command(args...).CombinedOutput()
+	observeCLI(args, start, err)
+	return output, err
+}
+
+// ListContainers 获取容器列表
+func (r *CLIRuntime) ListContainers() ([]Container, error) {
+	return GetContainerList()
+}
+
+// GetContainer 根据ID或名称获取容器信息
+func (r *CLIRuntime) GetContainer(containerId string) (Container, error) {
+	return GetContainerById(containerId)
+}
+
+// InspectContainer 汇总容器配置、运行参数、cgroup 与 /proc 中的信息
+func (r *CLIRuntime) InspectContainer(containerId string) (ContainerInspect, error) {
+	return inspectContainer(containerId)
+}
+
+// CreateContainer 创建容器
+func (r *CLIRuntime) CreateContainer(req CreateContainerRequest) (Container, error) {
+	c, err := r.run(req)
+	if err != nil {
+		return Container{}, err
+	}
+	if err := saveRunConfig(c.Name, req); err != nil {
+		log.Printf("保存容器 %s 运行参数失败: %v", c.Name, err)
+	}
+	return c, nil
+}
+
+// run 执行 zdocker run 并返回创建的容器信息
+func (r *CLIRuntime) run(req CreateContainerRequest) (Container, error) {
+	command := containerArgs(req)
+	launcher := ""
+	// on-failure 策略需要区分正常退出，zdocker 不记录退出码，由启动脚本写入可写层
+	policy, _ := ParseRestartPolicy(req.RestartPolicy)
+	if req.Workdir != "" || !commandPassthrough(command) || policy.Name == RestartOnFailure {
+		// 启动脚本放在容器可写层中，需要在 zdocker 创建工作目录之前确定容器名称
+		if req.Name == "" {
+			req.Name = randomContainerId()
+		}
+		var err error
+		if launcher, err = writeLauncher(req.Name, command, req.Workdir); err != nil {
+			return Container{}, err
+		}
+		command = []string{"/bin/sh", "/" + launcherName}
+	}
+
+	// 构建zdocker run命令
+	args := []string{"run"}
+
+	if req.Detach {
+		args = append(args, "-d")
+	}
+	if req.TTY {
+		args = append(args, "-t")
+	}
+	if req.Name != "" {
+		args = append(args, "--name", req.Name)
+	}
+	if req.Volume != "" {
+		args = append(args, "-v", req.Volume)
+	}
+	if req.Memory != "" {
+		args = append(args, "-m", req.Memory)
+	}
+	if req.CpuShare != "" {
+		args = append(args, "--cpushare", req.CpuShare)
+	}
+	if req.CpuSet != "" {
+		args = append(args, "--cpuset", req.CpuSet)
+	}
+	if req.Network != "" {
+		args = append(args, "--net", req.Network)
+	}
+
+	// 添加环境变量
+	for key, value := range req.Environment {
+		args = append(args, "-e", fmt.Sprintf("%s=%s", key, value))
+	}
+
+	// 添加端口映射
+	for _, port := range req.PortMapping {
+		args = append(args, "-p", port)
+	}
+
+	// 添加镜像和命令
+	args = append(args, req.Image)
+	args = append(args, command...)
+
+	// 执行命令
+	output, err := r.combinedOutput(args...)
+	if err != nil {
+		if launcher != "" {
+			os.Remove(launcher)
+		}
+		return Container{}, fmt.Errorf("创建容器失败: %s, %v", string(output), err)
+	}
+
+	// 从输出中解析容器ID或名称
+	containerName := req.Name
+	if containerName == "" {
+		// 如果没有指定名称，从输出中解析
+		lines := strings.Split(string(output), "\n")
+		for _, line := range lines {
+			if strings.Contains(line, "container") {
+				containerName = strings.TrimSpace(line)
+				break
+			}
+		}
+	}
+
+	// 等待一段时间确保容器创建完成
+	time.Sleep(time.Millisecond * 500)
+
+	// 获取创建的容器信息
+	if containerName != "" {
+		return GetContainerById(containerName)
+	}
+
+	return Container{}, fmt.Errorf("无法获取创建的容器信息")
+}
+
+// writeLauncher 在容器可写层中写入启动脚本，由容器内的 /bin/sh 进入工作目录后运行原始 argv，
+// 进程退出后将退出码写入 /.zdocker-exit。脚本作为容器的 1 号进程转发 TERM/INT/HUP 信号，
+// 以后台方式运行命令才能在等待期间处理信号；后台命令的标准输入默认是 /dev/null，通过 fd 3 显式传递。
+// zdocker 用空格拼接命令传给容器 init，包含空白的参数或工作目录无法直接传递，因此要求镜像中有 /bin/sh
+func writeLauncher(containerName string, args []string, workdir string) (string, error) {
+	upper := fmt.Sprintf(container.WriteLayerUrl, containerName)
+	if err := os.MkdirAll(upper, 0777); err != nil {
+		return "", fmt.Errorf("创建容器可写层失败: %v", err)
+	}
+
+	removeExitCode(containerName)
+
+	var script strings.Builder
+	script.WriteString("#!/bin/sh\n")
+	if workdir != "" {
+		fmt.Fprintf(&script, "mkdir -p %s && cd %s || exit 1\n", quoteArg(workdir), quoteArg(workdir))
+	}
+	script.WriteString("trap 'kill -TERM $child 2>/dev/null' TERM INT HUP\n")
+	script.WriteString("exec 3<&0\n")
+	fmt.Fprintf(&script, "%s 0<&3 3<&- &\n", JoinCommand(args))
+	script.WriteString("child=$!\n")
+	script.WriteString("exec 3<&-\n")
+	// wait 被信号打断时返回大于 128 的值，子进程仍存在时继续等待
+	script.WriteString("while :; do wait $child; code=$?; kill -0 $child 2>/dev/null || break; done\n")
+	fmt.Fprintf(&script, "echo $code > /%s\n", exitCodeFileName)
+	script.WriteString("exit $code\n")
+
+	path := filepath.Join(upper, launcherName)
+	if err := os.WriteFile(path, []byte(script.String()), 0755); err != nil {
+		return "", fmt.Errorf("写入容器启动脚本失败: %v", err)
+	}
+	return path, nil
+}
+
+// StartContainer 按保存的运行参数以原名称重新运行已退出的容器，zdocker 本身没有 start 命令
+func (r *CLIRuntime) StartContainer(containerName string) error {
+	original, req, err := prepareStart(containerName)
+	if err != nil {
+		return err
+	}
+	if _, err := r.run(req); err != nil {
+		return err
+	}
+	_, err = restoreIdentity(req.Name, original)
+	return err
+}
+
+// ExitCode 返回启动脚本记录的容器最近一次退出的退出码。
+// 没有使用启动脚本的容器，以及被 SIGKILL 结束（包括 OOM）的容器没有退出码
+func (r *CLIRuntime) ExitCode(containerName string) (int, bool) {
+	return readExitCode(containerName)
+}
+
+// StopContainer 停止容器
+func (r *CLIRuntime) StopContainer(containerName string) error {
+	output, err := r.combinedOutput("stop", containerName)
+	if err != nil {
+		return fmt.Errorf("停止容器失败: %s, %v", string(output), err)
+	}
+	return nil
+}
+
+// RemoveContainer 删除容器
+func (r *CLIRuntime) RemoveContainer(containerName string) error {
+	output, err := r.combinedOutput("rm", containerName)
+	if err != nil {
+		return fmt.Errorf("删除容器失败: %s, %v", string(output), err)
+	}
+	return nil
+}
+
+// ContainerLogs 获取容器日志
+func (r *CLIRuntime) ContainerLogs(containerName string) (string, error) {
+	output, err := r.combinedOutput("logs", containerName)
+	if err != nil {
+		return "", fmt.Errorf("获取容器日志失败: %s, %v", string(output), err)
+	}
+	return string(output), nil
+}
+
+// ContainerLogFile 获取容器日志文件路径，zdocker 将后台容器的输出写入容器目录
+func (r *CLIRuntime) ContainerLogFile(containerName string) (string, error) {
+	name, err := lookupContainerName(containerName)
+	if err != nil {
+		return "", err
+	}
+	return containerStore.Dir(name) + container.ContainerLogFile, nil
+}
+
+// ExecContainer 在容器中执行命令。zdocker exec 直接用空格拼接参数后交给 sh -c，
+// 因此先加好引号，作为一个参数传入
+func (r *CLIRuntime) ExecContainer(containerName string, command []string) (ExecResult, error) {
+	args := []string{"exec", containerName, JoinCommand(command)}
+
+	output, err := r.combinedOutput(args...)
+
+	exitCode := 0
+	if err != nil {
+		var exitError *exec.ExitError
+		if errors.As(err, &exitError) {
+			exitCode = exitError.ExitCode()
+		}
+	}
+
+	return ExecResult{
+		Output:   string(output),
+		ExitCode: exitCode,
+	}, nil
+}
+
+// ExecInteractive 构造交互式执行进程。交互式执行不经过 zdocker 命令行，直接由本进程的 nsenter 进入容器：
+// 在伪终端中运行 zdocker exec 时，它打印的 container pid、command 日志会混入终端输出，
+// 并且 nsenter 执行完命令后固定以 0 退出，无法得到命令的退出码
+func (r *CLIRuntime) ExecInteractive(containerName string, command []string) (*ExecProcess, error) {
+	return execInContainer(containerName, command)
+}
+
+// ContainerStats 从容器进程所在的 cgroup 读取资源使用情况
+func (r *CLIRuntime) ContainerStats(containerName string) (ContainerStats, error) {
+	return containerStats(containerName)
+}
+
+// ContainerChanges 获取容器文件系统相对镜像的变化
+func (r *CLIRuntime) ContainerChanges(containerName string, opts ChangesOptions) (ContainerChanges, error) {
+	return containerChanges(containerName, opts)
+}
+
+// CommitContainer 将容器的文件系统提交为新镜像，不使用 zdocker commit，后者没有进度且输出 gzip 压缩的 tar 包
+func (r *CLIRuntime) CommitContainer(containerName string, opts CommitOptions, progress func(CommitProgress)) (Image, error) {
+	return commitContainer(containerName, opts, progress)
+}
+
+// ContainerFS 获取容器合并后的根文件系统
+func (r *CLIRuntime) ContainerFS(containerName string) (*ContainerFS, error) {
+	return containerFS(containerName)
+}
+
+// ListImages 获取镜像列表
+func (r *CLIRuntime) ListImages() ([]Image, error) {
+	return imageStore.List()
+}
+
+// GetImage 获取镜像详情
+func (r *CLIRuntime) GetImage(imageName string) (Image, error) {
+	return imageStore.Get(imageName)
+}
+
+// RemoveImage 删除镜像
+func (r *CLIRuntime) RemoveImage(imageName string, force bool) error {
+	return imageStore.Remove(imageName, force)
+}
+
+// ImportImage 从 tar 包流导入镜像
+func (r *CLIRuntime) ImportImage(imageName string, reader io.Reader, checksum string) (Image, error) {
+	return imageStore.Import(imageName, reader, checksum)
+}
+
+// OpenImage 打开镜像的 tar 包流
+func (r *CLIRuntime) OpenImage(imageName string) (io.ReadCloser, int64, error) {
+	return imageStore.Open(imageName)
+}
+
+// ListNetworks 获取网络列表
+func (r *CLIRuntime) ListNetworks() ([]NetworkInfo, error) {
+	output, err := r.combinedOutput("network", "list")
+	if err != nil {
+		// 如果命令失败，返回默认网络信息
+		return []NetworkInfo{
+			{Name: "bridge", Driver: "bridge", Subnet: "172.17.0.0/16"},
+		}, nil
+	}
+
+	// 解析输出
+	var networks []NetworkInfo
+	lines := strings.Split(string(output), "\n")
+	for _, line := range lines {
+		if strings.TrimSpace(line) != "" && !strings.Contains(line, "NAME") {
+			fields := strings.Fields(line)
+			if len(fields) >= 3 {
+				networks = append(networks, NetworkInfo{
+					Name:   fields[0],
+					Driver: fields[1],
+					Subnet: fields[2],
+				})
+			}
+		}
+	}
+
+	return networks, nil
+}
+
+// CreateNetwork 创建网络
+func (r *CLIRuntime) CreateNetwork(req CreateNetworkRequest) (NetworkInfo, error) {
+	args := []string{"network", "create"}
+	if req.Driver != "" {
+		args = append(args, "--driver", req.Driver)
+	}
+	if req.Subnet != "" {
+		args = append(args, "--subnet", req.Subnet)
+	}
+	args = append(args, req.Name)
+
+	output, err := r.combinedOutput(args...)
+	if err != nil {
+		return NetworkInfo{}, fmt.Errorf("创建网络失败: %s, %v", string(output), err)
+	}
+
+	return NetworkInfo{
+		Name:   req.Name,
+		Driver: req.Driver,
+		Subnet: req.Subnet,
+	}, nil
+}
+
+// RemoveNetwork 删除网络
+func (r *CLIRuntime) RemoveNetwork(networkName string) error {
+	output, err := r.combinedOutput("network", "remove", networkName)
+	if err != nil {
+		return fmt.Errorf("删除网络失败: %s, %v", string(output), err)
+	}
+	return nil
+}
+
+// Version 获取 zdocker 版本
+func (r *CLIRuntime) Version() (string, error) {
+	output, err := r.combinedOutput("--version")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/bytedance/sonic"
+)
+
+// shellSafeArg 不需要加引号的参数
+var shellSafeArg = regexp.MustCompile(`^[a-zA-Z0-9_@%+=:,./-]+$`)
+
+// CommandLine 命令行参数。JSON 中可以是字符串数组，按原样作为 argv；
+// 也可以是字符串，按 POSIX shell 的引号和转义规则拆分，不做变量展开、通配和命令替换。
+// 序列化时总是输出数组
+type CommandLine struct {
+	Args []string
+	// err 字符串拆分失败的原因，由 ValidateCreateContainer 作为字段错误返回
+	err error
+}
+
+// NewCommandLine 由 argv 创建命令行
+func NewCommandLine(args ...string) CommandLine {
+	return CommandLine{Args: args}
+}
+
+// MarshalJSON 实现 json.Marshaler
+func (c CommandLine) MarshalJSON() ([]byte, error) {
+	if c.Args == nil {
+		return []byte("[]"), nil
+	}
+	return sonic.Marshal(c.Args)
+}
+
+// UnmarshalJSON 实现 json.Unmarshaler，接受 null、字符串和字符串数组
+func (c *CommandLine) UnmarshalJSON(data []byte) error {
+	*c = CommandLine{}
+	data = bytes.TrimSpace(data)
+	switch string(data) {
+	case "null", "":
+		return nil
+	}
+	if data[0] == '[' {
+		return sonic.Unmarshal(data, &c.Args)
+	}
+
+	var s string
+	if err := sonic.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("命令应为字符串或字符串数组: %v", err)
+	}
+	c.Args, c.err = SplitCommand(s)
+	return nil
+}
+
+// String 返回按 shell 规则加引号的命令行，可由 SplitCommand 还原
+func (c CommandLine) String() string {
+	return JoinCommand(c.Args)
+}
+
+// Empty 判断命令行是否没有参数
+func (c CommandLine) Empty() bool {
+	return len(c.Args) == 0
+}
+
+// Err 返回字符串形式的命令拆分失败的原因
+func (c CommandLine) Err() error {
+	return c.err
+}
+
+// SplitCommand 按 POSIX shell 的规则将字符串拆分为参数：空白分隔参数，单引号内的内容原样保留，
+// 双引号内只有 \ 后跟 $ ` " \ 和换行时转义，引号外的 \ 转义下一个字符。
+// 不做任何展开，$ 和 * 等按字面处理；未加引号的管道、重定向和命令分隔符会报错，需要时应显式使用 sh -c
+func SplitCommand(s string) ([]string, error) {
+	args := []string{}
+	var word strings.Builder
+	// inWord 区分空参数 '' 与参数之间的空白
+	inWord := false
+
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\n':
+			if inWord {
+				args = append(args, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case ch == '\\':
+			if i+1 >= len(s) {
+				return nil, errors.New("以未转义的 \\ 结尾")
+			}
+			i++
+			// \ 加换行是续行，两者都被删除
+			if s[i] != '\n' {
+				word.WriteByte(s[i])
+				inWord = true
+			}
+		case ch == '\'':
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end < 0 {
+				return nil, errors.New("单引号未闭合")
+			}
+			word.WriteString(s[i+1 : i+1+end])
+			i += end + 1
+			inWord = true
+		case ch == '"':
+			closed := false
+			for i++; i < len(s); i++ {
+				if s[i] == '"' {
+					closed = true
+					break
+				}
+				if s[i] == '\\' && i+1 < len(s) && strings.IndexByte("$`\"\\\n", s[i+1]) >= 0 {
+					i++
+					if s[i] != '\n' {
+						word.WriteByte(s[i])
+					}
+					continue
+				}
+				word.WriteByte(s[i])
+			}
+			if !closed {
+				return nil, errors.New("双引号未闭合")
+			}
+			inWord = true
+		case strings.IndexByte("|&;<>()`", ch) >= 0:
+			return nil, fmt.Errorf("包含未加引号的 %q，命令不经过 shell 解释，需要时请使用 sh -c '...'", ch)
+		default:
+			word.WriteByte(ch)
+			inWord = true
+		}
+	}
+	if inWord {
+		args = append(args, word.String())
+	}
+	return args, nil
+}
+
+// JoinCommand 将参数拼接为 shell 命令行，需要时用单引号包裹，结果可由 SplitCommand 还原
+func JoinCommand(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = quoteArg(arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// quoteArg 需要时为单个参数加单引号，参数中的单引号先结束引号再转义
+func quoteArg(arg string) string {
+	if shellSafeArg.MatchString(arg) {
+		return arg
+	}
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
+
+// containerArgs 返回容器进程的完整 argv，与 docker 一致为 entrypoint 加 command
+func containerArgs(req CreateContainerRequest) []string {
+	args := make([]string, 0, len(req.Entrypoint.Args)+len(req.Command.Args))
+	args = append(args, req.Entrypoint.Args...)
+	return append(args, req.Command.Args...)
+}
+
+// recordedArgs 还原 zdocker config.json 中以空格拼接的命令，按 shell 规则拆分，无法拆分时退回按空白拆分
+func recordedArgs(command string) []string {
+	if args, err := SplitCommand(command); err == nil {
+		return args
+	}
+	return strings.Fields(command)
+}
+
+// commandPassthrough 判断 argv 能否原样交给 zdocker：zdocker 用空格拼接参数发送给容器 init，
+// init 再按单个空格拆分，包含空白或为空的参数会被拆错
+func commandPassthrough(args []string) bool {
+	for _, arg := range args {
+		if arg == "" || strings.ContainsAny(arg, " \t\n") {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,147 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bytedance/sonic"
+)
+
+func TestSplitCommand(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []string
+		wantErr bool
+	}{
+		{in: "", want: []string{}},
+		{in: "   \t\n", want: []string{}},
+		{in: "sleep 100", want: []string{"sleep", "100"}},
+		{in: "  ls   -l\t/tmp\n", want: []string{"ls", "-l", "/tmp"}},
+		{in: `echo 'hello world'`, want: []string{"echo", "hello world"}},
+		{in: `echo "hello world"`, want: []string{"echo", "hello world"}},
+		{in: `echo ''`, want: []string{"echo", ""}},
+		{in: `echo "" x`, want: []string{"echo", "", "x"}},
+		{in: `echo a'b'"c"`, want: []string{"echo", "abc"}},
+		{in: `echo 'a\nb'`, want: []string{"echo", `a\nb`}},
+		{in: `echo "a\"b\\c\$d\e"`, want: []string{"echo", `a"b\c$d\e`}},
+		{in: `echo a\ b`, want: []string{"echo", "a b"}},
+		{in: "echo a\\\nb", want: []string{"echo", "ab"}},
+		{in: `echo $HOME *`, want: []string{"echo", "$HOME", "*"}},
+		{in: `sh -c 'ls | wc -l'`, want: []string{"sh", "-c", "ls | wc -l"}},
+		{in: `echo 'it'\''s'`, want: []string{"echo", "it's"}},
+		{in: `echo 'open`, wantErr: true},
+		{in: `echo "open`, wantErr: true},
+		{in: `echo \`, wantErr: true},
+		{in: `ls | wc -l`, wantErr: true},
+		{in: `echo hi > out`, wantErr: true},
+		{in: `true && false`, wantErr: true},
+		{in: `echo $(id)`, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := SplitCommand(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("SplitCommand(%q) = %q, want error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("SplitCommand(%q) error: %v", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SplitCommand(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestJoinCommand(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{args: nil, want: ""},
+		{args: []string{"sleep", "100"}, want: "sleep 100"},
+		{args: []string{"ls", "-l", "/tmp/a_b.c", "key=value", "user@host:22"}, want: "ls -l /tmp/a_b.c key=value user@host:22"},
+		{args: []string{"echo", "hello world"}, want: "echo 'hello world'"},
+		{args: []string{"echo", ""}, want: "echo ''"},
+		{args: []string{"echo", "it's"}, want: `echo 'it'\''s'`},
+		{args: []string{"sh", "-c", "ls | wc -l"}, want: "sh -c 'ls | wc -l'"},
+		{args: []string{"echo", "$HOME", "*"}, want: "echo '$HOME' '*'"},
+	}
+	for _, tt := range tests {
+		if got := JoinCommand(tt.args); got != tt.want {
+			t.Errorf("JoinCommand(%q) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestJoinSplitRoundTrip(t *testing.T) {
+	tests := [][]string{
+		{"sleep", "100"},
+		{"echo", "hello world", ""},
+		{"sh", "-c", `echo "$HOME" | tr a-z A-Z; exit 3`},
+		{"printf", `%s\n`, "it's", `back\slash`},
+		{"echo", "tab\there", "new\nline"},
+		{"echo", "(paren)", "<in>", "a&b", "`cmd`"},
+	}
+	for _, args := range tests {
+		got, err := SplitCommand(JoinCommand(args))
+		if err != nil {
+			t.Errorf("SplitCommand(JoinCommand(%q)) error: %v", args, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, args) {
+			t.Errorf("SplitCommand(JoinCommand(%q)) = %q", args, got)
+		}
+	}
+}
+
+func TestCommandLineUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []string
+		wantErr bool
+	}{
+		{in: `null`, want: nil},
+		{in: ` null `, want: nil},
+		{in: `"sleep 100"`, want: []string{"sleep", "100"}},
+		{in: `["sh", "-c", "echo hi"]`, want: []string{"sh", "-c", "echo hi"}},
+		{in: " \n\t[\"echo\", \"a b\"]", want: []string{"echo", "a b"}},
+		{in: ` "echo 'a b'"`, want: []string{"echo", "a b"}},
+		{in: `[]`, want: []string{}},
+	}
+	for _, tt := range tests {
+		var c CommandLine
+		if err := c.UnmarshalJSON([]byte(tt.in)); err != nil {
+			t.Errorf("UnmarshalJSON(%q) error: %v", tt.in, err)
+			continue
+		}
+		if c.Err() != nil {
+			t.Errorf("UnmarshalJSON(%q) split error: %v", tt.in, c.Err())
+			continue
+		}
+		if !reflect.DeepEqual(c.Args, tt.want) {
+			t.Errorf("UnmarshalJSON(%q) = %q, want %q", tt.in, c.Args, tt.want)
+		}
+	}
+
+	var c CommandLine
+	if err := c.UnmarshalJSON([]byte(`"ls | wc -l"`)); err != nil {
+		t.Fatalf("UnmarshalJSON error: %v", err)
+	}
+	if c.Err() == nil {
+		t.Errorf("UnmarshalJSON of a pipeline: want split error, got %q", c.Args)
+	}
+	if err := c.UnmarshalJSON([]byte(`42`)); err == nil {
+		t.Errorf("UnmarshalJSON(42): want error")
+	}
+
+	var req CreateContainerRequest
+	if err := sonic.Unmarshal([]byte(`{"command": ["echo", "hi"], "entrypoint": "/bin/sh -c"}`), &req); err != nil {
+		t.Fatalf("unmarshal request: %v", err)
+	}
+	if want := []string{"/bin/sh", "-c", "echo", "hi"}; !reflect.DeepEqual(containerArgs(req), want) {
+		t.Errorf("containerArgs = %q, want %q", containerArgs(req), want)
+	}
+}
@@ -0,0 +1,202 @@
+package service
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/crazyfrankie/zdocker/container"
+)
+
+// freezeTimeout 等待 cgroup 冻结或解冻完成的最长时间
+const freezeTimeout = 5 * time.Second
+
+// CommitOptions 将容器文件系统提交为镜像的参数
+type CommitOptions struct {
+	// Image 新镜像名称
+	Image string `json:"image" binding:"required"`
+	// Pause 打包期间冻结容器进程，避免写入中的文件被打包成不一致的状态
+	Pause bool `json:"pause"`
+}
+
+// CommitProgress 提交进度，TotalBytes 为开始打包前统计的文件总大小
+type CommitProgress struct {
+	Entries    int64 `json:"entries"`
+	Bytes      int64 `json:"bytes"`
+	TotalBytes int64 `json:"total_bytes"`
+}
+
+// commitContainer 将容器 overlay 合并后的根文件系统打包为新镜像，数据卷不包含在内。
+// zdocker stop 不会卸载 overlay，已停止的容器同样可以提交；progress 在打包协程中调用
+func commitContainer(containerName string, opts CommitOptions, progress func(CommitProgress)) (Image, error) {
+	name, err := lookupContainerName(containerName)
+	if err != nil {
+		return Image{}, err
+	}
+	info, err := readContainerInfo(name)
+	if err != nil {
+		return Image{}, err
+	}
+	if err := validImageName(opts.Image); err != nil {
+		return Image{}, err
+	}
+	if _, err := imageStore.stat(opts.Image); err == nil {
+		return Image{}, fmt.Errorf("%w: %s", ErrImageExists, opts.Image)
+	}
+
+	rootfs := fmt.Sprintf(container.MntUrl, name)
+	if !isMountPoint(rootfs) {
+		return Image{}, fmt.Errorf("容器 %s 的文件系统未挂载", name)
+	}
+
+	if opts.Pause && info.Status == container.RUNNING && isProcessRunning(info.PID) {
+		thaw, err := freezeProcess(info.PID)
+		if err != nil {
+			return Image{}, fmt.Errorf("暂停容器失败: %v", err)
+		}
+		defer thaw()
+	}
+
+	exclude := commitExclude(info.Volume)
+	total := rootfsSize(rootfs, exclude)
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeRootfsArchive(pw, rootfs, archiveOptions{
+			exclude: exclude,
+			progress: func(entries, bytes int64) {
+				if progress != nil {
+					progress(CommitProgress{Entries: entries, Bytes: bytes, TotalBytes: total})
+				}
+			},
+		}))
+	}()
+	image, err := imageStore.Import(opts.Image, pr, "")
+	// 导入提前失败时让打包协程退出
+	pr.Close()
+	if err != nil {
+		return Image{}, fmt.Errorf("提交容器失败: %w", err)
+	}
+	return image, nil
+}
+
+// isMountPoint 判断路径是否为 /proc/mounts 中的挂载点
+func isMountPoint(path string) bool {
+	f, err := os.Open("/proc/mounts")
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	path = filepath.Clean(path)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) > 1 && fields[1] == path {
+			return true
+		}
+	}
+	return false
+}
+
+// internalFiles 服务端写入容器根目录的启动脚本和退出码文件，不属于容器的修改
+var internalFiles = []string{launcherName, exitCodeFileName}
+
+// commitExclude 返回提交镜像时不打包的相对路径：服务端的内部文件，以及数据卷在容器根文件系统中的路径，
+// 数据卷格式与 zdocker -v 一致为 宿主机路径:容器路径
+func commitExclude(volume string) map[string]bool {
+	exclude := make(map[string]bool)
+	for _, name := range internalFiles {
+		exclude[name] = true
+	}
+	parts := strings.Split(volume, ":")
+	if len(parts) == 2 && parts[0] != "" && parts[1] != "" {
+		if rel := strings.TrimPrefix(filepath.Clean("/"+parts[1]), "/"); rel != "" {
+			exclude[rel] = true
+		}
+	}
+	return exclude
+}
+
+// rootfsSize 统计根文件系统中将被打包的普通文件总大小
+func rootfsSize(root string, exclude map[string]bool) int64 {
+	var size int64
+	filepath.WalkDir(root, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if rel, _ := filepath.Rel(root, file); exclude[rel] {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
+
+// freezeProcess 通过 cgroup freezer 冻结进程所在 cgroup 中的所有进程，返回解冻函数。
+// 进程位于根 cgroup 或与本服务相同的 cgroup 时拒绝冻结，否则会冻结整个系统或服务自身
+func freezeProcess(pid string) (func(), error) {
+	paths, err := cgroupPaths(pid)
+	if err != nil {
+		return nil, fmt.Errorf("读取进程 cgroup 失败: %v", err)
+	}
+	self, err := cgroupPaths("self")
+	if err != nil {
+		return nil, fmt.Errorf("读取服务 cgroup 失败: %v", err)
+	}
+	if reflect.DeepEqual(paths, self) {
+		return nil, errors.New("容器与服务位于同一 cgroup，无法暂停")
+	}
+
+	var file, frozen, thawed string
+	var check func() bool
+	if unified, ok := paths[""]; ok && len(paths) == 1 {
+		if unified == "/" {
+			return nil, errors.New("容器位于根 cgroup，无法暂停")
+		}
+		dir := filepath.Join(cgroupRoot, unified)
+		file, frozen, thawed = filepath.Join(dir, "cgroup.freeze"), "1", "0"
+		check = func() bool {
+			return readKeyValues(filepath.Join(dir, "cgroup.events"))["frozen"] == 1
+		}
+	} else {
+		path, ok := paths["freezer"]
+		if !ok || path == "/" {
+			return nil, errors.New("容器没有独立的 freezer cgroup，无法暂停")
+		}
+		file, frozen, thawed = filepath.Join(cgroupRoot, "freezer", path, "freezer.state"), "FROZEN", "THAWED"
+		check = func() bool {
+			data, err := os.ReadFile(file)
+			return err == nil && strings.TrimSpace(string(data)) == frozen
+		}
+	}
+
+	thaw := func() {
+		os.WriteFile(file, []byte(thawed), 0)
+	}
+	if err := os.WriteFile(file, []byte(frozen), 0); err != nil {
+		return nil, err
+	}
+	for deadline := time.Now().Add(freezeTimeout); !check(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			thaw()
+			return nil, errors.New("等待 cgroup 冻结超时")
+		}
+	}
+	return thaw, nil
+}
@@ -0,0 +1,36 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCommitExclude(t *testing.T) {
+	internal := map[string]bool{launcherName: true, exitCodeFileName: true}
+	tests := []struct {
+		volume string
+		extra  []string
+	}{
+		{volume: ""},
+		{volume: "/srv/data:/data", extra: []string{"data"}},
+		{volume: "/srv/data:/var/lib/app/", extra: []string{"var/lib/app"}},
+		{volume: "/srv/data:data/../cache", extra: []string{"cache"}},
+		// 挂载到根目录或格式错误时只排除内部文件
+		{volume: "/srv/data:/"},
+		{volume: "/srv/data"},
+		{volume: ":/data"},
+		{volume: "/a:/b:/c"},
+	}
+	for _, tt := range tests {
+		want := make(map[string]bool)
+		for k := range internal {
+			want[k] = true
+		}
+		for _, rel := range tt.extra {
+			want[rel] = true
+		}
+		if got := commitExclude(tt.volume); !reflect.DeepEqual(got, want) {
+			t.Errorf("commitExclude(%q) = %v, want %v", tt.volume, got, want)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package service
+
+import "errors"
+
+// 运行时返回的类型化错误，调用方通过 errors.Is 判断
+var (
+	ErrContainerNotFound   = errors.New("容器不存在")
+	ErrContainerExists     = errors.New("容器已存在")
+	ErrContainerRunning    = errors.New("容器正在运行")
+	ErrContainerNotRunning = errors.New("容器未运行")
+	ErrNetworkNotFound     = errors.New("网络不存在")
+	ErrNetworkExists       = errors.New("网络已存在")
+	ErrImageNotFound       = errors.New("镜像不存在")
+	ErrImageExists         = errors.New("镜像已存在")
+	ErrImageInUse          = errors.New("镜像正在被使用")
+	ErrFileNotFound        = errors.New("文件不存在")
+	ErrTokenNotFound       = errors.New("令牌不存在")
+	ErrInvalidArgument     = errors.New("参数错误")
+	ErrUnauthenticated     = errors.New("认证失败")
+)
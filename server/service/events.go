@@ -0,0 +1,354 @@
+package service
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/crazyfrankie/zdocker/container"
+)
+
+// 事件类型
+const (
+	EventContainerCreated   = "container.created"
+	EventContainerStarted   = "container.started"
+	EventContainerStopped   = "container.stopped"
+	EventContainerExited    = "container.exited"
+	EventContainerRemoved   = "container.removed"
+	EventContainerRestarted = "container.restarted"
+	EventNetworkCreated     = "network.created"
+	EventNetworkRemoved     = "network.removed"
+	EventImageCreated       = "image.created"
+	EventImageRemoved       = "image.removed"
+)
+
+// 事件发起者
+const (
+	ActorAPI        = "api"
+	ActorReconciler = "reconciler"
+	ActorSupervisor = "supervisor"
+)
+
+const (
+	// defaultEventHistory 内存中保留的历史事件数量，用于 Last-Event-ID 断点续传
+	defaultEventHistory = 1024
+	// subscriberBuffer 订阅者的事件缓冲，消费过慢时丢弃该订阅者
+	subscriberBuffer = 256
+)
+
+// Event 容器、网络或镜像的生命周期事件
+type Event struct {
+	// ID 格式为 <启动标识>-<序号>，序号在每次服务启动后从 1 开始
+	ID            string    `json:"id"`
+	Type          string    `json:"type"`
+	Time          time.Time `json:"time"`
+	Actor         string    `json:"actor"`
+	ContainerID   string    `json:"container_id,omitempty"`
+	ContainerName string    `json:"container_name,omitempty"`
+	Network       string    `json:"network,omitempty"`
+	Image         string    `json:"image,omitempty"`
+	// ExitCode 退出码，仅 exited/restarted 事件且退出码已知时存在
+	ExitCode *int `json:"exit_code,omitempty"`
+	// RestartCount 重启次数，仅 restarted 事件存在
+	RestartCount int `json:"restart_count,omitempty"`
+
+	// seq 本次启动内的序号，用于判断补发哪些历史事件
+	seq uint64
+}
+
+// EventFilter 事件订阅过滤条件，空字段表示不过滤
+type EventFilter struct {
+	// Types 事件类型，支持 container / network / image 前缀匹配一类事件
+	Types []string
+	// Container 容器名称或ID
+	Container string
+}
+
+// Match 判断事件是否满足过滤条件
+func (f EventFilter) Match(e Event) bool {
+	if f.Container != "" && e.ContainerName != f.Container && e.ContainerID != f.Container {
+		return false
+	}
+	if len(f.Types) == 0 {
+		return true
+	}
+	for _, t := range f.Types {
+		if e.Type == t || strings.HasPrefix(e.Type, t+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// EventResync 订阅时无法按 Last-Event-ID 补发历史事件（服务已重启或历史事件已被丢弃），
+// 客户端需要重新加载全部状态
+type EventResync struct {
+	// ID 当前最新的事件ID，客户端之后从这里续传
+	ID   string `json:"id"`
+	Boot string `json:"boot"`
+}
+
+// subscriber 事件订阅者
+type subscriber struct {
+	filter EventFilter
+	ch     chan Event
+}
+
+// EventBus 进程内的事件总线，保存有限的历史事件并分发给订阅者。
+// nil 的 EventBus 可以安全调用 Publish，便于未配置事件的组件复用。
+type EventBus struct {
+	// boot 本次启动的标识，作为事件ID的前缀，使重启前的 Last-Event-ID 不会与新事件混淆
+	boot string
+
+	mu      sync.Mutex
+	nextId  uint64
+	history []Event
+	limit   int
+	subs    map[*subscriber]struct{}
+}
+
+// NewEventBus 创建事件总线，limit 为 0 时使用默认历史长度
+func NewEventBus(limit int) *EventBus {
+	if limit <= 0 {
+		limit = defaultEventHistory
+	}
+	return &EventBus{
+		boot:   strconv.FormatInt(time.Now().UnixNano(), 36),
+		nextId: 1,
+		limit:  limit,
+		subs:   make(map[*subscriber]struct{}),
+	}
+}
+
+// Publish 发布事件，自动填充ID和时间
+func (b *EventBus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	e.seq = b.nextId
+	e.ID = b.eventId(e.seq)
+	b.nextId++
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	b.history = append(b.history, e)
+	if len(b.history) > b.limit {
+		b.history = b.history[len(b.history)-b.limit:]
+	}
+
+	for sub := range b.subs {
+		if !sub.filter.Match(e) {
+			continue
+		}
+		select {
+		case sub.ch <- e:
+		default:
+			// 订阅者消费过慢，关闭通道让其重连并通过 Last-Event-ID 补齐
+			delete(b.subs, sub)
+			close(sub.ch)
+		}
+	}
+}
+
+// eventId 返回序号对应的事件ID
+func (b *EventBus) eventId(seq uint64) string {
+	return b.boot + "-" + strconv.FormatUint(seq, 10)
+}
+
+// Subscribe 订阅事件。lastEventId 不为空时先返回历史中在它之后的事件；
+// lastEventId 不是本次启动的事件，或者之后的事件已不在历史中时，返回 resync 要求客户端重新加载。
+// 返回的通道在取消订阅或订阅者过慢时关闭
+func (b *EventBus) Subscribe(filter EventFilter, lastEventId string) ([]Event, *EventResync, <-chan Event, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var backlog []Event
+	var resync *EventResync
+	if lastEventId != "" {
+		if lastSeq, ok := b.parseEventId(lastEventId); ok && b.covers(lastSeq) {
+			for _, e := range b.history {
+				if e.seq > lastSeq && filter.Match(e) {
+					backlog = append(backlog, e)
+				}
+			}
+		} else {
+			resync = &EventResync{ID: b.eventId(b.nextId - 1), Boot: b.boot}
+		}
+	}
+
+	sub := &subscriber{
+		filter: filter,
+		ch:     make(chan Event, subscriberBuffer),
+	}
+	b.subs[sub] = struct{}{}
+
+	cancel := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subs[sub]; ok {
+			delete(b.subs, sub)
+			close(sub.ch)
+		}
+	}
+	return backlog, resync, sub.ch, cancel
+}
+
+// parseEventId 解析本次启动的事件ID，返回序号
+func (b *EventBus) parseEventId(id string) (uint64, bool) {
+	boot, seq, ok := strings.Cut(id, "-")
+	if !ok || boot != b.boot {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(seq, 10, 64)
+	if err != nil || n >= b.nextId {
+		return 0, false
+	}
+	return n, true
+}
+
+// covers 判断序号之后的事件是否都还在历史中。调用方需持有锁
+func (b *EventBus) covers(seq uint64) bool {
+	return len(b.history) == 0 || b.history[0].seq <= seq+1
+}
+
+// EventRuntime 在 Runtime 之上为接口发起的操作发布事件
+type EventRuntime struct {
+	Runtime
+
+	events *EventBus
+}
+
+// NewEventRuntime 创建发布事件的运行时
+func NewEventRuntime(runtime Runtime, events *EventBus) *EventRuntime {
+	return &EventRuntime{
+		Runtime: runtime,
+		events:  events,
+	}
+}
+
+// publishContainer 发布容器事件
+func (r *EventRuntime) publishContainer(eventType string, c Container) {
+	r.events.Publish(Event{
+		Type:          eventType,
+		Actor:         ActorAPI,
+		ContainerID:   c.ID,
+		ContainerName: c.Name,
+	})
+}
+
+// CreateContainer 创建容器
+func (r *EventRuntime) CreateContainer(req CreateContainerRequest) (Container, error) {
+	c, err := r.Runtime.CreateContainer(req)
+	if err != nil {
+		return Container{}, err
+	}
+	r.publishContainer(EventContainerCreated, c)
+	if c.Status == container.RUNNING {
+		r.publishContainer(EventContainerStarted, c)
+	}
+	return c, nil
+}
+
+// StartContainer 启动容器
+func (r *EventRuntime) StartContainer(containerName string) error {
+	c, err := r.Runtime.GetContainer(containerName)
+	if err != nil {
+		return err
+	}
+	if err := r.Runtime.StartContainer(c.Name); err != nil {
+		return err
+	}
+	r.publishContainer(EventContainerStarted, c)
+	return nil
+}
+
+// StopContainer 停止容器
+func (r *EventRuntime) StopContainer(containerName string) error {
+	c, err := r.Runtime.GetContainer(containerName)
+	if err != nil {
+		return err
+	}
+	if err := r.Runtime.StopContainer(c.Name); err != nil {
+		return err
+	}
+	r.publishContainer(EventContainerStopped, c)
+	return nil
+}
+
+// RemoveContainer 删除容器
+func (r *EventRuntime) RemoveContainer(containerName string) error {
+	c, err := r.Runtime.GetContainer(containerName)
+	if err != nil {
+		return err
+	}
+	if err := r.Runtime.RemoveContainer(c.Name); err != nil {
+		return err
+	}
+	r.publishContainer(EventContainerRemoved, c)
+	return nil
+}
+
+// CreateNetwork 创建网络
+func (r *EventRuntime) CreateNetwork(req CreateNetworkRequest) (NetworkInfo, error) {
+	n, err := r.Runtime.CreateNetwork(req)
+	if err != nil {
+		return NetworkInfo{}, err
+	}
+	r.events.Publish(Event{Type: EventNetworkCreated, Actor: ActorAPI, Network: n.Name})
+	return n, nil
+}
+
+// RemoveNetwork 删除网络
+func (r *EventRuntime) RemoveNetwork(networkName string) error {
+	if err := r.Runtime.RemoveNetwork(networkName); err != nil {
+		return err
+	}
+	r.events.Publish(Event{Type: EventNetworkRemoved, Actor: ActorAPI, Network: networkName})
+	return nil
+}
+
+// CommitContainer 将容器提交为新镜像
+func (r *EventRuntime) CommitContainer(containerName string, opts CommitOptions, progress func(CommitProgress)) (Image, error) {
+	c, err := r.Runtime.GetContainer(containerName)
+	if err != nil {
+		return Image{}, err
+	}
+	image, err := r.Runtime.CommitContainer(c.Name, opts, progress)
+	if err != nil {
+		return Image{}, err
+	}
+	r.events.Publish(Event{
+		Type:          EventImageCreated,
+		Actor:         ActorAPI,
+		ContainerID:   c.ID,
+		ContainerName: c.Name,
+		Image:         image.Name,
+	})
+	return image, nil
+}
+
+// ImportImage 导入镜像
+func (r *EventRuntime) ImportImage(imageName string, reader io.Reader, checksum string) (Image, error) {
+	image, err := r.Runtime.ImportImage(imageName, reader, checksum)
+	if err != nil {
+		return Image{}, err
+	}
+	r.events.Publish(Event{Type: EventImageCreated, Actor: ActorAPI, Image: image.Name})
+	return image, nil
+}
+
+// RemoveImage 删除镜像
+func (r *EventRuntime) RemoveImage(imageName string, force bool) error {
+	if err := r.Runtime.RemoveImage(imageName, force); err != nil {
+		return err
+	}
+	r.events.Publish(Event{Type: EventImageRemoved, Actor: ActorAPI, Image: imageName})
+	return nil
+}
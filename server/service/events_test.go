@@ -0,0 +1,127 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+)
+
+// eventTypes 返回事件的类型列表
+func eventTypes(events []Event) []string {
+	var types []string
+	for _, e := range events {
+		types = append(types, e.Type)
+	}
+	return types
+}
+
+func TestEventFilterMatch(t *testing.T) {
+	e := Event{Type: EventContainerStarted, ContainerID: "1234", ContainerName: "web"}
+
+	tests := []struct {
+		name   string
+		filter EventFilter
+		want   bool
+	}{
+		{name: "empty", filter: EventFilter{}, want: true},
+		{name: "exact type", filter: EventFilter{Types: []string{EventContainerStarted}}, want: true},
+		{name: "type prefix", filter: EventFilter{Types: []string{"container"}}, want: true},
+		{name: "partial prefix", filter: EventFilter{Types: []string{"contain"}}},
+		{name: "other type", filter: EventFilter{Types: []string{"network", EventContainerStopped}}},
+		{name: "any of types", filter: EventFilter{Types: []string{"network", "container"}}, want: true},
+		{name: "container name", filter: EventFilter{Container: "web"}, want: true},
+		{name: "container id", filter: EventFilter{Container: "1234"}, want: true},
+		{name: "other container", filter: EventFilter{Container: "db"}},
+		{name: "type and other container", filter: EventFilter{Types: []string{"container"}, Container: "db"}},
+	}
+	for _, tt := range tests {
+		if got := tt.filter.Match(e); got != tt.want {
+			t.Errorf("%s: Match = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEventBusSubscribeBacklog(t *testing.T) {
+	b := NewEventBus(3)
+	for _, typ := range []string{EventContainerCreated, EventNetworkCreated, EventContainerStarted, EventContainerStopped} {
+		b.Publish(Event{Type: typ})
+	}
+	// 历史只保留最后 3 个事件，序号为 2-4
+	other := NewEventBus(0)
+
+	tests := []struct {
+		name        string
+		lastEventId string
+		filter      EventFilter
+		want        []string
+		wantResync  bool
+	}{
+		{name: "no last event id"},
+		{name: "after first kept event", lastEventId: b.eventId(2), want: []string{EventContainerStarted, EventContainerStopped}},
+		{name: "before first kept event", lastEventId: b.eventId(1), want: []string{EventNetworkCreated, EventContainerStarted, EventContainerStopped}},
+		{name: "filtered", lastEventId: b.eventId(1), filter: EventFilter{Types: []string{"container"}}, want: []string{EventContainerStarted, EventContainerStopped}},
+		{name: "latest", lastEventId: b.eventId(4)},
+		{name: "dropped from history", lastEventId: b.eventId(0), wantResync: true},
+		{name: "future", lastEventId: b.eventId(5), wantResync: true},
+		{name: "previous boot", lastEventId: other.eventId(2), wantResync: true},
+		{name: "malformed", lastEventId: "invalid", wantResync: true},
+		{name: "malformed sequence", lastEventId: b.boot + "-x", wantResync: true},
+	}
+	for _, tt := range tests {
+		backlog, resync, _, cancel := b.Subscribe(tt.filter, tt.lastEventId)
+		cancel()
+		if got := eventTypes(backlog); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: backlog = %v, want %v", tt.name, got, tt.want)
+		}
+		if tt.wantResync {
+			if resync == nil || resync.ID != b.eventId(4) || resync.Boot != b.boot {
+				t.Errorf("%s: resync = %+v, want latest event %s", tt.name, resync, b.eventId(4))
+			}
+		} else if resync != nil {
+			t.Errorf("%s: unexpected resync %+v", tt.name, resync)
+		}
+	}
+}
+
+func TestEventBusPublish(t *testing.T) {
+	b := NewEventBus(0)
+	_, _, all, cancelAll := b.Subscribe(EventFilter{}, "")
+	defer cancelAll()
+	_, _, web, cancelWeb := b.Subscribe(EventFilter{Container: "web"}, "")
+
+	b.Publish(Event{Type: EventContainerStarted, ContainerName: "db"})
+	b.Publish(Event{Type: EventContainerStarted, ContainerName: "web"})
+
+	for _, want := range []string{"db", "web"} {
+		e := <-all
+		if e.ContainerName != want || e.ID == "" || e.Time.IsZero() {
+			t.Errorf("all subscriber got %+v, want %s", e, want)
+		}
+	}
+	if e := <-web; e.ContainerName != "web" {
+		t.Errorf("web subscriber got %+v", e)
+	}
+
+	// 取消订阅后通道关闭，重复取消不会 panic
+	cancelWeb()
+	cancelWeb()
+	if _, ok := <-web; ok {
+		t.Error("channel still open after cancel")
+	}
+
+	// 消费过慢的订阅者被关闭
+	for i := 0; i <= subscriberBuffer; i++ {
+		b.Publish(Event{Type: EventContainerStarted})
+	}
+	n := 0
+	for range all {
+		n++
+	}
+	if n != subscriberBuffer {
+		t.Errorf("slow subscriber received %d events before close, want %d", n, subscriberBuffer)
+	}
+	cancelAll()
+
+	// nil 的事件总线可以安全发布
+	var nilBus *EventBus
+	nilBus.Publish(Event{Type: EventContainerStarted})
+}
@@ -0,0 +1,179 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/creack/pty"
+
+	"github.com/crazyfrankie/zdocker/container"
+)
+
+const (
+	// execStatusFd 子进程中用于回传退出码的文件描述符，对应 ExtraFiles[0]
+	execStatusFd = 3
+	// execStatusTimeout 进程结束后等待退出码的最长时间
+	execStatusTimeout = time.Second
+)
+
+// ExecProcess 在容器命名空间中运行的进程。
+// zdocker 的 nsenter 通过 system() 执行命令后固定以 0 退出，
+// 因此命令结束后由 shell 把退出码写入 execStatusFd，再由 Wait 读取
+type ExecProcess struct {
+	cmd     *exec.Cmd
+	status  *os.File
+	statusW *os.File
+	pty     *os.File
+
+	// mu 保护 exited，进程被回收后不再发送信号，避免进程组ID被复用时误杀
+	mu     sync.Mutex
+	exited bool
+}
+
+// newExecProcess 构造进入容器 pid 的命名空间执行 command 的进程。nsenter 把命令交给 sh -c 执行，
+// 因此参数先按 shell 规则加引号再拼接，含空格或特殊字符的参数原样传给命令
+func newExecProcess(pid string, command []string) (*ExecProcess, error) {
+	if len(command) == 0 {
+		return nil, fmt.Errorf("%w: 命令不能为空", ErrInvalidArgument)
+	}
+
+	status, statusW, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("创建管道失败: %v", err)
+	}
+
+	// 不继承服务端的环境变量，使用最小环境加上容器进程的环境变量
+	cmd := exec.Command("/proc/self/exe", "exec")
+	cmd.Env = minimalEnv()
+	if environ, err := os.ReadFile(fmt.Sprintf("/proc/%s/environ", pid)); err == nil {
+		for _, env := range strings.Split(string(environ), "\x00") {
+			if env != "" {
+				cmd.Env = append(cmd.Env, env)
+			}
+		}
+	}
+	cmd.Env = append(cmd.Env,
+		envExecPID+"="+pid,
+		envExecCMD+"="+JoinCommand(command)+"; echo $? >&"+strconv.Itoa(execStatusFd),
+	)
+	cmd.ExtraFiles = []*os.File{statusW}
+
+	return &ExecProcess{
+		cmd:     cmd,
+		status:  status,
+		statusW: statusW,
+	}, nil
+}
+
+// execInContainer 检查容器正在运行后构造执行进程
+func execInContainer(containerName string, command []string) (*ExecProcess, error) {
+	name, err := lookupContainerName(containerName)
+	if err != nil {
+		return nil, err
+	}
+	info, err := readContainerInfo(name)
+	if err != nil {
+		return nil, err
+	}
+	if info.Status != container.RUNNING || !isProcessRunning(info.PID) {
+		return nil, fmt.Errorf("%w: %s", ErrContainerNotRunning, name)
+	}
+	return newExecProcess(info.PID, command)
+}
+
+// CombinedOutput 运行进程并返回标准输出和标准错误
+func (p *ExecProcess) CombinedOutput() (ExecResult, error) {
+	output, err := p.cmd.CombinedOutput()
+	p.statusW.Close()
+	code, waitErr := p.exitCode(err)
+	if waitErr != nil {
+		return ExecResult{}, fmt.Errorf("执行命令失败: %v", waitErr)
+	}
+	return ExecResult{
+		Output:   string(output),
+		ExitCode: code,
+	}, nil
+}
+
+// StartPTY 在伪终端中启动进程，返回伪终端主设备，读写即为进程的输出和输入
+func (p *ExecProcess) StartPTY(rows, cols uint16) (*os.File, error) {
+	ptmx, err := pty.StartWithSize(p.cmd, &pty.Winsize{Rows: rows, Cols: cols})
+	p.statusW.Close()
+	if err != nil {
+		p.status.Close()
+		return nil, fmt.Errorf("启动终端失败: %v", err)
+	}
+	p.pty = ptmx
+	return ptmx, nil
+}
+
+// Resize 调整伪终端窗口大小
+func (p *ExecProcess) Resize(rows, cols uint16) error {
+	if p.pty == nil {
+		return errors.New("进程未在终端中运行")
+	}
+	return pty.Setsize(p.pty, &pty.Winsize{Rows: rows, Cols: cols})
+}
+
+// Kill 结束进程所在的整个进程组
+func (p *ExecProcess) Kill() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.cmd.Process == nil || p.exited {
+		return
+	}
+	// StartPTY 使用 setsid 启动，进程组ID即进程ID
+	syscall.Kill(-p.cmd.Process.Pid, syscall.SIGKILL)
+}
+
+// Wait 等待进程结束并返回命令的退出码
+func (p *ExecProcess) Wait() (int, error) {
+	err := p.cmd.Wait()
+	p.mu.Lock()
+	p.exited = true
+	p.mu.Unlock()
+	if p.pty != nil {
+		p.pty.Close()
+	}
+	return p.exitCode(err)
+}
+
+// exitCode 读取 shell 回传的退出码，没有回传时使用进程本身的退出状态
+func (p *ExecProcess) exitCode(waitErr error) (int, error) {
+	defer p.status.Close()
+
+	// 命令在后台启动的进程也会继承写端，不能等到 EOF，读到换行或超时即止
+	p.status.SetReadDeadline(time.Now().Add(execStatusTimeout))
+	var data []byte
+	buf := make([]byte, 16)
+	for !bytes.Contains(data, []byte("\n")) {
+		n, err := p.status.Read(buf)
+		data = append(data, buf[:n]...)
+		if err != nil {
+			break
+		}
+	}
+	if code, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil {
+		return code, nil
+	}
+
+	if waitErr == nil {
+		return 0, nil
+	}
+	var exitError *exec.ExitError
+	if errors.As(waitErr, &exitError) {
+		if ws, ok := exitError.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+			return 128 + int(ws.Signal()), nil
+		}
+		return exitError.ExitCode(), nil
+	}
+	return 0, waitErr
+}
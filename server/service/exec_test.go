@@ -0,0 +1,163 @@
+package service
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// shellProcess 构造执行 command 的进程，并把 nsenter 替换为直接用 sh -c 执行 zdocker_cmd，
+// 与 nsenter 在容器中调用 system() 的行为一致
+func shellProcess(t *testing.T, command []string) *ExecProcess {
+	t.Helper()
+	p, err := newExecProcess(strconv.Itoa(os.Getpid()), command)
+	if err != nil {
+		t.Fatal(err)
+	}
+	script, ok := lookupEnv(p.cmd.Env, envExecCMD)
+	if !ok {
+		t.Fatalf("env %v has no %s", p.cmd.Env, envExecCMD)
+	}
+	cmd := exec.Command("/bin/sh", "-c", script)
+	cmd.Env = minimalEnv()
+	cmd.ExtraFiles = p.cmd.ExtraFiles
+	p.cmd = cmd
+	return p
+}
+
+// lookupEnv 返回环境变量列表中最后一个 key 的值
+func lookupEnv(env []string, key string) (string, bool) {
+	value, found := "", false
+	for _, kv := range env {
+		if k, v, ok := strings.Cut(kv, "="); ok && k == key {
+			value, found = v, true
+		}
+	}
+	return value, found
+}
+
+func TestNewExecProcessEnv(t *testing.T) {
+	t.Setenv("ZDOCKER_ADMIN_PASSWORD", "secret")
+	// 模拟容器进程，环境变量中包含与服务端同名的变量
+	target := exec.Command("sleep", "10")
+	target.Env = []string{"APP=x", "PATH=/app/bin", "zdocker_cmd=rm -rf /"}
+	if err := target.Start(); err != nil {
+		t.Skipf("start sleep: %v", err)
+	}
+	defer func() {
+		target.Process.Kill()
+		target.Wait()
+	}()
+
+	pid := strconv.Itoa(target.Process.Pid)
+	p, err := newExecProcess(pid, []string{"echo", "a b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.status.Close()
+	defer p.statusW.Close()
+
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{key: "APP", want: "x"},
+		{key: "PATH", want: "/app/bin"},
+		{key: "HOME", want: "/root"},
+		{key: envExecPID, want: pid},
+		{key: envExecCMD, want: "echo 'a b'; echo $? >&3"},
+	}
+	for _, tt := range tests {
+		if got, ok := lookupEnv(p.cmd.Env, tt.key); !ok || got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+	if _, ok := lookupEnv(p.cmd.Env, "ZDOCKER_ADMIN_PASSWORD"); ok {
+		t.Error("exec process inherits ZDOCKER_ADMIN_PASSWORD")
+	}
+
+	if _, err := newExecProcess(pid, nil); err == nil {
+		t.Error("newExecProcess with empty command: want error")
+	}
+}
+
+func TestExecProcessCombinedOutput(t *testing.T) {
+	tests := []struct {
+		name       string
+		command    []string
+		wantOutput string
+		wantCode   int
+	}{
+		{name: "success", command: []string{"echo", "hello"}, wantOutput: "hello\n"},
+		{name: "arguments with spaces", command: []string{"printf", "%s|", "a b", "c"}, wantOutput: "a b|c|"},
+		{name: "shell characters", command: []string{"echo", "$HOME", "`id`", "a;b", "'q'"}, wantOutput: "$HOME `id` a;b 'q'\n"},
+		{name: "exit code", command: []string{"sh", "-c", "echo out; echo err >&2; exit 3"}, wantOutput: "out\nerr\n", wantCode: 3},
+		{name: "command not found", command: []string{"zdocker-no-such-command"}, wantCode: 127},
+		// 后台进程继承了退出码的写端，不能阻塞到它结束
+		{name: "background process", command: []string{"sh", "-c", "sleep 5 >/dev/null 2>&1 & exit 4"}, wantCode: 4},
+	}
+	for _, tt := range tests {
+		start := time.Now()
+		result, err := shellProcess(t, tt.command).CombinedOutput()
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if result.ExitCode != tt.wantCode {
+			t.Errorf("%s: exit code = %d, want %d", tt.name, result.ExitCode, tt.wantCode)
+		}
+		if tt.wantCode != 127 && result.Output != tt.wantOutput {
+			t.Errorf("%s: output = %q, want %q", tt.name, result.Output, tt.wantOutput)
+		}
+		if elapsed := time.Since(start); elapsed > 3*time.Second {
+			t.Errorf("%s: took %v", tt.name, elapsed)
+		}
+	}
+}
+
+func TestExecProcessPTY(t *testing.T) {
+	p := shellProcess(t, []string{"sh", "-c", "stty size; read line; echo got $line; exit 5"})
+	ptmx, err := p.StartPTY(30, 100)
+	if err != nil {
+		t.Skipf("start pty: %v", err)
+	}
+	if _, err := ptmx.Write([]byte("hello\n")); err != nil {
+		t.Fatal(err)
+	}
+	output, _ := io.ReadAll(ptmx)
+	for _, want := range []string{"30 100", "got hello"} {
+		if !strings.Contains(string(output), want) {
+			t.Errorf("output %q does not contain %q", output, want)
+		}
+	}
+	if code, err := p.Wait(); err != nil || code != 5 {
+		t.Errorf("Wait = %d, %v, want 5", code, err)
+	}
+	// 进程结束后 Kill 不再发送信号
+	p.Kill()
+
+	notStarted := shellProcess(t, []string{"true"})
+	defer notStarted.status.Close()
+	defer notStarted.statusW.Close()
+	if err := notStarted.Resize(10, 10); err == nil {
+		t.Error("Resize without pty: want error")
+	}
+}
+
+func TestExecProcessKill(t *testing.T) {
+	p := shellProcess(t, []string{"sleep", "100"})
+	if _, err := p.StartPTY(24, 80); err != nil {
+		t.Skipf("start pty: %v", err)
+	}
+	if err := p.Resize(40, 120); err != nil {
+		t.Errorf("Resize: %v", err)
+	}
+	p.Kill()
+	if code, err := p.Wait(); err != nil || code != 128+9 {
+		t.Errorf("Wait after Kill = %d, %v, want %d", code, err, 128+9)
+	}
+}
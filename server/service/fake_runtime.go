@@ -0,0 +1,573 @@
+package service
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/crazyfrankie/zdocker/container"
+)
+
+// FakeRuntime 容器状态保存在内存、日志写入临时目录的运行时，不依赖 zdocker 和 root 权限，用于测试和前端开发
+type FakeRuntime struct {
+	mu         sync.Mutex
+	nextId     int
+	containers map[string]*Container
+	networks   map[string]NetworkInfo
+	images     map[string]Image
+	// requests 创建容器时的参数，用于返回完整信息
+	requests map[string]CreateContainerRequest
+	// logDir 日志文件目录，首次创建容器时在临时目录下创建
+	logDir string
+}
+
+// NewFakeRuntime 创建内存运行时
+func NewFakeRuntime() *FakeRuntime {
+	return &FakeRuntime{
+		nextId:     1000000000,
+		containers: make(map[string]*Container),
+		requests:   make(map[string]CreateContainerRequest),
+		networks:   make(map[string]NetworkInfo),
+		images: map[string]Image{
+			"busybox": {Name: "busybox", Size: 4 << 20, TarSize: 4 << 20, ModTime: time.Now()},
+		},
+	}
+}
+
+// find 根据ID或名称查找容器，调用方需持有锁
+func (r *FakeRuntime) find(containerId string) (*Container, error) {
+	if c, ok := r.containers[containerId]; ok {
+		return c, nil
+	}
+	for _, c := range r.containers {
+		if c.ID == containerId {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrContainerNotFound, containerId)
+}
+
+// ListContainers 获取容器列表
+func (r *FakeRuntime) ListContainers() ([]Container, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	containers := make([]Container, 0, len(r.containers))
+	for _, c := range r.containers {
+		containers = append(containers, *c)
+	}
+	return containers, nil
+}
+
+// GetContainer 根据ID或名称获取容器信息
+func (r *FakeRuntime) GetContainer(containerId string) (Container, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, err := r.find(containerId)
+	if err != nil {
+		return Container{}, err
+	}
+	return *c, nil
+}
+
+// InspectContainer 根据内存中的容器和创建参数构造完整信息，没有命名空间和 IP 地址
+func (r *FakeRuntime) InspectContainer(containerId string) (ContainerInspect, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, err := r.find(containerId)
+	if err != nil {
+		return ContainerInspect{}, err
+	}
+	req := r.requests[c.Name]
+
+	inspect := ContainerInspect{
+		ID:         c.ID,
+		Name:       c.Name,
+		Image:      c.Image,
+		Status:     c.Status,
+		Running:    c.Status == container.RUNNING,
+		Args:       containerArgs(req),
+		Env:        environmentList(req.Environment),
+		Resources:  resourcesFromConfig(req),
+		Rootfs:     ContainerRootfs{Merged: r.rootfsPath(c.Name), Mounted: true},
+		Mounts:     []Mount{},
+		Ports:      []PortBinding{},
+		Namespaces: map[string]uint64{},
+	}
+	if created, err := time.ParseInLocation(time.DateTime, c.CreatedTime, time.Local); err == nil {
+		inspect.Created = created
+		if inspect.Running {
+			inspect.StartedAt = &created
+			inspect.UptimeSeconds = int64(time.Since(created).Seconds())
+		}
+	}
+	if inspect.Running {
+		inspect.PID, _ = strconv.Atoi(c.Pid)
+	}
+	if parts := strings.Split(c.Volume, ":"); len(parts) == 2 && parts[0] != "" && parts[1] != "" {
+		inspect.Mounts = append(inspect.Mounts, Mount{Type: "bind", Source: parts[0], Destination: path.Clean("/" + parts[1])})
+	}
+	for _, mapping := range req.PortMapping {
+		if port, err := ParsePortBinding(mapping); err == nil {
+			inspect.Ports = append(inspect.Ports, port)
+		}
+	}
+	if req.Network != "" {
+		inspect.Network = &ContainerNetwork{Name: req.Network, IPAddresses: []string{}}
+	}
+	inspect.maskSecrets()
+	return inspect, nil
+}
+
+// CreateContainer 创建容器
+func (r *FakeRuntime) CreateContainer(req CreateContainerRequest) (Container, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextId++
+	id := strconv.Itoa(r.nextId)
+	name := req.Name
+	if name == "" {
+		name = id
+	}
+	if _, ok := r.containers[name]; ok {
+		return Container{}, fmt.Errorf("%w: %s", ErrContainerExists, name)
+	}
+	if req.Network != "" {
+		if _, ok := r.networks[req.Network]; !ok {
+			return Container{}, fmt.Errorf("%w: %s", ErrNetworkNotFound, req.Network)
+		}
+	}
+	if r.logDir == "" {
+		dir, err := os.MkdirTemp("", "zdocker-fake-")
+		if err != nil {
+			return Container{}, fmt.Errorf("创建日志目录失败: %v", err)
+		}
+		r.logDir = dir
+	}
+	if err := os.WriteFile(r.logPath(name), nil, configFilePerm); err != nil {
+		return Container{}, fmt.Errorf("创建日志文件失败: %v", err)
+	}
+	if err := r.createRootfs(name); err != nil {
+		return Container{}, fmt.Errorf("创建根文件系统失败: %v", err)
+	}
+
+	c := &Container{
+		ID:          id,
+		Name:        name,
+		Image:       req.Image,
+		Command:     JoinCommand(containerArgs(req)),
+		Status:      container.RUNNING,
+		CreatedTime: time.Now().Format(time.DateTime),
+		Pid:         id,
+		Volume:      req.Volume,
+		PortMapping: strings.Join(req.PortMapping, ","),
+		Labels:      req.Labels,
+	}
+	r.containers[name] = c
+	r.requests[name] = req
+
+	return *c, nil
+}
+
+// StartContainer 启动容器
+func (r *FakeRuntime) StartContainer(containerName string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, err := r.find(containerName)
+	if err != nil {
+		return err
+	}
+	if c.Status == container.RUNNING {
+		return fmt.Errorf("%w: %s", ErrContainerRunning, containerName)
+	}
+	c.Status = container.RUNNING
+	c.Pid = c.ID
+	return nil
+}
+
+// StopContainer 停止容器
+func (r *FakeRuntime) StopContainer(containerName string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, err := r.find(containerName)
+	if err != nil {
+		return err
+	}
+	c.Status = container.STOP
+	c.Pid = ""
+	return nil
+}
+
+// RemoveContainer 删除容器
+func (r *FakeRuntime) RemoveContainer(containerName string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, err := r.find(containerName)
+	if err != nil {
+		return err
+	}
+	if c.Status == container.RUNNING {
+		return fmt.Errorf("%w: 不能删除正在运行的容器", ErrContainerRunning)
+	}
+	delete(r.containers, c.Name)
+	delete(r.requests, c.Name)
+	os.Remove(r.logPath(c.Name))
+	os.Remove(r.logPath(c.Name) + logIndexSuffix)
+	os.RemoveAll(r.rootfsPath(c.Name))
+	return nil
+}
+
+// logPath 返回容器日志文件路径
+func (r *FakeRuntime) logPath(containerName string) string {
+	return filepath.Join(r.logDir, containerName+".log")
+}
+
+// ContainerLogs 获取容器日志
+func (r *FakeRuntime) ContainerLogs(containerName string) (string, error) {
+	path, err := r.ContainerLogFile(containerName)
+	if err != nil {
+		return "", err
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("读取日志文件失败: %v", err)
+	}
+	return string(content), nil
+}
+
+// ContainerLogFile 获取容器日志文件路径
+func (r *FakeRuntime) ContainerLogFile(containerName string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, err := r.find(containerName)
+	if err != nil {
+		return "", err
+	}
+	return r.logPath(c.Name), nil
+}
+
+// ExecContainer 在容器中执行命令，只记录命令并原样回显
+func (r *FakeRuntime) ExecContainer(containerName string, command []string) (ExecResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, err := r.find(containerName)
+	if err != nil {
+		return ExecResult{}, err
+	}
+	if c.Status != container.RUNNING {
+		return ExecResult{}, fmt.Errorf("%w: %s", ErrContainerNotRunning, containerName)
+	}
+
+	output := strings.Join(command, " ") + "\n"
+	f, err := os.OpenFile(r.logPath(c.Name), os.O_WRONLY|os.O_APPEND|os.O_CREATE, configFilePerm)
+	if err != nil {
+		return ExecResult{}, fmt.Errorf("写入日志文件失败: %v", err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(output); err != nil {
+		return ExecResult{}, fmt.Errorf("写入日志文件失败: %v", err)
+	}
+	return ExecResult{Output: output}, nil
+}
+
+// ExecInteractive fake 运行时没有真实容器，不支持交互式执行
+func (r *FakeRuntime) ExecInteractive(containerName string, command []string) (*ExecProcess, error) {
+	return nil, fmt.Errorf("%w: fake 运行时不支持交互式执行", ErrInvalidArgument)
+}
+
+// ContainerStats 按容器运行时间生成模拟的资源使用情况
+func (r *FakeRuntime) ContainerStats(containerName string) (ContainerStats, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, err := r.find(containerName)
+	if err != nil {
+		return ContainerStats{}, err
+	}
+	if c.Status != container.RUNNING {
+		return ContainerStats{}, fmt.Errorf("%w: %s", ErrContainerNotRunning, containerName)
+	}
+
+	now := time.Now()
+	created, _ := time.ParseInLocation(time.DateTime, c.CreatedTime, time.Local)
+	uptime := uint64(now.Sub(created))
+	// 不同容器使用不同的负载，便于前端展示排序
+	seed, _ := strconv.ParseUint(c.ID, 10, 64)
+	load := seed%5 + 1
+
+	return ContainerStats{
+		ID:            c.ID,
+		Name:          c.Name,
+		Read:          now,
+		CgroupVersion: 2,
+		CPU: CPUStats{
+			UsageNanos:  uptime / 20 * load,
+			UserNanos:   uptime / 30 * load,
+			SystemNanos: uptime / 60 * load,
+			OnlineCPUs:  1,
+		},
+		Memory: MemoryStats{
+			Usage:    load * 16 << 20,
+			RawUsage: load * 20 << 20,
+			Cache:    load * 4 << 20,
+			Limit:    1 << 30,
+			Percent:  float64(load*16<<20) / float64(1<<30) * 100,
+		},
+		Pids: PidsStats{Current: load},
+		Networks: map[string]NetworkStats{
+			"eth0": {RxBytes: uptime / 1e6 * load, TxBytes: uptime / 2e6 * load},
+		},
+	}, nil
+}
+
+// ContainerChanges 返回固定的示例变化
+func (r *FakeRuntime) ContainerChanges(containerName string, opts ChangesOptions) (ContainerChanges, error) {
+	r.mu.Lock()
+	_, err := r.find(containerName)
+	r.mu.Unlock()
+	if err != nil {
+		return ContainerChanges{}, err
+	}
+
+	prefix := path.Clean("/" + opts.Prefix)
+	result := ContainerChanges{Changes: []FileChange{}}
+	for _, change := range []FileChange{
+		{Path: "/etc", Kind: ChangeModified, IsDir: true},
+		{Path: "/etc/hostname", Kind: ChangeModified, Size: 13},
+		{Path: "/root/.ash_history", Kind: ChangeAdded, Size: 42},
+		{Path: "/tmp/app.log", Kind: ChangeAdded, Size: 1024},
+		{Path: "/usr/share/doc", Kind: ChangeDeleted, IsDir: true, Size: 4096},
+	} {
+		if hasPathPrefix(change.Path, prefix) {
+			result.add(change, -1)
+		}
+	}
+	return result, nil
+}
+
+// CommitContainer 只记录新镜像，大小与容器的镜像相同
+func (r *FakeRuntime) CommitContainer(containerName string, opts CommitOptions, progress func(CommitProgress)) (Image, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, err := r.find(containerName)
+	if err != nil {
+		return Image{}, err
+	}
+	if err := validImageName(opts.Image); err != nil {
+		return Image{}, err
+	}
+	if _, ok := r.images[opts.Image]; ok {
+		return Image{}, fmt.Errorf("%w: %s", ErrImageExists, opts.Image)
+	}
+
+	size := r.images[c.Image].Size
+	if progress != nil {
+		progress(CommitProgress{Entries: 1, Bytes: size, TotalBytes: size})
+	}
+	image := Image{Name: opts.Image, Size: size, TarSize: size, ModTime: time.Now()}
+	r.images[opts.Image] = image
+	return r.image(image), nil
+}
+
+// ContainerFS 返回临时目录中的示例根文件系统
+func (r *FakeRuntime) ContainerFS(containerName string) (*ContainerFS, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, err := r.find(containerName)
+	if err != nil {
+		return nil, err
+	}
+	return NewContainerFS(r.rootfsPath(c.Name)), nil
+}
+
+// rootfsPath 返回容器示例根文件系统的目录
+func (r *FakeRuntime) rootfsPath(containerName string) string {
+	return filepath.Join(r.logDir, containerName+".rootfs")
+}
+
+// createRootfs 创建包含少量示例文件的根文件系统
+func (r *FakeRuntime) createRootfs(containerName string) error {
+	root := r.rootfsPath(containerName)
+	for _, dir := range []string{"bin", "etc", "root", "tmp"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			return err
+		}
+	}
+	files := map[string]string{
+		"bin/busybox":  "",
+		"etc/hostname": containerName + "\n",
+		"etc/passwd":   "root:x:0:0:root:/root:/bin/sh\nnobody:x:65534:65534:nobody:/:/bin/false\n",
+		"etc/group":    "root:x:0:\nnogroup:x:65534:\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0644); err != nil {
+			return err
+		}
+	}
+	return os.Symlink("/bin/busybox", filepath.Join(root, "bin/sh"))
+}
+
+// image 返回填充了使用者的镜像信息，调用方需持有锁
+func (r *FakeRuntime) image(image Image) Image {
+	image.Containers = []string{}
+	for _, c := range r.containers {
+		if c.Image == image.Name {
+			image.Containers = append(image.Containers, c.Name)
+		}
+	}
+	sort.Strings(image.Containers)
+	return image
+}
+
+// ListImages 获取镜像列表
+func (r *FakeRuntime) ListImages() ([]Image, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	images := make([]Image, 0, len(r.images))
+	for _, image := range r.images {
+		images = append(images, r.image(image))
+	}
+	sort.Slice(images, func(i, j int) bool { return images[i].Name < images[j].Name })
+	return images, nil
+}
+
+// GetImage 获取镜像详情
+func (r *FakeRuntime) GetImage(imageName string) (Image, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	image, ok := r.images[imageName]
+	if !ok {
+		return Image{}, fmt.Errorf("%w: %s", ErrImageNotFound, imageName)
+	}
+	return r.image(image), nil
+}
+
+// RemoveImage 删除镜像
+func (r *FakeRuntime) RemoveImage(imageName string, force bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	image, ok := r.images[imageName]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrImageNotFound, imageName)
+	}
+	for _, name := range r.image(image).Containers {
+		if !force {
+			return fmt.Errorf("%w: %s 被容器 %s 使用", ErrImageInUse, imageName, name)
+		}
+		if r.containers[name].Status == container.RUNNING {
+			return fmt.Errorf("%w: %s 被运行中的容器 %s 使用", ErrImageInUse, imageName, name)
+		}
+	}
+	delete(r.images, imageName)
+	return nil
+}
+
+// ImportImage 校验 tar 包后只记录镜像信息，不保存内容
+func (r *FakeRuntime) ImportImage(imageName string, reader io.Reader, checksum string) (Image, error) {
+	if err := validImageName(imageName); err != nil {
+		return Image{}, err
+	}
+	checksum, err := normalizeChecksum(checksum)
+	if err != nil {
+		return Image{}, err
+	}
+	archive, err := copyImageArchive(io.Discard, reader)
+	if err != nil {
+		return Image{}, err
+	}
+	if checksum != "" && checksum != archive.SHA256 {
+		return Image{}, fmt.Errorf("%w: sha256 校验失败，期望 %s，实际 %s", ErrInvalidArgument, checksum, archive.SHA256)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.images[imageName]; ok {
+		return Image{}, fmt.Errorf("%w: %s", ErrImageExists, imageName)
+	}
+	image := Image{Name: imageName, Size: archive.Size, TarSize: archive.Size, ModTime: time.Now()}
+	r.images[imageName] = image
+	return r.image(image), nil
+}
+
+// OpenImage 返回只包含根目录的 tar 包
+func (r *FakeRuntime) OpenImage(imageName string) (io.ReadCloser, int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.images[imageName]; !ok {
+		return nil, 0, fmt.Errorf("%w: %s", ErrImageNotFound, imageName)
+	}
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	tw.WriteHeader(&tar.Header{Name: "./", Typeflag: tar.TypeDir, Mode: 0755, ModTime: time.Now()})
+	tw.Close()
+	return io.NopCloser(&buf), int64(buf.Len()), nil
+}
+
+// ListNetworks 获取网络列表
+func (r *FakeRuntime) ListNetworks() ([]NetworkInfo, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	networks := make([]NetworkInfo, 0, len(r.networks))
+	for _, n := range r.networks {
+		networks = append(networks, n)
+	}
+	return networks, nil
+}
+
+// CreateNetwork 创建网络
+func (r *FakeRuntime) CreateNetwork(req CreateNetworkRequest) (NetworkInfo, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.networks[req.Name]; ok {
+		return NetworkInfo{}, fmt.Errorf("%w: %s", ErrNetworkExists, req.Name)
+	}
+	n := NetworkInfo{
+		Name:   req.Name,
+		Driver: req.Driver,
+		Subnet: req.Subnet,
+	}
+	r.networks[req.Name] = n
+	return n, nil
+}
+
+// RemoveNetwork 删除网络
+func (r *FakeRuntime) RemoveNetwork(networkName string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.networks[networkName]; !ok {
+		return fmt.Errorf("%w: %s", ErrNetworkNotFound, networkName)
+	}
+	delete(r.networks, networkName)
+	return nil
+}
+
+// Version 获取运行时版本
+func (r *FakeRuntime) Version() (string, error) {
+	return "zdocker fake runtime", nil
+}
@@ -0,0 +1,592 @@
+package service
+
+import (
+	"archive/tar"
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/crazyfrankie/zdocker/container"
+)
+
+// 容器内文件的类型
+const (
+	FileTypeFile    = "file"
+	FileTypeDir     = "dir"
+	FileTypeSymlink = "symlink"
+	FileTypeChar    = "char"
+	FileTypeBlock   = "block"
+	FileTypeFifo    = "fifo"
+	FileTypeSocket  = "socket"
+)
+
+// defaultFileMode 上传新文件且未指定权限时使用的权限
+const defaultFileMode = 0644
+
+// FileInfo 容器内文件的元数据，符号链接描述链接本身
+type FileInfo struct {
+	Name string `json:"name"`
+	// Path 容器内的绝对路径
+	Path string `json:"path"`
+	Type string `json:"type"`
+	Size int64  `json:"size"`
+	// Mode 八进制权限，包含 setuid、setgid 和 sticky 位
+	Mode    string    `json:"mode"`
+	UID     int       `json:"uid"`
+	GID     int       `json:"gid"`
+	ModTime time.Time `json:"mod_time"`
+	// LinkTarget 符号链接的目标，按容器内路径解析
+	LinkTarget string `json:"link_target,omitempty"`
+}
+
+// FileOwner 文件属主
+type FileOwner struct {
+	UID int
+	GID int
+}
+
+// WriteFileOptions 上传文件的参数
+type WriteFileOptions struct {
+	// Mode 文件权限，为空时保留已有文件的权限，新文件为 0644
+	Mode *os.FileMode
+	// Owner 文件属主，为空时保留已有文件的属主，新文件属于服务进程的用户
+	Owner *FileOwner
+}
+
+// ContainerFS 容器合并后的根文件系统。所有路径都按容器内路径解析：
+// 通过 openat2 的 RESOLVE_IN_ROOT 由内核把 ..、绝对路径和符号链接限制在根目录内，
+// 容器进程同时修改文件系统也无法让解析结果逃逸到宿主机
+type ContainerFS struct {
+	root string
+}
+
+// NewContainerFS 创建以 root 为根目录的容器文件系统
+func NewContainerFS(root string) *ContainerFS {
+	return &ContainerFS{root: root}
+}
+
+// containerFS 返回容器 overlay 合并后的根文件系统，zdocker stop 不会卸载 overlay，已停止的容器同样可以访问
+func containerFS(containerName string) (*ContainerFS, error) {
+	name, err := lookupContainerName(containerName)
+	if err != nil {
+		return nil, err
+	}
+	root := fmt.Sprintf(container.MntUrl, name)
+	if !isMountPoint(root) {
+		return nil, fmt.Errorf("容器 %s 的文件系统未挂载", name)
+	}
+	return NewContainerFS(root), nil
+}
+
+// cleanFilePath 将容器内路径规范化为以 / 开头的绝对路径
+func cleanFilePath(p string) string {
+	return path.Clean("/" + p)
+}
+
+// open 在根目录内打开路径，flags 不含 O_NOFOLLOW 时最后一级的符号链接同样在根目录内解析
+func (fsys *ContainerFS) open(p string, flags int, mode uint32) (int, error) {
+	root, err := unix.Open(fsys.root, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return -1, fmt.Errorf("打开容器根目录失败: %v", err)
+	}
+	defer unix.Close(root)
+
+	rel := strings.TrimPrefix(cleanFilePath(p), "/")
+	if rel == "" {
+		rel = "."
+	}
+	fd, err := unix.Openat2(root, rel, &unix.OpenHow{
+		Flags:   uint64(flags | unix.O_CLOEXEC),
+		Mode:    uint64(mode),
+		Resolve: unix.RESOLVE_IN_ROOT | unix.RESOLVE_NO_MAGICLINKS,
+	})
+	if err != nil {
+		return -1, fileError(p, err)
+	}
+	return fd, nil
+}
+
+// openParent 打开路径的上级目录，返回目录描述符和最后一级名称；根目录本身没有上级目录
+func (fsys *ContainerFS) openParent(p string) (int, string, error) {
+	p = cleanFilePath(p)
+	if p == "/" {
+		return -1, "", fmt.Errorf("%w: 不能对根目录执行该操作", ErrInvalidArgument)
+	}
+	dir, err := fsys.open(path.Dir(p), unix.O_PATH|unix.O_DIRECTORY, 0)
+	if err != nil {
+		return -1, "", err
+	}
+	return dir, path.Base(p), nil
+}
+
+// fileError 将系统调用错误转换为类型化错误
+func fileError(p string, err error) error {
+	switch {
+	case errors.Is(err, unix.ENOENT):
+		return fmt.Errorf("%w: %s", ErrFileNotFound, p)
+	case errors.Is(err, unix.ENOTDIR):
+		return fmt.Errorf("%w: %s 不是目录", ErrInvalidArgument, p)
+	case errors.Is(err, unix.EISDIR):
+		return fmt.Errorf("%w: %s 是目录", ErrInvalidArgument, p)
+	case errors.Is(err, unix.ELOOP):
+		return fmt.Errorf("%w: %s 的符号链接层级过多", ErrInvalidArgument, p)
+	default:
+		return fmt.Errorf("%s: %v", p, err)
+	}
+}
+
+// Stat 获取路径的元数据，路径本身是符号链接时返回链接的信息
+func (fsys *ContainerFS) Stat(p string) (FileInfo, error) {
+	p = cleanFilePath(p)
+	if p == "/" {
+		fd, err := fsys.open(p, unix.O_PATH, 0)
+		if err != nil {
+			return FileInfo{}, err
+		}
+		defer unix.Close(fd)
+		var st unix.Stat_t
+		if err := unix.Fstat(fd, &st); err != nil {
+			return FileInfo{}, fileError(p, err)
+		}
+		return fileInfo("/", p, &st, ""), nil
+	}
+
+	dir, name, err := fsys.openParent(p)
+	if err != nil {
+		return FileInfo{}, err
+	}
+	defer unix.Close(dir)
+	return statAt(dir, name, p)
+}
+
+// statAt 获取目录描述符下名为 name 的条目的元数据，不跟随符号链接
+func statAt(dir int, name, p string) (FileInfo, error) {
+	var st unix.Stat_t
+	if err := unix.Fstatat(dir, name, &st, unix.AT_SYMLINK_NOFOLLOW); err != nil {
+		return FileInfo{}, fileError(p, err)
+	}
+	link := ""
+	if st.Mode&unix.S_IFMT == unix.S_IFLNK {
+		link, _ = readlinkAt(dir, name)
+	}
+	return fileInfo(name, p, &st, link), nil
+}
+
+// List 列出目录内容，目录排在文件之前，同类按名称排序；路径是指向目录的符号链接时列出链接目标
+func (fsys *ContainerFS) List(p string) ([]FileInfo, error) {
+	p = cleanFilePath(p)
+	fd, err := fsys.open(p, unix.O_RDONLY|unix.O_DIRECTORY, 0)
+	if err != nil {
+		return nil, err
+	}
+	dir := os.NewFile(uintptr(fd), p)
+	defer dir.Close()
+
+	names, err := dir.Readdirnames(-1)
+	if err != nil {
+		return nil, fmt.Errorf("读取目录 %s 失败: %v", p, err)
+	}
+	files := make([]FileInfo, 0, len(names))
+	for _, name := range names {
+		info, err := statAt(fd, name, path.Join(p, name))
+		if err != nil {
+			// 读取目录后被删除的条目
+			continue
+		}
+		files = append(files, info)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if di, dj := files[i].Type == FileTypeDir, files[j].Type == FileTypeDir; di != dj {
+			return di
+		}
+		return files[i].Name < files[j].Name
+	})
+	return files, nil
+}
+
+// Open 打开路径用于下载，路径最后一级的符号链接在根目录内解析。
+// 普通文件直接返回文件；目录在后台打包为 tar 流，size 为 -1，读取方关闭时停止打包
+func (fsys *ContainerFS) Open(p string) (io.ReadCloser, FileInfo, error) {
+	p = cleanFilePath(p)
+	fd, err := fsys.open(p, unix.O_RDONLY|unix.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, FileInfo{}, err
+	}
+	var st unix.Stat_t
+	if err := unix.Fstat(fd, &st); err != nil {
+		unix.Close(fd)
+		return nil, FileInfo{}, fileError(p, err)
+	}
+	info := fileInfo(path.Base(p), p, &st, "")
+
+	switch info.Type {
+	case FileTypeFile:
+		// O_NONBLOCK 只为避免打开 FIFO 时阻塞，普通文件清除后正常读取
+		unix.SetNonblock(fd, false)
+		return os.NewFile(uintptr(fd), p), info, nil
+	case FileTypeDir:
+		info.Size = -1
+		pr, pw := io.Pipe()
+		go func() {
+			defer unix.Close(fd)
+			// 根目录的条目直接以 . 为前缀
+			prefix := info.Name
+			if p == "/" {
+				prefix = "."
+			}
+			tw := tar.NewWriter(pw)
+			err := writeDirArchive(tw, fd, prefix, &st)
+			if err == nil {
+				err = tw.Close()
+			}
+			if err != nil && !errors.Is(err, io.ErrClosedPipe) {
+				err = fmt.Errorf("打包目录 %s 失败: %v", p, err)
+			}
+			pw.CloseWithError(err)
+		}()
+		return pr, info, nil
+	default:
+		unix.Close(fd)
+		return nil, FileInfo{}, fmt.Errorf("%w: %s 不是普通文件或目录", ErrInvalidArgument, p)
+	}
+}
+
+// writeDirArchive 将目录描述符对应的目录打包写入 tw，条目名以 name 为前缀。
+// 子条目都相对父目录描述符以 O_NOFOLLOW 打开，符号链接按原样保存，不会跟随到容器之外
+func writeDirArchive(tw *tar.Writer, dir int, name string, st *unix.Stat_t) error {
+	if err := tw.WriteHeader(tarHeader(name+"/", st, "")); err != nil {
+		return err
+	}
+
+	names, err := readDirNames(dir)
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+	for _, child := range names {
+		var cst unix.Stat_t
+		if err := unix.Fstatat(dir, child, &cst, unix.AT_SYMLINK_NOFOLLOW); err != nil {
+			continue
+		}
+		entry := name + "/" + child
+
+		switch cst.Mode & unix.S_IFMT {
+		case unix.S_IFDIR:
+			fd, err := unix.Openat(dir, child, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+			if err != nil {
+				continue
+			}
+			err = writeDirArchive(tw, fd, entry, &cst)
+			unix.Close(fd)
+			if err != nil {
+				return err
+			}
+		case unix.S_IFREG:
+			fd, err := unix.Openat(dir, child, unix.O_RDONLY|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+			if err != nil {
+				continue
+			}
+			file := os.NewFile(uintptr(fd), entry)
+			// 以打开后的元数据为准，打包期间文件可能被修改
+			if err := unix.Fstat(fd, &cst); err != nil {
+				file.Close()
+				continue
+			}
+			hdr := tarHeader(entry, &cst, "")
+			err = tw.WriteHeader(hdr)
+			if err == nil {
+				_, err = io.Copy(tw, io.LimitReader(file, hdr.Size))
+			}
+			file.Close()
+			if err != nil {
+				return err
+			}
+		case unix.S_IFLNK:
+			link, err := readlinkAt(dir, child)
+			if err != nil {
+				continue
+			}
+			if err := tw.WriteHeader(tarHeader(entry, &cst, link)); err != nil {
+				return err
+			}
+		case unix.S_IFSOCK:
+			// 套接字无法打包
+		default:
+			if err := tw.WriteHeader(tarHeader(entry, &cst, "")); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// WriteFile 将 r 的内容写入容器内的文件，上级目录必须存在。
+// 内容先写入同目录下的临时文件，完成后原子替换目标；目标是符号链接时替换链接本身而不是写入链接目标
+func (fsys *ContainerFS) WriteFile(p string, r io.Reader, opts WriteFileOptions) (FileInfo, error) {
+	p = cleanFilePath(p)
+	dir, name, err := fsys.openParent(p)
+	if err != nil {
+		return FileInfo{}, err
+	}
+	defer unix.Close(dir)
+
+	mode := os.FileMode(defaultFileMode)
+	var owner *FileOwner
+	var st unix.Stat_t
+	if err := unix.Fstatat(dir, name, &st, unix.AT_SYMLINK_NOFOLLOW); err == nil {
+		switch st.Mode & unix.S_IFMT {
+		case unix.S_IFDIR:
+			return FileInfo{}, fmt.Errorf("%w: %s 是目录", ErrInvalidArgument, p)
+		case unix.S_IFREG:
+			mode = os.FileMode(st.Mode & 07777)
+			owner = &FileOwner{UID: int(st.Uid), GID: int(st.Gid)}
+		}
+	} else if !errors.Is(err, unix.ENOENT) {
+		return FileInfo{}, fileError(p, err)
+	}
+	if opts.Mode != nil {
+		mode = *opts.Mode
+	}
+	if opts.Owner != nil {
+		owner = opts.Owner
+	}
+
+	tmp := fmt.Sprintf(".%s.upload-%d", name, time.Now().UnixNano())
+	fd, err := unix.Openat(dir, tmp, unix.O_WRONLY|unix.O_CREAT|unix.O_EXCL|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0600)
+	if err != nil {
+		return FileInfo{}, fmt.Errorf("创建临时文件失败: %v", err)
+	}
+	f := os.NewFile(uintptr(fd), tmp)
+	err = func() error {
+		if _, err := io.Copy(f, r); err != nil {
+			return fmt.Errorf("写入文件失败: %v", err)
+		}
+		// 先修改属主再设置权限，chown 会清除 setuid 和 setgid 位
+		if owner != nil {
+			if err := unix.Fchown(fd, owner.UID, owner.GID); err != nil {
+				return fmt.Errorf("设置文件属主失败: %v", err)
+			}
+		}
+		if err := unix.Fchmod(fd, uint32(mode.Perm())|uint32(modeSpecialBits(mode))); err != nil {
+			return fmt.Errorf("设置文件权限失败: %v", err)
+		}
+		return nil
+	}()
+	if closeErr := f.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("写入文件失败: %v", closeErr)
+	}
+	if err == nil {
+		if renameErr := unix.Renameat(dir, tmp, dir, name); renameErr != nil {
+			err = fmt.Errorf("保存文件失败: %v", renameErr)
+		}
+	}
+	if err != nil {
+		unix.Unlinkat(dir, tmp, 0)
+		return FileInfo{}, err
+	}
+	return statAt(dir, name, p)
+}
+
+// ParseFileMode 解析八进制权限，如 644 或 0755
+func ParseFileMode(s string) (os.FileMode, error) {
+	n, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || n > 07777 {
+		return 0, fmt.Errorf("%w: 无效的文件权限 %q", ErrInvalidArgument, s)
+	}
+	mode := os.FileMode(n & 0777)
+	if n&04000 != 0 {
+		mode |= os.ModeSetuid
+	}
+	if n&02000 != 0 {
+		mode |= os.ModeSetgid
+	}
+	if n&01000 != 0 {
+		mode |= os.ModeSticky
+	}
+	return mode, nil
+}
+
+// modeSpecialBits 将 os.FileMode 中的 setuid、setgid 和 sticky 位转换为 chmod 使用的数值
+func modeSpecialBits(mode os.FileMode) uint32 {
+	var bits uint32
+	if mode&os.ModeSetuid != 0 {
+		bits |= unix.S_ISUID
+	}
+	if mode&os.ModeSetgid != 0 {
+		bits |= unix.S_ISGID
+	}
+	if mode&os.ModeSticky != 0 {
+		bits |= unix.S_ISVTX
+	}
+	return bits
+}
+
+// ParseOwner 解析 用户[:组] 格式的属主，用户和组可以是数字 ID 或容器内 /etc/passwd、/etc/group 中的名称。
+// 只指定用户时组为该用户在 /etc/passwd 中的主组，数字用户 ID 找不到时组为同一数字
+func (fsys *ContainerFS) ParseOwner(s string) (FileOwner, error) {
+	user, group, hasGroup := strings.Cut(s, ":")
+	if user == "" || (hasGroup && group == "") {
+		return FileOwner{}, fmt.Errorf("%w: 无效的文件属主 %q", ErrInvalidArgument, s)
+	}
+
+	var owner FileOwner
+	var primaryGroup string
+	if uid, err := strconv.Atoi(user); err == nil && uid >= 0 {
+		owner.UID = uid
+		primaryGroup = user
+		if fields := fsys.lookupEntry("/etc/passwd", 2, user); fields != nil {
+			primaryGroup = fields[3]
+		}
+	} else {
+		fields := fsys.lookupEntry("/etc/passwd", 0, user)
+		if fields == nil {
+			return FileOwner{}, fmt.Errorf("%w: 容器内不存在用户 %q", ErrInvalidArgument, user)
+		}
+		if owner.UID, err = strconv.Atoi(fields[2]); err != nil {
+			return FileOwner{}, fmt.Errorf("%w: 用户 %q 的 ID 无效", ErrInvalidArgument, user)
+		}
+		primaryGroup = fields[3]
+	}
+	if !hasGroup {
+		group = primaryGroup
+	}
+
+	if gid, err := strconv.Atoi(group); err == nil && gid >= 0 {
+		owner.GID = gid
+		return owner, nil
+	}
+	fields := fsys.lookupEntry("/etc/group", 0, group)
+	if fields == nil {
+		return FileOwner{}, fmt.Errorf("%w: 容器内不存在组 %q", ErrInvalidArgument, group)
+	}
+	gid, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return FileOwner{}, fmt.Errorf("%w: 组 %q 的 ID 无效", ErrInvalidArgument, group)
+	}
+	owner.GID = gid
+	return owner, nil
+}
+
+// lookupEntry 在容器内 passwd 或 group 格式的文件中查找第 field 列等于 value 的行，返回该行的各列
+func (fsys *ContainerFS) lookupEntry(file string, field int, value string) []string {
+	r, info, err := fsys.Open(file)
+	if err != nil {
+		return nil
+	}
+	defer r.Close()
+	if info.Type != FileTypeFile {
+		return nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), ":")
+		if len(fields) >= 4 && fields[field] == value {
+			return fields
+		}
+	}
+	return nil
+}
+
+// fileInfo 根据 stat 结果构造文件元数据
+func fileInfo(name, p string, st *unix.Stat_t, link string) FileInfo {
+	info := FileInfo{
+		Name:       name,
+		Path:       p,
+		Type:       fileType(st.Mode),
+		Mode:       fmt.Sprintf("%04o", st.Mode&07777),
+		UID:        int(st.Uid),
+		GID:        int(st.Gid),
+		ModTime:    time.Unix(st.Mtim.Unix()),
+		LinkTarget: link,
+	}
+	if info.Type == FileTypeFile || info.Type == FileTypeSymlink {
+		info.Size = st.Size
+	}
+	return info
+}
+
+// fileType 返回 stat 模式对应的文件类型
+func fileType(mode uint32) string {
+	switch mode & unix.S_IFMT {
+	case unix.S_IFDIR:
+		return FileTypeDir
+	case unix.S_IFLNK:
+		return FileTypeSymlink
+	case unix.S_IFCHR:
+		return FileTypeChar
+	case unix.S_IFBLK:
+		return FileTypeBlock
+	case unix.S_IFIFO:
+		return FileTypeFifo
+	case unix.S_IFSOCK:
+		return FileTypeSocket
+	default:
+		return FileTypeFile
+	}
+}
+
+// tarHeader 根据 stat 结果构造 tar 条目头
+func tarHeader(name string, st *unix.Stat_t, link string) *tar.Header {
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    int64(st.Mode & 07777),
+		Uid:     int(st.Uid),
+		Gid:     int(st.Gid),
+		ModTime: time.Unix(st.Mtim.Unix()),
+		Format:  tar.FormatPAX,
+	}
+	switch st.Mode & unix.S_IFMT {
+	case unix.S_IFDIR:
+		hdr.Typeflag = tar.TypeDir
+	case unix.S_IFLNK:
+		hdr.Typeflag = tar.TypeSymlink
+		hdr.Linkname = link
+	case unix.S_IFCHR:
+		hdr.Typeflag = tar.TypeChar
+		hdr.Devmajor, hdr.Devminor = int64(unix.Major(st.Rdev)), int64(unix.Minor(st.Rdev))
+	case unix.S_IFBLK:
+		hdr.Typeflag = tar.TypeBlock
+		hdr.Devmajor, hdr.Devminor = int64(unix.Major(st.Rdev)), int64(unix.Minor(st.Rdev))
+	case unix.S_IFIFO:
+		hdr.Typeflag = tar.TypeFifo
+	default:
+		hdr.Typeflag = tar.TypeReg
+		hdr.Size = st.Size
+	}
+	return hdr
+}
+
+// readDirNames 读取目录描述符下的条目名称，使用复制的描述符，不影响调用方关闭原描述符
+func readDirNames(dir int) ([]string, error) {
+	fd, err := unix.Dup(dir)
+	if err != nil {
+		return nil, err
+	}
+	f := os.NewFile(uintptr(fd), "")
+	defer f.Close()
+	return f.Readdirnames(-1)
+}
+
+// readlinkAt 读取目录描述符下符号链接的目标
+func readlinkAt(dir int, name string) (string, error) {
+	for size := 256; ; size *= 2 {
+		buf := make([]byte, size)
+		n, err := unix.Readlinkat(dir, name, buf)
+		if err != nil {
+			return "", err
+		}
+		if n < size {
+			return string(buf[:n]), nil
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package service
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newTestFS 在临时目录中创建容器根目录 root 和根目录之外的 outside/secret，
+// 根目录中包含指向根目录之外的绝对、相对符号链接和作为中间目录的符号链接
+func newTestFS(t *testing.T) (fsys *ContainerFS, root, outside string) {
+	base := t.TempDir()
+	root = filepath.Join(base, "root")
+	outside = filepath.Join(base, "outside")
+	for _, dir := range []string{filepath.Join(root, "etc"), outside} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := map[string]string{
+		filepath.Join(root, "etc", "passwd"): "inner",
+		filepath.Join(outside, "secret"):     "secret",
+		filepath.Join(outside, "passwd"):     "host",
+	}
+	for file, content := range files {
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		// 绝对路径在容器内按容器根目录解析
+		"abs":        "/",
+		"abs-secret": filepath.Join(outside, "secret"),
+		"abs-dir":    outside,
+		// 相对路径的 .. 不能越过容器根目录
+		"rel":        "../../..",
+		"rel-secret": "../outside/secret",
+		"rel-dir":    "../outside",
+		"etc/up":     "../../../../etc",
+	}
+	for link, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return NewContainerFS(root), root, outside
+}
+
+func TestContainerFSOpenSymlinkEscape(t *testing.T) {
+	fsys, _, _ := newTestFS(t)
+
+	tests := []struct {
+		path string
+		// want 读取到的内容，为空表示文件不存在
+		want string
+	}{
+		{path: "/etc/passwd", want: "inner"},
+		{path: "/../../etc/passwd", want: "inner"},
+		{path: "/abs/etc/passwd", want: "inner"},
+		{path: "/rel/etc/passwd", want: "inner"},
+		{path: "/etc/up/passwd", want: "inner"},
+		{path: "/abs-secret"},
+		{path: "/rel-secret"},
+		{path: "/abs-dir/secret"},
+		{path: "/rel-dir/secret"},
+		{path: "/rel/outside/secret"},
+		{path: "/abs-dir/passwd"},
+	}
+	for _, tt := range tests {
+		r, _, err := fsys.Open(tt.path)
+		if tt.want == "" {
+			if !errors.Is(err, ErrFileNotFound) {
+				t.Errorf("Open(%s): error = %v, want ErrFileNotFound", tt.path, err)
+			}
+			if err == nil {
+				r.Close()
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Open(%s): %v", tt.path, err)
+			continue
+		}
+		data, err := io.ReadAll(r)
+		r.Close()
+		if err != nil || string(data) != tt.want {
+			t.Errorf("Open(%s) = %q, %v, want %q", tt.path, data, err, tt.want)
+		}
+	}
+}
+
+func TestContainerFSListSymlinkEscape(t *testing.T) {
+	fsys, _, _ := newTestFS(t)
+	rootEntries := []string{"etc", "abs", "abs-dir", "abs-secret", "rel", "rel-dir", "rel-secret"}
+
+	tests := []struct {
+		path string
+		// want 列出的条目名称，nil 表示目录不存在
+		want []string
+	}{
+		{path: "/", want: rootEntries},
+		{path: "/..", want: rootEntries},
+		{path: "/abs", want: rootEntries},
+		{path: "/rel", want: rootEntries},
+		{path: "/etc/up", want: []string{"passwd", "up"}},
+		{path: "/abs-dir"},
+		{path: "/rel-dir"},
+	}
+	for _, tt := range tests {
+		files, err := fsys.List(tt.path)
+		if tt.want == nil {
+			if !errors.Is(err, ErrFileNotFound) {
+				t.Errorf("List(%s): error = %v, want ErrFileNotFound", tt.path, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("List(%s): %v", tt.path, err)
+			continue
+		}
+		var names []string
+		for _, f := range files {
+			names = append(names, f.Name)
+		}
+		if !reflect.DeepEqual(names, tt.want) {
+			t.Errorf("List(%s) = %v, want %v", tt.path, names, tt.want)
+		}
+	}
+
+	// 符号链接本身按原样展示
+	info, err := fsys.Stat("/abs-dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Type != FileTypeSymlink || !strings.HasSuffix(info.LinkTarget, "outside") {
+		t.Errorf("Stat(/abs-dir) = %+v", info)
+	}
+}
+
+func TestContainerFSWriteFileSymlinkEscape(t *testing.T) {
+	tests := []struct {
+		path string
+		// wantFile 写入成功时内容所在的宿主机文件，相对容器根目录；为空表示写入失败
+		wantFile string
+	}{
+		{path: "/etc/new", wantFile: "etc/new"},
+		{path: "/abs/etc/new", wantFile: "etc/new"},
+		{path: "/rel/etc/new", wantFile: "etc/new"},
+		{path: "/etc/up/new", wantFile: "etc/new"},
+		{path: "/../outside/new"},
+		{path: "/abs-dir/new"},
+		{path: "/rel-dir/new"},
+		{path: "/rel/outside/secret"},
+		// 上传到已有的符号链接时替换链接本身
+		{path: "/abs-secret", wantFile: "abs-secret"},
+		{path: "/rel-secret", wantFile: "rel-secret"},
+	}
+	for _, tt := range tests {
+		fsys, root, outside := newTestFS(t)
+		info, err := fsys.WriteFile(tt.path, strings.NewReader("uploaded"), WriteFileOptions{})
+		if tt.wantFile == "" {
+			if !errors.Is(err, ErrFileNotFound) {
+				t.Errorf("WriteFile(%s): error = %v, want ErrFileNotFound", tt.path, err)
+			}
+		} else if err != nil {
+			t.Errorf("WriteFile(%s): %v", tt.path, err)
+		} else {
+			if info.Type != FileTypeFile || info.Size != int64(len("uploaded")) {
+				t.Errorf("WriteFile(%s) = %+v", tt.path, info)
+			}
+			file := filepath.Join(root, tt.wantFile)
+			if st, err := os.Lstat(file); err != nil || !st.Mode().IsRegular() {
+				t.Errorf("WriteFile(%s): %s is not a regular file: %v", tt.path, file, err)
+			}
+			if data, _ := os.ReadFile(file); string(data) != "uploaded" {
+				t.Errorf("WriteFile(%s): %s = %q, want uploaded", tt.path, file, data)
+			}
+		}
+
+		// 根目录之外的文件保持不变，也没有新文件
+		entries, err := os.ReadDir(outside)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 2 {
+			t.Errorf("WriteFile(%s): outside directory has %d entries, want 2", tt.path, len(entries))
+		}
+		if data, _ := os.ReadFile(filepath.Join(outside, "secret")); string(data) != "secret" {
+			t.Errorf("WriteFile(%s): outside secret = %q", tt.path, data)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package service
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/crazyfrankie/zdocker/container"
+)
+
+// reservedImageNames zdocker 在镜像目录下创建的工作目录，不是镜像
+var reservedImageNames = map[string]bool{
+	"mnt":        true,
+	"writeLayer": true,
+	"workdir":    true,
+}
+
+// Image 镜像信息。zdocker 的镜像是镜像目录下的 <name>.tar，
+// 首次运行时解压为同名目录作为 overlay 的只读层，两者可能只存在其一
+type Image struct {
+	Name string `json:"name"`
+	// Size tar 包与解压目录的总大小，单位为字节
+	Size       int64  `json:"size"`
+	TarPath    string `json:"tar_path,omitempty"`
+	TarSize    int64  `json:"tar_size"`
+	RootfsPath string `json:"rootfs_path,omitempty"`
+	RootfsSize int64  `json:"rootfs_size"`
+	// ModTime tar 包和解压目录中较新的修改时间
+	ModTime time.Time `json:"mod_time"`
+	// Containers 使用该镜像的容器名称
+	Containers []string `json:"containers"`
+}
+
+// ImageStore 镜像目录，默认与 zdocker 一致为 /root
+type ImageStore struct {
+	root string
+	// mu 串行化删除操作
+	mu sync.Mutex
+}
+
+// imageStore 默认镜像目录
+var imageStore = NewImageStore(container.RootUrl)
+
+// NewImageStore 创建镜像目录
+func NewImageStore(root string) *ImageStore {
+	return &ImageStore{root: root}
+}
+
+// validImageName 检查镜像名称，拒绝路径分隔符、隐藏文件和 zdocker 工作目录
+func validImageName(name string) error {
+	if name == "" || strings.HasPrefix(name, ".") || strings.ContainsAny(name, `/\`) || reservedImageNames[name] {
+		return fmt.Errorf("%w: 无效的镜像名称 %q", ErrInvalidArgument, name)
+	}
+	return nil
+}
+
+// rootfsEntries 导出的根文件系统都包含的目录
+var rootfsEntries = []string{"bin", "dev", "etc", "proc"}
+
+// isRootfs 判断没有对应 tar 包的目录是否为解压后的根文件系统。镜像目录通常是 /root，
+// 其中的其他目录（如 go、miniconda）不应被当作镜像，更不能被删除
+func isRootfs(dir string) bool {
+	for _, entry := range rootfsEntries {
+		info, err := os.Stat(filepath.Join(dir, entry))
+		if err != nil || !info.IsDir() {
+			return false
+		}
+	}
+	return true
+}
+
+// List 列出所有镜像，按名称排序
+func (s *ImageStore) List() ([]Image, error) {
+	entries, err := os.ReadDir(s.root)
+	if err != nil {
+		return nil, fmt.Errorf("读取镜像目录失败: %v", err)
+	}
+
+	names := make(map[string]bool)
+	for _, entry := range entries {
+		name := entry.Name()
+		if validImageName(strings.TrimSuffix(name, ".tar")) != nil {
+			continue
+		}
+		if entry.Type().IsRegular() && strings.HasSuffix(name, ".tar") {
+			names[strings.TrimSuffix(name, ".tar")] = true
+		}
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() && !names[name] && validImageName(name) == nil && isRootfs(filepath.Join(s.root, name)) {
+			names[name] = true
+		}
+	}
+
+	usage := imageUsage()
+	images := make([]Image, 0, len(names))
+	for name := range names {
+		image, err := s.stat(name)
+		if err != nil {
+			continue
+		}
+		if containers, ok := usage[name]; ok {
+			image.Containers = containers
+		}
+		images = append(images, image)
+	}
+	sort.Slice(images, func(i, j int) bool { return images[i].Name < images[j].Name })
+	return images, nil
+}
+
+// Get 获取单个镜像
+func (s *ImageStore) Get(name string) (Image, error) {
+	if err := validImageName(name); err != nil {
+		return Image{}, err
+	}
+	image, err := s.stat(name)
+	if err != nil {
+		return Image{}, err
+	}
+	if containers, ok := imageUsage()[name]; ok {
+		image.Containers = containers
+	}
+	return image, nil
+}
+
+// stat 读取镜像的 tar 包和解压目录，两者都不存在时返回 ErrImageNotFound
+func (s *ImageStore) stat(name string) (Image, error) {
+	image := Image{Name: name, Containers: []string{}}
+
+	tarPath := filepath.Join(s.root, name+".tar")
+	if info, err := os.Stat(tarPath); err == nil && info.Mode().IsRegular() {
+		image.TarPath = tarPath
+		image.TarSize = info.Size()
+		image.ModTime = info.ModTime()
+	}
+
+	rootfs := filepath.Join(s.root, name)
+	if info, err := os.Stat(rootfs); err == nil && info.IsDir() && (image.TarPath != "" || isRootfs(rootfs)) {
+		image.RootfsPath = rootfs
+		image.RootfsSize = dirSize(rootfs)
+		if info.ModTime().After(image.ModTime) {
+			image.ModTime = info.ModTime()
+		}
+	}
+
+	if image.TarPath == "" && image.RootfsPath == "" {
+		return Image{}, fmt.Errorf("%w: %s", ErrImageNotFound, name)
+	}
+	image.Size = image.TarSize + image.RootfsSize
+	return image, nil
+}
+
+// Remove 删除镜像的 tar 包和解压目录。
+// 被容器使用的镜像需要 force 才能删除；运行中容器的 overlay 只读层就是解压目录，
+// 删除会破坏容器文件系统，因此即使指定 force 也拒绝
+func (s *ImageStore) Remove(name string, force bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	image, err := s.Get(name)
+	if err != nil {
+		return err
+	}
+	if len(image.Containers) > 0 {
+		if !force {
+			return fmt.Errorf("%w: %s 被容器 %s 使用", ErrImageInUse, name, strings.Join(image.Containers, ", "))
+		}
+		for _, containerName := range image.Containers {
+			if info, err := readContainerInfo(containerName); err == nil &&
+				info.Status == container.RUNNING && isProcessRunning(info.PID) {
+				return fmt.Errorf("%w: %s 被运行中的容器 %s 使用", ErrImageInUse, name, containerName)
+			}
+		}
+	}
+
+	if image.TarPath != "" {
+		if err := os.Remove(image.TarPath); err != nil {
+			return fmt.Errorf("删除镜像文件失败: %v", err)
+		}
+	}
+	if image.RootfsPath != "" {
+		if err := os.RemoveAll(image.RootfsPath); err != nil {
+			return fmt.Errorf("删除镜像目录失败: %v", err)
+		}
+	}
+	return nil
+}
+
+// imageUsage 返回镜像名称到使用该镜像的容器名称的映射
+func imageUsage() map[string][]string {
+	usage := make(map[string][]string)
+	containers, err := GetContainerList()
+	if err != nil {
+		return usage
+	}
+	for _, c := range containers {
+		if image := containerImage(c.Name); image != "" {
+			usage[image] = append(usage[image], c.Name)
+		}
+	}
+	for _, names := range usage {
+		sort.Strings(names)
+	}
+	return usage
+}
+
+// containerImage 返回容器使用的镜像，优先读取 runconfig.json，其次从 overlay 挂载推断
+func containerImage(containerName string) string {
+	if req, err := readRunConfig(containerName); err == nil {
+		return req.Image
+	}
+	return imageFromMount(containerName)
+}
+
+// dirSize 统计目录下普通文件的总大小，不跟随符号链接
+func dirSize(dir string) int64 {
+	var size int64
+	filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
@@ -0,0 +1,293 @@
+package service
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// imageUploadPattern 上传中的临时文件，位于镜像目录以便完成后原子重命名；不以 .tar 结尾，不会被当作镜像
+const imageUploadPattern = ".upload-*"
+
+// ImageArchive 校验后的镜像 tar 包信息
+type ImageArchive struct {
+	Size   int64
+	SHA256 string
+}
+
+// normalizeChecksum 去掉可选的 sha256: 前缀并转为小写，格式错误返回 ErrInvalidArgument
+func normalizeChecksum(checksum string) (string, error) {
+	checksum = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(checksum), "sha256:"))
+	if checksum == "" {
+		return "", nil
+	}
+	if _, err := hex.DecodeString(checksum); err != nil || len(checksum) != sha256.Size*2 {
+		return "", fmt.Errorf("%w: 无效的 sha256 校验和 %q", ErrInvalidArgument, checksum)
+	}
+	return checksum, nil
+}
+
+// copyImageArchive 将 tar 包从 r 流式写入 w，同时计算 sha256 并逐个检查条目，不在内存中缓存文件内容。
+// 拒绝包含 .. 的路径、越界的硬链接以及位于此前符号链接之下的条目，这些条目解压时会写到根文件系统之外
+func copyImageArchive(w io.Writer, r io.Reader) (ImageArchive, error) {
+	hash := sha256.New()
+	counter := &countingWriter{}
+	tee := io.TeeReader(r, io.MultiWriter(w, hash, counter))
+
+	tr := tar.NewReader(tee)
+	symlinks := make(map[string]bool)
+	entries := 0
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return ImageArchive{}, fmt.Errorf("%w: 无效的 tar 包: %v", ErrInvalidArgument, err)
+		}
+		name, err := checkArchiveEntry(hdr, symlinks)
+		if err != nil {
+			return ImageArchive{}, err
+		}
+		if hdr.Typeflag == tar.TypeSymlink {
+			symlinks[name] = true
+		}
+		entries++
+	}
+	if entries == 0 {
+		return ImageArchive{}, fmt.Errorf("%w: tar 包为空", ErrInvalidArgument)
+	}
+	// tar 结束标记之后可能还有填充块，一并写入以保持文件与上传内容一致
+	if _, err := io.Copy(io.Discard, tee); err != nil {
+		return ImageArchive{}, fmt.Errorf("读取上传内容失败: %v", err)
+	}
+
+	return ImageArchive{
+		Size:   counter.n,
+		SHA256: hex.EncodeToString(hash.Sum(nil)),
+	}, nil
+}
+
+// checkArchiveEntry 检查 tar 条目的路径，返回规范化后的相对路径
+func checkArchiveEntry(hdr *tar.Header, symlinks map[string]bool) (string, error) {
+	name, ok := archivePath(hdr.Name)
+	if !ok {
+		return "", fmt.Errorf("%w: tar 包中存在越界路径 %q", ErrInvalidArgument, hdr.Name)
+	}
+	// 条目的任一上级目录是符号链接时，解压会跟随链接写到目标位置
+	for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+		if symlinks[dir] {
+			return "", fmt.Errorf("%w: tar 包中的 %q 位于符号链接 %q 之下", ErrInvalidArgument, hdr.Name, dir)
+		}
+	}
+	// 硬链接目标是包内路径；符号链接在容器内解析，绝对路径的目标是正常的
+	if hdr.Typeflag == tar.TypeLink {
+		if _, ok := archivePath(hdr.Linkname); !ok {
+			return "", fmt.Errorf("%w: tar 包中的硬链接 %q 指向越界路径 %q", ErrInvalidArgument, hdr.Name, hdr.Linkname)
+		}
+	}
+	return name, nil
+}
+
+// archivePath 将 tar 条目路径规范化为相对路径，开头的 / 与 tar 解压时的处理一致被去掉，包含 .. 时返回 false
+func archivePath(name string) (string, bool) {
+	name = strings.TrimLeft(name, "/")
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return "", false
+		}
+	}
+	return path.Clean("./" + name), true
+}
+
+// countingWriter 统计写入的字节数
+type countingWriter struct {
+	n int64
+}
+
+// Write 实现 io.Writer
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+// archiveOptions 打包根文件系统的选项
+type archiveOptions struct {
+	// exclude 不打包的相对路径，如挂载到容器内的数据卷
+	exclude map[string]bool
+	// progress 打包过程中调用，参数为已打包的条目数和文件字节数
+	progress func(entries, bytes int64)
+}
+
+// writerFunc 将函数适配为 io.Writer
+type writerFunc func(p []byte) (int, error)
+
+// Write 实现 io.Writer
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+// writeRootfsArchive 将根文件系统打包写入 w，符号链接按原样保存
+func writeRootfsArchive(w io.Writer, root string, opts archiveOptions) error {
+	var entries, bytes int64
+	tw := tar.NewWriter(w)
+	err := filepath.WalkDir(root, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, file)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		if opts.exclude[rel] {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		// 套接字等无法打包的文件
+		if info.Mode()&os.ModeSocket != 0 {
+			return nil
+		}
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(file); err != nil {
+				return err
+			}
+		}
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = "./" + filepath.ToSlash(rel)
+		if d.IsDir() {
+			hdr.Name += "/"
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			f, err := os.Open(file)
+			if err != nil {
+				return err
+			}
+			var dst io.Writer = tw
+			if opts.progress != nil {
+				// 大文件在复制过程中也报告进度
+				dst = writerFunc(func(p []byte) (int, error) {
+					n, err := tw.Write(p)
+					bytes += int64(n)
+					opts.progress(entries, bytes)
+					return n, err
+				})
+			}
+			_, err = io.Copy(dst, io.LimitReader(f, hdr.Size))
+			f.Close()
+			if err != nil {
+				return err
+			}
+		}
+
+		entries++
+		if opts.progress != nil {
+			opts.progress(entries, bytes)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// Import 从 r 读取 tar 包保存为名为 name 的镜像，checksum 不为空时校验 sha256。
+// 内容先写入镜像目录下的临时文件，校验通过后重命名为 <name>.tar
+func (s *ImageStore) Import(name string, r io.Reader, checksum string) (Image, error) {
+	if err := validImageName(name); err != nil {
+		return Image{}, err
+	}
+	checksum, err := normalizeChecksum(checksum)
+	if err != nil {
+		return Image{}, err
+	}
+	if _, err := s.stat(name); err == nil {
+		return Image{}, fmt.Errorf("%w: %s", ErrImageExists, name)
+	}
+
+	tmp, err := os.CreateTemp(s.root, imageUploadPattern)
+	if err != nil {
+		return Image{}, fmt.Errorf("创建临时文件失败: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	archive, err := copyImageArchive(tmp, r)
+	if closeErr := tmp.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("写入镜像文件失败: %v", closeErr)
+	}
+	if err != nil {
+		return Image{}, err
+	}
+	if checksum != "" && checksum != archive.SHA256 {
+		return Image{}, fmt.Errorf("%w: sha256 校验失败，期望 %s，实际 %s", ErrInvalidArgument, checksum, archive.SHA256)
+	}
+	if err := os.Chmod(tmp.Name(), configFilePerm); err != nil {
+		return Image{}, fmt.Errorf("设置镜像文件权限失败: %v", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// 上传期间可能已有同名镜像
+	if _, err := s.stat(name); err == nil {
+		return Image{}, fmt.Errorf("%w: %s", ErrImageExists, name)
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(s.root, name+".tar")); err != nil {
+		return Image{}, fmt.Errorf("保存镜像文件失败: %v", err)
+	}
+	return s.Get(name)
+}
+
+// Open 打开镜像的 tar 包用于下载，size 为 -1 表示长度未知。
+// 只有解压目录的镜像在后台打包，读取方关闭时停止打包
+func (s *ImageStore) Open(name string) (io.ReadCloser, int64, error) {
+	if err := validImageName(name); err != nil {
+		return nil, 0, err
+	}
+	image, err := s.stat(name)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if image.TarPath != "" {
+		f, err := os.Open(image.TarPath)
+		if err != nil {
+			return nil, 0, fmt.Errorf("打开镜像文件失败: %v", err)
+		}
+		return f, image.TarSize, nil
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		err := writeRootfsArchive(pw, image.RootfsPath, archiveOptions{})
+		if err != nil && !errors.Is(err, io.ErrClosedPipe) {
+			err = fmt.Errorf("打包镜像目录失败: %v", err)
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr, -1, nil
+}
@@ -0,0 +1,252 @@
+package service
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testTarEntry 构造测试 tar 包的条目
+type testTarEntry struct {
+	name     string
+	typeflag byte
+	linkname string
+	content  string
+}
+
+// buildTar 按顺序写入条目并返回 tar 包内容
+func buildTar(t *testing.T, entries ...testTarEntry) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Typeflag: e.typeflag, Linkname: e.linkname, Mode: 0644, Size: int64(len(e.content))}
+		if e.typeflag == 0 {
+			hdr.Typeflag = tar.TypeReg
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			hdr.Size = 0
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Size > 0 {
+			if _, err := tw.Write([]byte(e.content)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCopyImageArchive(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []testTarEntry
+		wantErr bool
+	}{
+		{name: "rootfs", entries: []testTarEntry{
+			{name: "./bin/", typeflag: tar.TypeDir},
+			{name: "./bin/busybox", content: "elf"},
+			{name: "./bin/sh", typeflag: tar.TypeSymlink, linkname: "/bin/busybox"},
+			{name: "./bin/ls", typeflag: tar.TypeLink, linkname: "./bin/busybox"},
+		}},
+		{name: "absolute paths", entries: []testTarEntry{{name: "/etc/passwd", content: "root"}}},
+		{name: "symlink to parent directory", entries: []testTarEntry{{name: "lib", typeflag: tar.TypeSymlink, linkname: "../../.."}}},
+		{name: "dot dot in file name", entries: []testTarEntry{{name: "etc/..conf", content: "x"}}},
+		{name: "parent path", entries: []testTarEntry{{name: "../evil", content: "x"}}, wantErr: true},
+		{name: "nested parent path", entries: []testTarEntry{{name: "./etc/../../evil", content: "x"}}, wantErr: true},
+		{name: "absolute parent path", entries: []testTarEntry{{name: "/../evil", content: "x"}}, wantErr: true},
+		{name: "hardlink outside", entries: []testTarEntry{{name: "passwd", typeflag: tar.TypeLink, linkname: "../etc/passwd"}}, wantErr: true},
+		{name: "entry under symlink", entries: []testTarEntry{
+			{name: "./etc", typeflag: tar.TypeSymlink, linkname: "/host/etc"},
+			{name: "./etc/passwd", content: "x"},
+		}, wantErr: true},
+		{name: "entry under nested symlink", entries: []testTarEntry{
+			{name: "usr/", typeflag: tar.TypeDir},
+			{name: "usr/lib", typeflag: tar.TypeSymlink, linkname: "/"},
+			{name: "/usr/lib/x/y", content: "x"},
+		}, wantErr: true},
+		{name: "empty", wantErr: true},
+	}
+	for _, tt := range tests {
+		data := buildTar(t, tt.entries...)
+		var out bytes.Buffer
+		archive, err := copyImageArchive(&out, bytes.NewReader(data))
+		if tt.wantErr {
+			if !errors.Is(err, ErrInvalidArgument) {
+				t.Errorf("%s: error = %v, want ErrInvalidArgument", tt.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		// 写入的内容与上传内容完全一致，包括结束标记之后的填充
+		sum := sha256.Sum256(data)
+		if !bytes.Equal(out.Bytes(), data) || archive.Size != int64(len(data)) || archive.SHA256 != hex.EncodeToString(sum[:]) {
+			t.Errorf("%s: archive = %+v, copied %d of %d bytes", tt.name, archive, out.Len(), len(data))
+		}
+	}
+
+	if _, err := copyImageArchive(io.Discard, strings.NewReader("not a tar archive")); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("invalid archive: error = %v, want ErrInvalidArgument", err)
+	}
+}
+
+func TestNormalizeChecksum(t *testing.T) {
+	sum := strings.Repeat("ab", sha256.Size)
+
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "", want: ""},
+		{in: sum, want: sum},
+		{in: "sha256:" + sum, want: sum},
+		{in: " " + strings.ToUpper(sum) + "\n", want: sum},
+		{in: sum[:10], wantErr: true},
+		{in: strings.Repeat("zz", sha256.Size), wantErr: true},
+		{in: "md5:" + sum, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := normalizeChecksum(tt.in)
+		if tt.wantErr {
+			if !errors.Is(err, ErrInvalidArgument) {
+				t.Errorf("normalizeChecksum(%q) = %q, %v, want ErrInvalidArgument", tt.in, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("normalizeChecksum(%q) = %q, %v, want %q", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestImageStoreImport(t *testing.T) {
+	useTestIndex(t)
+	s, root := newTestImageStore(t)
+	data := buildTar(t, testTarEntry{name: "./bin/sh", content: "sh"})
+	sum := sha256.Sum256(data)
+	checksum := hex.EncodeToString(sum[:])
+
+	tests := []struct {
+		name     string
+		image    string
+		data     []byte
+		checksum string
+		wantErr  error
+	}{
+		{name: "checksum mismatch", image: "app", data: data, checksum: strings.Repeat("0", 64), wantErr: ErrInvalidArgument},
+		{name: "invalid checksum", image: "app", data: data, checksum: "abc", wantErr: ErrInvalidArgument},
+		{name: "invalid archive", image: "app", data: buildTar(t, testTarEntry{name: "../evil", content: "x"}), wantErr: ErrInvalidArgument},
+		{name: "invalid name", image: "../app", data: data, wantErr: ErrInvalidArgument},
+		{name: "existing tar", image: "alpine", data: data, wantErr: ErrImageExists},
+		{name: "existing rootfs", image: "busybox", data: data, wantErr: ErrImageExists},
+		{name: "success", image: "app", data: data, checksum: "sha256:" + checksum},
+		{name: "duplicate", image: "app", data: data, wantErr: ErrImageExists},
+	}
+	for _, tt := range tests {
+		image, err := s.Import(tt.image, bytes.NewReader(tt.data), tt.checksum)
+		if tt.wantErr != nil {
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("%s: error = %v, want %v", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if image.TarPath != filepath.Join(root, tt.image+".tar") || image.TarSize != int64(len(tt.data)) {
+			t.Errorf("%s: image = %+v", tt.name, image)
+		}
+		if saved, _ := os.ReadFile(image.TarPath); !bytes.Equal(saved, tt.data) {
+			t.Errorf("%s: saved archive differs from upload", tt.name)
+		}
+	}
+
+	// 失败的上传不留下临时文件
+	matches, err := filepath.Glob(filepath.Join(root, imageUploadPattern))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(matches, []string{filepath.Join(root, ".upload-123")}) {
+		t.Errorf("upload files = %v, want only the fixture", matches)
+	}
+}
+
+func TestImageStoreOpen(t *testing.T) {
+	useTestIndex(t)
+	s, root := newTestImageStore(t)
+	if err := os.Symlink("/bin/busybox", filepath.Join(root, "busybox", "bin", "sh")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "busybox", "etc", "hostname"), []byte("zdocker"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// 有 tar 包的镜像直接返回文件
+	r, size, err := s.Open("alpine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(r)
+	r.Close()
+	if string(data) != "tar" || size != 3 {
+		t.Errorf("Open(alpine) = %q, %d", data, size)
+	}
+
+	// 只有解压目录的镜像在读取时打包，符号链接按原样保存
+	r, size, err = s.Open("busybox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if size != -1 {
+		t.Errorf("Open(busybox) size = %d, want -1", size)
+	}
+	entries := make(map[string]string)
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := io.ReadAll(tr)
+		entries[hdr.Name] = string(content) + hdr.Linkname
+	}
+	want := map[string]string{
+		"./bin/":         "",
+		"./bin/sh":       "/bin/busybox",
+		"./dev/":         "",
+		"./etc/":         "",
+		"./etc/hostname": "zdocker",
+		"./proc/":        "",
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("busybox archive = %v, want %v", entries, want)
+	}
+
+	for _, name := range []string{"go", "mnt", "../alpine"} {
+		if r, _, err := s.Open(name); err == nil {
+			r.Close()
+			t.Errorf("Open(%s): want error", name)
+		}
+	}
+}
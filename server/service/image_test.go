@@ -0,0 +1,209 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/crazyfrankie/zdocker/container"
+)
+
+// useTestIndex 将全局容器状态存储和容器索引替换为临时目录中的实现，测试结束后恢复
+func useTestIndex(t *testing.T) *ContainerStore {
+	store := useTestStore(t)
+	idx := NewContainerIndex(store)
+	idx.Rescan()
+	idx.ready = true
+	old := containerIndex
+	containerIndex = idx
+	t.Cleanup(func() {
+		containerIndex = old
+		store.onChange = nil
+	})
+	return store
+}
+
+// newTestImageStore 在临时目录中创建镜像目录：
+// alpine 同时有 tar 包和解压目录，busybox 只有解压目录，其余条目都不是镜像
+func newTestImageStore(t *testing.T) (*ImageStore, string) {
+	root := t.TempDir()
+	files := map[string]string{
+		"alpine.tar":     "tar",
+		"alpine/bin/sh":  "sh",
+		"notes.txt":      "notes",
+		".upload-123":    "partial",
+		"writeLayer.tar": "reserved",
+		"go/bin/go":      "go",
+	}
+	for name, content := range files {
+		file := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// mnt 是 zdocker 的工作目录，即使内容像根文件系统也不是镜像
+	for _, dir := range rootfsEntries {
+		for _, image := range []string{"busybox", "mnt"} {
+			if err := os.MkdirAll(filepath.Join(root, image, dir), 0755); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return NewImageStore(root), root
+}
+
+func TestValidImageName(t *testing.T) {
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{name: "busybox", valid: true},
+		{name: "my-app_1.0", valid: true},
+		{name: ""},
+		{name: "."},
+		{name: ".."},
+		{name: ".hidden"},
+		{name: "a/b"},
+		{name: `a\b`},
+		{name: "../etc"},
+		{name: "mnt"},
+		{name: "writeLayer"},
+		{name: "workdir"},
+	}
+	for _, tt := range tests {
+		err := validImageName(tt.name)
+		if tt.valid && err != nil {
+			t.Errorf("validImageName(%q) = %v, want nil", tt.name, err)
+		}
+		if !tt.valid && !errors.Is(err, ErrInvalidArgument) {
+			t.Errorf("validImageName(%q) = %v, want ErrInvalidArgument", tt.name, err)
+		}
+	}
+}
+
+func TestImageStoreList(t *testing.T) {
+	useTestIndex(t)
+	s, root := newTestImageStore(t)
+
+	images, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, image := range images {
+		names = append(names, image.Name)
+	}
+	if want := []string{"alpine", "busybox"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("List = %v, want %v", names, want)
+	}
+
+	alpine := images[0]
+	if alpine.TarPath != filepath.Join(root, "alpine.tar") || alpine.TarSize != 3 ||
+		alpine.RootfsPath != filepath.Join(root, "alpine") || alpine.RootfsSize != 2 || alpine.Size != 5 {
+		t.Errorf("alpine = %+v", alpine)
+	}
+	busybox := images[1]
+	if busybox.TarPath != "" || busybox.RootfsPath != filepath.Join(root, "busybox") {
+		t.Errorf("busybox = %+v", busybox)
+	}
+
+	tests := []struct {
+		name    string
+		wantErr error
+	}{
+		{name: "alpine"},
+		{name: "busybox"},
+		{name: "go", wantErr: ErrImageNotFound},
+		{name: "notes", wantErr: ErrImageNotFound},
+		{name: "missing", wantErr: ErrImageNotFound},
+		{name: "mnt", wantErr: ErrInvalidArgument},
+		{name: "../alpine", wantErr: ErrInvalidArgument},
+	}
+	for _, tt := range tests {
+		image, err := s.Get(tt.name)
+		if tt.wantErr != nil {
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Get(%s): error = %v, want %v", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || image.Name != tt.name || image.Containers == nil {
+			t.Errorf("Get(%s) = %+v, %v", tt.name, image, err)
+		}
+	}
+}
+
+func TestImageStoreRemove(t *testing.T) {
+	store := useTestIndex(t)
+	s, root := newTestImageStore(t)
+
+	containers := []struct {
+		info  container.ContainerInfo
+		image string
+	}{
+		{info: container.ContainerInfo{Name: "web", Status: container.STOP}, image: "alpine"},
+		{info: container.ContainerInfo{Name: "db", Status: container.EXIT}, image: "alpine"},
+		{info: container.ContainerInfo{Name: "job", Status: container.RUNNING, PID: strconv.Itoa(os.Getpid())}, image: "busybox"},
+	}
+	for _, c := range containers {
+		if err := store.Write(&c.info); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.WriteRunConfig(c.info.Name, CreateContainerRequest{Image: c.image}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	image, err := s.Get("alpine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"db", "web"}; !reflect.DeepEqual(image.Containers, want) {
+		t.Errorf("alpine containers = %v, want %v", image.Containers, want)
+	}
+
+	tests := []struct {
+		name    string
+		force   bool
+		wantErr error
+		// gone 删除成功后不应存在的文件，相对镜像目录
+		gone []string
+	}{
+		{name: "alpine", wantErr: ErrImageInUse},
+		{name: "busybox", force: true, wantErr: ErrImageInUse},
+		{name: "go", force: true, wantErr: ErrImageNotFound},
+		{name: "mnt", force: true, wantErr: ErrInvalidArgument},
+		{name: "alpine", force: true, gone: []string{"alpine.tar", "alpine"}},
+		{name: "alpine", force: true, wantErr: ErrImageNotFound},
+	}
+	for _, tt := range tests {
+		err := s.Remove(tt.name, tt.force)
+		if tt.wantErr != nil {
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Remove(%s, %v): error = %v, want %v", tt.name, tt.force, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Remove(%s, %v): %v", tt.name, tt.force, err)
+		}
+		for _, name := range tt.gone {
+			if _, err := os.Lstat(filepath.Join(root, name)); !os.IsNotExist(err) {
+				t.Errorf("Remove(%s): %s still exists", tt.name, name)
+			}
+		}
+	}
+
+	// 删除失败的镜像和非镜像目录保持不变
+	for _, name := range []string{"busybox/bin", "go/bin/go", "mnt/bin"} {
+		if _, err := os.Lstat(filepath.Join(root, name)); err != nil {
+			t.Errorf("%s after Remove: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,338 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const (
+	// indexRescanInterval inotify 可用时的兜底全量扫描间隔
+	indexRescanInterval = 30 * time.Second
+	// indexPollInterval inotify 不可用时的轮询扫描间隔
+	indexPollInterval = 2 * time.Second
+
+	// 监听容器根目录：容器目录的创建和删除
+	rootWatchMask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_ONLYDIR
+	// 监听容器目录：config.json 被写入或通过 rename 替换
+	dirWatchMask = syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO | syscall.IN_DELETE | syscall.IN_DELETE_SELF | syscall.IN_ONLYDIR
+)
+
+// ContainerFilter 容器列表过滤条件，空字段表示不过滤
+type ContainerFilter struct {
+	// Status 容器状态，精确匹配
+	Status string
+	// Name 容器名称或ID包含的子串
+	Name string
+	// Image 镜像名称，精确匹配
+	Image string
+}
+
+// Match 判断容器是否满足过滤条件
+func (f ContainerFilter) Match(c Container) bool {
+	if f.Status != "" && c.Status != f.Status {
+		return false
+	}
+	if f.Name != "" && !strings.Contains(c.Name, f.Name) && !strings.Contains(c.ID, f.Name) {
+		return false
+	}
+	if f.Image != "" && c.Image != f.Image {
+		return false
+	}
+	return true
+}
+
+// FilterContainers 返回满足过滤条件的容器
+func FilterContainers(containers []Container, filter ContainerFilter) []Container {
+	result := make([]Container, 0, len(containers))
+	for _, c := range containers {
+		if filter.Match(c) {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+// ContainerIndex 以ID和名称为键的内存容器索引。启动时全量构建，
+// 之后通过 inotify 监听容器目录增量更新，并定期全量扫描兜底。
+type ContainerIndex struct {
+	store *ContainerStore
+
+	mu     sync.RWMutex
+	byName map[string]Container
+	byId   map[string]string
+	ready  bool
+
+	// inotify 状态，只在监听协程和 Start 中访问
+	watchMu sync.Mutex
+	inotify *os.File
+	// inotifyFd inotify 的原始 fd，调用 inotify.Fd() 会把 fd 切换为阻塞模式，使 Close 无法中断 Read
+	inotifyFd int
+	watches   map[int32]string
+
+	done chan struct{}
+}
+
+// containerIndex 服务端统一使用的容器索引，Start 之前所有查询直接读取磁盘
+var containerIndex = NewContainerIndex(containerStore)
+
+// StartContainerIndex 构建容器索引并开始监听容器目录
+func StartContainerIndex() {
+	containerIndex.Start()
+}
+
+// NewContainerIndex 创建容器索引
+func NewContainerIndex(store *ContainerStore) *ContainerIndex {
+	idx := &ContainerIndex{
+		store:   store,
+		byName:  make(map[string]Container),
+		byId:    make(map[string]string),
+		watches: make(map[int32]string),
+		done:    make(chan struct{}),
+	}
+	// 服务端自身的写入同步刷新索引，保证写后立即可读
+	store.onChange = idx.Refresh
+	return idx
+}
+
+// Start 全量构建索引并启动监听协程
+func (idx *ContainerIndex) Start() {
+	interval := indexRescanInterval
+	if err := idx.watch(); err != nil {
+		log.Printf("容器索引: inotify 不可用，改为每 %v 轮询: %v", indexPollInterval, err)
+		interval = indexPollInterval
+	}
+	idx.Rescan()
+
+	idx.mu.Lock()
+	idx.ready = true
+	idx.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-idx.done:
+				return
+			case <-ticker.C:
+				idx.Rescan()
+			}
+		}
+	}()
+}
+
+// Stop 停止监听
+func (idx *ContainerIndex) Stop() {
+	close(idx.done)
+	idx.watchMu.Lock()
+	defer idx.watchMu.Unlock()
+	if idx.inotify != nil {
+		idx.inotify.Close()
+		idx.inotifyFd = -1
+	}
+}
+
+// Ready 索引是否已完成构建
+func (idx *ContainerIndex) Ready() bool {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return idx.ready
+}
+
+// rootDir 返回容器根目录，不带结尾的 /
+func (idx *ContainerIndex) rootDir() string {
+	return strings.TrimSuffix(idx.store.Dir(""), "/")
+}
+
+// Rescan 全量扫描容器目录重建索引
+func (idx *ContainerIndex) Rescan() {
+	files, err := os.ReadDir(idx.rootDir())
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("容器索引: 扫描容器目录失败: %v", err)
+		return
+	}
+
+	byName := make(map[string]Container, len(files))
+	byId := make(map[string]string, len(files))
+	for _, f := range files {
+		if !f.IsDir() {
+			continue
+		}
+		idx.addWatch(f.Name())
+		info, err := idx.store.Read(f.Name())
+		if err != nil {
+			continue
+		}
+		byName[info.Name] = containerFromInfo(info)
+		byId[info.ID] = info.Name
+	}
+
+	idx.mu.Lock()
+	idx.byName = byName
+	idx.byId = byId
+	idx.mu.Unlock()
+}
+
+// Refresh 重新读取单个容器，容器已删除时从索引中移除
+func (idx *ContainerIndex) Refresh(containerName string) {
+	info, err := idx.store.Read(containerName)
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if old, ok := idx.byName[containerName]; ok {
+		delete(idx.byId, old.ID)
+		delete(idx.byName, containerName)
+	}
+	if err != nil {
+		return
+	}
+	idx.byName[containerName] = containerFromInfo(info)
+	idx.byId[info.ID] = containerName
+}
+
+// List 返回满足过滤条件的容器
+func (idx *ContainerIndex) List(filter ContainerFilter) []Container {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	containers := make([]Container, 0, len(idx.byName))
+	for _, c := range idx.byName {
+		if filter.Match(c) {
+			containers = append(containers, c)
+		}
+	}
+	return containers
+}
+
+// Get 根据ID或名称查找容器。按名称未命中时直接读取磁盘，
+// 覆盖 zdocker 命令行刚创建、inotify 事件尚未处理的容器
+func (idx *ContainerIndex) Get(containerId string) (Container, bool) {
+	idx.mu.RLock()
+	name, ok := idx.byId[containerId]
+	if !ok {
+		name = containerId
+	}
+	c, ok := idx.byName[name]
+	idx.mu.RUnlock()
+	if ok {
+		return c, true
+	}
+
+	if strings.ContainsRune(containerId, '/') {
+		return Container{}, false
+	}
+	if _, err := idx.store.Read(containerId); err != nil {
+		return Container{}, false
+	}
+	idx.Refresh(containerId)
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	c, ok = idx.byName[containerId]
+	return c, ok
+}
+
+// watch 初始化 inotify 并启动事件处理协程
+func (idx *ContainerIndex) watch() error {
+	if err := os.MkdirAll(idx.rootDir(), containerDirPerm); err != nil {
+		return err
+	}
+
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return err
+	}
+	if _, err := syscall.InotifyAddWatch(fd, idx.rootDir(), rootWatchMask); err != nil {
+		syscall.Close(fd)
+		return err
+	}
+
+	idx.watchMu.Lock()
+	// 非阻塞 fd 交给 os.File 后由 Go 的网络轮询器等待，Close 可以中断 Read
+	idx.inotify = os.NewFile(uintptr(fd), "inotify")
+	idx.inotifyFd = fd
+	idx.watchMu.Unlock()
+
+	go idx.readEvents()
+	return nil
+}
+
+// addWatch 监听单个容器目录
+func (idx *ContainerIndex) addWatch(containerName string) {
+	idx.watchMu.Lock()
+	defer idx.watchMu.Unlock()
+	if idx.inotify == nil || idx.inotifyFd < 0 {
+		return
+	}
+
+	// 重复添加同一目录会返回相同的 wd，直接覆盖即可
+	wd, err := syscall.InotifyAddWatch(idx.inotifyFd, idx.store.Dir(containerName), dirWatchMask)
+	if err != nil {
+		return
+	}
+	idx.watches[int32(wd)] = containerName
+}
+
+// readEvents 处理 inotify 事件，直到 inotify 被关闭
+func (idx *ContainerIndex) readEvents() {
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := idx.inotify.Read(buf)
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				log.Printf("容器索引: 读取 inotify 事件失败: %v", err)
+			}
+			return
+		}
+
+		rescan := false
+		changed := make(map[string]struct{})
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameBytes := buf[offset+syscall.SizeofInotifyEvent : offset+syscall.SizeofInotifyEvent+int(event.Len)]
+			name := string(bytes.TrimRight(nameBytes, "\x00"))
+			offset += syscall.SizeofInotifyEvent + int(event.Len)
+
+			if event.Mask&syscall.IN_Q_OVERFLOW != 0 {
+				rescan = true
+				continue
+			}
+
+			idx.watchMu.Lock()
+			containerName, isDir := idx.watches[event.Wd]
+			if event.Mask&syscall.IN_IGNORED != 0 {
+				delete(idx.watches, event.Wd)
+			}
+			idx.watchMu.Unlock()
+
+			if isDir {
+				changed[containerName] = struct{}{}
+				continue
+			}
+			// 根目录事件：容器目录被创建或删除
+			if name == "" {
+				continue
+			}
+			if event.Mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 {
+				idx.addWatch(name)
+			}
+			changed[name] = struct{}{}
+		}
+
+		if rescan {
+			idx.Rescan()
+			continue
+		}
+		for name := range changed {
+			idx.Refresh(name)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package service
+
+import (
+	"os"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/crazyfrankie/zdocker/container"
+)
+
+// newTestIndex 返回使用临时全局容器状态存储的容器索引，
+// 同时返回指向同一目录、不回调索引的存储，模拟 zdocker 命令行的写入
+func newTestIndex(t *testing.T) (idx *ContainerIndex, external *ContainerStore) {
+	store := useTestStore(t)
+	idx = NewContainerIndex(store)
+	t.Cleanup(func() { store.onChange = nil })
+	return idx, NewContainerStore(store.location)
+}
+
+// indexNames 返回索引中满足过滤条件的容器名称，按名称排序
+func indexNames(idx *ContainerIndex, filter ContainerFilter) []string {
+	names := []string{}
+	for _, c := range idx.List(filter) {
+		names = append(names, c.Name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// waitIndex 等待索引中满足过滤条件的容器名称变为 want，超时后测试失败
+func waitIndex(t *testing.T, idx *ContainerIndex, filter ContainerFilter, want []string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got := indexNames(idx, filter)
+		if reflect.DeepEqual(got, want) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("index = %v, want %v", got, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestContainerFilterMatch(t *testing.T) {
+	c := Container{ID: "1234567890", Name: "web-1", Image: "nginx", Status: container.RUNNING}
+
+	tests := []struct {
+		name   string
+		filter ContainerFilter
+		want   bool
+	}{
+		{name: "empty", filter: ContainerFilter{}, want: true},
+		{name: "status", filter: ContainerFilter{Status: container.RUNNING}, want: true},
+		{name: "other status", filter: ContainerFilter{Status: container.STOP}},
+		{name: "name substring", filter: ContainerFilter{Name: "web"}, want: true},
+		{name: "id substring", filter: ContainerFilter{Name: "4567"}, want: true},
+		{name: "other name", filter: ContainerFilter{Name: "db"}},
+		{name: "image", filter: ContainerFilter{Image: "nginx"}, want: true},
+		{name: "image prefix", filter: ContainerFilter{Image: "ngin"}},
+		{name: "all fields", filter: ContainerFilter{Status: container.RUNNING, Name: "web", Image: "nginx"}, want: true},
+		{name: "one field mismatch", filter: ContainerFilter{Status: container.RUNNING, Name: "web", Image: "busybox"}},
+	}
+	for _, tt := range tests {
+		if got := tt.filter.Match(c); got != tt.want {
+			t.Errorf("%s: Match = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestContainerIndexServerWrites(t *testing.T) {
+	idx, external := newTestIndex(t)
+	// 启动前已存在的容器在全量构建时加入
+	if err := external.Write(&container.ContainerInfo{ID: "1111", Name: "db", Status: container.STOP}); err != nil {
+		t.Fatal(err)
+	}
+	idx.Start()
+	defer idx.Stop()
+	if !idx.Ready() {
+		t.Fatal("index not ready after Start")
+	}
+	if got := indexNames(idx, ContainerFilter{}); !reflect.DeepEqual(got, []string{"db"}) {
+		t.Fatalf("index after Start = %v, want [db]", got)
+	}
+
+	// 服务端的写入同步刷新，写后立即可读
+	if err := containerStore.Write(&container.ContainerInfo{ID: "2222", Name: "web", Status: container.RUNNING}); err != nil {
+		t.Fatal(err)
+	}
+	if got := indexNames(idx, ContainerFilter{Status: container.RUNNING}); !reflect.DeepEqual(got, []string{"web"}) {
+		t.Errorf("running containers after write = %v, want [web]", got)
+	}
+	if c, ok := idx.Get("2222"); !ok || c.Name != "web" {
+		t.Errorf("Get by id = %+v, %v", c, ok)
+	}
+
+	if err := containerStore.Update("web", func(info *container.ContainerInfo) error {
+		info.Status = container.STOP
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if c, ok := idx.Get("web"); !ok || c.Status != container.STOP {
+		t.Errorf("Get after update = %+v, %v", c, ok)
+	}
+
+	if err := containerStore.Remove("web"); err != nil {
+		t.Fatal(err)
+	}
+	if c, ok := idx.Get("web"); ok {
+		t.Errorf("Get after remove = %+v, want not found", c)
+	}
+	if _, ok := idx.Get("2222"); ok {
+		t.Error("Get by id after remove: still found")
+	}
+}
+
+func TestContainerIndexExternalWrites(t *testing.T) {
+	idx, external := newTestIndex(t)
+	idx.Start()
+	defer idx.Stop()
+
+	// 命令行创建和修改的容器通过 inotify 更新
+	if err := external.Write(&container.ContainerInfo{ID: "1111", Name: "db", Status: container.RUNNING}); err != nil {
+		t.Fatal(err)
+	}
+	waitIndex(t, idx, ContainerFilter{}, []string{"db"})
+
+	if err := external.Update("db", func(info *container.ContainerInfo) error {
+		info.Status = container.STOP
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	waitIndex(t, idx, ContainerFilter{Status: container.STOP}, []string{"db"})
+
+	if err := os.RemoveAll(external.Dir("db")); err != nil {
+		t.Fatal(err)
+	}
+	waitIndex(t, idx, ContainerFilter{}, []string{})
+}
+
+func TestContainerIndexGetFallback(t *testing.T) {
+	idx, external := newTestIndex(t)
+
+	// 未启动监听时按名称查找直接读取磁盘
+	if err := external.Write(&container.ContainerInfo{ID: "1111", Name: "db", Status: container.RUNNING}); err != nil {
+		t.Fatal(err)
+	}
+	if c, ok := idx.Get("db"); !ok || c.ID != "1111" {
+		t.Errorf("Get(db) = %+v, %v", c, ok)
+	}
+	// 读取后加入索引，之后可以按ID查找
+	if c, ok := idx.Get("1111"); !ok || c.Name != "db" {
+		t.Errorf("Get(1111) = %+v, %v", c, ok)
+	}
+
+	tests := []string{"missing", "../db", "db/..", ""}
+	for _, name := range tests {
+		if c, ok := idx.Get(name); ok {
+			t.Errorf("Get(%q) = %+v, want not found", name, c)
+		}
+	}
+}
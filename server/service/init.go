@@ -0,0 +1,138 @@
+package service
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+
+	"github.com/bytedance/sonic"
+)
+
+// initPipeFd 容器 init 进程读取启动参数的管道，由 NewParentProcess 作为 ExtraFiles 的第一个传入
+const initPipeFd = 3
+
+// defaultPath 容器进程默认的 PATH，与 docker 相同
+const defaultPath = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+// nsenterEnvs nsenter 用于区分创建容器和容器 init 的环境变量，不传给用户命令
+var nsenterEnvs = []string{"ZDOCKER_CREATE", "ZDOCKER_INIT"}
+
+// minimalEnv 返回容器进程和容器内执行的命令使用的环境变量：PATH、HOME、TERM 加上 extra。
+// 不继承服务端的环境变量，避免 ZDOCKER_ADMIN_PASSWORD、ZDOCKER_WEB_DATA 等进入容器；
+// extra 中的同名变量覆盖默认值
+func minimalEnv(extra ...string) []string {
+	env := []string{"PATH=" + defaultPath, "HOME=/root", "TERM=xterm"}
+	return append(env, extra...)
+}
+
+// initEnv 返回用户命令的环境变量：去掉 nsenter 使用的变量，同名变量保留最后一个
+func initEnv(environ []string) []string {
+	index := make(map[string]int, len(environ))
+	env := make([]string, 0, len(environ))
+	for _, kv := range environ {
+		key, _, _ := strings.Cut(kv, "=")
+		if slices.Contains(nsenterEnvs, key) {
+			continue
+		}
+		if i, ok := index[key]; ok {
+			env[i] = kv
+			continue
+		}
+		index[key] = len(env)
+		env = append(env, kv)
+	}
+	return env
+}
+
+// initConfig 通过管道发送给容器 init 进程的启动参数。zdocker 自带的 init 用空格拼接 argv，
+// 包含空格的参数（如 sh -c 的脚本）会被拆开，因此使用 JSON 传递
+type initConfig struct {
+	Args    []string `json:"args"`
+	Workdir string   `json:"workdir,omitempty"`
+}
+
+// RunInitProcess 容器 init 进程入口，只在 /proc/self/exe init 中调用。
+// 读取启动参数，切换到容器根文件系统并进入工作目录后 exec 用户命令
+func RunInitProcess() error {
+	pipe := os.NewFile(uintptr(initPipeFd), "pipe")
+	data, err := io.ReadAll(pipe)
+	pipe.Close()
+	if err != nil {
+		return fmt.Errorf("读取启动参数失败: %v", err)
+	}
+	var cfg initConfig
+	if err := sonic.Unmarshal(data, &cfg); err != nil {
+		return fmt.Errorf("解析启动参数失败: %v", err)
+	}
+	if len(cfg.Args) == 0 {
+		return fmt.Errorf("启动参数中没有命令")
+	}
+
+	if err := setUpMount(); err != nil {
+		return err
+	}
+	if cfg.Workdir != "" {
+		if err := os.MkdirAll(cfg.Workdir, 0755); err != nil {
+			return fmt.Errorf("创建工作目录失败: %v", err)
+		}
+		if err := os.Chdir(cfg.Workdir); err != nil {
+			return fmt.Errorf("进入工作目录失败: %v", err)
+		}
+	}
+
+	path, err := exec.LookPath(cfg.Args[0])
+	if err != nil {
+		return fmt.Errorf("查找可执行文件失败: %v", err)
+	}
+	return syscall.Exec(path, cfg.Args, initEnv(os.Environ()))
+}
+
+// setUpMount 将当前目录（容器的 overlay 挂载点）切换为根文件系统，并挂载 /proc 和 /dev，与 zdocker 的 init 相同
+func setUpMount() error {
+	// 挂载传播默认为 shared，pivot_root 要求新旧根不共享，先改为 private 以免影响宿主机
+	if err := syscall.Mount("", "/", "", syscall.MS_PRIVATE|syscall.MS_REC, ""); err != nil {
+		return fmt.Errorf("设置挂载传播失败: %v", err)
+	}
+	pwd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("获取当前目录失败: %v", err)
+	}
+	if err := pivotRoot(pwd); err != nil {
+		return err
+	}
+
+	syscall.Mount("proc", "/proc", "proc", syscall.MS_NOEXEC|syscall.MS_NOSUID|syscall.MS_NODEV, "")
+	syscall.Mount("tmpfs", "/dev", "tmpfs", syscall.MS_NOSUID|syscall.MS_STRICTATIME, "mode=755")
+	return nil
+}
+
+// pivotRoot 将 root 绑定挂载到自身后通过 pivot_root 切换为根目录，并卸载旧的根目录
+func pivotRoot(root string) error {
+	if err := syscall.Mount(root, root, "bind", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+		return fmt.Errorf("绑定挂载根文件系统失败: %v", err)
+	}
+	if err := syscall.Chdir(root); err != nil {
+		return fmt.Errorf("进入根文件系统失败: %v", err)
+	}
+	// 容器重启时保留可写层，上次意外退出可能残留 .pivot_root
+	pivotDir := filepath.Join(root, ".pivot_root")
+	if err := os.Mkdir(pivotDir, 0777); err != nil && !os.IsExist(err) {
+		return fmt.Errorf("创建 .pivot_root 失败: %v", err)
+	}
+	if err := syscall.PivotRoot(root, pivotDir); err != nil {
+		return fmt.Errorf("pivot_root 失败: %v", err)
+	}
+	if err := syscall.Chdir("/"); err != nil {
+		return fmt.Errorf("进入新的根目录失败: %v", err)
+	}
+	pivotDir = filepath.Join("/", ".pivot_root")
+	if err := syscall.Unmount(pivotDir, syscall.MNT_DETACH); err != nil {
+		return fmt.Errorf("卸载旧的根目录失败: %v", err)
+	}
+	return os.Remove(pivotDir)
+}
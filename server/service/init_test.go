@@ -0,0 +1,53 @@
+package service
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInitEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		environ []string
+		want    []string
+	}{
+		{name: "empty", environ: nil, want: []string{}},
+		{
+			name:    "nsenter variables removed",
+			environ: []string{"ZDOCKER_CREATE=1", "PATH=/bin", "ZDOCKER_INIT=1", "APP=x"},
+			want:    []string{"PATH=/bin", "APP=x"},
+		},
+		{
+			name:    "last value wins",
+			environ: []string{"PATH=/bin", "HOME=/root", "PATH=/usr/bin"},
+			want:    []string{"PATH=/usr/bin", "HOME=/root"},
+		},
+		{
+			name:    "value with equals sign",
+			environ: []string{"OPTS=a=b", "EMPTY="},
+			want:    []string{"OPTS=a=b", "EMPTY="},
+		},
+	}
+	for _, tt := range tests {
+		if got := initEnv(tt.environ); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: initEnv = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMinimalEnv(t *testing.T) {
+	t.Setenv("ZDOCKER_ADMIN_PASSWORD", "secret")
+	t.Setenv("ZDOCKER_WEB_DATA", "/var/lib/zdocker-web")
+
+	env := initEnv(minimalEnv("APP=x", "PATH=/app/bin"))
+	want := []string{"PATH=/app/bin", "HOME=/root", "TERM=xterm", "APP=x"}
+	if !reflect.DeepEqual(env, want) {
+		t.Errorf("minimalEnv = %q, want %q", env, want)
+	}
+	for _, kv := range minimalEnv() {
+		if strings.HasPrefix(kv, "ZDOCKER_") {
+			t.Errorf("minimalEnv contains server variable %s", kv)
+		}
+	}
+}
@@ -0,0 +1,418 @@
+package service
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/crazyfrankie/zdocker/container"
+)
+
+// 资源限制的来源
+const (
+	// ResourcesFromCgroup 从运行中容器进程所在的 cgroup 读取
+	ResourcesFromCgroup = "cgroup"
+	// ResourcesFromConfig 容器未运行，取自创建时的运行参数
+	ResourcesFromConfig = "config"
+)
+
+// inspectNamespaces 读取 inode 编号的命名空间类型
+var inspectNamespaces = []string{"cgroup", "ipc", "mnt", "net", "pid", "user", "uts"}
+
+// cgroupV1Unlimited cgroup v1 中大于该值的内存限制表示不限制，内核按页对齐后的最大值略小于 2^63
+const cgroupV1Unlimited = 1 << 62
+
+// ContainerInspect 容器的完整信息，字段均已解析为对应的类型
+type ContainerInspect struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Image  string `json:"image"`
+	Status string `json:"status"`
+	// Running 容器状态为运行中且进程存在
+	Running bool      `json:"running"`
+	Created time.Time `json:"created"`
+	// StartedAt 容器进程的启动时间，重启后与 Created 不同；未运行时为空
+	StartedAt *time.Time `json:"started_at,omitempty"`
+	// UptimeSeconds 容器进程已运行的秒数，未运行时为 0
+	UptimeSeconds int64 `json:"uptime_seconds"`
+	// PID 容器 init 进程在宿主机上的 PID，未运行时为 0
+	PID int `json:"pid"`
+
+	// Args 容器进程的命令行参数，运行中读取 /proc/<pid>/cmdline，否则取创建时的 entrypoint 和命令；
+	// --password=xxx 形式的敏感参数已替换
+	Args []string `json:"args"`
+	// Env 容器进程的环境变量，运行中读取 /proc/<pid>/environ，否则取自运行参数；敏感变量的值已替换
+	Env       []string           `json:"env"`
+	Resources ContainerResources `json:"resources"`
+	Rootfs    ContainerRootfs    `json:"rootfs"`
+	Mounts    []Mount            `json:"mounts"`
+	Network   *ContainerNetwork  `json:"network,omitempty"`
+	Ports     []PortBinding      `json:"ports"`
+	// Namespaces 命名空间类型到 inode 编号的映射，相同编号表示同一命名空间；未运行时为空
+	Namespaces map[string]uint64 `json:"namespaces"`
+
+	RestartPolicy string `json:"restart_policy"`
+	RestartCount  int    `json:"restart_count"`
+}
+
+// ContainerResources 容器的资源限制，0 或空表示不限制
+type ContainerResources struct {
+	Source      string `json:"source"`
+	MemoryLimit uint64 `json:"memory_limit"`
+	// CPUShares cgroup v1 的 CPU 权重
+	CPUShares uint64 `json:"cpu_shares,omitempty"`
+	// CPUWeight cgroup v2 的 CPU 权重
+	CPUWeight uint64 `json:"cpu_weight,omitempty"`
+	CPUSet    string `json:"cpuset"`
+	PidsLimit uint64 `json:"pids_limit"`
+}
+
+// ContainerRootfs 容器根文件系统的 overlay 目录
+type ContainerRootfs struct {
+	// Lower 镜像解压目录，只读
+	Lower string `json:"lower"`
+	// Upper 容器的可写层
+	Upper  string `json:"upper"`
+	Merged string `json:"merged"`
+	// Mounted 合并目录当前是否已挂载
+	Mounted bool `json:"mounted"`
+}
+
+// Mount 挂载到容器内的数据卷
+type Mount struct {
+	Type        string `json:"type"`
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+}
+
+// ContainerNetwork 容器连接的网络
+type ContainerNetwork struct {
+	Name string `json:"name"`
+	// IPAddresses 容器网络命名空间中的 IPv4 地址，不含回环地址；未运行时为空
+	IPAddresses []string `json:"ip_addresses"`
+}
+
+// PortBinding 宿主机端口到容器端口的映射
+type PortBinding struct {
+	Host      int    `json:"host"`
+	Container int    `json:"container"`
+	Proto     string `json:"proto"`
+}
+
+// ParsePortBinding 解析 宿主机端口:容器端口[/协议] 格式的端口映射，协议默认为 tcp，与 zdocker -p 一致
+func ParsePortBinding(s string) (PortBinding, error) {
+	ports, proto, ok := strings.Cut(s, "/")
+	if !ok {
+		proto = "tcp"
+	}
+	host, cont, ok := strings.Cut(ports, ":")
+	if !ok || (proto != "tcp" && proto != "udp") {
+		return PortBinding{}, fmt.Errorf("%w: 无效的端口映射 %q", ErrInvalidArgument, s)
+	}
+	hostPort, err := strconv.Atoi(host)
+	if err != nil || hostPort < 1 || hostPort > 65535 {
+		return PortBinding{}, fmt.Errorf("%w: 无效的宿主机端口 %q", ErrInvalidArgument, host)
+	}
+	contPort, err := strconv.Atoi(cont)
+	if err != nil || contPort < 1 || contPort > 65535 {
+		return PortBinding{}, fmt.Errorf("%w: 无效的容器端口 %q", ErrInvalidArgument, cont)
+	}
+	return PortBinding{Host: hostPort, Container: contPort, Proto: proto}, nil
+}
+
+// inspectContainer 汇总容器配置、运行参数、cgroup 与 /proc 中的信息
+func inspectContainer(containerId string) (ContainerInspect, error) {
+	name, err := lookupContainerName(containerId)
+	if err != nil {
+		return ContainerInspect{}, err
+	}
+	info, err := readContainerInfo(name)
+	if err != nil {
+		return ContainerInspect{}, err
+	}
+	req, _ := readRunConfig(name)
+
+	inspect := ContainerInspect{
+		ID:         info.ID,
+		Name:       info.Name,
+		Image:      req.Image,
+		Status:     info.Status,
+		Args:       containerArgs(req),
+		Env:        environmentList(req.Environment),
+		Mounts:     []Mount{},
+		Ports:      []PortBinding{},
+		Namespaces: map[string]uint64{},
+	}
+	if inspect.Image == "" {
+		inspect.Image = imageFromMount(name)
+	}
+	if len(inspect.Args) == 0 {
+		inspect.Args = recordedArgs(info.Command)
+	}
+	if created, err := time.ParseInLocation(time.DateTime, info.CreateTime, time.Local); err == nil {
+		inspect.Created = created
+	}
+
+	merged := fmt.Sprintf(container.MntUrl, name)
+	inspect.Rootfs = ContainerRootfs{
+		Upper:   fmt.Sprintf(container.WriteLayerUrl, name),
+		Merged:  merged,
+		Mounted: isMountPoint(merged),
+	}
+	if inspect.Image != "" {
+		inspect.Rootfs.Lower = fmt.Sprintf(container.OverlayLower, inspect.Image)
+	}
+
+	if parts := strings.Split(info.Volume, ":"); len(parts) == 2 && parts[0] != "" && parts[1] != "" {
+		inspect.Mounts = append(inspect.Mounts, Mount{
+			Type:        "bind",
+			Source:      parts[0],
+			Destination: filepath.Clean("/" + parts[1]),
+		})
+	}
+	for _, mapping := range info.PortMapping {
+		if port, err := ParsePortBinding(mapping); err == nil {
+			inspect.Ports = append(inspect.Ports, port)
+		}
+	}
+	if req.Network != "" {
+		inspect.Network = &ContainerNetwork{Name: req.Network, IPAddresses: []string{}}
+	}
+
+	inspect.Resources = resourcesFromConfig(req)
+	if info.Status == container.RUNNING && isProcessRunning(info.PID) {
+		inspectProcess(info.PID, &inspect)
+	}
+	inspect.maskSecrets()
+	return inspect, nil
+}
+
+// maskSecrets 替换名称中包含敏感词的环境变量的值，以及命令行中 --password=xxx 形式的参数
+func (i *ContainerInspect) maskSecrets() {
+	for n, kv := range i.Env {
+		if key, _, ok := strings.Cut(kv, "="); ok && secretKeyPattern.MatchString(key) {
+			i.Env[n] = key + "=" + maskedValue
+		}
+	}
+	for n, arg := range i.Args {
+		i.Args[n] = secretAssignPattern.ReplaceAllString(arg, "${1}"+maskedValue)
+	}
+}
+
+// HideEnv 隐藏全部环境变量的值，只保留名称，用于没有执行命令权限的调用方
+func (i *ContainerInspect) HideEnv() {
+	for n, kv := range i.Env {
+		if key, _, ok := strings.Cut(kv, "="); ok {
+			i.Env[n] = key + "=" + maskedValue
+		}
+	}
+}
+
+// inspectProcess 从运行中的容器进程读取启动时间、命令行、环境变量、资源限制、IP 地址和命名空间
+func inspectProcess(pid string, inspect *ContainerInspect) {
+	inspect.Running = true
+	inspect.PID, _ = strconv.Atoi(pid)
+
+	if started, err := processStartTime(pid); err == nil {
+		inspect.StartedAt = &started
+		inspect.UptimeSeconds = int64(time.Since(started).Seconds())
+	}
+	if args := readNulSeparated(fmt.Sprintf("/proc/%s/cmdline", pid)); len(args) > 0 {
+		inspect.Args = args
+	}
+	if env := readNulSeparated(fmt.Sprintf("/proc/%s/environ", pid)); env != nil {
+		inspect.Env = env
+	}
+	if resources, err := resourcesFromCgroup(pid); err == nil {
+		inspect.Resources = resources
+	}
+	if inspect.Network != nil {
+		inspect.Network.IPAddresses = processIPv4Addresses(pid)
+	}
+	for _, ns := range inspectNamespaces {
+		link, err := os.Readlink(fmt.Sprintf("/proc/%s/ns/%s", pid, ns))
+		if err != nil {
+			continue
+		}
+		// 格式为 net:[4026531840]
+		_, inode, ok := strings.Cut(link, "[")
+		if !ok {
+			continue
+		}
+		if n, err := strconv.ParseUint(strings.TrimSuffix(inode, "]"), 10, 64); err == nil {
+			inspect.Namespaces[ns] = n
+		}
+	}
+}
+
+// environmentList 将环境变量映射转换为按名称排序的 KEY=VALUE 列表
+func environmentList(env map[string]string) []string {
+	list := make([]string, 0, len(env))
+	for k, v := range env {
+		list = append(list, k+"="+v)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// resourcesFromConfig 根据创建容器时的参数得到资源限制
+func resourcesFromConfig(req CreateContainerRequest) ContainerResources {
+	resources := ContainerResources{Source: ResourcesFromConfig, CPUSet: req.CpuSet}
+	if req.Memory != "" {
+		resources.MemoryLimit, _ = parseMemorySize(req.Memory)
+	}
+	if req.CpuShare != "" {
+		resources.CPUShares, _ = strconv.ParseUint(req.CpuShare, 10, 64)
+	}
+	return resources
+}
+
+// resourcesFromCgroup 从进程所在的 cgroup 读取实际生效的资源限制
+func resourcesFromCgroup(pid string) (ContainerResources, error) {
+	paths, err := cgroupPaths(pid)
+	if err != nil {
+		return ContainerResources{}, err
+	}
+
+	resources := ContainerResources{Source: ResourcesFromCgroup}
+	if unified, ok := paths[""]; ok && len(paths) == 1 {
+		dir := filepath.Join(cgroupRoot, unified)
+		resources.MemoryLimit = readUint(filepath.Join(dir, "memory.max"))
+		resources.CPUWeight = readUint(filepath.Join(dir, "cpu.weight"))
+		resources.CPUSet = readString(filepath.Join(dir, "cpuset.cpus.effective"))
+		resources.PidsLimit = readUint(filepath.Join(dir, "pids.max"))
+		return resources, nil
+	}
+
+	if path, ok := paths["memory"]; ok {
+		if limit := readUint(filepath.Join(cgroupRoot, "memory", path, "memory.limit_in_bytes")); limit < cgroupV1Unlimited {
+			resources.MemoryLimit = limit
+		}
+	}
+	if path, ok := paths["cpu"]; ok {
+		resources.CPUShares = readUint(filepath.Join(cgroupRoot, "cpu", path, "cpu.shares"))
+	}
+	if path, ok := paths["cpuset"]; ok {
+		resources.CPUSet = readString(filepath.Join(cgroupRoot, "cpuset", path, "cpuset.cpus"))
+	}
+	if path, ok := paths["pids"]; ok {
+		resources.PidsLimit = readUint(filepath.Join(cgroupRoot, "pids", path, "pids.max"))
+	}
+	return resources, nil
+}
+
+// parseMemorySize 解析 zdocker -m 使用的内存大小，支持 k、m、g 后缀，不区分大小写
+func parseMemorySize(s string) (uint64, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	multiplier := uint64(1)
+	switch {
+	case strings.HasSuffix(s, "k"):
+		multiplier = 1 << 10
+	case strings.HasSuffix(s, "m"):
+		multiplier = 1 << 20
+	case strings.HasSuffix(s, "g"):
+		multiplier = 1 << 30
+	}
+	if multiplier > 1 {
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: 无效的内存大小 %q", ErrInvalidArgument, s)
+	}
+	return n * multiplier, nil
+}
+
+// processStartTime 根据 /proc/<pid>/stat 的 starttime 和系统启动时间计算进程启动时间
+func processStartTime(pid string) (time.Time, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%s/stat", pid))
+	if err != nil {
+		return time.Time{}, err
+	}
+	// 进程名可能包含空格和括号，从最后一个右括号之后开始按空白拆分，starttime 为第 22 个字段
+	stat := string(data)
+	fields := strings.Fields(stat[strings.LastIndex(stat, ")")+1:])
+	if len(fields) < 20 {
+		return time.Time{}, fmt.Errorf("无法解析 /proc/%s/stat", pid)
+	}
+	ticks, err := strconv.ParseUint(fields[19], 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var bootTime int64
+	f, err := os.Open("/proc/stat")
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if value, ok := strings.CutPrefix(scanner.Text(), "btime "); ok {
+			bootTime, err = strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+			if err != nil {
+				return time.Time{}, err
+			}
+			break
+		}
+	}
+	if bootTime == 0 {
+		return time.Time{}, fmt.Errorf("无法读取系统启动时间")
+	}
+	// starttime 的单位是 USER_HZ，通常为 100
+	return time.Unix(bootTime, 0).Add(time.Duration(ticks) * (time.Second / 100)), nil
+}
+
+// processIPv4Addresses 从进程网络命名空间的 /proc/<pid>/net/fib_trie 读取本地 IPv4 地址
+func processIPv4Addresses(pid string) []string {
+	addresses := []string{}
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%s/net/fib_trie", pid))
+	if err != nil {
+		return addresses
+	}
+
+	// 本地地址的格式为一行 "|-- 172.18.0.2"，紧跟一行 "/32 host LOCAL"
+	seen := make(map[string]bool)
+	var last string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if ip, ok := strings.CutPrefix(line, "|-- "); ok {
+			last = ip
+			continue
+		}
+		if line == "/32 host LOCAL" && last != "" && !strings.HasPrefix(last, "127.") && !seen[last] {
+			seen[last] = true
+			addresses = append(addresses, last)
+		}
+	}
+	return addresses
+}
+
+// readNulSeparated 读取以 NUL 分隔的 /proc 文件，如 cmdline 和 environ；读取失败时返回 nil
+func readNulSeparated(path string) []string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	items := []string{}
+	for _, item := range strings.Split(string(data), "\x00") {
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// readString 读取只包含一行文本的 cgroup 文件
+func readString(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
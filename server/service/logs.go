@@ -0,0 +1,530 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// logTrackInterval 记录日志文件增长的间隔，决定日志时间戳的精度
+	logTrackInterval = time.Second
+	// logFollowInterval 跟随模式下检查日志文件的间隔
+	logFollowInterval = 250 * time.Millisecond
+	// logPartialFlush 没有换行的末尾内容超过该时间不再增长时按一行输出
+	logPartialFlush = time.Second
+	// logIndexSuffix 日志时间索引文件后缀，与日志文件放在同一目录
+	logIndexSuffix = ".idx"
+	// maxLogCheckpoints 单个日志文件保留的检查点上限，超过后隔一个丢弃一个
+	maxLogCheckpoints = 100000
+	// tailChunkSize 从文件末尾向前查找 tail 行时每次读取的大小
+	tailChunkSize = 64 * 1024
+)
+
+// LogOptions 日志查询参数
+type LogOptions struct {
+	// Tail 只返回最后 N 行，小于 0 表示全部
+	Tail int
+	// Since/Until 只返回该时间范围内的日志，零值表示不限制
+	Since time.Time
+	Until time.Time
+	// Offset 从日志文件的该字节偏移开始读取，用于跟随模式断线续传
+	Offset int64
+}
+
+// LogLine 一行日志
+type LogLine struct {
+	// Time 服务端观察到该行写入的时间，精度为 logTrackInterval
+	Time time.Time `json:"time"`
+	Line string    `json:"line"`
+	// Offset 该行结束处在日志文件中的字节偏移，可作为续传位置
+	Offset int64 `json:"offset"`
+}
+
+// Format 输出一行日志文本，timestamps 为 true 时加上 RFC3339 时间前缀
+func (l LogLine) Format(timestamps bool) string {
+	if timestamps {
+		return l.Time.Format(time.RFC3339Nano) + " " + l.Line + "\n"
+	}
+	return l.Line + "\n"
+}
+
+// LogSink 跟随模式下接收日志的对象
+type LogSink interface {
+	// WriteLine 输出一行日志
+	WriteLine(line LogLine) error
+	// Truncated 日志文件被截断，之后从文件开头重新输出
+	Truncated() error
+}
+
+// logCheckpoint 某一时刻日志文件的大小
+type logCheckpoint struct {
+	Size int64
+	Time time.Time
+}
+
+// logIndex 单个日志文件的增长记录。zdocker 写入的日志没有时间信息，
+// 通过记录“某时刻文件大小”推算每一行的写入时间
+type logIndex struct {
+	path        string
+	checkpoints []logCheckpoint
+}
+
+// loadLogIndex 读取日志文件的时间索引，索引不存在时以文件修改时间作为第一个检查点
+func loadLogIndex(path string) *logIndex {
+	idx := &logIndex{path: path}
+
+	if f, err := os.Open(path + logIndexSuffix); err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			sizeStr, timeStr, ok := strings.Cut(scanner.Text(), " ")
+			if !ok {
+				continue
+			}
+			size, err1 := strconv.ParseInt(sizeStr, 10, 64)
+			nanos, err2 := strconv.ParseInt(timeStr, 10, 64)
+			if err1 != nil || err2 != nil {
+				continue
+			}
+			idx.checkpoints = append(idx.checkpoints, logCheckpoint{Size: size, Time: time.Unix(0, nanos)})
+		}
+		f.Close()
+	}
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		return idx
+	}
+	if last, ok := idx.last(); ok && stat.Size() >= last.Size {
+		if stat.Size() > last.Size {
+			// 服务停止期间写入的日志只能以文件修改时间近似
+			idx.append(logCheckpoint{Size: stat.Size(), Time: stat.ModTime()})
+		}
+		return idx
+	}
+	idx.reset(logCheckpoint{Size: stat.Size(), Time: stat.ModTime()})
+	return idx
+}
+
+// last 返回最后一个检查点
+func (x *logIndex) last() (logCheckpoint, bool) {
+	if len(x.checkpoints) == 0 {
+		return logCheckpoint{}, false
+	}
+	return x.checkpoints[len(x.checkpoints)-1], true
+}
+
+// append 追加检查点并写入索引文件
+func (x *logIndex) append(cp logCheckpoint) {
+	x.checkpoints = append(x.checkpoints, cp)
+	if len(x.checkpoints) > maxLogCheckpoints {
+		x.compact()
+		return
+	}
+
+	f, err := os.OpenFile(x.path+logIndexSuffix, os.O_WRONLY|os.O_APPEND|os.O_CREATE, runConfigFilePerm)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(f, "%d %d\n", cp.Size, cp.Time.UnixNano())
+	f.Close()
+}
+
+// reset 日志文件被截断，清空检查点
+func (x *logIndex) reset(cp logCheckpoint) {
+	x.checkpoints = []logCheckpoint{cp}
+	x.persist()
+}
+
+// compact 隔一个丢弃一个检查点，保留最后一个。被丢弃区间内的行时间会偏晚
+func (x *logIndex) compact() {
+	kept := x.checkpoints[:0]
+	for i, cp := range x.checkpoints {
+		if i%2 == 1 || i == len(x.checkpoints)-1 {
+			kept = append(kept, cp)
+		}
+	}
+	x.checkpoints = kept
+	x.persist()
+}
+
+// persist 重写整个索引文件
+func (x *logIndex) persist() {
+	var b bytes.Buffer
+	for _, cp := range x.checkpoints {
+		fmt.Fprintf(&b, "%d %d\n", cp.Size, cp.Time.UnixNano())
+	}
+	if err := writeFileAtomic(x.path+logIndexSuffix, b.Bytes(), runConfigFilePerm); err != nil && !os.IsNotExist(err) {
+		log.Printf("日志索引: 写入 %s 失败: %v", x.path+logIndexSuffix, err)
+	}
+}
+
+// timeAt 返回结束于 offset 的行的写入时间，即第一个覆盖该偏移的检查点时间
+func (x *logIndex) timeAt(offset int64) time.Time {
+	i := sort.Search(len(x.checkpoints), func(i int) bool {
+		return x.checkpoints[i].Size >= offset
+	})
+	if i == len(x.checkpoints) {
+		return time.Now()
+	}
+	return x.checkpoints[i].Time
+}
+
+// offsetSince 返回 since 之后写入的日志在文件中的起始偏移
+func (x *logIndex) offsetSince(since time.Time) int64 {
+	var offset int64
+	for _, cp := range x.checkpoints {
+		if !cp.Time.Before(since) {
+			break
+		}
+		offset = cp.Size
+	}
+	return offset
+}
+
+// offsetUntil 返回 until 之前写入的日志在文件中的结束偏移
+func (x *logIndex) offsetUntil(until time.Time) int64 {
+	var offset int64
+	for _, cp := range x.checkpoints {
+		if cp.Time.After(until) {
+			break
+		}
+		offset = cp.Size
+	}
+	return offset
+}
+
+// LogTracker 定期记录容器日志文件的增长，为日志提供时间戳，并实现日志的查询和跟随
+type LogTracker struct {
+	runtime Runtime
+
+	mu      sync.Mutex
+	indexes map[string]*logIndex
+
+	done chan struct{}
+}
+
+// NewLogTracker 创建日志跟踪器，需要调用 Start 开始记录
+func NewLogTracker(runtime Runtime) *LogTracker {
+	return &LogTracker{
+		runtime: runtime,
+		indexes: make(map[string]*logIndex),
+		done:    make(chan struct{}),
+	}
+}
+
+// Start 启动后台记录协程
+func (t *LogTracker) Start() {
+	go func() {
+		ticker := time.NewTicker(logTrackInterval)
+		defer ticker.Stop()
+		for {
+			t.scan()
+			select {
+			case <-t.done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop 停止后台记录协程
+func (t *LogTracker) Stop() {
+	close(t.done)
+}
+
+// scan 记录所有容器日志文件的当前大小，并清理已删除容器的索引
+func (t *LogTracker) scan() {
+	containers, err := t.runtime.ListContainers()
+	if err != nil {
+		return
+	}
+
+	seen := make(map[string]struct{}, len(containers))
+	for _, c := range containers {
+		path, err := t.runtime.ContainerLogFile(c.Name)
+		if err != nil {
+			continue
+		}
+		seen[path] = struct{}{}
+		t.observe(path)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for path := range t.indexes {
+		if _, ok := seen[path]; !ok {
+			delete(t.indexes, path)
+		}
+	}
+}
+
+// observe 记录日志文件当前大小，返回文件大小
+func (t *LogTracker) observe(path string) (int64, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	idx, ok := t.indexes[path]
+	if !ok {
+		idx = loadLogIndex(path)
+		t.indexes[path] = idx
+	}
+
+	size := stat.Size()
+	last, _ := idx.last()
+	switch {
+	case size < last.Size:
+		idx.reset(logCheckpoint{Size: size, Time: time.Now()})
+	case size > last.Size:
+		idx.append(logCheckpoint{Size: size, Time: time.Now()})
+	}
+	return size, nil
+}
+
+// timeAt 返回日志文件中结束于 offset 的行的写入时间
+func (t *LogTracker) timeAt(path string, offset int64) time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if idx, ok := t.indexes[path]; ok {
+		return idx.timeAt(offset)
+	}
+	return time.Now()
+}
+
+// bounds 根据 since/until 计算需要读取的文件区间
+func (t *LogTracker) bounds(path string, size int64, opts LogOptions) (int64, int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	start, end := int64(0), size
+	if opts.Offset > 0 && opts.Offset <= size {
+		start = opts.Offset
+	}
+	idx, ok := t.indexes[path]
+	if !ok {
+		return start, end
+	}
+	if !opts.Since.IsZero() {
+		start = max(start, idx.offsetSince(opts.Since))
+	}
+	if !opts.Until.IsZero() {
+		end = min(end, idx.offsetUntil(opts.Until))
+	}
+	return start, max(start, end)
+}
+
+// Read 读取容器日志。partial 为 false 时末尾没有换行的内容不输出，
+// 返回的偏移为下一次读取的起始位置
+func (t *LogTracker) Read(containerName string, opts LogOptions, partial bool) ([]LogLine, int64, error) {
+	path, err := t.runtime.ContainerLogFile(containerName)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	size, err := t.observe(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []LogLine{}, 0, nil
+		}
+		return nil, 0, fmt.Errorf("读取日志文件失败: %v", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, fmt.Errorf("读取日志文件失败: %v", err)
+	}
+	defer f.Close()
+
+	start, end := t.bounds(path, size, opts)
+	if !opts.Since.IsZero() {
+		// 检查点可能落在一行中间，回退到该行开头，由下面按行时间过滤
+		if start, err = lineStart(f, start); err != nil {
+			return nil, 0, fmt.Errorf("读取日志文件失败: %v", err)
+		}
+	}
+	if opts.Tail >= 0 {
+		tailStart, err := tailOffset(f, start, end, opts.Tail)
+		if err != nil {
+			return nil, 0, fmt.Errorf("读取日志文件失败: %v", err)
+		}
+		start = tailStart
+	}
+
+	data := make([]byte, end-start)
+	if _, err := f.ReadAt(data, start); err != nil && !errors.Is(err, io.EOF) {
+		return nil, 0, fmt.Errorf("读取日志文件失败: %v", err)
+	}
+
+	// until 截断的区间末尾可能是半行，不输出
+	lines, consumed := t.splitLines(path, data, start, partial && end == size)
+	result := make([]LogLine, 0, len(lines))
+	for _, line := range lines {
+		if !opts.Since.IsZero() && line.Time.Before(opts.Since) {
+			continue
+		}
+		if !opts.Until.IsZero() && line.Time.After(opts.Until) {
+			continue
+		}
+		result = append(result, line)
+	}
+	return result, start + consumed, nil
+}
+
+// splitLines 将 data 按行拆分，返回完整的行和已消费的字节数
+func (t *LogTracker) splitLines(path string, data []byte, base int64, partial bool) ([]LogLine, int64) {
+	var lines []LogLine
+	var consumed int64
+	for len(data) > 0 {
+		text := data
+		n := len(data)
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			text, n = data[:i], i+1
+		} else if !partial {
+			break
+		}
+
+		consumed += int64(n)
+		lines = append(lines, LogLine{
+			Time:   t.timeAt(path, base+consumed),
+			Line:   strings.TrimSuffix(string(text), "\r"),
+			Offset: base + consumed,
+		})
+		data = data[n:]
+	}
+	return lines, consumed
+}
+
+// Follow 从 offset 开始持续输出新写入的日志，直到 ctx 结束、到达 until 或容器被删除。
+// 容器被删除时返回 ErrContainerNotFound
+func (t *LogTracker) Follow(ctx context.Context, containerName string, offset int64, opts LogOptions, sink LogSink) error {
+	path, err := t.runtime.ContainerLogFile(containerName)
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(logFollowInterval)
+	defer ticker.Stop()
+
+	var pendingSize int64
+	var pendingSince time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		if !opts.Until.IsZero() && time.Now().After(opts.Until) {
+			return nil
+		}
+		if _, err := t.runtime.GetContainer(containerName); err != nil {
+			return err
+		}
+
+		size, err := t.observe(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				// 容器目录可能正在被删除，下一轮通过 GetContainer 确认
+				continue
+			}
+			return fmt.Errorf("读取日志文件失败: %v", err)
+		}
+		if size < offset {
+			offset = 0
+			pendingSize = 0
+			if err := sink.Truncated(); err != nil {
+				return err
+			}
+		}
+		if size == offset {
+			continue
+		}
+
+		// 末尾没有换行的内容在持续一段时间不增长后才输出
+		now := time.Now()
+		if size != pendingSize {
+			pendingSize = size
+			pendingSince = now
+		}
+		flushPartial := now.Sub(pendingSince) >= logPartialFlush
+
+		lines, next, err := t.Read(containerName, LogOptions{Tail: -1, Offset: offset}, flushPartial)
+		if err != nil {
+			return err
+		}
+		for _, line := range lines {
+			if err := sink.WriteLine(line); err != nil {
+				return err
+			}
+		}
+		offset = next
+	}
+}
+
+// lineStart 返回 offset 所在行的起始偏移
+func lineStart(f *os.File, offset int64) (int64, error) {
+	buf := make([]byte, tailChunkSize)
+	pos := offset
+	for pos > 0 {
+		size := min(int64(len(buf)), pos)
+		pos -= size
+		if _, err := f.ReadAt(buf[:size], pos); err != nil && !errors.Is(err, io.EOF) {
+			return 0, err
+		}
+		if i := bytes.LastIndexByte(buf[:size], '\n'); i >= 0 {
+			return pos + int64(i) + 1, nil
+		}
+	}
+	return 0, nil
+}
+
+// tailOffset 从 end 向前查找最后 n 行的起始偏移，不早于 start
+func tailOffset(f *os.File, start, end int64, n int) (int64, error) {
+	if n == 0 {
+		return end, nil
+	}
+
+	buf := make([]byte, tailChunkSize)
+	pos := end
+	newlines := 0
+	// 文件末尾的换行属于最后一行，不计入
+	skipLast := true
+	for pos > start {
+		size := min(int64(len(buf)), pos-start)
+		pos -= size
+		if _, err := f.ReadAt(buf[:size], pos); err != nil && !errors.Is(err, io.EOF) {
+			return 0, err
+		}
+		for i := size - 1; i >= 0; i-- {
+			if buf[i] != '\n' {
+				skipLast = false
+				continue
+			}
+			if skipLast {
+				skipLast = false
+				continue
+			}
+			newlines++
+			if newlines == n {
+				return pos + i + 1, nil
+			}
+		}
+	}
+	return start, nil
+}
@@ -0,0 +1,210 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// logRuntime 所有容器都使用同一个日志文件的运行时
+type logRuntime struct {
+	*FakeRuntime
+	path string
+}
+
+// ContainerLogFile 返回固定的日志文件
+func (r *logRuntime) ContainerLogFile(containerName string) (string, error) {
+	return r.path, nil
+}
+
+// writeLog 在临时目录中写入日志文件，返回文件路径
+func writeLog(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "container.log")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// logLines 返回日志行的文本
+func logLines(lines []LogLine) []string {
+	texts := []string{}
+	for _, l := range lines {
+		texts = append(texts, l.Line)
+	}
+	return texts
+}
+
+func TestTailOffset(t *testing.T) {
+	// 每行 1000 字节，跨越多个 tailChunkSize
+	long := strings.Repeat(strings.Repeat("x", 999)+"\n", 200)
+
+	tests := []struct {
+		name    string
+		content string
+		start   int64
+		n       int
+		want    int64
+	}{
+		{name: "zero lines", content: "a\nb\nc\n", n: 0, want: 6},
+		{name: "last line", content: "a\nb\nc\n", n: 1, want: 4},
+		{name: "two lines", content: "a\nb\nc\n", n: 2, want: 2},
+		{name: "all lines", content: "a\nb\nc\n", n: 3, want: 0},
+		{name: "more than available", content: "a\nb\nc\n", n: 10, want: 0},
+		{name: "no trailing newline", content: "a\nb\nc", n: 1, want: 4},
+		{name: "empty lines", content: "a\n\n\n", n: 2, want: 2},
+		{name: "not before start", content: "a\nb\nc\n", start: 2, n: 10, want: 2},
+		{name: "across chunks", content: long, n: 150, want: 50 * 1000},
+	}
+	for _, tt := range tests {
+		f, err := os.Open(writeLog(t, tt.content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := tailOffset(f, tt.start, int64(len(tt.content)), tt.n)
+		f.Close()
+		if err != nil || got != tt.want {
+			t.Errorf("%s: tailOffset = %d, %v, want %d", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestLineStart(t *testing.T) {
+	long := strings.Repeat("x", tailChunkSize+10)
+	content := "one\ntwo\n" + long + "\n"
+
+	tests := []struct {
+		offset int64
+		want   int64
+	}{
+		{offset: 0, want: 0},
+		{offset: 2, want: 0},
+		{offset: 4, want: 4},
+		{offset: 6, want: 4},
+		{offset: 8, want: 8},
+		{offset: int64(len(content)) - 1, want: 8},
+	}
+	f, err := os.Open(writeLog(t, content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for _, tt := range tests {
+		if got, err := lineStart(f, tt.offset); err != nil || got != tt.want {
+			t.Errorf("lineStart(%d) = %d, %v, want %d", tt.offset, got, err, tt.want)
+		}
+	}
+}
+
+func TestLogTrackerRead(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	content := "one\ntwo\nthree\nfour\npartial"
+	path := writeLog(t, content)
+
+	// one、two 在 t1 写入，three、four 在 t2 写入，partial 在 t3 写入
+	t1 := time.Unix(1000, 0)
+	t2 := t1.Add(time.Minute)
+	t3 := t2.Add(time.Minute)
+	tracker := NewLogTracker(&logRuntime{FakeRuntime: NewFakeRuntime(), path: path})
+	tracker.indexes[path] = &logIndex{path: path, checkpoints: []logCheckpoint{
+		{Size: 8, Time: t1},
+		{Size: 19, Time: t2},
+		{Size: int64(len(content)), Time: t3},
+	}}
+
+	tests := []struct {
+		name     string
+		opts     LogOptions
+		partial  bool
+		want     []string
+		wantNext int64
+	}{
+		{name: "all", opts: LogOptions{Tail: -1}, want: []string{"one", "two", "three", "four"}, wantNext: 19},
+		{name: "all with partial", opts: LogOptions{Tail: -1}, partial: true, want: []string{"one", "two", "three", "four", "partial"}, wantNext: 26},
+		{name: "tail", opts: LogOptions{Tail: 2}, partial: true, want: []string{"four", "partial"}, wantNext: 26},
+		{name: "tail zero", opts: LogOptions{Tail: 0}, want: []string{}, wantNext: 26},
+		{name: "offset", opts: LogOptions{Tail: -1, Offset: 8}, want: []string{"three", "four"}, wantNext: 19},
+		{name: "since checkpoint", opts: LogOptions{Tail: -1, Since: t2}, want: []string{"three", "four"}, wantNext: 19},
+		{name: "since between checkpoints", opts: LogOptions{Tail: -1, Since: t1.Add(time.Second)}, want: []string{"three", "four"}, wantNext: 19},
+		{name: "until", opts: LogOptions{Tail: -1, Until: t1}, partial: true, want: []string{"one", "two"}, wantNext: 8},
+		{name: "since and until", opts: LogOptions{Tail: -1, Since: t2, Until: t2}, partial: true, want: []string{"three", "four"}, wantNext: 19},
+		{name: "since, until and tail", opts: LogOptions{Tail: 1, Since: t1, Until: t2}, want: []string{"four"}, wantNext: 19},
+	}
+	for _, tt := range tests {
+		lines, next, err := tracker.Read("web", tt.opts, tt.partial)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := logLines(lines); !reflect.DeepEqual(got, tt.want) || next != tt.wantNext {
+			t.Errorf("%s: Read = %v, %d, want %v, %d", tt.name, got, next, tt.want, tt.wantNext)
+		}
+	}
+
+	lines, _, err := tracker.Read("web", LogOptions{Tail: -1, Since: t2}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, l := range lines {
+		if !l.Time.Equal(t2) {
+			t.Errorf("line %q time = %v, want %v", l.Line, l.Time, t2)
+		}
+	}
+	if got, want := lines[0].Format(true), t2.Format(time.RFC3339Nano)+" three\n"; got != want {
+		t.Errorf("Format = %q, want %q", got, want)
+	}
+}
+
+func TestLogIndexPersist(t *testing.T) {
+	path := writeLog(t, "one\n")
+	tracker := NewLogTracker(nil)
+	if _, err := tracker.observe(path); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("two\n")
+	f.Close()
+	if _, err := tracker.observe(path); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重新加载时读取索引文件中的检查点
+	sizes := func(x *logIndex) []int64 {
+		var sizes []int64
+		for _, cp := range x.checkpoints {
+			sizes = append(sizes, cp.Size)
+		}
+		return sizes
+	}
+	if got := sizes(loadLogIndex(path)); !reflect.DeepEqual(got, []int64{4, 8}) {
+		t.Errorf("reloaded checkpoints = %v, want [4 8]", got)
+	}
+
+	// 服务停止期间文件增长，以修改时间补一个检查点
+	f, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("three\n")
+	f.Close()
+	if got := sizes(loadLogIndex(path)); !reflect.DeepEqual(got, []int64{4, 8, 14}) {
+		t.Errorf("checkpoints after growth = %v, want [4 8 14]", got)
+	}
+
+	// 文件被截断时清空检查点
+	if err := os.WriteFile(path, []byte("x\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := sizes(loadLogIndex(path)); !reflect.DeepEqual(got, []int64{2}) {
+		t.Errorf("checkpoints after truncate = %v, want [2]", got)
+	}
+	if got := sizes(loadLogIndex(path)); !reflect.DeepEqual(got, []int64{2}) {
+		t.Errorf("reloaded checkpoints after truncate = %v, want [2]", got)
+	}
+}
@@ -0,0 +1,518 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/crazyfrankie/zdocker/container"
+)
+
+// 容器指标
+const (
+	MetricContainerCPUPercent    = "container_cpu_percent"
+	MetricContainerMemoryUsage   = "container_memory_usage_bytes"
+	MetricContainerMemoryPercent = "container_memory_percent"
+	MetricContainerPids          = "container_pids"
+	MetricContainerNetworkRx     = "container_network_rx_bytes_per_second"
+	MetricContainerNetworkTx     = "container_network_tx_bytes_per_second"
+)
+
+// 主机指标
+const (
+	MetricHostCPUPercent    = "host_cpu_percent"
+	MetricHostMemoryUsed    = "host_memory_used_bytes"
+	MetricHostMemoryPercent = "host_memory_percent"
+	MetricHostLoad1         = "host_load1"
+)
+
+// HostTarget 主机指标的采集对象名称
+const HostTarget = "host"
+
+// metricNames 所有指标名称，key 为是否为容器指标
+var metricNames = map[string]bool{
+	MetricContainerCPUPercent:    true,
+	MetricContainerMemoryUsage:   true,
+	MetricContainerMemoryPercent: true,
+	MetricContainerPids:          true,
+	MetricContainerNetworkRx:     true,
+	MetricContainerNetworkTx:     true,
+	MetricHostCPUPercent:         false,
+	MetricHostMemoryUsed:         false,
+	MetricHostMemoryPercent:      false,
+	MetricHostLoad1:              false,
+}
+
+// MetricNames 返回所有指标名称
+func MetricNames() []string {
+	names := make([]string, 0, len(metricNames))
+	for name := range metricNames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// metricTier 一个精度层级：每 resolution 一个数据点，共保留 size 个
+type metricTier struct {
+	resolution time.Duration
+	size       int
+}
+
+// metricTiers 由细到粗的精度层级：1s 保留 10 分钟，1m 保留 24 小时，10m 保留 7 天
+var metricTiers = []metricTier{
+	{resolution: time.Second, size: 600},
+	{resolution: time.Minute, size: 1440},
+	{resolution: 10 * time.Minute, size: 1008},
+}
+
+// metricBucket 环形缓冲中的一个槽位，保存该时间段内样本的聚合值
+type metricBucket struct {
+	// start 时间段起点的 Unix 秒，0 表示空槽位
+	start int64
+	sum   float64
+	count int
+}
+
+// metricRing 固定大小的环形缓冲，槽位由时间段起点对容量取模确定，过期数据被自然覆盖
+type metricRing struct {
+	tier    metricTier
+	buckets []metricBucket
+}
+
+// add 将样本累加到所在时间段
+func (r *metricRing) add(t time.Time, value float64) {
+	res := int64(r.tier.resolution / time.Second)
+	start := t.Unix() / res * res
+	b := &r.buckets[(start/res)%int64(r.tier.size)]
+	if b.start != start {
+		*b = metricBucket{start: start}
+	}
+	b.sum += value
+	b.count++
+}
+
+// retention 返回该层级覆盖的时间长度
+func (r *metricRing) retention() time.Duration {
+	return r.tier.resolution * time.Duration(r.tier.size)
+}
+
+// points 返回 [from, to] 范围内的数据点，按时间排序，值为时间段内的平均值
+func (r *metricRing) points(from, to time.Time) []MetricPoint {
+	oldest := time.Now().Add(-r.retention()).Unix()
+	var points []MetricPoint
+	for _, b := range r.buckets {
+		if b.count == 0 || b.start < oldest || b.start < from.Unix() || b.start > to.Unix() {
+			continue
+		}
+		points = append(points, MetricPoint{Time: b.start, Value: b.sum / float64(b.count)})
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].Time < points[j].Time })
+	return points
+}
+
+// metricSeries 单个指标、单个采集对象的所有层级
+type metricSeries struct {
+	rings   []*metricRing
+	updated time.Time
+}
+
+// newMetricSeries 创建时间序列
+func newMetricSeries() *metricSeries {
+	s := &metricSeries{}
+	for _, tier := range metricTiers {
+		s.rings = append(s.rings, &metricRing{tier: tier, buckets: make([]metricBucket, tier.size)})
+	}
+	return s
+}
+
+// MetricPoint 时间序列中的一个点，Time 为 Unix 秒
+type MetricPoint struct {
+	Time  int64   `json:"t"`
+	Value float64 `json:"v"`
+}
+
+// MetricSeries 查询结果中的一条时间序列
+type MetricSeries struct {
+	// Target 容器名称，主机指标为 host
+	Target string        `json:"target"`
+	Points []MetricPoint `json:"points"`
+}
+
+// MetricQuery 时间序列查询
+type MetricQuery struct {
+	Metric string
+	// Selector 容器选择器：逗号分隔的名称或通配符模式，空表示所有容器
+	Selector string
+	// Start/End 查询范围
+	Start time.Time
+	End   time.Time
+	// Step 数据点间隔，0 表示自动选择
+	Step time.Duration
+}
+
+// MetricQueryResult 时间序列查询结果
+type MetricQueryResult struct {
+	Metric string `json:"metric"`
+	// Step 实际使用的数据点间隔
+	Step   string         `json:"step"`
+	Start  int64          `json:"start"`
+	End    int64          `json:"end"`
+	Series []MetricSeries `json:"series"`
+}
+
+// maxQueryPoints 自动选择 step 时每条序列的目标点数
+const maxQueryPoints = 300
+
+// MetricStore 内存中的多精度时间序列存储
+type MetricStore struct {
+	mu     sync.RWMutex
+	series map[string]map[string]*metricSeries
+}
+
+// NewMetricStore 创建时间序列存储
+func NewMetricStore() *MetricStore {
+	return &MetricStore{
+		series: make(map[string]map[string]*metricSeries),
+	}
+}
+
+// Record 记录一个样本
+func (s *MetricStore) Record(metric, target string, t time.Time, value float64) {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	targets, ok := s.series[metric]
+	if !ok {
+		targets = make(map[string]*metricSeries)
+		s.series[metric] = targets
+	}
+	series, ok := targets[target]
+	if !ok {
+		series = newMetricSeries()
+		targets[target] = series
+	}
+	for _, ring := range series.rings {
+		ring.add(t, value)
+	}
+	series.updated = t
+}
+
+// Prune 删除超过最长保留时间未更新的序列，对应已删除的容器
+func (s *MetricStore) Prune(now time.Time) {
+	last := metricTiers[len(metricTiers)-1]
+	retention := last.resolution * time.Duration(last.size)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for metric, targets := range s.series {
+		for target, series := range targets {
+			if now.Sub(series.updated) > retention {
+				delete(targets, target)
+			}
+		}
+		if len(targets) == 0 {
+			delete(s.series, metric)
+		}
+	}
+}
+
+// Query 查询时间序列。选择保留时间覆盖查询开始时间的最细层级，step 小于该层级的精度时提高到该精度，再按 step 求平均
+func (s *MetricStore) Query(q MetricQuery) (MetricQueryResult, error) {
+	isContainer, ok := metricNames[q.Metric]
+	if !ok {
+		return MetricQueryResult{}, fmt.Errorf("%w: 未知的指标 %q，可用指标: %s",
+			ErrInvalidArgument, q.Metric, strings.Join(MetricNames(), ", "))
+	}
+	if !q.End.After(q.Start) {
+		return MetricQueryResult{}, fmt.Errorf("%w: 查询范围的结束时间必须晚于开始时间", ErrInvalidArgument)
+	}
+
+	tier := selectMetricTier(q.Start, time.Now())
+	resolution := metricTiers[tier].resolution
+
+	step := q.Step
+	if step == 0 {
+		step = q.End.Sub(q.Start) / maxQueryPoints
+	}
+	step = max(step.Truncate(resolution), resolution)
+
+	result := MetricQueryResult{
+		Metric: q.Metric,
+		Step:   step.String(),
+		Start:  q.Start.Unix(),
+		End:    q.End.Unix(),
+		Series: []MetricSeries{},
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for target, series := range s.series[q.Metric] {
+		if isContainer && !matchSelector(q.Selector, target) {
+			continue
+		}
+		points := downsample(series.rings[tier].points(q.Start, q.End), step)
+		if len(points) == 0 {
+			continue
+		}
+		result.Series = append(result.Series, MetricSeries{Target: target, Points: points})
+	}
+	sort.Slice(result.Series, func(i, j int) bool {
+		return result.Series[i].Target < result.Series[j].Target
+	})
+	return result, nil
+}
+
+// selectMetricTier 返回保留时间覆盖 start 的最细层级，都不覆盖时返回保留时间最长的层级
+func selectMetricTier(start, now time.Time) int {
+	for i, t := range metricTiers {
+		// 允许一个精度的误差，使 range=10m 之类恰好等于保留时间的查询仍使用该层级
+		retention := t.resolution * time.Duration(t.size+1)
+		if !start.Before(now.Add(-retention)) {
+			return i
+		}
+	}
+	return len(metricTiers) - 1
+}
+
+// downsample 将数据点按 step 对齐分组求平均
+func downsample(points []MetricPoint, step time.Duration) []MetricPoint {
+	seconds := int64(step / time.Second)
+	if seconds <= 1 || len(points) == 0 {
+		return points
+	}
+
+	var result []MetricPoint
+	var sum float64
+	var count int
+	current := points[0].Time / seconds * seconds
+	for _, p := range points {
+		start := p.Time / seconds * seconds
+		if start != current {
+			result = append(result, MetricPoint{Time: current, Value: sum / float64(count)})
+			current, sum, count = start, 0, 0
+		}
+		sum += p.Value
+		count++
+	}
+	return append(result, MetricPoint{Time: current, Value: sum / float64(count)})
+}
+
+// matchSelector 判断容器名称是否匹配选择器，选择器为逗号分隔的名称或通配符模式
+func matchSelector(selector, name string) bool {
+	if selector == "" {
+		return true
+	}
+	for _, pattern := range strings.Split(selector, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == name {
+			return true
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// metricsInterval 指标采集间隔，与最细层级的精度一致
+const metricsInterval = time.Second
+
+// metricsPruneInterval 清理过期序列的间隔
+const metricsPruneInterval = time.Hour
+
+// hostCPUTimes /proc/stat 中的 CPU 时间
+type hostCPUTimes struct {
+	busy  uint64
+	total uint64
+}
+
+// MetricsCollector 定期采集容器和主机指标写入时间序列存储
+type MetricsCollector struct {
+	runtime Runtime
+	store   *MetricStore
+
+	prev     map[string]ContainerStats
+	prevHost hostCPUTimes
+
+	done chan struct{}
+}
+
+// NewMetricsCollector 创建指标采集器，需要调用 Start 开始采集
+func NewMetricsCollector(runtime Runtime, store *MetricStore) *MetricsCollector {
+	return &MetricsCollector{
+		runtime: runtime,
+		store:   store,
+		prev:    make(map[string]ContainerStats),
+		done:    make(chan struct{}),
+	}
+}
+
+// Start 启动后台采集协程
+func (m *MetricsCollector) Start() {
+	go func() {
+		ticker := time.NewTicker(metricsInterval)
+		defer ticker.Stop()
+		lastPrune := time.Now()
+		for {
+			select {
+			case <-m.done:
+				return
+			case now := <-ticker.C:
+				m.collect(now)
+				if now.Sub(lastPrune) > metricsPruneInterval {
+					m.store.Prune(now)
+					lastPrune = now
+				}
+			}
+		}
+	}()
+}
+
+// Stop 停止后台采集协程
+func (m *MetricsCollector) Stop() {
+	close(m.done)
+}
+
+// collect 采集一次所有运行中容器和主机的指标
+func (m *MetricsCollector) collect(now time.Time) {
+	m.collectHost(now)
+
+	containers, err := m.runtime.ListContainers()
+	if err != nil {
+		log.Printf("指标采集: 获取容器列表失败: %v", err)
+		return
+	}
+
+	current := make(map[string]ContainerStats, len(containers))
+	for _, c := range containers {
+		if c.Status != container.RUNNING {
+			continue
+		}
+		stats, err := m.runtime.ContainerStats(c.Name)
+		if err != nil {
+			continue
+		}
+		current[c.Name] = stats
+
+		m.store.Record(MetricContainerMemoryUsage, c.Name, now, float64(stats.Memory.Usage))
+		m.store.Record(MetricContainerMemoryPercent, c.Name, now, stats.Memory.Percent)
+		m.store.Record(MetricContainerPids, c.Name, now, float64(stats.Pids.Current))
+
+		prev, ok := m.prev[c.Name]
+		if !ok {
+			continue
+		}
+		stats.CalculateCPUPercent(prev)
+		if stats.CPU.Percent != nil {
+			m.store.Record(MetricContainerCPUPercent, c.Name, now, *stats.CPU.Percent)
+		}
+		elapsed := stats.Read.Sub(prev.Read).Seconds()
+		if elapsed <= 0 {
+			continue
+		}
+		rx, tx := networkTotals(stats)
+		prevRx, prevTx := networkTotals(prev)
+		if rx >= prevRx && tx >= prevTx {
+			m.store.Record(MetricContainerNetworkRx, c.Name, now, float64(rx-prevRx)/elapsed)
+			m.store.Record(MetricContainerNetworkTx, c.Name, now, float64(tx-prevTx)/elapsed)
+		}
+	}
+	// 已停止的容器不再保留上一次采样，重新启动后从头计算
+	m.prev = current
+}
+
+// networkTotals 返回所有网络接口的收发字节数之和
+func networkTotals(stats ContainerStats) (uint64, uint64) {
+	var rx, tx uint64
+	for _, n := range stats.Networks {
+		rx += n.RxBytes
+		tx += n.TxBytes
+	}
+	return rx, tx
+}
+
+// collectHost 采集主机 CPU、内存和负载
+func (m *MetricsCollector) collectHost(now time.Time) {
+	if times, err := readHostCPUTimes(); err == nil {
+		if m.prevHost.total > 0 && times.total > m.prevHost.total {
+			percent := float64(times.busy-m.prevHost.busy) / float64(times.total-m.prevHost.total) * 100
+			m.store.Record(MetricHostCPUPercent, HostTarget, now, percent)
+		}
+		m.prevHost = times
+	}
+
+	meminfo := readMeminfo()
+	if total, ok := meminfo["MemTotal"]; ok && total > 0 {
+		used := total - min(meminfo["MemAvailable"], total)
+		m.store.Record(MetricHostMemoryUsed, HostTarget, now, float64(used))
+		m.store.Record(MetricHostMemoryPercent, HostTarget, now, float64(used)/float64(total)*100)
+	}
+
+	if data, err := os.ReadFile("/proc/loadavg"); err == nil {
+		if fields := strings.Fields(string(data)); len(fields) > 0 {
+			if load, err := strconv.ParseFloat(fields[0], 64); err == nil {
+				m.store.Record(MetricHostLoad1, HostTarget, now, load)
+			}
+		}
+	}
+}
+
+// readHostCPUTimes 读取 /proc/stat 第一行的 CPU 时间
+func readHostCPUTimes() (hostCPUTimes, error) {
+	data, err := os.ReadFile("/proc/stat")
+	if err != nil {
+		return hostCPUTimes{}, err
+	}
+	line, _, _ := strings.Cut(string(data), "\n")
+	fields := strings.Fields(line)
+	if len(fields) < 5 || fields[0] != "cpu" {
+		return hostCPUTimes{}, fmt.Errorf("无法解析 /proc/stat")
+	}
+
+	var times hostCPUTimes
+	for i, field := range fields[1:] {
+		n, _ := strconv.ParseUint(field, 10, 64)
+		// guest/guest_nice 已计入 user/nice
+		if i >= 8 {
+			break
+		}
+		times.total += n
+		// idle 和 iowait
+		if i != 3 && i != 4 {
+			times.busy += n
+		}
+	}
+	return times, nil
+}
+
+// readMeminfo 读取 /proc/meminfo，单位为字节
+func readMeminfo() map[string]uint64 {
+	values := make(map[string]uint64)
+	data, err := os.ReadFile("/proc/meminfo")
+	if err != nil {
+		return values
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		if n, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+			values[strings.TrimSuffix(fields[0], ":")] = n * 1024
+		}
+	}
+	return values
+}
@@ -0,0 +1,149 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSelectMetricTier(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		ago  time.Duration
+		want int
+	}{
+		{ago: 0, want: 0},
+		{ago: 5 * time.Minute, want: 0},
+		{ago: 10 * time.Minute, want: 0},
+		{ago: 10*time.Minute + 2*time.Second, want: 1},
+		{ago: time.Hour, want: 1},
+		{ago: 24 * time.Hour, want: 1},
+		{ago: 24*time.Hour + 2*time.Minute, want: 2},
+		{ago: 7 * 24 * time.Hour, want: 2},
+		{ago: 30 * 24 * time.Hour, want: 2},
+	}
+	for _, tt := range tests {
+		if got := selectMetricTier(now.Add(-tt.ago), now); got != tt.want {
+			t.Errorf("selectMetricTier(now-%v) = %d, want %d", tt.ago, got, tt.want)
+		}
+	}
+}
+
+func TestMetricStoreQuery(t *testing.T) {
+	s := NewMetricStore()
+	now := time.Now().Truncate(time.Second)
+	// 最近 3 分钟每秒一个样本
+	for i := 0; i < 180; i++ {
+		s.Record(MetricHostCPUPercent, HostTarget, now.Add(-time.Duration(i)*time.Second), 50)
+	}
+
+	tests := []struct {
+		name     string
+		rangeAgo time.Duration
+		step     time.Duration
+		wantStep string
+		// minPoints/maxPoints 期望的数据点数量范围
+		minPoints, maxPoints int
+	}{
+		{name: "fine tier", rangeAgo: 2 * time.Minute, step: time.Second, wantStep: "1s", minPoints: 120, maxPoints: 121},
+		{name: "auto step", rangeAgo: 2 * time.Minute, wantStep: "1s", minPoints: 120, maxPoints: 121},
+		{name: "downsample in fine tier", rangeAgo: 2 * time.Minute, step: 30 * time.Second, wantStep: "30s", minPoints: 4, maxPoints: 5},
+		{name: "step not multiple of resolution", rangeAgo: 2 * time.Minute, step: 2500 * time.Millisecond, wantStep: "2s", minPoints: 60, maxPoints: 61},
+		// 1 小时超出 1s 层级的保留时间，使用 1m 层级，step 提高到 1m，而不是退回 10m 层级
+		{name: "step raised to tier resolution", rangeAgo: time.Hour, step: time.Second, wantStep: "1m0s", minPoints: 3, maxPoints: 4},
+		{name: "coarse step in minute tier", rangeAgo: 6 * time.Hour, step: 5 * time.Minute, wantStep: "5m0s", minPoints: 1, maxPoints: 2},
+		{name: "coarsest tier", rangeAgo: 3 * 24 * time.Hour, wantStep: "10m0s", minPoints: 1, maxPoints: 2},
+	}
+	for _, tt := range tests {
+		result, err := s.Query(MetricQuery{
+			Metric: MetricHostCPUPercent,
+			Start:  now.Add(-tt.rangeAgo),
+			End:    now,
+			Step:   tt.step,
+		})
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if result.Step != tt.wantStep {
+			t.Errorf("%s: step = %s, want %s", tt.name, result.Step, tt.wantStep)
+		}
+		if len(result.Series) != 1 {
+			t.Errorf("%s: %d series, want 1", tt.name, len(result.Series))
+			continue
+		}
+		points := result.Series[0].Points
+		if len(points) < tt.minPoints || len(points) > tt.maxPoints {
+			t.Errorf("%s: %d points, want %d-%d", tt.name, len(points), tt.minPoints, tt.maxPoints)
+		}
+		for i, p := range points {
+			if p.Value != 50 {
+				t.Errorf("%s: point %d value = %v, want 50", tt.name, i, p.Value)
+				break
+			}
+			if i > 0 && p.Time <= points[i-1].Time {
+				t.Errorf("%s: points not sorted at %d", tt.name, i)
+				break
+			}
+		}
+	}
+}
+
+func TestMetricStoreQuerySelector(t *testing.T) {
+	s := NewMetricStore()
+	now := time.Now()
+	for _, name := range []string{"web-2", "web-1", "db"} {
+		s.Record(MetricContainerCPUPercent, name, now, 1)
+	}
+	s.Record(MetricHostCPUPercent, HostTarget, now, 1)
+
+	tests := []struct {
+		selector string
+		want     []string
+	}{
+		{selector: "", want: []string{"db", "web-1", "web-2"}},
+		{selector: "web-*", want: []string{"web-1", "web-2"}},
+		{selector: "db, web-2", want: []string{"db", "web-2"}},
+		{selector: "cache", want: nil},
+	}
+	for _, tt := range tests {
+		result, err := s.Query(MetricQuery{
+			Metric:   MetricContainerCPUPercent,
+			Selector: tt.selector,
+			Start:    now.Add(-time.Minute),
+			End:      now.Add(time.Second),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, series := range result.Series {
+			got = append(got, series.Target)
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("selector %q: targets = %v, want %v", tt.selector, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("selector %q: targets = %v, want %v", tt.selector, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestMetricStoreQueryInvalid(t *testing.T) {
+	s := NewMetricStore()
+	now := time.Now()
+	tests := []MetricQuery{
+		{Metric: "container_disk_bytes", Start: now.Add(-time.Minute), End: now},
+		{Metric: MetricHostCPUPercent, Start: now, End: now},
+		{Metric: MetricHostCPUPercent, Start: now, End: now.Add(-time.Minute)},
+	}
+	for _, q := range tests {
+		if _, err := s.Query(q); !errors.Is(err, ErrInvalidArgument) {
+			t.Errorf("Query(%+v) error = %v, want ErrInvalidArgument", q, err)
+		}
+	}
+}
@@ -0,0 +1,538 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/bytedance/sonic"
+
+	"github.com/crazyfrankie/zdocker/cgroups"
+	"github.com/crazyfrankie/zdocker/container"
+	"github.com/crazyfrankie/zdocker/network"
+)
+
+const (
+	// networkLocation zdocker 保存网络配置的目录
+	networkLocation = "/var/run/zdocker/network/network/"
+	// defaultStopTimeout 停止容器时等待进程退出的时间，超时后发送 SIGKILL
+	defaultStopTimeout = 10 * time.Second
+	// envExecPID/envExecCMD nsenter 用于进入容器命名空间的环境变量
+	envExecPID = "zdocker_pid"
+	envExecCMD = "zdocker_cmd"
+)
+
+// NativeRuntime 直接调用 zdocker Go 包实现的运行时，不再为每个请求 fork zdocker 命令行。
+// 容器进程通过 /proc/self/exe init 启动，因此 main 需要处理 init 子命令（见 RunInitProcess）。
+type NativeRuntime struct {
+	// mu 串行化变更操作：zdocker 的 network 包使用全局状态，
+	// 且 NewParentProcess 会修改当前进程的环境变量
+	mu sync.Mutex
+
+	// exitCodes 由本进程启动的容器最近一次的退出码
+	exitMu    sync.Mutex
+	exitCodes map[string]int
+}
+
+// NewNativeRuntime 创建原生运行时
+func NewNativeRuntime() *NativeRuntime {
+	return &NativeRuntime{
+		exitCodes: make(map[string]int),
+	}
+}
+
+// ExitCode 返回容器最近一次退出的退出码。本进程启动的容器从内存中读取，
+// 服务重启前启动的容器读取退出时写入可写层的记录
+func (r *NativeRuntime) ExitCode(containerName string) (int, bool) {
+	r.exitMu.Lock()
+	code, ok := r.exitCodes[containerName]
+	r.exitMu.Unlock()
+	if ok {
+		return code, true
+	}
+	return readExitCode(containerName)
+}
+
+// wait 等待容器进程退出并记录退出码，同时回收子进程，避免其成为僵尸进程而被误判为仍在运行
+func (r *NativeRuntime) wait(containerName string, cmd *exec.Cmd) {
+	cmd.Wait()
+
+	code := cmd.ProcessState.ExitCode()
+	if err := writeExitCode(containerName, code); err != nil {
+		log.Printf("记录容器 %s 的退出码失败: %v", containerName, err)
+	}
+
+	r.exitMu.Lock()
+	defer r.exitMu.Unlock()
+	r.exitCodes[containerName] = code
+}
+
+// cgroupPath 返回容器的 cgroup 路径，每个容器使用独立的子 cgroup
+func cgroupPath(containerName string) string {
+	return filepath.Join("zdocker", containerName)
+}
+
+// imageExists 检查镜像 tar 包或已解压的镜像目录是否存在
+func imageExists(imageName string) bool {
+	if _, err := os.Stat(filepath.Join(container.RootUrl, imageName+".tar")); err == nil {
+		return true
+	}
+	if _, err := os.Stat(fmt.Sprintf(container.OverlayLower, imageName)); err == nil {
+		return true
+	}
+	return false
+}
+
+// randomContainerId 生成与 zdocker 一致的10位数字容器ID
+func randomContainerId() string {
+	var sb strings.Builder
+	for i := 0; i < 10; i++ {
+		sb.WriteString(strconv.Itoa(rand.Intn(10)))
+	}
+	return sb.String()
+}
+
+// ListContainers 获取容器列表
+func (r *NativeRuntime) ListContainers() ([]Container, error) {
+	return GetContainerList()
+}
+
+// GetContainer 根据ID或名称获取容器信息
+func (r *NativeRuntime) GetContainer(containerId string) (Container, error) {
+	return GetContainerById(containerId)
+}
+
+// InspectContainer 汇总容器配置、运行参数、cgroup 与 /proc 中的信息
+func (r *NativeRuntime) InspectContainer(containerId string) (ContainerInspect, error) {
+	return inspectContainer(containerId)
+}
+
+// CreateContainer 创建并以后台模式运行容器。HTTP 请求没有终端，因此忽略 tty 参数。
+func (r *NativeRuntime) CreateContainer(req CreateContainerRequest) (Container, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if req.Name == "" {
+		req.Name = randomContainerId()
+	}
+	if _, err := os.Stat(fmt.Sprintf(container.DefaultLocation, req.Name)); err == nil {
+		return Container{}, fmt.Errorf("%w: %s", ErrContainerExists, req.Name)
+	}
+
+	c, err := r.run(req, false)
+	if err != nil {
+		return Container{}, err
+	}
+	if err := saveRunConfig(c.Name, req); err != nil {
+		log.Printf("保存容器 %s 运行参数失败: %v", c.Name, err)
+	}
+	return c, nil
+}
+
+// run 启动容器进程并记录容器信息，调用方需持有锁。
+// restart 为 true 时表示重新启动已有容器，失败时保留容器目录和可写层。
+func (r *NativeRuntime) run(req CreateContainerRequest, restart bool) (Container, error) {
+	commands := containerArgs(req)
+	if len(commands) == 0 {
+		commands = []string{"sleep", "infinity"}
+	}
+	initCfg, err := sonic.Marshal(initConfig{Args: commands, Workdir: req.Workdir})
+	if err != nil {
+		return Container{}, fmt.Errorf("序列化启动参数失败: %v", err)
+	}
+
+	containerId := randomContainerId()
+	containerName := req.Name
+	if !imageExists(req.Image) {
+		return Container{}, fmt.Errorf("%w: %s", ErrImageNotFound, req.Image)
+	}
+	if req.Network != "" {
+		if _, err := os.Stat(networkLocation + req.Network); err != nil {
+			return Container{}, fmt.Errorf("%w: %s", ErrNetworkNotFound, req.Network)
+		}
+	}
+
+	envs := make([]string, 0, len(req.Environment))
+	for key, value := range req.Environment {
+		envs = append(envs, fmt.Sprintf("%s=%s", key, value))
+	}
+
+	// NewParentProcess 会在当前进程设置 ZDOCKER_CREATE，复制到子进程后立即清除，
+	// 避免后续 fork 的 /proc/self/exe 被 nsenter 误认为要创建容器
+	parent, writePipe := container.NewParentProcess(req.Image, containerName, req.Volume, false, envs)
+	os.Unsetenv("ZDOCKER_CREATE")
+	if parent == nil {
+		return Container{}, fmt.Errorf("创建容器进程失败")
+	}
+	// NewParentProcess 把服务端的全部环境变量传给容器，替换为最小环境
+	parent.Env = minimalEnv(append(envs, "ZDOCKER_CREATE=1")...)
+	if err := parent.Start(); err != nil {
+		writePipe.Close()
+		return Container{}, fmt.Errorf("启动容器进程失败: %v", err)
+	}
+	// 日志文件和管道读端已由子进程继承，关闭父进程持有的句柄
+	if logFile, ok := parent.Stdout.(*os.File); ok {
+		logFile.Close()
+	}
+	for _, f := range parent.ExtraFiles {
+		f.Close()
+	}
+	r.exitMu.Lock()
+	delete(r.exitCodes, containerName)
+	r.exitMu.Unlock()
+	removeExitCode(containerName)
+	go r.wait(containerName, parent)
+
+	pid := parent.Process.Pid
+	info := &container.ContainerInfo{
+		PID:         strconv.Itoa(pid),
+		ID:          containerId,
+		Name:        containerName,
+		Command:     JoinCommand(commands),
+		CreateTime:  time.Now().Format(time.DateTime),
+		Status:      container.RUNNING,
+		Volume:      req.Volume,
+		PortMapping: req.PortMapping,
+	}
+
+	// fail 在容器启动失败时清理已经创建的进程和工作目录
+	fail := func(err error) (Container, error) {
+		writePipe.Close()
+		syscall.Kill(pid, syscall.SIGKILL)
+		if restart {
+			containerStore.Update(containerName, func(info *container.ContainerInfo) error {
+				info.Status = container.EXIT
+				info.PID = ""
+				return nil
+			})
+			return Container{}, err
+		}
+		containerStore.Remove(containerName)
+		container.DeleteWorkSpace(containerName, req.Volume)
+		cgroups.NewCgroupManager(cgroupPath(containerName)).Destroy()
+		return Container{}, err
+	}
+
+	if err := containerStore.Write(info); err != nil {
+		return fail(err)
+	}
+
+	cgroupManager := cgroups.NewCgroupManager(cgroupPath(containerName))
+	if err := cgroupManager.Set(&cgroups.ResourceConfig{
+		MemoryLimit: req.Memory,
+		CpuShare:    req.CpuShare,
+		CpuSet:      req.CpuSet,
+	}); err != nil {
+		return fail(fmt.Errorf("设置资源限制失败: %v", err))
+	}
+	if err := cgroupManager.Apply(pid); err != nil {
+		return fail(fmt.Errorf("加入cgroup失败: %v", err))
+	}
+
+	if req.Network != "" {
+		if err := network.InitNetwork(); err != nil {
+			return fail(fmt.Errorf("初始化网络失败: %v", err))
+		}
+		if err := network.Connect(req.Network, info); err != nil {
+			return fail(fmt.Errorf("连接网络失败: %v", err))
+		}
+	}
+
+	// 将用户命令和工作目录发送给容器 init 进程
+	if _, err := writePipe.Write(initCfg); err != nil {
+		return fail(fmt.Errorf("发送容器命令失败: %v", err))
+	}
+	writePipe.Close()
+
+	return containerFromInfo(info), nil
+}
+
+// StartContainer 按保存的运行参数以原名称重新启动已退出的容器
+func (r *NativeRuntime) StartContainer(containerName string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	original, req, err := prepareStart(containerName)
+	if err != nil {
+		return err
+	}
+	if _, err := r.run(req, true); err != nil {
+		return err
+	}
+	_, err = restoreIdentity(req.Name, original)
+	return err
+}
+
+// StopContainer 停止容器，先发送 SIGTERM，超时后发送 SIGKILL
+func (r *NativeRuntime) StopContainer(containerName string) error {
+	name, err := lookupContainerName(containerName)
+	if err != nil {
+		return err
+	}
+	info, err := readContainerInfo(name)
+	if err != nil {
+		return err
+	}
+	if info.Status != container.RUNNING || info.PID == "" {
+		return fmt.Errorf("%w: %s", ErrContainerNotRunning, name)
+	}
+
+	pid, err := strconv.Atoi(info.PID)
+	if err != nil {
+		return fmt.Errorf("invalid container pid %q: %v", info.PID, err)
+	}
+	if err := syscall.Kill(pid, syscall.SIGTERM); err != nil && !errors.Is(err, syscall.ESRCH) {
+		return fmt.Errorf("发送SIGTERM失败: %v", err)
+	}
+
+	deadline := time.Now().Add(defaultStopTimeout)
+	for isProcessRunning(info.PID) {
+		if time.Now().After(deadline) {
+			if err := syscall.Kill(pid, syscall.SIGKILL); err != nil && !errors.Is(err, syscall.ESRCH) {
+				return fmt.Errorf("发送SIGKILL失败: %v", err)
+			}
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	// 进程退出期间 Reconciler 可能已将其标记为 exit，两种情况都改为 stop
+	return containerStore.Update(name, func(current *container.ContainerInfo) error {
+		if current.PID != info.PID && current.PID != "" {
+			return errNoChange
+		}
+		current.Status = container.STOP
+		current.PID = ""
+		return nil
+	})
+}
+
+// RemoveContainer 删除容器及其工作目录
+func (r *NativeRuntime) RemoveContainer(containerName string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	name, err := lookupContainerName(containerName)
+	if err != nil {
+		return err
+	}
+	unlock, err := containerStore.Lock(name)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	info, err := readContainerInfo(name)
+	if err != nil {
+		return err
+	}
+	if info.Status == container.RUNNING && isProcessRunning(info.PID) {
+		return fmt.Errorf("%w: 不能删除正在运行的容器 %s", ErrContainerRunning, name)
+	}
+
+	dirUrl := containerStore.Dir(name)
+	if err := os.RemoveAll(dirUrl); err != nil {
+		return fmt.Errorf("删除容器目录 %s 失败: %v", dirUrl, err)
+	}
+	container.DeleteWorkSpace(name, info.Volume)
+	cgroups.NewCgroupManager(cgroupPath(name)).Destroy()
+	return nil
+}
+
+// ContainerLogs 获取容器日志
+func (r *NativeRuntime) ContainerLogs(containerName string) (string, error) {
+	name, err := lookupContainerName(containerName)
+	if err != nil {
+		return "", err
+	}
+
+	logFile := fmt.Sprintf(container.DefaultLocation, name) + container.ContainerLogFile
+	content, err := os.ReadFile(logFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("读取日志文件失败: %v", err)
+	}
+	return string(content), nil
+}
+
+// ContainerLogFile 获取容器日志文件路径
+func (r *NativeRuntime) ContainerLogFile(containerName string) (string, error) {
+	name, err := lookupContainerName(containerName)
+	if err != nil {
+		return "", err
+	}
+	return containerStore.Dir(name) + container.ContainerLogFile, nil
+}
+
+// ExecContainer 通过 nsenter 进入容器命名空间执行命令
+func (r *NativeRuntime) ExecContainer(containerName string, command []string) (ExecResult, error) {
+	p, err := execInContainer(containerName, command)
+	if err != nil {
+		return ExecResult{}, err
+	}
+	return p.CombinedOutput()
+}
+
+// ExecInteractive 构造进入容器命名空间执行命令的交互式进程
+func (r *NativeRuntime) ExecInteractive(containerName string, command []string) (*ExecProcess, error) {
+	return execInContainer(containerName, command)
+}
+
+// ContainerStats 从容器进程所在的 cgroup 读取资源使用情况
+func (r *NativeRuntime) ContainerStats(containerName string) (ContainerStats, error) {
+	return containerStats(containerName)
+}
+
+// ContainerChanges 获取容器文件系统相对镜像的变化
+func (r *NativeRuntime) ContainerChanges(containerName string, opts ChangesOptions) (ContainerChanges, error) {
+	return containerChanges(containerName, opts)
+}
+
+// CommitContainer 将容器的文件系统提交为新镜像
+func (r *NativeRuntime) CommitContainer(containerName string, opts CommitOptions, progress func(CommitProgress)) (Image, error) {
+	return commitContainer(containerName, opts, progress)
+}
+
+// ContainerFS 获取容器合并后的根文件系统
+func (r *NativeRuntime) ContainerFS(containerName string) (*ContainerFS, error) {
+	return containerFS(containerName)
+}
+
+// ListImages 获取镜像列表
+func (r *NativeRuntime) ListImages() ([]Image, error) {
+	return imageStore.List()
+}
+
+// GetImage 获取镜像详情
+func (r *NativeRuntime) GetImage(imageName string) (Image, error) {
+	return imageStore.Get(imageName)
+}
+
+// RemoveImage 删除镜像
+func (r *NativeRuntime) RemoveImage(imageName string, force bool) error {
+	return imageStore.Remove(imageName, force)
+}
+
+// ImportImage 从 tar 包流导入镜像
+func (r *NativeRuntime) ImportImage(imageName string, reader io.Reader, checksum string) (Image, error) {
+	return imageStore.Import(imageName, reader, checksum)
+}
+
+// OpenImage 打开镜像的 tar 包流
+func (r *NativeRuntime) OpenImage(imageName string) (io.ReadCloser, int64, error) {
+	return imageStore.Open(imageName)
+}
+
+// ListNetworks 读取 zdocker 保存的网络配置
+func (r *NativeRuntime) ListNetworks() ([]NetworkInfo, error) {
+	files, err := os.ReadDir(networkLocation)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []NetworkInfo{}, nil
+		}
+		return nil, err
+	}
+
+	networks := make([]NetworkInfo, 0, len(files))
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(networkLocation, f.Name()))
+		if err != nil {
+			continue
+		}
+		var nw network.Network
+		if err := sonic.Unmarshal(data, &nw); err != nil {
+			continue
+		}
+
+		subnet := ""
+		if nw.IpRange != nil {
+			subnet = nw.IpRange.String()
+		}
+		networks = append(networks, NetworkInfo{
+			Name:   nw.Name,
+			Driver: nw.Driver,
+			Subnet: subnet,
+		})
+	}
+
+	return networks, nil
+}
+
+// CreateNetwork 创建网络
+func (r *NativeRuntime) CreateNetwork(req CreateNetworkRequest) (NetworkInfo, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	driver := req.Driver
+	if driver == "" {
+		driver = "bridge"
+	}
+	if driver != "bridge" {
+		return NetworkInfo{}, fmt.Errorf("%w: 不支持的网络驱动 %s", ErrInvalidArgument, driver)
+	}
+	if _, _, err := net.ParseCIDR(req.Subnet); err != nil {
+		return NetworkInfo{}, fmt.Errorf("%w: 无效的子网 %q", ErrInvalidArgument, req.Subnet)
+	}
+	if _, err := os.Stat(networkLocation + req.Name); err == nil {
+		return NetworkInfo{}, fmt.Errorf("%w: %s", ErrNetworkExists, req.Name)
+	}
+
+	if err := network.InitNetwork(); err != nil {
+		return NetworkInfo{}, fmt.Errorf("初始化网络失败: %v", err)
+	}
+	if err := network.CreateNetwork(driver, req.Subnet, req.Name); err != nil {
+		return NetworkInfo{}, fmt.Errorf("创建网络失败: %v", err)
+	}
+
+	return NetworkInfo{
+		Name:   req.Name,
+		Driver: driver,
+		Subnet: req.Subnet,
+	}, nil
+}
+
+// RemoveNetwork 删除网络
+func (r *NativeRuntime) RemoveNetwork(networkName string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, err := os.Stat(networkLocation + networkName); err != nil {
+		return fmt.Errorf("%w: %s", ErrNetworkNotFound, networkName)
+	}
+	if err := network.InitNetwork(); err != nil {
+		return fmt.Errorf("初始化网络失败: %v", err)
+	}
+	if err := network.RemoveNetwork(networkName); err != nil {
+		return fmt.Errorf("删除网络失败: %v", err)
+	}
+	return nil
+}
+
+// Version 返回编译进服务端的 zdocker 库版本
+func (r *NativeRuntime) Version() (string, error) {
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, dep := range bi.Deps {
+			if dep.Path == "github.com/crazyfrankie/zdocker" {
+				return "zdocker " + dep.Version + " (native)", nil
+			}
+		}
+	}
+	return "zdocker (native)", nil
+}
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/crazyfrankie/zdocker/container"
+)
+
+func TestRandomContainerId(t *testing.T) {
+	re := regexp.MustCompile(`^[0-9]{10}$`)
+	for i := 0; i < 100; i++ {
+		if id := randomContainerId(); !re.MatchString(id) {
+			t.Fatalf("randomContainerId = %q, want 10 digits", id)
+		}
+	}
+	if got := cgroupPath("web"); got != "zdocker/web" {
+		t.Errorf("cgroupPath(web) = %q", got)
+	}
+}
+
+func TestNativeRuntimeExitCode(t *testing.T) {
+	r := NewNativeRuntime()
+	cmd := exec.Command("/bin/sh", "-c", "exit 3")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	// 可写层不存在时退出码只记录在内存中
+	r.wait("zdw-test-exit", cmd)
+
+	if code, ok := r.ExitCode("zdw-test-exit"); !ok || code != 3 {
+		t.Errorf("ExitCode(zdw-test-exit) = %d, %v, want 3, true", code, ok)
+	}
+	if code, ok := r.ExitCode("zdw-test-missing"); ok {
+		t.Errorf("ExitCode(zdw-test-missing) = %d, want not found", code)
+	}
+}
+
+func TestNativeRuntimeStopContainer(t *testing.T) {
+	store := useTestIndex(t)
+	cmd := exec.Command("sleep", "100")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		<-done
+	})
+
+	containers := []container.ContainerInfo{
+		{ID: "1111", Name: "zdw-test-running", Status: container.RUNNING, PID: strconv.Itoa(cmd.Process.Pid)},
+		{ID: "2222", Name: "zdw-test-stopped", Status: container.STOP},
+		// 状态为运行中但没有记录 PID
+		{ID: "3333", Name: "zdw-test-nopid", Status: container.RUNNING},
+	}
+	for i := range containers {
+		if err := store.Write(&containers[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := NewNativeRuntime()
+	tests := []struct {
+		id      string
+		wantErr error
+	}{
+		{id: "zdw-test-stopped", wantErr: ErrContainerNotRunning},
+		{id: "zdw-test-nopid", wantErr: ErrContainerNotRunning},
+		{id: "zdw-test-missing", wantErr: ErrContainerNotFound},
+		{id: "1111"},
+	}
+	for _, tt := range tests {
+		err := r.StopContainer(tt.id)
+		if tt.wantErr != nil {
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("StopContainer(%s): error = %v, want %v", tt.id, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("StopContainer(%s): %v", tt.id, err)
+		}
+	}
+
+	// SIGTERM 即可结束进程，无需等到超时
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("container process still running after stop")
+	}
+	info, err := store.Read("zdw-test-running")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Status != container.STOP || info.PID != "" {
+		t.Errorf("stored info = %+v", info)
+	}
+}
+
+func TestNativeRuntimeRemoveRunningContainer(t *testing.T) {
+	store := useTestIndex(t)
+	if err := store.Write(&container.ContainerInfo{ID: "1111", Name: "zdw-test-running", Status: container.RUNNING, PID: strconv.Itoa(os.Getpid())}); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewNativeRuntime()
+	if err := r.RemoveContainer("1111"); !errors.Is(err, ErrContainerRunning) {
+		t.Errorf("RemoveContainer(1111): error = %v, want ErrContainerRunning", err)
+	}
+	if err := r.RemoveContainer("zdw-test-missing"); !errors.Is(err, ErrContainerNotFound) {
+		t.Errorf("RemoveContainer(zdw-test-missing): error = %v, want ErrContainerNotFound", err)
+	}
+	// 拒绝删除时保留容器信息
+	if _, err := store.Read("zdw-test-running"); err != nil {
+		t.Errorf("stored info after refused remove: %v", err)
+	}
+}
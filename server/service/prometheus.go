@@ -0,0 +1,144 @@
+package service
+
+import (
+	"errors"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/crazyfrankie/zdocker/container"
+)
+
+// cliDuration zdocker 命令行调用的耗时，_count 即调用次数
+var cliDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: "zdocker",
+	Name:      "cli_duration_seconds",
+	Help:      "zdocker 命令行调用耗时，按子命令和退出码区分",
+	Buckets:   []float64{.01, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+}, []string{"subcommand", "exit_code"})
+
+// observeCLI 记录一次 zdocker 命令行调用，无法启动进程时退出码记为 error
+func observeCLI(args []string, start time.Time, err error) {
+	code := "0"
+	if err != nil {
+		code = "error"
+		var exitError *exec.ExitError
+		if errors.As(err, &exitError) {
+			code = strconv.Itoa(exitError.ExitCode())
+		}
+	}
+	cliDuration.WithLabelValues(cliSubcommand(args), code).Observe(time.Since(start).Seconds())
+}
+
+// cliSubcommand 返回子命令名称，network 等命令组包含下一级子命令
+func cliSubcommand(args []string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	name := strings.TrimLeft(args[0], "-")
+	if name == "network" && len(args) > 1 {
+		return name + " " + args[1]
+	}
+	return name
+}
+
+// containerLabels 容器指标的标签
+var containerLabels = []string{"id", "name", "image"}
+
+// PrometheusCollector 在每次抓取时读取容器状态和资源使用情况
+type PrometheusCollector struct {
+	runtime Runtime
+
+	containers    *prometheus.Desc
+	cpuUsage      *prometheus.Desc
+	memoryUsage   *prometheus.Desc
+	memoryLimit   *prometheus.Desc
+	pids          *prometheus.Desc
+	networkRx     *prometheus.Desc
+	networkTx     *prometheus.Desc
+	restartCount  *prometheus.Desc
+	scrapeFailure *prometheus.Desc
+}
+
+// NewPrometheusCollector 创建容器指标收集器，需要注册到 Prometheus registry
+func NewPrometheusCollector(runtime Runtime) *PrometheusCollector {
+	return &PrometheusCollector{
+		runtime: runtime,
+		containers: prometheus.NewDesc("zdocker_containers",
+			"按状态统计的容器数量", []string{"status"}, nil),
+		cpuUsage: prometheus.NewDesc("zdocker_container_cpu_usage_seconds_total",
+			"容器累计使用的 CPU 时间", containerLabels, nil),
+		memoryUsage: prometheus.NewDesc("zdocker_container_memory_usage_bytes",
+			"容器内存使用量，不含可回收页缓存", containerLabels, nil),
+		memoryLimit: prometheus.NewDesc("zdocker_container_memory_limit_bytes",
+			"容器内存限制，未设置时为主机内存总量", containerLabels, nil),
+		pids: prometheus.NewDesc("zdocker_container_pids",
+			"容器内的进程数", containerLabels, nil),
+		networkRx: prometheus.NewDesc("zdocker_container_network_receive_bytes_total",
+			"容器网络接口累计接收字节数", append(containerLabels, "interface"), nil),
+		networkTx: prometheus.NewDesc("zdocker_container_network_transmit_bytes_total",
+			"容器网络接口累计发送字节数", append(containerLabels, "interface"), nil),
+		restartCount: prometheus.NewDesc("zdocker_container_restart_count",
+			"容器被自动重启的次数", containerLabels, nil),
+		scrapeFailure: prometheus.NewDesc("zdocker_container_scrape_error",
+			"读取容器列表失败时为 1", nil, nil),
+	}
+}
+
+// Describe 实现 prometheus.Collector
+func (p *PrometheusCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- p.containers
+	ch <- p.cpuUsage
+	ch <- p.memoryUsage
+	ch <- p.memoryLimit
+	ch <- p.pids
+	ch <- p.networkRx
+	ch <- p.networkTx
+	ch <- p.restartCount
+	ch <- p.scrapeFailure
+}
+
+// Collect 实现 prometheus.Collector
+func (p *PrometheusCollector) Collect(ch chan<- prometheus.Metric) {
+	containers, err := p.runtime.ListContainers()
+	if err != nil {
+		ch <- prometheus.MustNewConstMetric(p.scrapeFailure, prometheus.GaugeValue, 1)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(p.scrapeFailure, prometheus.GaugeValue, 0)
+
+	counts := map[string]int{
+		container.RUNNING: 0,
+		container.STOP:    0,
+		container.EXIT:    0,
+	}
+	for _, c := range containers {
+		counts[c.Status]++
+		labels := []string{c.ID, c.Name, c.Image}
+		ch <- prometheus.MustNewConstMetric(p.restartCount, prometheus.GaugeValue, float64(c.RestartCount), labels...)
+
+		if c.Status != container.RUNNING {
+			continue
+		}
+		stats, err := p.runtime.ContainerStats(c.Name)
+		if err != nil {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(p.cpuUsage, prometheus.CounterValue, float64(stats.CPU.UsageNanos)/float64(time.Second), labels...)
+		ch <- prometheus.MustNewConstMetric(p.memoryUsage, prometheus.GaugeValue, float64(stats.Memory.Usage), labels...)
+		ch <- prometheus.MustNewConstMetric(p.memoryLimit, prometheus.GaugeValue, float64(stats.Memory.Limit), labels...)
+		ch <- prometheus.MustNewConstMetric(p.pids, prometheus.GaugeValue, float64(stats.Pids.Current), labels...)
+		for iface, n := range stats.Networks {
+			ch <- prometheus.MustNewConstMetric(p.networkRx, prometheus.CounterValue, float64(n.RxBytes), append(labels, iface)...)
+			ch <- prometheus.MustNewConstMetric(p.networkTx, prometheus.CounterValue, float64(n.TxBytes), append(labels, iface)...)
+		}
+	}
+
+	for status, n := range counts {
+		ch <- prometheus.MustNewConstMetric(p.containers, prometheus.GaugeValue, float64(n), status)
+	}
+}
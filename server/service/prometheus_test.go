@@ -0,0 +1,121 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/crazyfrankie/zdocker/container"
+)
+
+// statsRuntime 返回固定容器列表和资源使用情况的运行时
+type statsRuntime struct {
+	*FakeRuntime
+	containers []Container
+	stats      map[string]ContainerStats
+	listErr    error
+}
+
+// ListContainers 返回固定的容器列表
+func (r *statsRuntime) ListContainers() ([]Container, error) {
+	return r.containers, r.listErr
+}
+
+// ContainerStats 返回固定的资源使用情况
+func (r *statsRuntime) ContainerStats(containerName string) (ContainerStats, error) {
+	stats, ok := r.stats[containerName]
+	if !ok {
+		return ContainerStats{}, ErrContainerNotRunning
+	}
+	return stats, nil
+}
+
+func TestPrometheusCollector(t *testing.T) {
+	rt := &statsRuntime{
+		FakeRuntime: NewFakeRuntime(),
+		containers: []Container{
+			{ID: "1111", Name: "web", Image: "nginx", Status: container.RUNNING, RestartCount: 2},
+			{ID: "2222", Name: "db", Image: "redis", Status: container.STOP},
+			// 读取资源使用情况失败的容器只报告重启次数
+			{ID: "3333", Name: "job", Image: "busybox", Status: container.RUNNING},
+		},
+		stats: map[string]ContainerStats{
+			"web": {
+				CPU:      CPUStats{UsageNanos: 1500000000},
+				Memory:   MemoryStats{Usage: 1024, Limit: 4096},
+				Pids:     PidsStats{Current: 3},
+				Networks: map[string]NetworkStats{"eth0": {RxBytes: 100, TxBytes: 200}},
+			},
+		},
+	}
+
+	want := `
+# HELP zdocker_container_cpu_usage_seconds_total 容器累计使用的 CPU 时间
+# TYPE zdocker_container_cpu_usage_seconds_total counter
+zdocker_container_cpu_usage_seconds_total{id="1111",image="nginx",name="web"} 1.5
+# HELP zdocker_container_memory_limit_bytes 容器内存限制，未设置时为主机内存总量
+# TYPE zdocker_container_memory_limit_bytes gauge
+zdocker_container_memory_limit_bytes{id="1111",image="nginx",name="web"} 4096
+# HELP zdocker_container_memory_usage_bytes 容器内存使用量，不含可回收页缓存
+# TYPE zdocker_container_memory_usage_bytes gauge
+zdocker_container_memory_usage_bytes{id="1111",image="nginx",name="web"} 1024
+# HELP zdocker_container_network_receive_bytes_total 容器网络接口累计接收字节数
+# TYPE zdocker_container_network_receive_bytes_total counter
+zdocker_container_network_receive_bytes_total{id="1111",image="nginx",interface="eth0",name="web"} 100
+# HELP zdocker_container_network_transmit_bytes_total 容器网络接口累计发送字节数
+# TYPE zdocker_container_network_transmit_bytes_total counter
+zdocker_container_network_transmit_bytes_total{id="1111",image="nginx",interface="eth0",name="web"} 200
+# HELP zdocker_container_pids 容器内的进程数
+# TYPE zdocker_container_pids gauge
+zdocker_container_pids{id="1111",image="nginx",name="web"} 3
+# HELP zdocker_container_restart_count 容器被自动重启的次数
+# TYPE zdocker_container_restart_count gauge
+zdocker_container_restart_count{id="1111",image="nginx",name="web"} 2
+zdocker_container_restart_count{id="2222",image="redis",name="db"} 0
+zdocker_container_restart_count{id="3333",image="busybox",name="job"} 0
+# HELP zdocker_container_scrape_error 读取容器列表失败时为 1
+# TYPE zdocker_container_scrape_error gauge
+zdocker_container_scrape_error 0
+# HELP zdocker_containers 按状态统计的容器数量
+# TYPE zdocker_containers gauge
+zdocker_containers{status="exit"} 0
+zdocker_containers{status="running"} 2
+zdocker_containers{status="stop"} 1
+`
+	collector := NewPrometheusCollector(rt)
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+
+	// 读取容器列表失败时只报告错误
+	rt.listErr = errors.New("list failed")
+	want = `
+# HELP zdocker_container_scrape_error 读取容器列表失败时为 1
+# TYPE zdocker_container_scrape_error gauge
+zdocker_container_scrape_error 1
+`
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCLISubcommand(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{args: nil, want: ""},
+		{args: []string{"ps"}, want: "ps"},
+		{args: []string{"run", "-d", "busybox"}, want: "run"},
+		{args: []string{"--version"}, want: "version"},
+		{args: []string{"network", "create", "--driver", "bridge"}, want: "network create"},
+		{args: []string{"network"}, want: "network"},
+	}
+	for _, tt := range tests {
+		if got := cliSubcommand(tt.args); got != tt.want {
+			t.Errorf("cliSubcommand(%q) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
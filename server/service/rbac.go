@@ -0,0 +1,362 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bytedance/sonic"
+)
+
+// Permission 接口操作的权限，格式为 资源:操作
+type Permission string
+
+// 内置的权限。容器相关的权限受角色的容器范围限制，其余权限不区分容器
+const (
+	// PermContainersRead 查看容器列表、详情、日志、资源使用、文件变化，浏览和下载容器文件，订阅事件
+	PermContainersRead Permission = "containers:read"
+	// PermContainersWrite 创建、启动和停止容器
+	PermContainersWrite Permission = "containers:write"
+	// PermContainersDelete 删除容器
+	PermContainersDelete Permission = "containers:delete"
+	// PermContainersExec 在容器中执行命令、上传文件和创建挂载数据卷的容器，等同于容器内的 root 权限
+	PermContainersExec Permission = "containers:exec"
+	// PermImagesRead 查看和下载镜像
+	PermImagesRead Permission = "images:read"
+	// PermImagesWrite 上传、删除镜像和将容器提交为镜像
+	PermImagesWrite Permission = "images:write"
+	// PermNetworksRead 查看网络
+	PermNetworksRead Permission = "networks:read"
+	// PermNetworksWrite 创建和删除网络
+	PermNetworksWrite Permission = "networks:write"
+	// PermSystemRead 查看系统信息、版本和历史指标，以及抓取 /metrics
+	PermSystemRead Permission = "system:read"
+	// PermSystemWrite 触发状态校正等系统操作
+	PermSystemWrite Permission = "system:write"
+	// PermAuditRead 查看审计日志，其中包含所有用户的操作记录
+	PermAuditRead Permission = "audit:read"
+)
+
+// allPermissions 所有权限，用于校验自定义角色
+var allPermissions = []Permission{
+	PermContainersRead, PermContainersWrite, PermContainersDelete, PermContainersExec,
+	PermImagesRead, PermImagesWrite,
+	PermNetworksRead, PermNetworksWrite,
+	PermSystemRead, PermSystemWrite,
+	PermAuditRead,
+}
+
+// 内置角色
+const (
+	RoleViewer   = "viewer"
+	RoleOperator = "operator"
+	RoleAdmin    = "admin"
+)
+
+// rolesFileName 自定义角色的配置文件名
+const rolesFileName = "roles.json"
+
+// builtinRoles 内置角色，不能被自定义角色覆盖
+var builtinRoles = map[string]Role{
+	RoleViewer: {
+		Name:        RoleViewer,
+		Description: "查看容器、日志、镜像、网络和系统信息",
+		Permissions: []Permission{PermContainersRead, PermImagesRead, PermNetworksRead, PermSystemRead},
+	},
+	RoleOperator: {
+		Name:        RoleOperator,
+		Description: "在 viewer 的基础上创建、启动和停止容器",
+		Permissions: []Permission{PermContainersRead, PermContainersWrite, PermImagesRead, PermNetworksRead, PermSystemRead},
+	},
+	RoleAdmin: {
+		Name:        RoleAdmin,
+		Description: "所有权限，包括删除容器、进入容器执行命令、管理镜像和网络",
+		Permissions: []Permission{"*"},
+	},
+}
+
+// RolesFile 返回自定义角色的配置文件路径
+func RolesFile() string {
+	return filepath.Join(DataDir(), rolesFileName)
+}
+
+// Role 角色，由一组权限和可选的容器范围组成
+type Role struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Permissions 权限列表，支持 * 表示所有权限，containers:* 表示一类资源的所有操作
+	Permissions []Permission `json:"permissions"`
+	// Containers 容器名称的通配符模式（path.Match 语法），为空时不限制名称
+	Containers []string `json:"containers,omitempty"`
+	// Labels 容器必须包含的标签，为空时不限制标签
+	Labels map[string]string `json:"labels,omitempty"`
+	// Builtin 是否为内置角色
+	Builtin bool `json:"builtin,omitempty"`
+}
+
+// Grants 判断角色是否包含权限，不考虑容器范围
+func (r Role) Grants(perm Permission) bool {
+	return grants(r.Permissions, perm)
+}
+
+// grants 判断权限列表是否包含权限，支持 * 和 资源:* 通配符
+func grants(perms []Permission, perm Permission) bool {
+	resource, _, _ := strings.Cut(string(perm), ":")
+	for _, p := range perms {
+		if p == "*" || p == perm || p == Permission(resource+":*") {
+			return true
+		}
+	}
+	return false
+}
+
+// Scoped 判断角色是否只能操作部分容器
+func (r Role) Scoped() bool {
+	return len(r.Containers) > 0 || len(r.Labels) > 0
+}
+
+// InScope 判断容器是否在角色的范围内：名称匹配任一模式，并且包含所有要求的标签
+func (r Role) InScope(name string, labels map[string]string) bool {
+	if len(r.Containers) > 0 {
+		matched := false
+		for _, pattern := range r.Containers {
+			if ok, _ := path.Match(pattern, name); ok {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	for key, value := range r.Labels {
+		if v, ok := labels[key]; !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
+
+// validate 校验自定义角色
+func (r Role) validate() error {
+	if !usernamePattern.MatchString(r.Name) {
+		return fmt.Errorf("角色名称 %q 无效", r.Name)
+	}
+	if _, ok := builtinRoles[r.Name]; ok {
+		return fmt.Errorf("不能覆盖内置角色 %s", r.Name)
+	}
+	for _, p := range r.Permissions {
+		if !validPermission(p) {
+			return fmt.Errorf("角色 %s 的权限 %q 无效", r.Name, p)
+		}
+	}
+	for _, pattern := range r.Containers {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("角色 %s 的容器模式 %q 无效: %v", r.Name, pattern, err)
+		}
+	}
+	return nil
+}
+
+// validPermission 判断权限是否为已知权限或通配符
+func validPermission(p Permission) bool {
+	if p == "*" {
+		return true
+	}
+	for _, known := range allPermissions {
+		resource, _, _ := strings.Cut(string(known), ":")
+		if p == known || p == Permission(resource+":*") {
+			return true
+		}
+	}
+	return false
+}
+
+// rolesFile 自定义角色配置文件的结构
+type rolesFile struct {
+	Roles []Role `json:"roles"`
+}
+
+// RoleStore 内置角色和配置文件中的自定义角色，配置文件修改后在下次访问时重新加载
+type RoleStore struct {
+	path string
+
+	mu      sync.Mutex
+	custom  map[string]Role
+	modTime time.Time
+}
+
+// NewRoleStore 加载自定义角色，配置文件不存在时只有内置角色
+func NewRoleStore(path string) (*RoleStore, error) {
+	s := &RoleStore{path: path, custom: map[string]Role{}}
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// reload 在文件修改时间变化时重新读取配置，调用方需持有锁（构造时除外）。
+// 配置有误时返回错误并保留上一次成功加载的角色
+func (s *RoleStore) reload() error {
+	st, err := os.Stat(s.path)
+	if os.IsNotExist(err) {
+		s.custom, s.modTime = map[string]Role{}, time.Time{}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("读取角色配置失败: %v", err)
+	}
+	if st.ModTime().Equal(s.modTime) {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return fmt.Errorf("读取角色配置失败: %v", err)
+	}
+	var file rolesFile
+	if err := sonic.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("解析角色配置 %s 失败: %v", s.path, err)
+	}
+	custom := make(map[string]Role, len(file.Roles))
+	for _, r := range file.Roles {
+		if err := r.validate(); err != nil {
+			return fmt.Errorf("角色配置 %s 有误: %v", s.path, err)
+		}
+		r.Builtin = false
+		custom[r.Name] = r
+	}
+	s.custom = custom
+	s.modTime = st.ModTime()
+	return nil
+}
+
+// Get 根据名称获取角色
+func (s *RoleStore) Get(name string) (Role, bool) {
+	if r, ok := builtinRoles[name]; ok {
+		r.Builtin = true
+		return r, true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.reload(); err != nil {
+		log.Printf("加载角色配置失败，继续使用上一次的配置: %v", err)
+	}
+	r, ok := s.custom[name]
+	return r, ok
+}
+
+// List 返回所有角色，内置角色在前
+func (s *RoleStore) List() []Role {
+	roles := make([]Role, 0, len(builtinRoles))
+	for _, name := range []string{RoleViewer, RoleOperator, RoleAdmin} {
+		r := builtinRoles[name]
+		r.Builtin = true
+		roles = append(roles, r)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.reload(); err != nil {
+		log.Printf("加载角色配置失败，继续使用上一次的配置: %v", err)
+	}
+	custom := make([]Role, 0, len(s.custom))
+	for _, r := range s.custom {
+		custom = append(custom, r)
+	}
+	sort.Slice(custom, func(i, j int) bool { return custom[i].Name < custom[j].Name })
+	return append(roles, custom...)
+}
+
+// Access 调用方的角色，用于判断能否执行操作
+type Access struct {
+	Username string
+	Roles    []Role
+	// Scopes 通过 API 令牌认证时令牌的权限范围，为 nil 时不限制
+	Scopes []Permission
+}
+
+// Can 判断是否有任一角色包含权限，不考虑容器范围。用于列表等之后再按容器过滤的接口
+func (a Access) Can(perm Permission) bool {
+	if a.Scopes != nil && !grants(a.Scopes, perm) {
+		return false
+	}
+	for _, r := range a.Roles {
+		if r.Grants(perm) {
+			return true
+		}
+	}
+	return false
+}
+
+// CanContainer 判断是否有包含权限、且容器在其范围内的角色
+func (a Access) CanContainer(perm Permission, name string, labels map[string]string) bool {
+	if a.Scopes != nil && !grants(a.Scopes, perm) {
+		return false
+	}
+	for _, r := range a.Roles {
+		if r.Grants(perm) && r.InScope(name, labels) {
+			return true
+		}
+	}
+	return false
+}
+
+// Permissions 返回所有角色的权限并集，通配符展开为具体权限
+func (a Access) Permissions() []Permission {
+	perms := []Permission{}
+	for _, p := range allPermissions {
+		if a.Can(p) {
+			perms = append(perms, p)
+		}
+	}
+	return perms
+}
+
+// Authorizer 根据用户的角色计算访问权限
+type Authorizer struct {
+	users *UserStore
+	roles *RoleStore
+}
+
+// NewAuthorizer 创建授权器
+func NewAuthorizer(users *UserStore, roles *RoleStore) *Authorizer {
+	return &Authorizer{users: users, roles: roles}
+}
+
+// Roles 返回角色存储
+func (z *Authorizer) Roles() *RoleStore {
+	return z.roles
+}
+
+// Access 返回调用方的访问权限，用户引用了不存在的角色时忽略该角色。
+// 通过 API 令牌认证时，权限为用户角色和令牌范围的交集
+func (z *Authorizer) Access(p Principal) (Access, error) {
+	u, err := z.users.Get(p.Username)
+	if err != nil {
+		return Access{}, err
+	}
+	access := Access{Username: u.Username}
+	if p.TokenID != "" {
+		access.Scopes = p.Scopes
+		if access.Scopes == nil {
+			access.Scopes = []Permission{}
+		}
+	}
+	for _, name := range u.RoleNames() {
+		r, ok := z.roles.Get(name)
+		if !ok {
+			log.Printf("用户 %s 的角色 %s 不存在", u.Username, name)
+			continue
+		}
+		access.Roles = append(access.Roles, r)
+	}
+	return access, nil
+}
@@ -0,0 +1,124 @@
+package service
+
+import "testing"
+
+func TestGrants(t *testing.T) {
+	tests := []struct {
+		perms []Permission
+		perm  Permission
+		want  bool
+	}{
+		{perms: nil, perm: PermContainersRead, want: false},
+		{perms: []Permission{"*"}, perm: PermAuditRead, want: true},
+		{perms: []Permission{PermContainersRead}, perm: PermContainersRead, want: true},
+		{perms: []Permission{PermContainersRead}, perm: PermContainersWrite, want: false},
+		{perms: []Permission{"containers:*"}, perm: PermContainersExec, want: true},
+		{perms: []Permission{"containers:*"}, perm: PermImagesRead, want: false},
+		{perms: []Permission{"images:*", PermNetworksRead}, perm: PermNetworksRead, want: true},
+		{perms: []Permission{"images:*", PermNetworksRead}, perm: PermNetworksWrite, want: false},
+		// 资源名称必须完全一致，不能按前缀匹配
+		{perms: []Permission{"container:*"}, perm: PermContainersRead, want: false},
+		{perms: []Permission{"containers"}, perm: PermContainersRead, want: false},
+	}
+	for _, tt := range tests {
+		if got := grants(tt.perms, tt.perm); got != tt.want {
+			t.Errorf("grants(%v, %s) = %v, want %v", tt.perms, tt.perm, got, tt.want)
+		}
+	}
+}
+
+func TestRoleInScope(t *testing.T) {
+	tests := []struct {
+		name   string
+		role   Role
+		target string
+		labels map[string]string
+		want   bool
+	}{
+		{name: "unscoped", role: Role{}, target: "web", want: true},
+		{name: "exact name", role: Role{Containers: []string{"web"}}, target: "web", want: true},
+		{name: "other name", role: Role{Containers: []string{"web"}}, target: "web-1", want: false},
+		{name: "glob", role: Role{Containers: []string{"team-a-*"}}, target: "team-a-api", want: true},
+		{name: "glob mismatch", role: Role{Containers: []string{"team-a-*"}}, target: "team-b-api", want: false},
+		{name: "any pattern", role: Role{Containers: []string{"db", "web-?"}}, target: "web-1", want: true},
+		{name: "single char glob", role: Role{Containers: []string{"web-?"}}, target: "web-10", want: false},
+		{name: "label", role: Role{Labels: map[string]string{"team": "a"}}, target: "x", labels: map[string]string{"team": "a", "env": "prod"}, want: true},
+		{name: "label value", role: Role{Labels: map[string]string{"team": "a"}}, target: "x", labels: map[string]string{"team": "b"}, want: false},
+		{name: "label missing", role: Role{Labels: map[string]string{"team": "a"}}, target: "x", want: false},
+		{name: "empty label value", role: Role{Labels: map[string]string{"team": ""}}, target: "x", want: false},
+		{name: "all labels", role: Role{Labels: map[string]string{"team": "a", "env": "prod"}}, target: "x", labels: map[string]string{"team": "a"}, want: false},
+		{
+			name:   "name and labels",
+			role:   Role{Containers: []string{"team-a-*"}, Labels: map[string]string{"env": "dev"}},
+			target: "team-a-api",
+			labels: map[string]string{"env": "dev"},
+			want:   true,
+		},
+		{
+			name:   "name matches but labels do not",
+			role:   Role{Containers: []string{"team-a-*"}, Labels: map[string]string{"env": "dev"}},
+			target: "team-a-api",
+			labels: map[string]string{"env": "prod"},
+			want:   false,
+		},
+		{name: "malformed pattern", role: Role{Containers: []string{"web-["}}, target: "web-[", want: false},
+	}
+	for _, tt := range tests {
+		if got := tt.role.InScope(tt.target, tt.labels); got != tt.want {
+			t.Errorf("%s: InScope(%q, %v) = %v, want %v", tt.name, tt.target, tt.labels, got, tt.want)
+		}
+	}
+}
+
+func TestAccessCanContainer(t *testing.T) {
+	teamA := Role{
+		Name:        "team-a",
+		Permissions: []Permission{"containers:*"},
+		Containers:  []string{"team-a-*"},
+	}
+	viewer := builtinRoles[RoleViewer]
+
+	tests := []struct {
+		name   string
+		access Access
+		perm   Permission
+		target string
+		want   bool
+	}{
+		{name: "scoped role in scope", access: Access{Roles: []Role{teamA}}, perm: PermContainersExec, target: "team-a-api", want: true},
+		{name: "scoped role out of scope", access: Access{Roles: []Role{teamA}}, perm: PermContainersExec, target: "team-b-api", want: false},
+		// 权限和范围必须来自同一个角色：viewer 的读权限不能与 team-a 的范围组合
+		{name: "roles not combined", access: Access{Roles: []Role{teamA, viewer}}, perm: PermContainersWrite, target: "team-b-api", want: false},
+		{name: "unscoped viewer", access: Access{Roles: []Role{teamA, viewer}}, perm: PermContainersRead, target: "team-b-api", want: true},
+		{name: "token scope allows", access: Access{Roles: []Role{teamA}, Scopes: []Permission{PermContainersRead}}, perm: PermContainersRead, target: "team-a-api", want: true},
+		{name: "token scope limits", access: Access{Roles: []Role{teamA}, Scopes: []Permission{PermContainersRead}}, perm: PermContainersWrite, target: "team-a-api", want: false},
+		{name: "token scope cannot widen role", access: Access{Roles: []Role{viewer}, Scopes: []Permission{"*"}}, perm: PermContainersDelete, target: "web", want: false},
+		{name: "empty token scope", access: Access{Roles: []Role{builtinRoles[RoleAdmin]}, Scopes: []Permission{}}, perm: PermContainersRead, target: "web", want: false},
+		{name: "no roles", access: Access{}, perm: PermContainersRead, target: "web", want: false},
+	}
+	for _, tt := range tests {
+		if got := tt.access.CanContainer(tt.perm, tt.target, nil); got != tt.want {
+			t.Errorf("%s: CanContainer(%s, %q) = %v, want %v", tt.name, tt.perm, tt.target, got, tt.want)
+		}
+	}
+}
+
+func TestValidPermission(t *testing.T) {
+	tests := []struct {
+		perm Permission
+		want bool
+	}{
+		{perm: "*", want: true},
+		{perm: PermContainersExec, want: true},
+		{perm: "containers:*", want: true},
+		{perm: "audit:*", want: true},
+		{perm: "containers:admin", want: false},
+		{perm: "volumes:*", want: false},
+		{perm: "", want: false},
+	}
+	for _, tt := range tests {
+		if got := validPermission(tt.perm); got != tt.want {
+			t.Errorf("validPermission(%q) = %v, want %v", tt.perm, got, tt.want)
+		}
+	}
+}
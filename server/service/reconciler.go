@@ -0,0 +1,230 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/crazyfrankie/zdocker/container"
+)
+
+// defaultReconcileInterval 后台校正容器状态的默认间隔
+const defaultReconcileInterval = 2 * time.Second
+
+// ReconcileResult 一次状态校正的结果
+type ReconcileResult struct {
+	// Checked 检查的 running 容器数量
+	Checked int `json:"checked"`
+	// Exited 本次发现已退出并标记为 exit 的容器
+	Exited []string `json:"exited"`
+}
+
+// Reconciler 后台校正容器状态：定期检查 running 容器的进程是否存在，
+// 将已退出的容器标记为 exit 并记录发现时间。读取容器信息时不再修改 config.json。
+type Reconciler struct {
+	Runtime
+
+	interval time.Duration
+	// runMu 串行化校正过程，避免并发重写同一个 config.json
+	runMu sync.Mutex
+
+	mu    sync.Mutex
+	exits map[string]time.Time
+
+	events *EventBus
+
+	trigger chan struct{}
+	done    chan struct{}
+}
+
+// NewReconciler 创建状态校正器，interval 为 0 时使用默认间隔，events 为 nil 时不发布事件
+func NewReconciler(runtime Runtime, interval time.Duration, events *EventBus) *Reconciler {
+	if interval <= 0 {
+		interval = defaultReconcileInterval
+	}
+	return &Reconciler{
+		Runtime:  runtime,
+		interval: interval,
+		exits:    make(map[string]time.Time),
+		events:   events,
+		trigger:  make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start 立即校正一次并启动后台校正协程
+func (r *Reconciler) Start() {
+	r.reconcileAndLog()
+	go func() {
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.done:
+				return
+			case <-ticker.C:
+			case <-r.trigger:
+			}
+			r.reconcileAndLog()
+		}
+	}()
+}
+
+// Stop 停止后台校正协程
+func (r *Reconciler) Stop() {
+	close(r.done)
+}
+
+// Trigger 请求后台协程尽快执行一次校正，不等待结果
+func (r *Reconciler) Trigger() {
+	select {
+	case r.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// reconcileAndLog 执行校正并记录错误
+func (r *Reconciler) reconcileAndLog() {
+	if _, err := r.Reconcile(); err != nil {
+		log.Printf("状态校正失败: %v", err)
+	}
+}
+
+// Reconcile 同步执行一次校正
+func (r *Reconciler) Reconcile() (ReconcileResult, error) {
+	r.runMu.Lock()
+	defer r.runMu.Unlock()
+
+	result := ReconcileResult{Exited: []string{}}
+
+	containers, err := r.Runtime.ListContainers()
+	if err != nil {
+		// zdocker 尚未创建过容器时状态目录不存在
+		if os.IsNotExist(err) {
+			return result, nil
+		}
+		return result, err
+	}
+
+	for _, c := range containers {
+		if c.Status != container.RUNNING || c.Pid == "" {
+			continue
+		}
+
+		result.Checked++
+		if isProcessRunning(c.Pid) {
+			continue
+		}
+
+		noticed := time.Now()
+		updated, err := updateContainerStatusToExit(c.Name, c.Pid)
+		if errors.Is(err, ErrContainerNotFound) {
+			// 列出后容器已被删除
+			continue
+		}
+		if err != nil {
+			log.Printf("状态校正: 标记容器 %s 退出失败: %v", c.Name, err)
+			continue
+		}
+		if !updated {
+			continue
+		}
+
+		r.mu.Lock()
+		r.exits[c.Name] = noticed
+		r.mu.Unlock()
+		updateContainerState(c.Name, func(state *ContainerState) {
+			state.LastExitTime = noticed
+		})
+		result.Exited = append(result.Exited, c.Name)
+
+		event := Event{
+			Type:          EventContainerExited,
+			Time:          noticed,
+			Actor:         ActorReconciler,
+			ContainerID:   c.ID,
+			ContainerName: c.Name,
+		}
+		if code, ok := r.ExitCode(c.Name); ok {
+			event.ExitCode = &code
+		}
+		r.events.Publish(event)
+	}
+
+	return result, nil
+}
+
+// ExitedAt 返回校正器发现容器退出的时间，首次查询时从 state.json 读取服务重启前记录的时间
+func (r *Reconciler) ExitedAt(containerName string) (time.Time, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t, ok := r.exits[containerName]
+	if !ok {
+		// 没有记录时同样缓存零值，避免每次列出容器都读取文件
+		t = readContainerState(containerName).LastExitTime
+		r.exits[containerName] = t
+	}
+	return t, !t.IsZero()
+}
+
+// ExitCode 转发底层运行时记录的退出码
+func (r *Reconciler) ExitCode(containerName string) (int, bool) {
+	if reporter, ok := r.Runtime.(exitCodeReporter); ok {
+		return reporter.ExitCode(containerName)
+	}
+	return 0, false
+}
+
+// decorate 在容器信息中补充最近一次退出时间
+func (r *Reconciler) decorate(c *Container) {
+	if t, ok := r.ExitedAt(c.Name); ok {
+		c.LastExitTime = t.Format(time.DateTime)
+	}
+}
+
+// ListContainers 获取容器列表
+func (r *Reconciler) ListContainers() ([]Container, error) {
+	containers, err := r.Runtime.ListContainers()
+	if err != nil {
+		return nil, err
+	}
+	for i := range containers {
+		r.decorate(&containers[i])
+	}
+	return containers, nil
+}
+
+// GetContainer 根据ID或名称获取容器信息
+func (r *Reconciler) GetContainer(containerId string) (Container, error) {
+	c, err := r.Runtime.GetContainer(containerId)
+	if err != nil {
+		return Container{}, err
+	}
+	r.decorate(&c)
+	return c, nil
+}
+
+// StopContainer 停止容器后立即校正，尽快反映最新状态
+func (r *Reconciler) StopContainer(containerName string) error {
+	defer r.Trigger()
+	return r.Runtime.StopContainer(containerName)
+}
+
+// RemoveContainer 删除容器及其退出记录
+func (r *Reconciler) RemoveContainer(containerName string) error {
+	c, err := r.Runtime.GetContainer(containerName)
+	if err != nil {
+		return err
+	}
+	if err := r.Runtime.RemoveContainer(c.Name); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.exits, c.Name)
+	return nil
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"os"
+	"os/exec"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/crazyfrankie/zdocker/container"
+)
+
+// listRuntime 返回固定容器列表的运行时，其余方法由内存运行时实现
+type listRuntime struct {
+	*FakeRuntime
+	containers []Container
+}
+
+// ListContainers 返回固定的容器列表
+func (r *listRuntime) ListContainers() ([]Container, error) {
+	return r.containers, nil
+}
+
+// exitedPid 返回一个已退出进程的 PID
+func exitedPid(t *testing.T) string {
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Skipf("run true: %v", err)
+	}
+	return strconv.Itoa(cmd.Process.Pid)
+}
+
+func TestReconcile(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	store := useTestStore(t)
+
+	self := strconv.Itoa(os.Getpid())
+	dead := exitedPid(t)
+	infos := []*container.ContainerInfo{
+		{Name: "alive", Status: container.RUNNING, PID: self},
+		{Name: "dead", Status: container.RUNNING, PID: dead},
+		{Name: "stopped", Status: container.STOP},
+	}
+	for _, info := range infos {
+		if err := store.Write(info); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rt := &listRuntime{FakeRuntime: NewFakeRuntime(), containers: []Container{
+		{Name: "alive", Status: container.RUNNING, Pid: self},
+		{Name: "dead", Status: container.RUNNING, Pid: dead},
+		{Name: "stopped", Status: container.STOP},
+		// 列出后被删除的容器
+		{Name: "removed", Status: container.RUNNING, Pid: dead},
+	}}
+	events := NewEventBus(0)
+	backlog, _, ch, cancel := events.Subscribe(EventFilter{}, "")
+	defer cancel()
+	if len(backlog) != 0 {
+		t.Fatalf("backlog = %v, want empty", backlog)
+	}
+
+	r := NewReconciler(rt, 0, events)
+	result, err := r.Reconcile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (ReconcileResult{Checked: 3, Exited: []string{"dead"}}); !reflect.DeepEqual(result, want) {
+		t.Errorf("result = %+v, want %+v", result, want)
+	}
+
+	info, err := store.Read("dead")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Status != container.EXIT || info.PID != "" {
+		t.Errorf("dead container: status = %s, pid = %q, want %s and empty pid", info.Status, info.PID, container.EXIT)
+	}
+	exited, ok := r.ExitedAt("dead")
+	if !ok {
+		t.Fatal("ExitedAt(dead) not recorded")
+	}
+	if state, _ := store.ReadState("dead"); !state.LastExitTime.Equal(exited) {
+		t.Errorf("state.json last exit time = %v, want %v", state.LastExitTime, exited)
+	}
+	if _, ok := r.ExitedAt("alive"); ok {
+		t.Error("ExitedAt(alive) recorded")
+	}
+
+	select {
+	case e := <-ch:
+		if e.Type != EventContainerExited || e.ContainerName != "dead" || e.Actor != ActorReconciler {
+			t.Errorf("event = %+v", e)
+		}
+	default:
+		t.Error("no exited event published")
+	}
+
+	// 列表仍为 running 时已标记的容器不会再次标记；新的校正器从 state.json 读取退出时间
+	if result, err := r.Reconcile(); err != nil || len(result.Exited) != 0 {
+		t.Errorf("second reconcile: result = %+v, error = %v", result, err)
+	}
+	if got, ok := NewReconciler(rt, 0, nil).ExitedAt("dead"); !ok || !got.Equal(exited) {
+		t.Errorf("ExitedAt after restart = %v, %v, want %v", got, ok, exited)
+	}
+}
@@ -0,0 +1,168 @@
+package service
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/crazyfrankie/zdocker/container"
+)
+
+// RunConfigName 保存容器原始运行参数的文件名，与 config.json 位于同一目录。
+// zdocker 的 config.json 只记录命令、卷和端口，并且 zdocker stop 会按自身结构体重写该文件，
+// 因此镜像、资源限制、网络和环境变量单独保存，随容器目录一起删除。
+const RunConfigName = "runconfig.json"
+
+// exitCodeFileName 记录容器退出码的文件，位于容器根目录，实际保存在可写层中
+const exitCodeFileName = ".zdocker-exit"
+
+// readExitCode 读取可写层中记录的退出码
+func readExitCode(containerName string) (int, bool) {
+	data, err := os.ReadFile(filepath.Join(fmt.Sprintf(container.WriteLayerUrl, containerName), exitCodeFileName))
+	if err != nil {
+		return 0, false
+	}
+	code, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, false
+	}
+	return code, true
+}
+
+// removeExitCode 删除上次运行记录的退出码，运行中的容器没有退出码
+func removeExitCode(containerName string) {
+	os.Remove(filepath.Join(fmt.Sprintf(container.WriteLayerUrl, containerName), exitCodeFileName))
+}
+
+// writeExitCode 在可写层中记录退出码，服务重启后仍能读取
+func writeExitCode(containerName string, code int) error {
+	path := filepath.Join(fmt.Sprintf(container.WriteLayerUrl, containerName), exitCodeFileName)
+	return os.WriteFile(path, []byte(strconv.Itoa(code)+"\n"), 0644)
+}
+
+// saveRunConfig 保存容器的运行参数
+func saveRunConfig(containerName string, req CreateContainerRequest) error {
+	return containerStore.WriteRunConfig(containerName, req)
+}
+
+// loadRunConfig 重建容器的运行参数。优先读取 runconfig.json，
+// 对于通过 zdocker 命令行创建的容器，从 config.json 和挂载信息推断
+func loadRunConfig(info *container.ContainerInfo) (CreateContainerRequest, error) {
+	req, err := readRunConfig(info.Name)
+	if err == nil {
+		return req, nil
+	}
+	if !os.IsNotExist(err) {
+		return CreateContainerRequest{}, err
+	}
+
+	image := imageFromMount(info.Name)
+	if image == "" {
+		return CreateContainerRequest{}, fmt.Errorf("%w: 无法确定容器 %s 的镜像", ErrImageNotFound, info.Name)
+	}
+	return CreateContainerRequest{
+		Image:       image,
+		Command:     NewCommandLine(recordedArgs(info.Command)...),
+		Name:        info.Name,
+		Volume:      info.Volume,
+		PortMapping: info.PortMapping,
+	}, nil
+}
+
+// readRunConfig 读取 runconfig.json，文件不存在时返回 os.IsNotExist 可判断的错误
+func readRunConfig(containerName string) (CreateContainerRequest, error) {
+	return containerStore.ReadRunConfig(containerName)
+}
+
+// readContainerState 读取服务端维护的容器状态，读取失败时返回零值
+func readContainerState(containerName string) ContainerState {
+	state, err := containerStore.ReadState(containerName)
+	if err != nil {
+		log.Printf("读取容器 %s 的状态失败: %v", containerName, err)
+	}
+	return state
+}
+
+// updateContainerState 修改并保存容器状态，容器已被删除时忽略
+func updateContainerState(containerName string, fn func(state *ContainerState)) {
+	if err := containerStore.UpdateState(containerName, fn); err != nil && !errors.Is(err, ErrContainerNotFound) {
+		log.Printf("保存容器 %s 的状态失败: %v", containerName, err)
+	}
+}
+
+// imageFromMount 从 /proc/mounts 中容器 overlay 挂载的 lowerdir 推断镜像名称
+func imageFromMount(containerName string) string {
+	f, err := os.Open("/proc/mounts")
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	mntUrl := fmt.Sprintf(container.MntUrl, containerName)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || fields[1] != mntUrl || fields[2] != "overlay" {
+			continue
+		}
+		for _, opt := range strings.Split(fields[3], ",") {
+			if lower, ok := strings.CutPrefix(opt, "lowerdir="); ok {
+				return filepath.Base(lower)
+			}
+		}
+	}
+	return ""
+}
+
+// prepareStart 检查容器可以启动并返回用于重新运行的参数。
+// 会卸载上次运行残留的 overlay 和卷挂载，但保留可写层，使容器的文件修改在重启后仍然存在。
+func prepareStart(containerId string) (*container.ContainerInfo, CreateContainerRequest, error) {
+	name, err := lookupContainerName(containerId)
+	if err != nil {
+		return nil, CreateContainerRequest{}, err
+	}
+	info, err := readContainerInfo(name)
+	if err != nil {
+		return nil, CreateContainerRequest{}, err
+	}
+	if info.Status == container.RUNNING && isProcessRunning(info.PID) {
+		return nil, CreateContainerRequest{}, fmt.Errorf("%w: %s", ErrContainerRunning, name)
+	}
+
+	req, err := loadRunConfig(info)
+	if err != nil {
+		return nil, CreateContainerRequest{}, err
+	}
+	req.Detach = true
+	req.TTY = false
+
+	releaseMounts(name, req.Volume)
+	return info, req, nil
+}
+
+// releaseMounts 卸载容器的卷和 overlay 挂载点，未挂载时忽略错误
+func releaseMounts(containerName string, volume string) {
+	mntUrl := fmt.Sprintf(container.MntUrl, containerName)
+	if volumeUrls := strings.Split(volume, ":"); len(volumeUrls) == 2 && volumeUrls[1] != "" {
+		exec.Command("umount", filepath.Join(mntUrl, strings.TrimPrefix(volumeUrls[1], "/"))).Run()
+	}
+	exec.Command("umount", mntUrl).Run()
+}
+
+// restoreIdentity 重新运行后恢复容器原有的ID和创建时间，使客户端持有的ID继续有效
+func restoreIdentity(containerName string, original *container.ContainerInfo) (Container, error) {
+	var c Container
+	err := containerStore.Update(containerName, func(info *container.ContainerInfo) error {
+		info.ID = original.ID
+		info.CreateTime = original.CreateTime
+		c = containerFromInfo(info)
+		return nil
+	})
+	return c, err
+}
@@ -0,0 +1,135 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/crazyfrankie/zdocker/container"
+)
+
+func TestLoadRunConfig(t *testing.T) {
+	store := useTestStore(t)
+	req := CreateContainerRequest{
+		Image:       "busybox",
+		Name:        "zdw-test-web",
+		Entrypoint:  NewCommandLine("/bin/sh", "-c"),
+		Command:     NewCommandLine("echo 'a b'"),
+		Environment: map[string]string{"APP": "x"},
+		PortMapping: []string{"8080:80"},
+		Labels:      map[string]string{"team": "web"},
+		Memory:      "64m",
+	}
+	for _, name := range []string{"zdw-test-web", "zdw-test-cli"} {
+		if err := store.Write(&container.ContainerInfo{Name: name, Command: "sleep 100"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.WriteRunConfig("zdw-test-web", req); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := loadRunConfig(&container.ContainerInfo{Name: "zdw-test-web"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, req) {
+		t.Errorf("loadRunConfig = %+v, want %+v", got, req)
+	}
+
+	// 命令行创建的容器没有 runconfig.json，也没有挂载时无法确定镜像
+	if _, err := loadRunConfig(&container.ContainerInfo{Name: "zdw-test-cli"}); !errors.Is(err, ErrImageNotFound) {
+		t.Errorf("loadRunConfig without run config: error = %v, want ErrImageNotFound", err)
+	}
+}
+
+func TestPrepareStart(t *testing.T) {
+	store := useTestIndex(t)
+	self := strconv.Itoa(os.Getpid())
+	dead := exitedPid(t)
+
+	containers := []struct {
+		info container.ContainerInfo
+		req  *CreateContainerRequest
+	}{
+		{info: container.ContainerInfo{ID: "1111", Name: "zdw-test-exited", Status: container.EXIT, PID: dead},
+			req: &CreateContainerRequest{Image: "busybox", Name: "zdw-test-exited", Command: NewCommandLine("top"), TTY: true}},
+		// 记录为运行中但进程已退出，例如宿主机重启后
+		{info: container.ContainerInfo{ID: "2222", Name: "zdw-test-stale", Status: container.RUNNING, PID: dead},
+			req: &CreateContainerRequest{Image: "busybox", Name: "zdw-test-stale", Detach: true}},
+		{info: container.ContainerInfo{ID: "3333", Name: "zdw-test-running", Status: container.RUNNING, PID: self},
+			req: &CreateContainerRequest{Image: "busybox", Name: "zdw-test-running"}},
+		{info: container.ContainerInfo{ID: "4444", Name: "zdw-test-cli", Status: container.STOP}},
+	}
+	for _, c := range containers {
+		if err := store.Write(&c.info); err != nil {
+			t.Fatal(err)
+		}
+		if c.req != nil {
+			if err := store.WriteRunConfig(c.info.Name, *c.req); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	tests := []struct {
+		id      string
+		wantErr error
+		// wantName 启动时使用的容器名称
+		wantName string
+	}{
+		{id: "zdw-test-exited", wantName: "zdw-test-exited"},
+		{id: "1111", wantName: "zdw-test-exited"},
+		{id: "zdw-test-stale", wantName: "zdw-test-stale"},
+		{id: "zdw-test-running", wantErr: ErrContainerRunning},
+		{id: "zdw-test-cli", wantErr: ErrImageNotFound},
+		{id: "zdw-test-missing", wantErr: ErrContainerNotFound},
+	}
+	for _, tt := range tests {
+		original, req, err := prepareStart(tt.id)
+		if tt.wantErr != nil {
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("prepareStart(%s): error = %v, want %v", tt.id, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("prepareStart(%s): %v", tt.id, err)
+			continue
+		}
+		// 重新运行总是在后台，不分配终端
+		if original.Name != tt.wantName || req.Name != tt.wantName || req.Image != "busybox" || !req.Detach || req.TTY {
+			t.Errorf("prepareStart(%s) = %+v, %+v", tt.id, original, req)
+		}
+	}
+}
+
+func TestRestoreIdentity(t *testing.T) {
+	store := useTestStore(t)
+	original := &container.ContainerInfo{ID: "1111", Name: "web", CreateTime: "2026-10-01 12:00:00"}
+	// 重新运行后 zdocker 写入新的ID和创建时间
+	if err := store.Write(&container.ContainerInfo{ID: "9999", Name: "web", CreateTime: "2026-10-02 08:00:00", Status: container.RUNNING, PID: "42"}); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := restoreIdentity("web", original)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.ID != "1111" || c.CreatedTime != original.CreateTime || c.Pid != "42" {
+		t.Errorf("restoreIdentity = %+v", c)
+	}
+	info, err := store.Read("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.ID != "1111" || info.CreateTime != original.CreateTime || info.Status != container.RUNNING {
+		t.Errorf("stored info = %+v", info)
+	}
+
+	if _, err := restoreIdentity("missing", original); !errors.Is(err, ErrContainerNotFound) {
+		t.Errorf("restoreIdentity(missing): error = %v, want ErrContainerNotFound", err)
+	}
+}
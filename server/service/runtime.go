@@ -0,0 +1,83 @@
+package service
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// Runtime 容器运行时接口，屏蔽底层 zdocker 的具体调用方式
+type Runtime interface {
+	// ListContainers 获取容器列表
+	ListContainers() ([]Container, error)
+	// GetContainer 根据ID或名称获取容器信息
+	GetContainer(containerId string) (Container, error)
+	// InspectContainer 获取容器的完整信息
+	InspectContainer(containerId string) (ContainerInspect, error)
+	// CreateContainer 创建并运行容器
+	CreateContainer(req CreateContainerRequest) (Container, error)
+	// StartContainer 启动容器
+	StartContainer(containerName string) error
+	// StopContainer 停止容器
+	StopContainer(containerName string) error
+	// RemoveContainer 删除容器
+	RemoveContainer(containerName string) error
+	// ContainerLogs 获取容器日志
+	ContainerLogs(containerName string) (string, error)
+	// ContainerLogFile 获取容器日志文件路径，供日志跟随和按时间查询使用
+	ContainerLogFile(containerName string) (string, error)
+	// ExecContainer 在容器中执行命令
+	ExecContainer(containerName string, command []string) (ExecResult, error)
+	// ExecInteractive 构造在容器中执行命令的交互式进程，由调用方在伪终端中启动
+	ExecInteractive(containerName string, command []string) (*ExecProcess, error)
+	// ContainerStats 读取容器资源使用情况的一次采样
+	ContainerStats(containerName string) (ContainerStats, error)
+	// ContainerChanges 获取容器文件系统相对镜像的变化
+	ContainerChanges(containerName string, opts ChangesOptions) (ContainerChanges, error)
+	// CommitContainer 将容器的文件系统提交为新镜像，progress 可以为空
+	CommitContainer(containerName string, opts CommitOptions, progress func(CommitProgress)) (Image, error)
+	// ContainerFS 获取容器合并后的根文件系统，用于浏览、下载和上传文件
+	ContainerFS(containerName string) (*ContainerFS, error)
+
+	// ListImages 获取镜像列表
+	ListImages() ([]Image, error)
+	// GetImage 获取镜像详情
+	GetImage(imageName string) (Image, error)
+	// RemoveImage 删除镜像，force 为 true 时允许删除被已停止容器使用的镜像
+	RemoveImage(imageName string, force bool) error
+	// ImportImage 从 tar 包流导入镜像，checksum 不为空时校验 sha256
+	ImportImage(imageName string, r io.Reader, checksum string) (Image, error)
+	// OpenImage 打开镜像的 tar 包流，size 为 -1 表示长度未知
+	OpenImage(imageName string) (io.ReadCloser, int64, error)
+
+	// ListNetworks 获取网络列表
+	ListNetworks() ([]NetworkInfo, error)
+	// CreateNetwork 创建网络
+	CreateNetwork(req CreateNetworkRequest) (NetworkInfo, error)
+	// RemoveNetwork 删除网络
+	RemoveNetwork(networkName string) error
+
+	// Version 获取运行时版本
+	Version() (string, error)
+}
+
+// 运行时类型
+const (
+	RuntimeCLI    = "cli"
+	RuntimeNative = "native"
+	RuntimeFake   = "fake"
+)
+
+// NewRuntime 根据名称创建运行时，名称为空时默认使用 CLI 运行时
+func NewRuntime(name string) (Runtime, error) {
+	switch name {
+	case "", RuntimeCLI:
+		return NewCLIRuntime(os.Getenv("ZDOCKER_BIN")), nil
+	case RuntimeNative:
+		return NewNativeRuntime(), nil
+	case RuntimeFake:
+		return NewFakeRuntime(), nil
+	default:
+		return nil, fmt.Errorf("未知的运行时类型: %s", name)
+	}
+}
@@ -4,14 +4,10 @@ import (
 	"errors"
 	"fmt"
 	"os"
-	"os/exec"
 	"runtime"
 	"strconv"
 	"strings"
 	"syscall"
-	"time"
-
-	"github.com/bytedance/sonic"
 
 	"github.com/crazyfrankie/zdocker/container"
 )
@@ -27,22 +23,32 @@ type Container struct {
 	Pid         string `json:"pid"`
 	Volume      string `json:"volume"`
 	PortMapping string `json:"port_mapping"`
+	// Labels 创建时指定的标签
+	Labels map[string]string `json:"labels,omitempty"`
+
+	RestartPolicy string `json:"restart_policy"`
+	RestartCount  int    `json:"restart_count"`
+	LastExitTime  string `json:"last_exit_time,omitempty"`
 }
 
 // CreateContainerRequest 创建容器请求
 type CreateContainerRequest struct {
-	Image       string            `json:"image" binding:"required"`
-	Command     string            `json:"command" binding:"required"`
-	Name        string            `json:"name"`
-	Detach      bool              `json:"detach"`
-	TTY         bool              `json:"tty"`
-	Volume      string            `json:"volume"`
-	Memory      string            `json:"memory"`
-	CpuShare    string            `json:"cpu_share"`
-	CpuSet      string            `json:"cpu_set"`
-	Network     string            `json:"network"`
-	Environment map[string]string `json:"environment"`
-	PortMapping []string          `json:"port_mapping"`
+	Image         string            `json:"image"`
+	Command       CommandLine       `json:"command"`
+	Entrypoint    CommandLine       `json:"entrypoint"`
+	Workdir       string            `json:"workdir"`
+	Name          string            `json:"name"`
+	Detach        bool              `json:"detach"`
+	TTY           bool              `json:"tty"`
+	Volume        string            `json:"volume"`
+	Memory        string            `json:"memory"`
+	CpuShare      string            `json:"cpu_share"`
+	CpuSet        string            `json:"cpu_set"`
+	Network       string            `json:"network"`
+	Environment   map[string]string `json:"environment"`
+	Labels        map[string]string `json:"labels"`
+	PortMapping   []string          `json:"port_mapping"`
+	RestartPolicy string            `json:"restart_policy"`
 }
 
 // ExecRequest 执行命令请求
@@ -79,8 +85,12 @@ type SystemInfo struct {
 	ZDockerRoot  string `json:"zdocker_root"`
 }
 
-// GetContainerList 获取容器列表
+// GetContainerList 获取容器列表，索引就绪后从内存索引读取，状态由 Reconciler 负责校正
 func GetContainerList() ([]Container, error) {
+	if containerIndex.Ready() {
+		return containerIndex.List(ContainerFilter{}), nil
+	}
+
 	dirUrl := fmt.Sprintf(container.DefaultLocation, "")
 	dirUrl = dirUrl[:len(dirUrl)-1]
 
@@ -96,47 +106,48 @@ func GetContainerList() ([]Container, error) {
 			continue
 		}
 
-		// Check if container process is still running and update status if needed
-		if info.Status == container.RUNNING && info.PID != "" {
-			if !isProcessRunning(info.PID) {
-				if err := updateContainerStatusToExit(info.Name); err != nil {
-				} else {
-					info.Status = container.EXIT
-					info.PID = ""
-				}
-			}
-		}
-
-		containers = append(containers, Container{
-			ID:          info.ID,
-			Name:        info.Name,
-			Command:     info.Command,
-			Status:      info.Status,
-			CreatedTime: info.CreateTime,
-			Pid:         info.PID,
-			Volume:      info.Volume,
-		})
+		containers = append(containers, containerFromInfo(info))
 	}
 
 	return containers, nil
 }
 
-// getContainerInfoByName 根据容器名称获取容器信息
-func getContainerInfo(file os.DirEntry) (*container.ContainerInfo, error) {
-	var info container.ContainerInfo
-	fileName := file.Name()
-	cfgDir := fmt.Sprintf(container.DefaultLocation, fileName)
-	cfgName := cfgDir + container.ConfigName
-	data, err := os.ReadFile(cfgName)
-	if err != nil {
-		return nil, err
-	}
-	err = sonic.Unmarshal(data, &info)
-	if err != nil {
-		return nil, err
+// containerFromInfo 将 zdocker 的容器配置转换为接口返回的容器信息。
+// config.json 不记录镜像，镜像取自 runconfig.json 或 overlay 挂载信息；
+// 命令优先取 runconfig.json 中的 argv，config.json 中可能是包装后的启动脚本
+func containerFromInfo(info *container.ContainerInfo) Container {
+	image, command := "", info.Command
+	var labels map[string]string
+	if req, err := readRunConfig(info.Name); err == nil {
+		image, labels = req.Image, req.Labels
+		if args := containerArgs(req); len(args) > 0 {
+			command = JoinCommand(args)
+		}
+	} else {
+		image = imageFromMount(info.Name)
+	}
+	return Container{
+		ID:          info.ID,
+		Name:        info.Name,
+		Image:       image,
+		Command:     command,
+		Status:      info.Status,
+		CreatedTime: info.CreateTime,
+		Pid:         info.PID,
+		Volume:      info.Volume,
+		PortMapping: strings.Join(info.PortMapping, ","),
+		Labels:      labels,
 	}
+}
 
-	return &info, nil
+// getContainerInfo 根据容器目录获取容器信息
+func getContainerInfo(file os.DirEntry) (*container.ContainerInfo, error) {
+	return readContainerInfo(file.Name())
+}
+
+// readContainerInfo 读取容器配置，配置不存在时返回 ErrContainerNotFound
+func readContainerInfo(containerName string) (*container.ContainerInfo, error) {
+	return containerStore.Read(containerName)
 }
 
 // isProcessRunning checks if a process with the given PID is still running
@@ -163,41 +174,32 @@ func isProcessRunning(pidStr string) bool {
 	return true
 }
 
-// updateContainerStatusToExit updates container status to EXIT and clears PID
-func updateContainerStatusToExit(containerName string) error {
-	dirUrl := fmt.Sprintf(container.DefaultLocation, containerName)
-	cfgFile := dirUrl + container.ConfigName
-
-	// Read current container info
-	content, err := os.ReadFile(cfgFile)
-	if err != nil {
-		return fmt.Errorf("read container config error: %v", err)
-	}
-
-	var info container.ContainerInfo
-	if err := sonic.Unmarshal(content, &info); err != nil {
-		return fmt.Errorf("unmarshal container info error: %v", err)
-	}
-
-	// Update status and clear PID
-	info.Status = container.EXIT
-	info.PID = ""
-
-	// Write back to file
-	newContent, err := sonic.Marshal(info)
-	if err != nil {
-		return fmt.Errorf("marshal container info error: %v", err)
-	}
-
-	if err := os.WriteFile(cfgFile, newContent, 0622); err != nil {
-		return fmt.Errorf("write container config error: %v", err)
-	}
-
-	return nil
+// updateContainerStatusToExit updates container status to EXIT and clears PID.
+// The config is re-read under the container lock and left untouched if the container
+// was stopped or relaunched with another PID in the meantime.
+func updateContainerStatusToExit(containerName string, pid string) (bool, error) {
+	updated := false
+	err := containerStore.Update(containerName, func(info *container.ContainerInfo) error {
+		if info.Status != container.RUNNING || info.PID != pid {
+			return errNoChange
+		}
+		info.Status = container.EXIT
+		info.PID = ""
+		updated = true
+		return nil
+	})
+	return updated, err
 }
 
 // GetContainerById 根据ID获取容器信息
 func GetContainerById(containerId string) (Container, error) {
+	if containerIndex.Ready() {
+		if c, ok := containerIndex.Get(containerId); ok {
+			return c, nil
+		}
+		return Container{}, fmt.Errorf("%w: %s", ErrContainerNotFound, containerId)
+	}
+
 	containers, err := GetContainerList()
 	if err != nil {
 		return Container{}, err
@@ -209,206 +211,16 @@ func GetContainerById(containerId string) (Container, error) {
 		}
 	}
 
-	return Container{}, fmt.Errorf("容器不存在")
-}
-
-// CreateContainer 创建容器
-func CreateContainer(req CreateContainerRequest) (Container, error) {
-	// 构建zdocker run命令
-	args := []string{"run"}
-
-	if req.Detach {
-		args = append(args, "-d")
-	}
-	if req.TTY {
-		args = append(args, "-t")
-	}
-	if req.Name != "" {
-		args = append(args, "--name", req.Name)
-	}
-	if req.Volume != "" {
-		args = append(args, "-v", req.Volume)
-	}
-	if req.Memory != "" {
-		args = append(args, "-m", req.Memory)
-	}
-	if req.CpuShare != "" {
-		args = append(args, "--cpushare", req.CpuShare)
-	}
-	if req.CpuSet != "" {
-		args = append(args, "--cpuset", req.CpuSet)
-	}
-	if req.Network != "" {
-		args = append(args, "--net", req.Network)
-	}
-
-	// 添加环境变量
-	for key, value := range req.Environment {
-		args = append(args, "-e", fmt.Sprintf("%s=%s", key, value))
-	}
-
-	// 添加端口映射
-	for _, port := range req.PortMapping {
-		args = append(args, "-p", port)
-	}
-
-	// 添加镜像和命令
-	args = append(args, req.Image)
-	if req.Command != "" {
-		args = append(args, strings.Fields(req.Command)...)
-	}
-
-	// 执行命令
-	cmd := exec.Command("zdocker", args...)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return Container{}, fmt.Errorf("创建容器失败: %s, %v", string(output), err)
-	}
-
-	// 从输出中解析容器ID或名称
-	containerName := req.Name
-	if containerName == "" {
-		// 如果没有指定名称，从输出中解析
-		lines := strings.Split(string(output), "\n")
-		for _, line := range lines {
-			if strings.Contains(line, "container") {
-				containerName = strings.TrimSpace(line)
-				break
-			}
-		}
-	}
-
-	// 等待一段时间确保容器创建完成
-	time.Sleep(time.Millisecond * 500)
-
-	// 获取创建的容器信息
-	if containerName != "" {
-		return GetContainerById(containerName)
-	}
-
-	return Container{}, fmt.Errorf("无法获取创建的容器信息")
-}
-
-// StartContainer 启动容器
-func StartContainer(containerId string) error {
-	// zdocker没有专门的start命令，这里返回成功
-	return nil
-}
-
-// StopContainer 停止容器
-func StopContainer(containerName string) error {
-	cmd := exec.Command("zdocker", "stop", containerName)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("停止容器失败: %s, %v", string(output), err)
-	}
-	return nil
-}
-
-// RemoveContainer 删除容器
-func RemoveContainer(containerName string) error {
-	cmd := exec.Command("zdocker", "rm", containerName)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("删除容器失败: %s, %v", string(output), err)
-	}
-	return nil
-}
-
-// GetContainerLogs 获取容器日志
-func GetContainerLogs(containerName string) (string, error) {
-	cmd := exec.Command("zdocker", "logs", containerName)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return "", fmt.Errorf("获取容器日志失败: %s, %v", string(output), err)
-	}
-	return string(output), nil
-}
-
-// ExecContainer 在容器中执行命令
-func ExecContainer(containerId string, req ExecRequest) (ExecResult, error) {
-	args := []string{"exec", containerId}
-	args = append(args, req.Command...)
-
-	cmd := exec.Command("zdocker", args...)
-	output, err := cmd.CombinedOutput()
-
-	exitCode := 0
-	if err != nil {
-		var exitError *exec.ExitError
-		if errors.As(err, &exitError) {
-			exitCode = exitError.ExitCode()
-		}
-	}
-
-	return ExecResult{
-		Output:   string(output),
-		ExitCode: exitCode,
-	}, nil
-}
-
-// GetNetworkList 获取网络列表
-func GetNetworkList() ([]NetworkInfo, error) {
-	cmd := exec.Command("zdocker", "network", "list")
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		// 如果命令失败，返回默认网络信息
-		return []NetworkInfo{
-			{Name: "bridge", Driver: "bridge", Subnet: "172.17.0.0/16"},
-		}, nil
-	}
-
-	// 解析输出
-	var networks []NetworkInfo
-	lines := strings.Split(string(output), "\n")
-	for _, line := range lines {
-		if strings.TrimSpace(line) != "" && !strings.Contains(line, "NAME") {
-			fields := strings.Fields(line)
-			if len(fields) >= 3 {
-				networks = append(networks, NetworkInfo{
-					Name:   fields[0],
-					Driver: fields[1],
-					Subnet: fields[2],
-				})
-			}
-		}
-	}
-
-	return networks, nil
-}
-
-// CreateNetwork 创建网络
-func CreateNetwork(req CreateNetworkRequest) (NetworkInfo, error) {
-	args := []string{"network", "create"}
-	if req.Driver != "" {
-		args = append(args, "--driver", req.Driver)
-	}
-	if req.Subnet != "" {
-		args = append(args, "--subnet", req.Subnet)
-	}
-	args = append(args, req.Name)
-
-	cmd := exec.Command("zdocker", args...)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return NetworkInfo{}, fmt.Errorf("创建网络失败: %s, %v", string(output), err)
-	}
-
-	return NetworkInfo{
-		Name:   req.Name,
-		Driver: req.Driver,
-		Subnet: req.Subnet,
-	}, nil
+	return Container{}, fmt.Errorf("%w: %s", ErrContainerNotFound, containerId)
 }
 
-// RemoveNetwork 删除网络
-func RemoveNetwork(networkId string) error {
-	cmd := exec.Command("zdocker", "network", "remove", networkId)
-	output, err := cmd.CombinedOutput()
+// lookupContainerName 将ID或名称解析为容器名称
+func lookupContainerName(containerId string) (string, error) {
+	c, err := GetContainerById(containerId)
 	if err != nil {
-		return fmt.Errorf("删除网络失败: %s, %v", string(output), err)
+		return "", err
 	}
-	return nil
+	return c.Name, nil
 }
 
 // GetSystemInfo 获取系统信息
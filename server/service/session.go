@@ -0,0 +1,302 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bytedance/sonic"
+)
+
+const (
+	// DefaultAccessTokenTTL 访问令牌有效期，过期后使用刷新令牌换取新的令牌
+	DefaultAccessTokenTTL = 15 * time.Minute
+	// DefaultRefreshTokenTTL 刷新令牌有效期，每次刷新后重新计算
+	DefaultRefreshTokenTTL = 7 * 24 * time.Hour
+
+	// tokenTypeAccess/tokenTypeRefresh 令牌用途，防止刷新令牌被当作访问令牌使用
+	tokenTypeAccess  = "access"
+	tokenTypeRefresh = "refresh"
+)
+
+// TokenPair 登录或刷新后返回的令牌
+type TokenPair struct {
+	AccessToken      string `json:"access_token"`
+	RefreshToken     string `json:"refresh_token"`
+	TokenType        string `json:"token_type"`
+	ExpiresIn        int64  `json:"expires_in"`
+	RefreshExpiresIn int64  `json:"refresh_expires_in"`
+}
+
+// Principal 通过认证的调用方，通过登录会话或 API 令牌认证
+type Principal struct {
+	Username  string `json:"username"`
+	SessionID string `json:"session_id,omitempty"`
+	// TokenID/Scopes 通过 API 令牌认证时的令牌和权限范围
+	TokenID string       `json:"token_id,omitempty"`
+	Scopes  []Permission `json:"scopes,omitempty"`
+}
+
+// tokenClaims 令牌中签名的内容
+type tokenClaims struct {
+	Type      string `json:"typ"`
+	Subject   string `json:"sub"`
+	SessionID string `json:"sid"`
+	// Generation 刷新令牌的序号，每次刷新加一，旧的刷新令牌随即失效
+	Generation uint64 `json:"gen,omitempty"`
+	IssuedAt   int64  `json:"iat"`
+	ExpiresAt  int64  `json:"exp"`
+}
+
+// session 登录会话，登出、修改密码或刷新令牌被重复使用时删除
+type session struct {
+	username   string
+	createdAt  time.Time
+	expiresAt  time.Time
+	generation uint64
+}
+
+// SessionManager 签发和校验会话令牌。令牌是 HMAC-SHA256 签名的 JSON，
+// 会话保存在内存中，签名密钥在每次启动时随机生成，因此服务重启后需要重新登录
+type SessionManager struct {
+	users      *UserStore
+	key        []byte
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+
+	mu       sync.Mutex
+	sessions map[string]*session
+}
+
+// NewSessionManager 创建会话管理器，ttl 为 0 时使用默认有效期
+func NewSessionManager(users *UserStore, accessTTL, refreshTTL time.Duration) (*SessionManager, error) {
+	if accessTTL <= 0 {
+		accessTTL = DefaultAccessTokenTTL
+	}
+	if refreshTTL <= 0 {
+		refreshTTL = DefaultRefreshTokenTTL
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("生成签名密钥失败: %v", err)
+	}
+	return &SessionManager{
+		users:      users,
+		key:        key,
+		accessTTL:  accessTTL,
+		refreshTTL: refreshTTL,
+		sessions:   map[string]*session{},
+	}, nil
+}
+
+// Users 返回会话使用的用户存储
+func (m *SessionManager) Users() *UserStore {
+	return m.users
+}
+
+// Login 校验用户名和密码，创建会话并签发令牌
+func (m *SessionManager) Login(username, password string) (TokenPair, User, error) {
+	u, err := m.users.Authenticate(username, password)
+	if err != nil {
+		return TokenPair{}, User{}, err
+	}
+	sid, err := randomHex(16)
+	if err != nil {
+		return TokenPair{}, User{}, err
+	}
+
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pruneLocked(now)
+	s := &session{username: u.Username, createdAt: now}
+	m.sessions[sid] = s
+	return m.issueLocked(sid, s, now), u, nil
+}
+
+// Refresh 用刷新令牌换取新的令牌，旧的刷新令牌随即失效。
+// 已失效的刷新令牌再次出现说明可能被盗用，此时注销整个会话
+func (m *SessionManager) Refresh(refreshToken string) (TokenPair, error) {
+	claims, err := m.parse(refreshToken, tokenTypeRefresh)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[claims.SessionID]
+	if !ok || !now.Before(s.expiresAt) {
+		return TokenPair{}, fmt.Errorf("%w: 会话已失效，请重新登录", ErrUnauthenticated)
+	}
+	if claims.Generation != s.generation {
+		delete(m.sessions, claims.SessionID)
+		return TokenPair{}, fmt.Errorf("%w: 刷新令牌已被使用，会话已注销", ErrUnauthenticated)
+	}
+	if err := m.checkUser(s.username, s.createdAt); err != nil {
+		delete(m.sessions, claims.SessionID)
+		return TokenPair{}, err
+	}
+	s.generation++
+	return m.issueLocked(claims.SessionID, s, now), nil
+}
+
+// Verify 校验访问令牌，返回令牌对应的调用方
+func (m *SessionManager) Verify(accessToken string) (Principal, error) {
+	claims, err := m.parse(accessToken, tokenTypeAccess)
+	if err != nil {
+		return Principal{}, err
+	}
+
+	m.mu.Lock()
+	s, ok := m.sessions[claims.SessionID]
+	m.mu.Unlock()
+	if !ok {
+		return Principal{}, fmt.Errorf("%w: 会话已失效，请重新登录", ErrUnauthenticated)
+	}
+	if err := m.checkUser(s.username, s.createdAt); err != nil {
+		return Principal{}, err
+	}
+	return Principal{Username: s.username, SessionID: claims.SessionID}, nil
+}
+
+// Logout 注销会话
+func (m *SessionManager) Logout(sessionID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, sessionID)
+}
+
+// RevokeUser 注销用户除 keep 以外的所有会话，用于修改密码后让其他登录失效
+func (m *SessionManager) RevokeUser(username string, keep string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for sid, s := range m.sessions {
+		if s.username == username && sid != keep {
+			delete(m.sessions, sid)
+		}
+	}
+}
+
+// ChangePassword 修改调用方的密码，并注销该用户的其他会话
+func (m *SessionManager) ChangePassword(p Principal, oldPassword, newPassword string) error {
+	if err := m.users.ChangePassword(p.Username, oldPassword, newPassword); err != nil {
+		return err
+	}
+	m.RevokeUser(p.Username, p.SessionID)
+
+	// 当前会话的创建时间早于新的密码修改时间，更新后才能继续使用
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s, ok := m.sessions[p.SessionID]; ok {
+		s.createdAt = time.Now()
+	}
+	return nil
+}
+
+// checkUser 检查会话所属用户仍然存在、未被禁用，且会话不早于最近一次修改密码（包括通过 passwd 子命令修改）
+func (m *SessionManager) checkUser(username string, createdAt time.Time) error {
+	u, err := m.users.Get(username)
+	if err != nil {
+		return err
+	}
+	if u.Disabled {
+		return fmt.Errorf("%w: 用户 %s 已被禁用", ErrUnauthenticated, username)
+	}
+	if createdAt.Before(u.PasswordChangedAt) {
+		return fmt.Errorf("%w: 密码已修改，请重新登录", ErrUnauthenticated)
+	}
+	return nil
+}
+
+// issueLocked 为会话签发访问令牌和刷新令牌，调用方需持有锁
+func (m *SessionManager) issueLocked(sid string, s *session, now time.Time) TokenPair {
+	s.expiresAt = now.Add(m.refreshTTL)
+	access := tokenClaims{
+		Type:      tokenTypeAccess,
+		Subject:   s.username,
+		SessionID: sid,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(m.accessTTL).Unix(),
+	}
+	refresh := tokenClaims{
+		Type:       tokenTypeRefresh,
+		Subject:    s.username,
+		SessionID:  sid,
+		Generation: s.generation,
+		IssuedAt:   now.Unix(),
+		ExpiresAt:  s.expiresAt.Unix(),
+	}
+	return TokenPair{
+		AccessToken:      m.sign(access),
+		RefreshToken:     m.sign(refresh),
+		TokenType:        "Bearer",
+		ExpiresIn:        int64(m.accessTTL.Seconds()),
+		RefreshExpiresIn: int64(m.refreshTTL.Seconds()),
+	}
+}
+
+// pruneLocked 删除刷新令牌已过期的会话，调用方需持有锁
+func (m *SessionManager) pruneLocked(now time.Time) {
+	for sid, s := range m.sessions {
+		if !now.Before(s.expiresAt) {
+			delete(m.sessions, sid)
+		}
+	}
+}
+
+// sign 将 claims 编码为 base64url(JSON).base64url(HMAC)
+func (m *SessionManager) sign(claims tokenClaims) string {
+	payload, _ := sonic.Marshal(claims)
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(m.mac(encoded))
+}
+
+// parse 校验令牌的签名、用途和有效期
+func (m *SessionManager) parse(token string, typ string) (tokenClaims, error) {
+	encoded, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return tokenClaims{}, fmt.Errorf("%w: 令牌格式错误", ErrUnauthenticated)
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(mac, m.mac(encoded)) {
+		return tokenClaims{}, fmt.Errorf("%w: 令牌签名无效", ErrUnauthenticated)
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return tokenClaims{}, fmt.Errorf("%w: 令牌格式错误", ErrUnauthenticated)
+	}
+	var claims tokenClaims
+	if err := sonic.Unmarshal(payload, &claims); err != nil {
+		return tokenClaims{}, fmt.Errorf("%w: 令牌格式错误", ErrUnauthenticated)
+	}
+	if claims.Type != typ {
+		return tokenClaims{}, fmt.Errorf("%w: 令牌类型错误", ErrUnauthenticated)
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return tokenClaims{}, fmt.Errorf("%w: 令牌已过期", ErrUnauthenticated)
+	}
+	return claims, nil
+}
+
+// mac 计算令牌内容的 HMAC-SHA256
+func (m *SessionManager) mac(encoded string) []byte {
+	h := hmac.New(sha256.New, m.key)
+	h.Write([]byte(encoded))
+	return h.Sum(nil)
+}
+
+// randomHex 生成 n 字节的随机十六进制字符串
+func randomHex(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
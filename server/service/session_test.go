@@ -0,0 +1,289 @@
+package service
+
+import (
+	"encoding/base64"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestUsers 返回临时目录中的用户存储，包含密码为 password 的 admin 用户 alice 和 bob
+func newTestUsers(t *testing.T) *UserStore {
+	users, err := NewUserStore(filepath.Join(t.TempDir(), usersFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"alice", "bob"} {
+		if err := users.SetPassword(name, "password", []string{RoleAdmin}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return users
+}
+
+// setDisabled 修改用户的禁用状态并写回用户文件
+func setDisabled(t *testing.T, users *UserStore, username string, disabled bool) {
+	users.mu.Lock()
+	defer users.mu.Unlock()
+	u := users.users[username]
+	u.Disabled = disabled
+	users.users[username] = u
+	if err := users.save(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newTestSessions 返回使用 newTestUsers 用户的会话管理器
+func newTestSessions(t *testing.T) *SessionManager {
+	m, err := NewSessionManager(newTestUsers(t), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// login 登录 password 密码的用户，失败时结束测试
+func login(t *testing.T, m *SessionManager, username string) TokenPair {
+	t.Helper()
+	pair, _, err := m.Login(username, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pair
+}
+
+func TestSessionVerifyRejectsInvalidTokens(t *testing.T) {
+	m := newTestSessions(t)
+	pair := login(t, m, "alice")
+	p, err := m.Verify(pair.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Username != "alice" || p.SessionID == "" || p.TokenID != "" {
+		t.Errorf("principal = %+v", p)
+	}
+
+	other, err := NewSessionManager(m.Users(), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPair := login(t, other, "alice")
+
+	payload, sig, _ := strings.Cut(pair.AccessToken, ".")
+	claims, err := m.parse(pair.AccessToken, tokenTypeAccess)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 修改令牌内容但保留原签名
+	forged := claims
+	forged.Subject = "bob"
+	forgedPayload, _, _ := strings.Cut(m.sign(forged), ".")
+	expired := claims
+	expired.ExpiresAt = time.Now().Add(-time.Second).Unix()
+	unknownSession := claims
+	unknownSession.SessionID = "0123456789abcdef"
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{name: "empty", token: ""},
+		{name: "no signature", token: payload},
+		{name: "tampered payload", token: forgedPayload + "." + sig},
+		{name: "tampered signature", token: payload + "." + base64.RawURLEncoding.EncodeToString([]byte("not the signature"))},
+		{name: "signature not base64", token: payload + ".!!!"},
+		{name: "signed by another key", token: otherPair.AccessToken},
+		{name: "payload not base64", token: "!!!." + sig},
+		{name: "refresh token", token: pair.RefreshToken},
+		{name: "expired", token: m.sign(expired)},
+		{name: "unknown session", token: m.sign(unknownSession)},
+	}
+	for _, tt := range tests {
+		if p, err := m.Verify(tt.token); !errors.Is(err, ErrUnauthenticated) {
+			t.Errorf("%s: Verify = %+v, %v, want ErrUnauthenticated", tt.name, p, err)
+		}
+	}
+
+	// 访问令牌不能用于刷新
+	if _, err := m.Refresh(pair.AccessToken); !errors.Is(err, ErrUnauthenticated) {
+		t.Errorf("Refresh with access token: error = %v, want ErrUnauthenticated", err)
+	}
+	expiredRefresh, err := m.parse(pair.RefreshToken, tokenTypeRefresh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expiredRefresh.ExpiresAt = time.Now().Add(-time.Second).Unix()
+	if _, err := m.Refresh(m.sign(expiredRefresh)); !errors.Is(err, ErrUnauthenticated) {
+		t.Errorf("Refresh with expired token: error = %v, want ErrUnauthenticated", err)
+	}
+}
+
+func TestSessionRefreshRotation(t *testing.T) {
+	m := newTestSessions(t)
+	first := login(t, m, "alice")
+
+	second, err := m.Refresh(first.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.RefreshToken == first.RefreshToken {
+		t.Fatal("refresh returned the same refresh token")
+	}
+	// 刷新不影响已签发的访问令牌
+	for _, token := range []string{first.AccessToken, second.AccessToken} {
+		if _, err := m.Verify(token); err != nil {
+			t.Errorf("Verify after refresh: %v", err)
+		}
+	}
+
+	// 旧的刷新令牌再次使用时注销整个会话
+	if _, err := m.Refresh(first.RefreshToken); !errors.Is(err, ErrUnauthenticated) {
+		t.Fatalf("reuse of old refresh token: error = %v, want ErrUnauthenticated", err)
+	}
+	tests := []struct {
+		name   string
+		verify func() error
+	}{
+		{name: "first access token", verify: func() error { _, err := m.Verify(first.AccessToken); return err }},
+		{name: "second access token", verify: func() error { _, err := m.Verify(second.AccessToken); return err }},
+		{name: "second refresh token", verify: func() error { _, err := m.Refresh(second.RefreshToken); return err }},
+	}
+	for _, tt := range tests {
+		if err := tt.verify(); !errors.Is(err, ErrUnauthenticated) {
+			t.Errorf("%s after reuse: error = %v, want ErrUnauthenticated", tt.name, err)
+		}
+	}
+}
+
+func TestSessionInvalidation(t *testing.T) {
+	tests := []struct {
+		name       string
+		invalidate func(t *testing.T, m *SessionManager, alice, bob Principal)
+		// wantAlice/wantBob 之后 alice 和 bob 的会话是否仍然有效
+		wantAlice bool
+		wantBob   bool
+	}{
+		{
+			name:       "logout",
+			invalidate: func(t *testing.T, m *SessionManager, alice, bob Principal) { m.Logout(alice.SessionID) },
+			wantAlice:  false,
+			wantBob:    true,
+		},
+		{
+			name:       "revoke user",
+			invalidate: func(t *testing.T, m *SessionManager, alice, bob Principal) { m.RevokeUser("alice", "") },
+			wantAlice:  false,
+			wantBob:    true,
+		},
+		{
+			// 通过 passwd 子命令修改密码时只更新用户文件
+			name: "password set outside the session",
+			invalidate: func(t *testing.T, m *SessionManager, alice, bob Principal) {
+				if err := m.Users().SetPassword("alice", "password2", nil); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantAlice: false,
+			wantBob:   true,
+		},
+		{
+			name:       "user disabled",
+			invalidate: func(t *testing.T, m *SessionManager, alice, bob Principal) { setDisabled(t, m.Users(), "bob", true) },
+			wantAlice:  true,
+			wantBob:    false,
+		},
+	}
+	for _, tt := range tests {
+		m := newTestSessions(t)
+		alicePair, bobPair := login(t, m, "alice"), login(t, m, "bob")
+		alice, _ := m.Verify(alicePair.AccessToken)
+		bob, _ := m.Verify(bobPair.AccessToken)
+
+		tt.invalidate(t, m, alice, bob)
+		for _, s := range []struct {
+			user string
+			pair TokenPair
+			want bool
+		}{{"alice", alicePair, tt.wantAlice}, {"bob", bobPair, tt.wantBob}} {
+			_, err := m.Verify(s.pair.AccessToken)
+			if (err == nil) != s.want {
+				t.Errorf("%s: Verify %s = %v, want valid %v", tt.name, s.user, err, s.want)
+			}
+			if err != nil && !errors.Is(err, ErrUnauthenticated) {
+				t.Errorf("%s: Verify %s error = %v, want ErrUnauthenticated", tt.name, s.user, err)
+			}
+			if _, err := m.Refresh(s.pair.RefreshToken); (err == nil) != s.want {
+				t.Errorf("%s: Refresh %s = %v, want valid %v", tt.name, s.user, err, s.want)
+			}
+		}
+	}
+}
+
+func TestSessionChangePassword(t *testing.T) {
+	m := newTestSessions(t)
+	current, other := login(t, m, "alice"), login(t, m, "alice")
+	p, err := m.Verify(current.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.ChangePassword(p, "wrong-password", "password2"); !errors.Is(err, ErrInvalidArgument) {
+		t.Fatalf("wrong old password: error = %v, want ErrInvalidArgument", err)
+	}
+	if _, err := m.Verify(other.AccessToken); err != nil {
+		t.Fatalf("failed password change revoked other session: %v", err)
+	}
+
+	if err := m.ChangePassword(p, "password", "password2"); err != nil {
+		t.Fatal(err)
+	}
+	// 当前会话继续有效，同一用户的其他会话被注销
+	if _, err := m.Verify(current.AccessToken); err != nil {
+		t.Errorf("current session after password change: %v", err)
+	}
+	if _, err := m.Refresh(current.RefreshToken); err != nil {
+		t.Errorf("refresh current session after password change: %v", err)
+	}
+	if _, err := m.Verify(other.AccessToken); !errors.Is(err, ErrUnauthenticated) {
+		t.Errorf("other session after password change: error = %v, want ErrUnauthenticated", err)
+	}
+	if _, _, err := m.Login("alice", "password"); !errors.Is(err, ErrUnauthenticated) {
+		t.Errorf("login with old password: error = %v, want ErrUnauthenticated", err)
+	}
+	if _, _, err := m.Login("alice", "password2"); err != nil {
+		t.Errorf("login with new password: %v", err)
+	}
+}
+
+func TestSessionLogin(t *testing.T) {
+	m := newTestSessions(t)
+	setDisabled(t, m.Users(), "bob", true)
+
+	tests := []struct {
+		username, password string
+		wantErr            bool
+	}{
+		{username: "alice", password: "password"},
+		{username: "alice", password: "Password", wantErr: true},
+		{username: "carol", password: "password", wantErr: true},
+		{username: "bob", password: "password", wantErr: true},
+	}
+	for _, tt := range tests {
+		pair, u, err := m.Login(tt.username, tt.password)
+		if tt.wantErr {
+			if !errors.Is(err, ErrUnauthenticated) {
+				t.Errorf("Login(%s, %s): error = %v, want ErrUnauthenticated", tt.username, tt.password, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Login(%s): %v", tt.username, err)
+			continue
+		}
+		if u.Username != tt.username || pair.TokenType != "Bearer" || pair.ExpiresIn != int64(DefaultAccessTokenTTL.Seconds()) {
+			t.Errorf("Login(%s) = %+v, %+v", tt.username, pair, u)
+		}
+	}
+}
@@ -0,0 +1,300 @@
+package service
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/crazyfrankie/zdocker/container"
+)
+
+// cgroupRoot cgroup 文件系统挂载点
+const cgroupRoot = "/sys/fs/cgroup"
+
+// ContainerStats 容器资源使用情况的一次采样
+type ContainerStats struct {
+	ID   string    `json:"id"`
+	Name string    `json:"name"`
+	Read time.Time `json:"read"`
+	// CgroupVersion 读取的 cgroup 版本，1 或 2
+	CgroupVersion int `json:"cgroup_version"`
+
+	CPU      CPUStats                `json:"cpu"`
+	Memory   MemoryStats             `json:"memory"`
+	Pids     PidsStats               `json:"pids"`
+	Networks map[string]NetworkStats `json:"networks"`
+}
+
+// CPUStats CPU 使用情况，时间单位为纳秒
+type CPUStats struct {
+	UsageNanos  uint64 `json:"usage_nanos"`
+	UserNanos   uint64 `json:"user_nanos"`
+	SystemNanos uint64 `json:"system_nanos"`
+	OnlineCPUs  int    `json:"online_cpus"`
+	// Percent 两次采样之间的 CPU 使用率，100 表示占满一个核，只有单次采样时为空
+	Percent *float64 `json:"percent,omitempty"`
+
+	Periods          uint64 `json:"periods"`
+	ThrottledPeriods uint64 `json:"throttled_periods"`
+	ThrottledNanos   uint64 `json:"throttled_nanos"`
+}
+
+// MemoryStats 内存使用情况，单位为字节
+type MemoryStats struct {
+	// Usage 不含可回收页缓存的使用量，与 docker stats 一致
+	Usage uint64 `json:"usage"`
+	// RawUsage cgroup 报告的原始使用量
+	RawUsage uint64 `json:"raw_usage"`
+	Cache    uint64 `json:"cache"`
+	// Limit 内存限制，未设置时为主机内存总量
+	Limit   uint64  `json:"limit"`
+	Percent float64 `json:"percent"`
+}
+
+// PidsStats 进程数，Limit 为 0 表示不限制
+type PidsStats struct {
+	Current uint64 `json:"current"`
+	Limit   uint64 `json:"limit"`
+}
+
+// NetworkStats 单个网络接口的收发统计
+type NetworkStats struct {
+	RxBytes   uint64 `json:"rx_bytes"`
+	RxPackets uint64 `json:"rx_packets"`
+	RxErrors  uint64 `json:"rx_errors"`
+	RxDropped uint64 `json:"rx_dropped"`
+	TxBytes   uint64 `json:"tx_bytes"`
+	TxPackets uint64 `json:"tx_packets"`
+	TxErrors  uint64 `json:"tx_errors"`
+	TxDropped uint64 `json:"tx_dropped"`
+}
+
+// CalculateCPUPercent 根据前一次采样计算 CPU 使用率
+func (s *ContainerStats) CalculateCPUPercent(prev ContainerStats) {
+	elapsed := s.Read.Sub(prev.Read)
+	if elapsed <= 0 || s.CPU.UsageNanos < prev.CPU.UsageNanos {
+		return
+	}
+	percent := float64(s.CPU.UsageNanos-prev.CPU.UsageNanos) / float64(elapsed.Nanoseconds()) * 100
+	s.CPU.Percent = &percent
+}
+
+// containerStats 读取运行中容器的资源使用情况
+func containerStats(containerName string) (ContainerStats, error) {
+	c, err := GetContainerById(containerName)
+	if err != nil {
+		return ContainerStats{}, err
+	}
+	if c.Status != container.RUNNING || !isProcessRunning(c.Pid) {
+		return ContainerStats{}, fmt.Errorf("%w: %s", ErrContainerNotRunning, c.Name)
+	}
+
+	stats, err := statsFromPid(c.Pid)
+	if err != nil {
+		return ContainerStats{}, err
+	}
+	stats.ID = c.ID
+	stats.Name = c.Name
+	return stats, nil
+}
+
+// statsFromPid 根据 /proc/<pid>/cgroup 定位进程所在的 cgroup 并读取资源使用情况，
+// 网络统计来自进程网络命名空间中的 /proc/<pid>/net/dev
+func statsFromPid(pid string) (ContainerStats, error) {
+	paths, err := cgroupPaths(pid)
+	if err != nil {
+		return ContainerStats{}, fmt.Errorf("读取进程 cgroup 失败: %v", err)
+	}
+
+	stats := ContainerStats{
+		Read:     time.Now(),
+		Networks: make(map[string]NetworkStats),
+	}
+	stats.CPU.OnlineCPUs = runtime.NumCPU()
+
+	if unified, ok := paths[""]; ok && len(paths) == 1 {
+		stats.CgroupVersion = 2
+		readCgroupV2(filepath.Join(cgroupRoot, unified), &stats)
+	} else {
+		stats.CgroupVersion = 1
+		readCgroupV1(paths, &stats)
+	}
+
+	if total := hostMemory(); stats.Memory.Limit == 0 || stats.Memory.Limit > total {
+		stats.Memory.Limit = total
+	}
+	if stats.Memory.Limit > 0 {
+		stats.Memory.Percent = float64(stats.Memory.Usage) / float64(stats.Memory.Limit) * 100
+	}
+
+	if networks, err := readNetDev(pid); err == nil {
+		stats.Networks = networks
+	}
+	return stats, nil
+}
+
+// cgroupPaths 解析 /proc/<pid>/cgroup，返回控制器到 cgroup 路径的映射，cgroup v2 的控制器为空字符串
+func cgroupPaths(pid string) (map[string]string, error) {
+	f, err := os.Open(fmt.Sprintf("/proc/%s/cgroup", pid))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	paths := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// hierarchy-ID:controller-list:cgroup-path
+		parts := strings.SplitN(scanner.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if parts[1] == "" {
+			paths[""] = parts[2]
+			continue
+		}
+		for _, controller := range strings.Split(parts[1], ",") {
+			paths[strings.TrimPrefix(controller, "name=")] = parts[2]
+		}
+	}
+	return paths, scanner.Err()
+}
+
+// readCgroupV2 读取 cgroup v2 统一层级下的统计文件
+func readCgroupV2(dir string, stats *ContainerStats) {
+	cpu := readKeyValues(filepath.Join(dir, "cpu.stat"))
+	stats.CPU.UsageNanos = cpu["usage_usec"] * 1000
+	stats.CPU.UserNanos = cpu["user_usec"] * 1000
+	stats.CPU.SystemNanos = cpu["system_usec"] * 1000
+	stats.CPU.Periods = cpu["nr_periods"]
+	stats.CPU.ThrottledPeriods = cpu["nr_throttled"]
+	stats.CPU.ThrottledNanos = cpu["throttled_usec"] * 1000
+
+	memory := readKeyValues(filepath.Join(dir, "memory.stat"))
+	stats.Memory.RawUsage = readUint(filepath.Join(dir, "memory.current"))
+	stats.Memory.Cache = memory["inactive_file"]
+	stats.Memory.Limit = readUint(filepath.Join(dir, "memory.max"))
+
+	stats.Pids.Current = readUint(filepath.Join(dir, "pids.current"))
+	stats.Pids.Limit = readUint(filepath.Join(dir, "pids.max"))
+
+	stats.Memory.Usage = stats.Memory.RawUsage - min(stats.Memory.Cache, stats.Memory.RawUsage)
+}
+
+// readCgroupV1 读取 cgroup v1 各控制器层级下的统计文件
+func readCgroupV1(paths map[string]string, stats *ContainerStats) {
+	if path, ok := paths["cpuacct"]; ok {
+		dir := filepath.Join(cgroupRoot, "cpuacct", path)
+		stats.CPU.UsageNanos = readUint(filepath.Join(dir, "cpuacct.usage"))
+		// cpuacct.stat 的单位是 USER_HZ，通常为 100
+		ticks := readKeyValues(filepath.Join(dir, "cpuacct.stat"))
+		stats.CPU.UserNanos = ticks["user"] * uint64(time.Second/100)
+		stats.CPU.SystemNanos = ticks["system"] * uint64(time.Second/100)
+	}
+	if path, ok := paths["cpu"]; ok {
+		cpu := readKeyValues(filepath.Join(cgroupRoot, "cpu", path, "cpu.stat"))
+		stats.CPU.Periods = cpu["nr_periods"]
+		stats.CPU.ThrottledPeriods = cpu["nr_throttled"]
+		stats.CPU.ThrottledNanos = cpu["throttled_time"]
+	}
+	if path, ok := paths["memory"]; ok {
+		dir := filepath.Join(cgroupRoot, "memory", path)
+		memory := readKeyValues(filepath.Join(dir, "memory.stat"))
+		stats.Memory.RawUsage = readUint(filepath.Join(dir, "memory.usage_in_bytes"))
+		stats.Memory.Cache = memory["total_inactive_file"]
+		stats.Memory.Limit = readUint(filepath.Join(dir, "memory.limit_in_bytes"))
+		stats.Memory.Usage = stats.Memory.RawUsage - min(stats.Memory.Cache, stats.Memory.RawUsage)
+	}
+	if path, ok := paths["pids"]; ok {
+		dir := filepath.Join(cgroupRoot, "pids", path)
+		stats.Pids.Current = readUint(filepath.Join(dir, "pids.current"))
+		stats.Pids.Limit = readUint(filepath.Join(dir, "pids.max"))
+	}
+}
+
+// readUint 读取只包含一个整数的 cgroup 文件，文件不存在或内容为 max 时返回 0
+func readUint(path string) uint64 {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	n, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// readKeyValues 读取每行为“键 值”格式的 cgroup 文件
+func readKeyValues(path string) map[string]uint64 {
+	values := make(map[string]uint64)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return values
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		if n, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+			values[fields[0]] = n
+		}
+	}
+	return values
+}
+
+// readNetDev 读取进程网络命名空间的接口统计，忽略回环接口
+func readNetDev(pid string) (map[string]NetworkStats, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%s/net/dev", pid))
+	if err != nil {
+		return nil, err
+	}
+
+	networks := make(map[string]NetworkStats)
+	// 前两行为表头
+	lines := strings.Split(string(data), "\n")
+	for _, line := range lines[min(2, len(lines)):] {
+		name, counters, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		name = strings.TrimSpace(name)
+		fields := strings.Fields(counters)
+		if name == "lo" || len(fields) < 12 {
+			continue
+		}
+
+		values := make([]uint64, 12)
+		for i := range values {
+			values[i], _ = strconv.ParseUint(fields[i], 10, 64)
+		}
+		// 接收：bytes packets errs drop fifo frame compressed multicast；发送从第 9 列开始
+		networks[name] = NetworkStats{
+			RxBytes:   values[0],
+			RxPackets: values[1],
+			RxErrors:  values[2],
+			RxDropped: values[3],
+			TxBytes:   values[8],
+			TxPackets: values[9],
+			TxErrors:  values[10],
+			TxDropped: values[11],
+		}
+	}
+	return networks, nil
+}
+
+// hostMemory 返回主机内存总量，单位为字节
+func hostMemory() uint64 {
+	var info syscall.Sysinfo_t
+	if err := syscall.Sysinfo(&info); err != nil {
+		return 0
+	}
+	return uint64(info.Totalram) * uint64(info.Unit)
+}
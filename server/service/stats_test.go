@@ -0,0 +1,132 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestReadCgroupV2(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"cpu.stat":       "usage_usec 5000\nuser_usec 3000\nsystem_usec 2000\nnr_periods 10\nnr_throttled 2\nthrottled_usec 700\n",
+		"memory.stat":    "anon 4096\nfile 8192\ninactive_file 1024\n",
+		"memory.current": "10240\n",
+		"memory.max":     "max\n",
+		"pids.current":   "3\n",
+		"pids.max":       "64\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var stats ContainerStats
+	readCgroupV2(dir, &stats)
+	wantCPU := CPUStats{
+		UsageNanos:       5000000,
+		UserNanos:        3000000,
+		SystemNanos:      2000000,
+		Periods:          10,
+		ThrottledPeriods: 2,
+		ThrottledNanos:   700000,
+	}
+	if !reflect.DeepEqual(stats.CPU, wantCPU) {
+		t.Errorf("cpu = %+v, want %+v", stats.CPU, wantCPU)
+	}
+	// 使用量不含可回收的页缓存，memory.max 为 max 表示不限制
+	wantMemory := MemoryStats{Usage: 9216, RawUsage: 10240, Cache: 1024}
+	if !reflect.DeepEqual(stats.Memory, wantMemory) {
+		t.Errorf("memory = %+v, want %+v", stats.Memory, wantMemory)
+	}
+	if want := (PidsStats{Current: 3, Limit: 64}); stats.Pids != want {
+		t.Errorf("pids = %+v, want %+v", stats.Pids, want)
+	}
+
+	// 统计文件不存在时为零值，缓存大于使用量时不会下溢
+	empty := t.TempDir()
+	if err := os.WriteFile(filepath.Join(empty, "memory.stat"), []byte("inactive_file 4096\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(empty, "memory.current"), []byte("1024\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stats = ContainerStats{}
+	readCgroupV2(empty, &stats)
+	if stats.Memory.Usage != 0 || stats.CPU != (CPUStats{}) || stats.Pids != (PidsStats{}) {
+		t.Errorf("stats from missing files = %+v", stats)
+	}
+}
+
+func TestReadKeyValues(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stat")
+	content := "user 10\nsystem 20\n\nmalformed\nnegative -1\nthree fields 1\nbig 18446744073709551615\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]uint64{"user": 10, "system": 20, "big": 18446744073709551615}
+	if got := readKeyValues(path); !reflect.DeepEqual(got, want) {
+		t.Errorf("readKeyValues = %v, want %v", got, want)
+	}
+	if got := readKeyValues(path + ".missing"); len(got) != 0 {
+		t.Errorf("readKeyValues(missing) = %v, want empty", got)
+	}
+}
+
+func TestCgroupPathsAndNetDev(t *testing.T) {
+	pid := strconv.Itoa(os.Getpid())
+	paths, err := cgroupPaths(pid)
+	if err != nil {
+		t.Skipf("read cgroup: %v", err)
+	}
+	if len(paths) == 0 {
+		t.Error("cgroupPaths returned no controllers")
+	}
+	for controller, path := range paths {
+		if path == "" || path[0] != '/' {
+			t.Errorf("controller %q path = %q, want absolute path", controller, path)
+		}
+	}
+
+	networks, err := readNetDev(pid)
+	if err != nil {
+		t.Skipf("read net/dev: %v", err)
+	}
+	if _, ok := networks["lo"]; ok {
+		t.Error("readNetDev includes the loopback interface")
+	}
+}
+
+func TestCalculateCPUPercent(t *testing.T) {
+	read := time.Unix(1000, 0)
+	prev := ContainerStats{Read: read, CPU: CPUStats{UsageNanos: 1000000000}}
+
+	tests := []struct {
+		name  string
+		stats ContainerStats
+		// want 期望的使用率，小于 0 表示不计算
+		want float64
+	}{
+		{name: "one core", stats: ContainerStats{Read: read.Add(time.Second), CPU: CPUStats{UsageNanos: 2000000000}}, want: 100},
+		{name: "two cores over two seconds", stats: ContainerStats{Read: read.Add(2 * time.Second), CPU: CPUStats{UsageNanos: 5000000000}}, want: 200},
+		{name: "idle", stats: ContainerStats{Read: read.Add(time.Second), CPU: CPUStats{UsageNanos: 1000000000}}, want: 0},
+		{name: "same sample time", stats: ContainerStats{Read: read, CPU: CPUStats{UsageNanos: 2000000000}}, want: -1},
+		{name: "counter reset", stats: ContainerStats{Read: read.Add(time.Second), CPU: CPUStats{UsageNanos: 10}}, want: -1},
+	}
+	for _, tt := range tests {
+		tt.stats.CalculateCPUPercent(prev)
+		if tt.want < 0 {
+			if tt.stats.CPU.Percent != nil {
+				t.Errorf("%s: percent = %v, want none", tt.name, *tt.stats.CPU.Percent)
+			}
+			continue
+		}
+		if tt.stats.CPU.Percent == nil || *tt.stats.CPU.Percent != tt.want {
+			t.Errorf("%s: percent = %v, want %v", tt.name, tt.stats.CPU.Percent, tt.want)
+		}
+	}
+}
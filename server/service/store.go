@@ -0,0 +1,301 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/bytedance/sonic"
+
+	"github.com/crazyfrankie/zdocker/container"
+)
+
+const (
+	// containerDirPerm 容器目录权限，zdocker 默认使用的 0622 对目录没有执行位
+	containerDirPerm = 0755
+	// configFilePerm config.json 权限
+	configFilePerm = 0644
+	// runConfigFilePerm runconfig.json 包含环境变量，只允许属主读写
+	runConfigFilePerm = 0600
+	// stateFilePerm state.json 权限
+	stateFilePerm = 0644
+)
+
+// StateName 保存服务端维护的容器状态的文件名，与 config.json 位于同一目录，随容器目录一起删除
+const StateName = "state.json"
+
+// ContainerState 服务端维护的容器状态，zdocker 的 config.json 没有这些字段。
+// 保存在文件中，服务重启后重启次数、退避时间和最近一次退出时间不会丢失
+type ContainerState struct {
+	RestartCount int `json:"restart_count"`
+	// RestartBackoff 下一次自动重启前等待的时间
+	RestartBackoff time.Duration `json:"restart_backoff,omitempty"`
+	LastExitTime   time.Time     `json:"last_exit_time"`
+}
+
+// errNoChange 由 Update 的回调返回，表示不需要写回文件
+var errNoChange = errors.New("no change")
+
+// ContainerStore 容器状态存储，负责容器目录下 config.json、runconfig.json 和 state.json 的读写。
+// 写入先写临时文件再 rename，崩溃时不会留下写了一半的文件；
+// 读-改-写过程持有容器目录上的 flock 建议锁，与其他遵守该锁的进程互斥。
+type ContainerStore struct {
+	// location 容器目录模板，格式同 container.DefaultLocation
+	location string
+	// onChange 写入或删除容器后回调，用于同步刷新容器索引
+	onChange func(containerName string)
+}
+
+// containerStore 服务端统一使用的容器状态存储
+var containerStore = NewContainerStore(container.DefaultLocation)
+
+// NewContainerStore 创建容器状态存储
+func NewContainerStore(location string) *ContainerStore {
+	return &ContainerStore{location: location}
+}
+
+// Dir 返回容器目录，以 / 结尾
+func (s *ContainerStore) Dir(containerName string) string {
+	return fmt.Sprintf(s.location, containerName)
+}
+
+// Lock 对容器目录加排他锁，返回解锁函数
+func (s *ContainerStore) Lock(containerName string) (func(), error) {
+	dir, err := os.Open(s.Dir(containerName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: %s", ErrContainerNotFound, containerName)
+		}
+		return nil, err
+	}
+	if err := syscall.Flock(int(dir.Fd()), syscall.LOCK_EX); err != nil {
+		dir.Close()
+		return nil, fmt.Errorf("lock container dir error: %v", err)
+	}
+
+	return func() {
+		syscall.Flock(int(dir.Fd()), syscall.LOCK_UN)
+		dir.Close()
+	}, nil
+}
+
+// Read 读取容器配置。写入是原子的 rename，因此读取不需要加锁
+func (s *ContainerStore) Read(containerName string) (*container.ContainerInfo, error) {
+	data, err := os.ReadFile(s.Dir(containerName) + container.ConfigName)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: %s", ErrContainerNotFound, containerName)
+		}
+		return nil, err
+	}
+
+	var info container.ContainerInfo
+	if err := sonic.Unmarshal(data, &info); err != nil {
+		return nil, fmt.Errorf("unmarshal container info error: %v", err)
+	}
+	return &info, nil
+}
+
+// Write 写入容器配置，容器目录不存在时创建
+func (s *ContainerStore) Write(info *container.ContainerInfo) error {
+	dir := s.Dir(info.Name)
+	if err := os.MkdirAll(dir, containerDirPerm); err != nil {
+		return fmt.Errorf("mkdir container dir error: %v", err)
+	}
+	// zdocker 以 0622 创建容器目录，这里统一修正
+	if err := os.Chmod(dir, containerDirPerm); err != nil {
+		return fmt.Errorf("chmod container dir error: %v", err)
+	}
+	unlock, err := s.Lock(info.Name)
+	if err != nil {
+		return err
+	}
+	err = s.writeInfo(info)
+	unlock()
+
+	s.changed(info.Name)
+	return err
+}
+
+// Update 在锁内读取容器配置，由 fn 修改后写回。fn 返回 errNoChange 时不写回
+func (s *ContainerStore) Update(containerName string, fn func(info *container.ContainerInfo) error) error {
+	unlock, err := s.Lock(containerName)
+	if err != nil {
+		return err
+	}
+	err = s.update(containerName, fn)
+	unlock()
+
+	if errors.Is(err, errNoChange) {
+		return nil
+	}
+	s.changed(containerName)
+	return err
+}
+
+// update 执行 Update 的读-改-写，调用方需持有锁
+func (s *ContainerStore) update(containerName string, fn func(info *container.ContainerInfo) error) error {
+	info, err := s.Read(containerName)
+	if err != nil {
+		return err
+	}
+	if err := fn(info); err != nil {
+		return err
+	}
+	return s.writeInfo(info)
+}
+
+// writeInfo 原子写入 config.json，调用方需持有锁
+func (s *ContainerStore) writeInfo(info *container.ContainerInfo) error {
+	data, err := sonic.Marshal(info)
+	if err != nil {
+		return fmt.Errorf("marshal container info error: %v", err)
+	}
+	if err := writeFileAtomic(s.Dir(info.Name)+container.ConfigName, data, configFilePerm); err != nil {
+		return fmt.Errorf("write container config error: %v", err)
+	}
+	return nil
+}
+
+// WriteRunConfig 原子写入 runconfig.json
+func (s *ContainerStore) WriteRunConfig(containerName string, req CreateContainerRequest) error {
+	req.Name = containerName
+	data, err := sonic.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("marshal run config error: %v", err)
+	}
+
+	unlock, err := s.Lock(containerName)
+	if err != nil {
+		return err
+	}
+	err = writeFileAtomic(s.Dir(containerName)+RunConfigName, data, runConfigFilePerm)
+	unlock()
+
+	s.changed(containerName)
+	if err != nil {
+		return fmt.Errorf("write run config error: %v", err)
+	}
+	return nil
+}
+
+// ReadRunConfig 读取 runconfig.json，文件不存在时返回 os.IsNotExist 可判断的错误
+func (s *ContainerStore) ReadRunConfig(containerName string) (CreateContainerRequest, error) {
+	data, err := os.ReadFile(s.Dir(containerName) + RunConfigName)
+	if err != nil {
+		return CreateContainerRequest{}, err
+	}
+
+	var req CreateContainerRequest
+	if err := sonic.Unmarshal(data, &req); err != nil {
+		return CreateContainerRequest{}, fmt.Errorf("unmarshal run config error: %v", err)
+	}
+	req.Name = containerName
+	return req, nil
+}
+
+// ReadState 读取 state.json，文件不存在时返回零值
+func (s *ContainerStore) ReadState(containerName string) (ContainerState, error) {
+	var state ContainerState
+	data, err := os.ReadFile(s.Dir(containerName) + StateName)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state, nil
+		}
+		return state, err
+	}
+	if err := sonic.Unmarshal(data, &state); err != nil {
+		return ContainerState{}, fmt.Errorf("unmarshal container state error: %v", err)
+	}
+	return state, nil
+}
+
+// UpdateState 在锁内读取 state.json，由 fn 修改后原子写回
+func (s *ContainerStore) UpdateState(containerName string, fn func(state *ContainerState)) error {
+	unlock, err := s.Lock(containerName)
+	if err != nil {
+		return err
+	}
+	err = s.updateState(containerName, fn)
+	unlock()
+
+	s.changed(containerName)
+	return err
+}
+
+// updateState 执行 UpdateState 的读-改-写，调用方需持有锁
+func (s *ContainerStore) updateState(containerName string, fn func(state *ContainerState)) error {
+	state, err := s.ReadState(containerName)
+	if err != nil {
+		return err
+	}
+	fn(&state)
+	data, err := sonic.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("marshal container state error: %v", err)
+	}
+	if err := writeFileAtomic(s.Dir(containerName)+StateName, data, stateFilePerm); err != nil {
+		return fmt.Errorf("write container state error: %v", err)
+	}
+	return nil
+}
+
+// Remove 在锁内删除容器目录
+func (s *ContainerStore) Remove(containerName string) error {
+	unlock, err := s.Lock(containerName)
+	if err != nil {
+		return err
+	}
+	err = os.RemoveAll(s.Dir(containerName))
+	unlock()
+
+	s.changed(containerName)
+	return err
+}
+
+// changed 通知容器发生了变化
+func (s *ContainerStore) changed(containerName string) {
+	if s.onChange != nil {
+		s.onChange(containerName)
+	}
+}
+
+// writeFileAtomic 先写入同目录下的临时文件并刷盘，再 rename 覆盖目标文件
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName)
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		return err
+	}
+
+	// 刷新目录项，保证 rename 落盘
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/crazyfrankie/zdocker/container"
+)
+
+// newTestStore 返回位于临时目录的容器状态存储，changed 记录 onChange 回调的容器名称
+func newTestStore(t *testing.T) (s *ContainerStore, changed *[]string) {
+	s = NewContainerStore(filepath.Join(t.TempDir(), "%s") + "/")
+	changed = new([]string)
+	s.onChange = func(containerName string) {
+		*changed = append(*changed, containerName)
+	}
+	return s, changed
+}
+
+// useTestStore 将全局容器状态存储替换为临时目录中的存储，测试结束后恢复
+func useTestStore(t *testing.T) *ContainerStore {
+	s, _ := newTestStore(t)
+	s.onChange = nil
+	old := containerStore
+	containerStore = s
+	t.Cleanup(func() { containerStore = old })
+	return s
+}
+
+func TestContainerStoreNotifiesChanges(t *testing.T) {
+	s, changed := newTestStore(t)
+	if err := s.Write(&container.ContainerInfo{Name: "web", Status: container.RUNNING}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		write func() error
+	}{
+		{name: "Update", write: func() error {
+			return s.Update("web", func(info *container.ContainerInfo) error {
+				info.Status = container.STOP
+				return nil
+			})
+		}},
+		{name: "WriteRunConfig", write: func() error {
+			return s.WriteRunConfig("web", CreateContainerRequest{Image: "busybox"})
+		}},
+		{name: "UpdateState", write: func() error {
+			return s.UpdateState("web", func(state *ContainerState) { state.RestartCount++ })
+		}},
+	}
+	for _, tt := range tests {
+		*changed = nil
+		if err := tt.write(); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(*changed, []string{"web"}) {
+			t.Errorf("%s: onChange calls = %v, want [web]", tt.name, *changed)
+		}
+	}
+
+	*changed = nil
+	if err := s.Update("web", func(info *container.ContainerInfo) error { return errNoChange }); err != nil {
+		t.Fatal(err)
+	}
+	if len(*changed) != 0 {
+		t.Errorf("Update without change: onChange calls = %v, want none", *changed)
+	}
+}
+
+func TestContainerStoreState(t *testing.T) {
+	s, _ := newTestStore(t)
+	if err := s.Write(&container.ContainerInfo{Name: "web"}); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := s.ReadState("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(state, ContainerState{}) {
+		t.Errorf("initial state = %+v, want zero value", state)
+	}
+
+	exited := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		if err := s.UpdateState("web", func(state *ContainerState) {
+			state.RestartCount++
+			state.RestartBackoff = 2 * time.Second
+			state.LastExitTime = exited
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	state, err = s.ReadState("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ContainerState{RestartCount: 3, RestartBackoff: 2 * time.Second, LastExitTime: exited}
+	if !state.LastExitTime.Equal(want.LastExitTime) || state.RestartCount != want.RestartCount || state.RestartBackoff != want.RestartBackoff {
+		t.Errorf("state = %+v, want %+v", state, want)
+	}
+
+	// 原子写入不留下临时文件
+	entries, err := os.ReadDir(s.Dir("web"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if want := []string{container.ConfigName, StateName}; !reflect.DeepEqual(names, want) {
+		t.Errorf("container dir = %v, want %v", names, want)
+	}
+}
+
+func TestContainerStoreMissingContainer(t *testing.T) {
+	s, changed := newTestStore(t)
+
+	tests := []struct {
+		name  string
+		write func() error
+	}{
+		{name: "Update", write: func() error {
+			return s.Update("web", func(info *container.ContainerInfo) error { return nil })
+		}},
+		{name: "WriteRunConfig", write: func() error {
+			return s.WriteRunConfig("web", CreateContainerRequest{})
+		}},
+		{name: "UpdateState", write: func() error {
+			return s.UpdateState("web", func(state *ContainerState) {})
+		}},
+	}
+	for _, tt := range tests {
+		if err := tt.write(); !errors.Is(err, ErrContainerNotFound) {
+			t.Errorf("%s: error = %v, want ErrContainerNotFound", tt.name, err)
+		}
+	}
+	if len(*changed) != 0 {
+		t.Errorf("onChange calls = %v, want none", *changed)
+	}
+}
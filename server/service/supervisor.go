@@ -0,0 +1,424 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/crazyfrankie/zdocker/container"
+)
+
+// 重启策略
+const (
+	RestartNo            = "no"
+	RestartAlways        = "always"
+	RestartOnFailure     = "on-failure"
+	RestartUnlessStopped = "unless-stopped"
+)
+
+const (
+	// superviseInterval 检查容器进程是否退出的间隔
+	superviseInterval = time.Second
+	// restartBackoffBase/restartBackoffMax 重启退避时间的初始值和上限，每次重启后翻倍
+	restartBackoffBase = time.Second
+	restartBackoffMax  = time.Minute
+	// restartResetAfter 容器持续运行超过该时间后退避时间恢复为初始值
+	restartResetAfter = 10 * time.Second
+)
+
+// RestartPolicy 容器重启策略
+type RestartPolicy struct {
+	Name string
+	// MaxRetries on-failure 策略的最大重启次数，0 表示不限制
+	MaxRetries int
+}
+
+// String 返回策略的文本形式，与 ParseRestartPolicy 互逆
+func (p RestartPolicy) String() string {
+	if p.Name == RestartOnFailure && p.MaxRetries > 0 {
+		return fmt.Sprintf("%s:%d", p.Name, p.MaxRetries)
+	}
+	return p.Name
+}
+
+// ParseRestartPolicy 解析 no / always / on-failure[:N] / unless-stopped，空字符串视为 no
+func ParseRestartPolicy(s string) (RestartPolicy, error) {
+	name, retries, hasRetries := strings.Cut(s, ":")
+	switch name {
+	case "", RestartNo:
+		name = RestartNo
+	case RestartAlways, RestartUnlessStopped:
+	case RestartOnFailure:
+		if hasRetries {
+			n, err := strconv.Atoi(retries)
+			if err != nil || n < 0 {
+				return RestartPolicy{}, fmt.Errorf("%w: 无效的重启次数 %q", ErrInvalidArgument, retries)
+			}
+			return RestartPolicy{Name: name, MaxRetries: n}, nil
+		}
+		return RestartPolicy{Name: name}, nil
+	default:
+		return RestartPolicy{}, fmt.Errorf("%w: 未知的重启策略 %q", ErrInvalidArgument, s)
+	}
+	if hasRetries {
+		return RestartPolicy{}, fmt.Errorf("%w: 重启策略 %s 不支持重启次数", ErrInvalidArgument, name)
+	}
+	return RestartPolicy{Name: name}, nil
+}
+
+// exitCodeReporter 能够报告容器退出码的运行时，on-failure 策略据此区分正常退出
+type exitCodeReporter interface {
+	// ExitCode 返回容器最近一次退出的退出码，未知时 ok 为 false
+	ExitCode(containerName string) (code int, ok bool)
+}
+
+// restartState 单个容器的重启状态
+type restartState struct {
+	policy    RestartPolicy
+	count     int
+	startedAt time.Time
+	backoff   time.Duration
+	// nextAttempt 下一次重启时间，零值表示没有待执行的重启
+	nextAttempt time.Time
+	// stopped 用户手动停止后不再自动重启，直到再次手动启动
+	stopped bool
+}
+
+// Supervisor 在 Runtime 之上按重启策略自动重启退出的容器，
+// 同时在容器信息中补充重启策略和重启次数
+type Supervisor struct {
+	Runtime
+
+	mu     sync.Mutex
+	states map[string]*restartState
+	events *EventBus
+	done   chan struct{}
+}
+
+// NewSupervisor 创建重启监控器，需要调用 Start 开始监控。events 为 nil 时不发布事件
+func NewSupervisor(runtime Runtime, events *EventBus) *Supervisor {
+	return &Supervisor{
+		Runtime: runtime,
+		states:  make(map[string]*restartState),
+		events:  events,
+		done:    make(chan struct{}),
+	}
+}
+
+// Start 启动后台监控协程。策略为 always 的已停止容器会在此时重新启动。
+func (s *Supervisor) Start() {
+	s.startAlways()
+	go func() {
+		ticker := time.NewTicker(superviseInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.done:
+				return
+			case <-ticker.C:
+				s.check()
+			}
+		}
+	}()
+}
+
+// Stop 停止后台监控协程
+func (s *Supervisor) Stop() {
+	close(s.done)
+}
+
+// state 获取容器的重启状态，首次访问时从 runconfig.json 读取重启策略，
+// 从 state.json 读取服务重启前记录的重启次数和退避时间。调用方需持有锁
+func (s *Supervisor) state(containerName string) *restartState {
+	if st, ok := s.states[containerName]; ok {
+		return st
+	}
+
+	st := &restartState{
+		policy:  RestartPolicy{Name: RestartNo},
+		backoff: restartBackoffBase,
+	}
+	if req, err := readRunConfig(containerName); err == nil {
+		if policy, err := ParseRestartPolicy(req.RestartPolicy); err == nil {
+			st.policy = policy
+		}
+	}
+	saved := readContainerState(containerName)
+	st.count = saved.RestartCount
+	if saved.RestartBackoff > 0 {
+		st.backoff = min(saved.RestartBackoff, restartBackoffMax)
+	}
+	s.states[containerName] = st
+	return st
+}
+
+// save 保存重启次数和退避时间。调用方需持有锁
+func (s *Supervisor) save(containerName string, st *restartState) {
+	updateContainerState(containerName, func(state *ContainerState) {
+		state.RestartCount = st.count
+		state.RestartBackoff = st.backoff
+	})
+}
+
+// decorate 在容器信息中补充重启相关字段。调用方需持有锁
+func (s *Supervisor) decorate(c *Container) {
+	st := s.state(c.Name)
+	c.RestartPolicy = st.policy.String()
+	c.RestartCount = st.count
+}
+
+// ListContainers 获取容器列表
+func (s *Supervisor) ListContainers() ([]Container, error) {
+	containers, err := s.Runtime.ListContainers()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range containers {
+		s.decorate(&containers[i])
+	}
+	return containers, nil
+}
+
+// GetContainer 根据ID或名称获取容器信息
+func (s *Supervisor) GetContainer(containerId string) (Container, error) {
+	c, err := s.Runtime.GetContainer(containerId)
+	if err != nil {
+		return Container{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.decorate(&c)
+	return c, nil
+}
+
+// InspectContainer 获取容器的完整信息并补充重启相关字段
+func (s *Supervisor) InspectContainer(containerId string) (ContainerInspect, error) {
+	inspect, err := s.Runtime.InspectContainer(containerId)
+	if err != nil {
+		return ContainerInspect{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.state(inspect.Name)
+	inspect.RestartPolicy = st.policy.String()
+	inspect.RestartCount = st.count
+	return inspect, nil
+}
+
+// CreateContainer 校验重启策略后创建容器
+func (s *Supervisor) CreateContainer(req CreateContainerRequest) (Container, error) {
+	policy, err := ParseRestartPolicy(req.RestartPolicy)
+	if err != nil {
+		return Container{}, err
+	}
+	req.RestartPolicy = policy.String()
+
+	c, err := s.Runtime.CreateContainer(req)
+	if err != nil {
+		return Container{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.states[c.Name] = &restartState{
+		policy:    policy,
+		startedAt: time.Now(),
+		backoff:   restartBackoffBase,
+	}
+	s.decorate(&c)
+	return c, nil
+}
+
+// StartContainer 手动启动容器，清除手动停止标记，重启次数和退避时间重新计算
+func (s *Supervisor) StartContainer(containerName string) error {
+	c, err := s.Runtime.GetContainer(containerName)
+	if err != nil {
+		return err
+	}
+	if err := s.Runtime.StartContainer(c.Name); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.state(c.Name)
+	st.stopped = false
+	st.nextAttempt = time.Time{}
+	st.startedAt = time.Now()
+	st.count = 0
+	st.backoff = restartBackoffBase
+	s.save(c.Name, st)
+	return nil
+}
+
+// StopContainer 手动停止容器，停止后不再自动重启
+func (s *Supervisor) StopContainer(containerName string) error {
+	c, err := s.Runtime.GetContainer(containerName)
+	if err != nil {
+		return err
+	}
+
+	// 先标记再停止，避免停止过程中进程退出被当作异常退出而重启
+	s.mu.Lock()
+	st := s.state(c.Name)
+	stopped, nextAttempt := st.stopped, st.nextAttempt
+	st.stopped = true
+	st.nextAttempt = time.Time{}
+	s.mu.Unlock()
+
+	if err := s.Runtime.StopContainer(c.Name); err != nil {
+		// 停止失败时容器仍按原策略监控
+		s.mu.Lock()
+		st.stopped, st.nextAttempt = stopped, nextAttempt
+		s.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// RemoveContainer 删除容器及其重启状态
+func (s *Supervisor) RemoveContainer(containerName string) error {
+	c, err := s.Runtime.GetContainer(containerName)
+	if err != nil {
+		return err
+	}
+	if err := s.Runtime.RemoveContainer(c.Name); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.states, c.Name)
+	return nil
+}
+
+// startAlways 服务启动时重新启动策略为 always 的已停止容器
+func (s *Supervisor) startAlways() {
+	containers, err := s.Runtime.ListContainers()
+	if err != nil {
+		log.Printf("重启监控: 获取容器列表失败: %v", err)
+		return
+	}
+
+	for _, c := range containers {
+		s.mu.Lock()
+		policy := s.state(c.Name).policy
+		s.mu.Unlock()
+
+		if policy.Name == RestartAlways && c.Status == container.STOP {
+			if err := s.StartContainer(c.Name); err != nil {
+				log.Printf("重启监控: 启动容器 %s 失败: %v", c.Name, err)
+			}
+		}
+	}
+}
+
+// check 检查所有容器，为退出的容器安排重启并执行已到期的重启
+func (s *Supervisor) check() {
+	// 进程已不存在的 running 容器由 Reconciler 标记为 exit
+	containers, err := s.Runtime.ListContainers()
+	if err != nil {
+		log.Printf("重启监控: 获取容器列表失败: %v", err)
+		return
+	}
+
+	now := time.Now()
+	for _, c := range containers {
+		if s.shouldRestart(c, now) {
+			s.restart(c)
+		}
+	}
+}
+
+// shouldRestart 更新容器的重启状态，返回是否应当立即重启
+func (s *Supervisor) shouldRestart(c Container, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st := s.state(c.Name)
+	if st.policy.Name == RestartNo || st.stopped {
+		return false
+	}
+
+	switch c.Status {
+	case container.RUNNING:
+		if st.startedAt.IsZero() {
+			st.startedAt = now
+		}
+		if now.Sub(st.startedAt) > restartResetAfter && st.backoff != restartBackoffBase {
+			st.backoff = restartBackoffBase
+			s.save(c.Name, st)
+		}
+		return false
+	case container.EXIT:
+	default:
+		return false
+	}
+
+	// 新发现的退出，按退避时间安排重启
+	if st.nextAttempt.IsZero() {
+		if st.policy.Name == RestartOnFailure {
+			if reporter, ok := s.Runtime.(exitCodeReporter); ok {
+				if code, ok := reporter.ExitCode(c.Name); ok && code == 0 {
+					st.stopped = true
+					return false
+				}
+			}
+			if st.policy.MaxRetries > 0 && st.count >= st.policy.MaxRetries {
+				log.Printf("重启监控: 容器 %s 已达到最大重启次数 %d", c.Name, st.policy.MaxRetries)
+				st.stopped = true
+				return false
+			}
+		}
+		st.nextAttempt = now.Add(st.backoff)
+		return false
+	}
+
+	return !now.Before(st.nextAttempt)
+}
+
+// restart 重启容器并更新退避时间
+func (s *Supervisor) restart(c Container) {
+	containerName := c.Name
+	event := Event{
+		Type:          EventContainerRestarted,
+		Actor:         ActorSupervisor,
+		ContainerID:   c.ID,
+		ContainerName: c.Name,
+	}
+	if reporter, ok := s.Runtime.(exitCodeReporter); ok {
+		if code, ok := reporter.ExitCode(containerName); ok {
+			event.ExitCode = &code
+		}
+	}
+	err := s.Runtime.StartContainer(containerName)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st := s.state(containerName)
+	st.backoff = min(st.backoff*2, restartBackoffMax)
+	if err != nil {
+		log.Printf("重启监控: 重启容器 %s 失败: %v", containerName, err)
+		st.nextAttempt = time.Now().Add(st.backoff)
+		s.save(containerName, st)
+		return
+	}
+
+	st.count++
+	st.nextAttempt = time.Time{}
+	st.startedAt = time.Now()
+	s.save(containerName, st)
+	log.Printf("重启监控: 容器 %s 已按策略 %s 重启，第 %d 次", containerName, st.policy, st.count)
+
+	event.RestartCount = st.count
+	s.events.Publish(event)
+}
@@ -0,0 +1,162 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/crazyfrankie/zdocker/container"
+)
+
+// exitCodeRuntime 报告固定退出码的运行时
+type exitCodeRuntime struct {
+	Runtime
+	code int
+	ok   bool
+}
+
+// ExitCode 返回固定的退出码
+func (r exitCodeRuntime) ExitCode(string) (int, bool) {
+	return r.code, r.ok
+}
+
+func TestSupervisorShouldRestart(t *testing.T) {
+	useTestStore(t)
+	now := time.Now()
+	always := RestartPolicy{Name: RestartAlways}
+
+	tests := []struct {
+		name     string
+		state    restartState
+		status   string
+		exitCode *int
+		want     bool
+		// wantScheduled 是否安排了下一次重启，wantStopped 是否不再自动重启
+		wantScheduled bool
+		wantStopped   bool
+		wantBackoff   time.Duration
+	}{
+		{name: "policy no", state: restartState{policy: RestartPolicy{Name: RestartNo}}, status: container.EXIT},
+		{name: "running", state: restartState{policy: always, startedAt: now}, status: container.RUNNING},
+		{name: "manually stopped", state: restartState{policy: always, stopped: true}, status: container.EXIT, wantStopped: true},
+		{name: "first exit schedules", state: restartState{policy: always}, status: container.EXIT, wantScheduled: true},
+		{name: "backoff pending", state: restartState{policy: always, nextAttempt: now.Add(time.Second)}, status: container.EXIT, wantScheduled: true},
+		{name: "backoff elapsed", state: restartState{policy: always, nextAttempt: now.Add(-time.Second)}, status: container.EXIT, want: true, wantScheduled: true},
+		{name: "unless-stopped", state: restartState{policy: RestartPolicy{Name: RestartUnlessStopped}}, status: container.EXIT, wantScheduled: true},
+		{name: "on-failure clean exit", state: restartState{policy: RestartPolicy{Name: RestartOnFailure}}, status: container.EXIT, exitCode: intPtr(0), wantStopped: true},
+		{name: "on-failure error exit", state: restartState{policy: RestartPolicy{Name: RestartOnFailure}}, status: container.EXIT, exitCode: intPtr(2), wantScheduled: true},
+		{name: "on-failure unknown exit code", state: restartState{policy: RestartPolicy{Name: RestartOnFailure}}, status: container.EXIT, wantScheduled: true},
+		{name: "on-failure max retries", state: restartState{policy: RestartPolicy{Name: RestartOnFailure, MaxRetries: 3}, count: 3}, status: container.EXIT, exitCode: intPtr(1), wantStopped: true},
+		{name: "on-failure below max retries", state: restartState{policy: RestartPolicy{Name: RestartOnFailure, MaxRetries: 3}, count: 2}, status: container.EXIT, exitCode: intPtr(1), wantScheduled: true},
+		{
+			name:        "backoff reset after running",
+			state:       restartState{policy: always, startedAt: now.Add(-restartResetAfter - time.Second), backoff: 8 * time.Second},
+			status:      container.RUNNING,
+			wantBackoff: restartBackoffBase,
+		},
+		{
+			name:        "backoff kept shortly after restart",
+			state:       restartState{policy: always, startedAt: now.Add(-time.Second), backoff: 8 * time.Second},
+			status:      container.RUNNING,
+			wantBackoff: 8 * time.Second,
+		},
+	}
+	for _, tt := range tests {
+		rt := exitCodeRuntime{}
+		if tt.exitCode != nil {
+			rt.code, rt.ok = *tt.exitCode, true
+		}
+		s := NewSupervisor(rt, nil)
+		st := tt.state
+		if st.backoff == 0 {
+			st.backoff = restartBackoffBase
+		}
+		s.states["web"] = &st
+
+		if got := s.shouldRestart(Container{Name: "web", Status: tt.status}, now); got != tt.want {
+			t.Errorf("%s: shouldRestart = %v, want %v", tt.name, got, tt.want)
+		}
+		if scheduled := !st.nextAttempt.IsZero(); scheduled != tt.wantScheduled {
+			t.Errorf("%s: scheduled = %v, want %v", tt.name, scheduled, tt.wantScheduled)
+		}
+		if st.stopped != tt.wantStopped {
+			t.Errorf("%s: stopped = %v, want %v", tt.name, st.stopped, tt.wantStopped)
+		}
+		if tt.wantBackoff != 0 && st.backoff != tt.wantBackoff {
+			t.Errorf("%s: backoff = %v, want %v", tt.name, st.backoff, tt.wantBackoff)
+		}
+	}
+}
+
+// intPtr 返回指向 n 的指针
+func intPtr(n int) *int {
+	return &n
+}
+
+func TestSupervisorRestartAndManualStart(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	store := useTestStore(t)
+	rt := NewFakeRuntime()
+	s := NewSupervisor(rt, nil)
+
+	c, err := s.CreateContainer(CreateContainerRequest{Image: "busybox", Name: "web", Command: NewCommandLine("sleep", "100"), RestartPolicy: "always"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// state.json 保存在状态存储中的容器目录
+	if err := store.Write(&container.ContainerInfo{Name: c.Name}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 进程退出后按策略重启，每次重启后退避时间翻倍
+	for i := 1; i <= 3; i++ {
+		if err := rt.StopContainer(c.Name); err != nil {
+			t.Fatal(err)
+		}
+		c.Status = container.EXIT
+		s.restart(c)
+		state, err := store.ReadState(c.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := restartBackoffBase << i; state.RestartCount != i || state.RestartBackoff != want {
+			t.Fatalf("restart %d: state = %+v, want count %d and backoff %v", i, state, i, want)
+		}
+	}
+	if got, _ := s.GetContainer(c.Name); got.RestartCount != 3 {
+		t.Errorf("restart count = %d, want 3", got.RestartCount)
+	}
+
+	// 手动停止后不再自动重启，手动启动后重启次数和退避时间重新计算
+	if err := s.StopContainer(c.Name); err != nil {
+		t.Fatal(err)
+	}
+	if s.shouldRestart(Container{Name: c.Name, Status: container.EXIT}, time.Now().Add(time.Hour)) {
+		t.Error("manually stopped container scheduled for restart")
+	}
+	if err := s.StartContainer(c.Name); err != nil {
+		t.Fatal(err)
+	}
+	state, err := store.ReadState(c.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.RestartCount != 0 || state.RestartBackoff != restartBackoffBase {
+		t.Errorf("after manual start: state = %+v, want count 0 and backoff %v", state, restartBackoffBase)
+	}
+	if got, _ := s.GetContainer(c.Name); got.RestartCount != 0 {
+		t.Errorf("after manual start: restart count = %d, want 0", got.RestartCount)
+	}
+
+	// 新的监控器从 state.json 恢复重启状态
+	if err := rt.StopContainer(c.Name); err != nil {
+		t.Fatal(err)
+	}
+	s.restart(c)
+	restored := NewSupervisor(rt, nil)
+	restored.mu.Lock()
+	st := restored.state(c.Name)
+	restored.mu.Unlock()
+	if st.count != 1 || st.backoff != 2*restartBackoffBase {
+		t.Errorf("restored state: count %d, backoff %v, want 1 and %v", st.count, st.backoff, 2*restartBackoffBase)
+	}
+}
@@ -0,0 +1,437 @@
+package service
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/crazyfrankie/zdocker/container"
+)
+
+// 字段校验错误码
+const (
+	ValidationRequired    = "required"
+	ValidationInvalid     = "invalid"
+	ValidationOutOfRange  = "out_of_range"
+	ValidationConflict    = "conflict"
+	ValidationNotFound    = "not_found"
+	ValidationUnsupported = "unsupported"
+)
+
+// 资源限制的取值范围
+const (
+	// minMemoryLimit 过小的内存限制会让容器进程启动即被 OOM
+	minMemoryLimit = 4 << 20
+	// minCPUShares、maxCPUShares 为 cgroup v1 cpu.shares 的取值范围
+	minCPUShares = 2
+	maxCPUShares = 262144
+)
+
+var (
+	// containerNamePattern 容器名称同时用作目录名和 cgroup 名称，与 docker 的规则一致
+	containerNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]{0,63}$`)
+	// envKeyPattern 环境变量名
+	envKeyPattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+	// labelKeyPattern 标签名，允许 team、app.kubernetes.io/name 这类带前缀的形式
+	labelKeyPattern = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9_./-]{0,126}[a-zA-Z0-9])?$`)
+)
+
+// maxLabelValueLength 标签值的最大长度
+const maxLabelValueLength = 256
+
+// FieldError 单个字段的校验错误，Field 为请求 JSON 中的字段路径，如 port_mapping[1]、environment.PATH
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ValidationError 请求校验失败，包含所有出错的字段
+type ValidationError struct {
+	Errors []FieldError
+}
+
+// Error 实现 error
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, fe := range e.Errors {
+		messages[i] = fe.Field + ": " + fe.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Unwrap 使 errors.Is(err, ErrInvalidArgument) 成立
+func (e *ValidationError) Unwrap() error {
+	return ErrInvalidArgument
+}
+
+// add 记录一个字段错误
+func (e *ValidationError) add(field, code, format string, args ...any) {
+	e.Errors = append(e.Errors, FieldError{Field: field, Code: code, Message: fmt.Sprintf(format, args...)})
+}
+
+// ValidateCreateContainer 在交给 zdocker 之前检查创建容器的请求，返回所有字段的错误而不是遇到第一个就停止。
+// 镜像、网络、名称冲突和端口占用通过 runtime 查询
+func ValidateCreateContainer(rt Runtime, req CreateContainerRequest) error {
+	v := &ValidationError{}
+
+	if req.Name != "" {
+		if !containerNamePattern.MatchString(req.Name) {
+			v.add("name", ValidationInvalid, "名称只能包含字母、数字、_、. 和 -，以字母或数字开头，最长 64 个字符")
+		} else if _, err := rt.GetContainer(req.Name); err == nil {
+			v.add("name", ValidationConflict, "容器 %s 已存在", req.Name)
+		}
+	}
+
+	if req.Image == "" {
+		v.add("image", ValidationRequired, "镜像不能为空")
+	} else if _, err := rt.GetImage(req.Image); err != nil {
+		v.add("image", ValidationNotFound, "镜像 %s 不存在", req.Image)
+	}
+
+	validateCommand(v, req)
+
+	validateResources(v, req)
+	validateVolume(v, req.Volume)
+	validateEnvironment(v, req.Environment)
+	validateLabels(v, req.Labels)
+
+	if req.Network != "" {
+		if !networkExists(rt, req.Network) {
+			v.add("network", ValidationNotFound, "网络 %s 不存在", req.Network)
+		}
+	}
+	validatePortMapping(v, rt, req)
+
+	if _, err := ParseRestartPolicy(req.RestartPolicy); err != nil {
+		v.add("restart_policy", ValidationInvalid, "重启策略应为 no、always、on-failure[:N] 或 unless-stopped")
+	}
+
+	if len(v.Errors) > 0 {
+		return v
+	}
+	return nil
+}
+
+// validateCommand 检查 entrypoint、命令和工作目录，二者拼接后的 argv 不能为空
+func validateCommand(v *ValidationError, req CreateContainerRequest) {
+	if err := req.Entrypoint.Err(); err != nil {
+		v.add("entrypoint", ValidationInvalid, "entrypoint 无法解析: %v", err)
+	}
+	if err := req.Command.Err(); err != nil {
+		v.add("command", ValidationInvalid, "命令无法解析: %v", err)
+	} else if req.Command.Empty() && req.Entrypoint.Empty() {
+		v.add("command", ValidationRequired, "命令不能为空")
+	}
+	entrypoint := len(req.Entrypoint.Args)
+	for i, arg := range containerArgs(req) {
+		field := fmt.Sprintf("command[%d]", i-entrypoint)
+		if i < entrypoint {
+			field = fmt.Sprintf("entrypoint[%d]", i)
+		}
+		if i == 0 && arg == "" {
+			v.add(field, ValidationInvalid, "可执行文件不能为空")
+		} else if strings.ContainsRune(arg, 0) {
+			v.add(field, ValidationInvalid, "参数不能包含 NUL 字符")
+		}
+	}
+
+	if req.Workdir != "" {
+		if !path.IsAbs(req.Workdir) {
+			v.add("workdir", ValidationInvalid, "工作目录必须是容器内的绝对路径")
+		} else if strings.ContainsRune(req.Workdir, 0) {
+			v.add("workdir", ValidationInvalid, "工作目录不能包含 NUL 字符")
+		}
+	}
+}
+
+// validateResources 检查内存、CPU 权重和 CPU 集合
+func validateResources(v *ValidationError, req CreateContainerRequest) {
+	if req.Memory != "" {
+		if limit, err := parseMemorySize(req.Memory); err != nil {
+			v.add("memory", ValidationInvalid, "内存大小 %q 无效，应为整数加可选的 k、m、g 单位，如 512m", req.Memory)
+		} else if limit < minMemoryLimit {
+			v.add("memory", ValidationOutOfRange, "内存限制不能小于 4m")
+		}
+	}
+
+	if req.CpuShare != "" {
+		shares, err := strconv.ParseUint(req.CpuShare, 10, 64)
+		if err != nil {
+			v.add("cpu_share", ValidationInvalid, "CPU 权重 %q 不是整数", req.CpuShare)
+		} else if shares < minCPUShares || shares > maxCPUShares {
+			v.add("cpu_share", ValidationOutOfRange, "CPU 权重应在 %d 到 %d 之间", minCPUShares, maxCPUShares)
+		}
+	}
+
+	if req.CpuSet != "" {
+		cpus, err := parseCPUSet(req.CpuSet)
+		if err != nil {
+			v.add("cpu_set", ValidationInvalid, "CPU 集合 %q 无效，应为逗号分隔的编号或范围，如 0-2,4", req.CpuSet)
+			return
+		}
+		online := onlineCPUs()
+		for _, cpu := range cpus {
+			if !online[cpu] {
+				v.add("cpu_set", ValidationOutOfRange, "主机上不存在在线的 CPU %d，可用的 CPU 为 %s", cpu, formatCPUSet(online))
+				break
+			}
+		}
+	}
+}
+
+// validateVolume 检查 宿主机路径:容器路径 格式的数据卷
+func validateVolume(v *ValidationError, volume string) {
+	if volume == "" {
+		return
+	}
+	parts := strings.Split(volume, ":")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		v.add("volume", ValidationInvalid, "数据卷格式应为 宿主机路径:容器路径")
+		return
+	}
+	host, target := parts[0], parts[1]
+	switch {
+	case !path.IsAbs(host) || !path.IsAbs(target):
+		v.add("volume", ValidationInvalid, "宿主机路径和容器路径都必须是绝对路径")
+	case hasDotDot(host) || hasDotDot(target):
+		v.add("volume", ValidationInvalid, "路径中不能包含 ..")
+	case path.Clean(host) == "/":
+		v.add("volume", ValidationInvalid, "不能将宿主机根目录挂载到容器")
+	case path.Clean(target) == "/":
+		v.add("volume", ValidationInvalid, "不能挂载到容器根目录")
+	case isZdockerWorkDir(path.Clean(host)):
+		v.add("volume", ValidationInvalid, "不能挂载 zdocker 的工作目录 %s", host)
+	}
+	if info, err := os.Stat(host); err == nil && !info.IsDir() {
+		v.add("volume", ValidationInvalid, "宿主机路径 %s 不是目录", host)
+	}
+}
+
+// isZdockerWorkDir 判断路径是否位于 zdocker 的挂载点、可写层或 overlay 工作目录中
+func isZdockerWorkDir(p string) bool {
+	for name := range reservedImageNames {
+		if hasPathPrefix(p, path.Join(container.RootUrl, name)) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasDotDot 判断路径中是否包含 .. 组成部分
+func hasDotDot(p string) bool {
+	for _, part := range strings.Split(p, "/") {
+		if part == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+// validateEnvironment 检查环境变量名和值
+func validateEnvironment(v *ValidationError, env map[string]string) {
+	keys := make([]string, 0, len(env))
+	for key := range env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := env[key]
+		field := "environment." + key
+		if !envKeyPattern.MatchString(key) {
+			v.add(field, ValidationInvalid, "环境变量名 %q 只能包含字母、数字和 _，且不能以数字开头", key)
+		}
+		if strings.ContainsRune(value, 0) {
+			v.add(field, ValidationInvalid, "环境变量值不能包含 NUL 字符")
+		}
+	}
+}
+
+// validateLabels 检查标签名和值，标签用于限定角色可以操作的容器
+func validateLabels(v *ValidationError, labels map[string]string) {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		field := "labels." + key
+		if !labelKeyPattern.MatchString(key) {
+			v.add(field, ValidationInvalid, "标签名 %q 只能包含字母、数字和 _ . / -，以字母或数字开头和结尾，最长 128 个字符", key)
+		}
+		if len(labels[key]) > maxLabelValueLength || strings.ContainsRune(labels[key], 0) {
+			v.add(field, ValidationInvalid, "标签值不能超过 %d 个字符，且不能包含 NUL 字符", maxLabelValueLength)
+		}
+	}
+}
+
+// validatePortMapping 检查端口映射的格式，以及与请求中其他映射、其他运行中容器和宿主机监听端口的冲突
+func validatePortMapping(v *ValidationError, rt Runtime, req CreateContainerRequest) {
+	if len(req.PortMapping) == 0 {
+		return
+	}
+	if req.Network == "" {
+		// zdocker 只在连接网络时配置端口转发
+		v.add("port_mapping", ValidationRequired, "端口映射需要同时指定网络")
+	}
+
+	used := containerHostPorts(rt)
+	listening := listeningTCPPorts()
+	seen := make(map[int]bool)
+	for i, mapping := range req.PortMapping {
+		field := fmt.Sprintf("port_mapping[%d]", i)
+		port, err := ParsePortBinding(mapping)
+		if err != nil {
+			v.add(field, ValidationInvalid, "端口映射 %q 格式应为 宿主机端口:容器端口，端口范围 1-65535", mapping)
+			continue
+		}
+		if strings.Contains(mapping, "/") {
+			// zdocker 原样把容器端口写入 iptables 规则，只支持不带协议后缀的 tcp 映射
+			v.add(field, ValidationUnsupported, "zdocker 只支持 tcp 端口映射，不能指定协议后缀")
+			continue
+		}
+		switch {
+		case seen[port.Host]:
+			v.add(field, ValidationConflict, "宿主机端口 %d 重复映射", port.Host)
+		case used[port.Host] != "":
+			v.add(field, ValidationConflict, "宿主机端口 %d 已被容器 %s 使用", port.Host, used[port.Host])
+		case listening[port.Host]:
+			v.add(field, ValidationConflict, "宿主机端口 %d 已被其他进程监听", port.Host)
+		}
+		seen[port.Host] = true
+	}
+}
+
+// networkExists 判断网络是否存在
+func networkExists(rt Runtime, name string) bool {
+	networks, err := rt.ListNetworks()
+	if err != nil {
+		// 无法确认时交给 zdocker 处理
+		return true
+	}
+	for _, nw := range networks {
+		if nw.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// containerHostPorts 返回运行中容器占用的宿主机端口到容器名称的映射
+func containerHostPorts(rt Runtime) map[int]string {
+	used := make(map[int]string)
+	containers, err := rt.ListContainers()
+	if err != nil {
+		return used
+	}
+	for _, c := range containers {
+		if c.Status != container.RUNNING || c.PortMapping == "" {
+			continue
+		}
+		for _, mapping := range strings.Split(c.PortMapping, ",") {
+			if port, err := ParsePortBinding(mapping); err == nil {
+				used[port.Host] = c.Name
+			}
+		}
+	}
+	return used
+}
+
+// listeningTCPPorts 读取 /proc/net/tcp 和 /proc/net/tcp6 中处于 LISTEN 状态的本地端口
+func listeningTCPPorts() map[int]bool {
+	ports := make(map[int]bool)
+	for _, file := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+		f, err := os.Open(file)
+		if err != nil {
+			continue
+		}
+		scanner := bufio.NewScanner(f)
+		// 第一行为表头；各行格式为 sl local_address rem_address st ...，地址为十六进制 IP:端口
+		scanner.Scan()
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) < 4 || fields[3] != "0A" {
+				continue
+			}
+			_, port, ok := strings.Cut(fields[1], ":")
+			if !ok {
+				continue
+			}
+			if n, err := strconv.ParseUint(port, 16, 16); err == nil {
+				ports[int(n)] = true
+			}
+		}
+		f.Close()
+	}
+	return ports
+}
+
+// parseCPUSet 解析 cpuset 格式的 CPU 列表，如 0-2,4
+func parseCPUSet(s string) ([]int, error) {
+	var cpus []int
+	for _, part := range strings.Split(s, ",") {
+		first, last, isRange := strings.Cut(strings.TrimSpace(part), "-")
+		start, err := strconv.Atoi(first)
+		if err != nil || start < 0 {
+			return nil, fmt.Errorf("%w: 无效的 CPU 编号 %q", ErrInvalidArgument, part)
+		}
+		end := start
+		if isRange {
+			if end, err = strconv.Atoi(last); err != nil || end < start {
+				return nil, fmt.Errorf("%w: 无效的 CPU 范围 %q", ErrInvalidArgument, part)
+			}
+		}
+		for cpu := start; cpu <= end; cpu++ {
+			cpus = append(cpus, cpu)
+		}
+	}
+	return cpus, nil
+}
+
+// onlineCPUs 返回主机在线 CPU 的编号，读取失败时认为 0 到 NumCPU-1 都在线
+func onlineCPUs() map[int]bool {
+	online := make(map[int]bool)
+	data, err := os.ReadFile("/sys/devices/system/cpu/online")
+	if err == nil {
+		if cpus, err := parseCPUSet(strings.TrimSpace(string(data))); err == nil {
+			for _, cpu := range cpus {
+				online[cpu] = true
+			}
+			return online
+		}
+	}
+	for cpu := 0; cpu < runtime.NumCPU(); cpu++ {
+		online[cpu] = true
+	}
+	return online
+}
+
+// formatCPUSet 将 CPU 编号集合格式化为 cpuset 格式，连续的编号合并为范围
+func formatCPUSet(cpus map[int]bool) string {
+	sorted := make([]int, 0, len(cpus))
+	for cpu := range cpus {
+		sorted = append(sorted, cpu)
+	}
+	sort.Ints(sorted)
+
+	var parts []string
+	for i := 0; i < len(sorted); {
+		j := i
+		for j+1 < len(sorted) && sorted[j+1] == sorted[j]+1 {
+			j++
+		}
+		if i == j {
+			parts = append(parts, strconv.Itoa(sorted[i]))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d-%d", sorted[i], sorted[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, ",")
+}
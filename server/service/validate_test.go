@@ -0,0 +1,289 @@
+package service
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// newValidateRuntime 返回包含网络 br0 和占用宿主机端口 38080 的运行中容器 web 的内存运行时
+func newValidateRuntime(t *testing.T) *FakeRuntime {
+	t.Setenv("TMPDIR", t.TempDir())
+	rt := NewFakeRuntime()
+	if _, err := rt.CreateNetwork(CreateNetworkRequest{Name: "br0", Driver: "bridge", Subnet: "10.20.0.0/24"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rt.CreateContainer(CreateContainerRequest{
+		Image:       "busybox",
+		Name:        "web",
+		Command:     NewCommandLine("sleep", "100"),
+		Network:     "br0",
+		PortMapping: []string{"38080:80"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return rt
+}
+
+// validationFields 返回校验错误中的字段和错误码，err 为 nil 时返回 nil
+func validationFields(t *testing.T, err error) map[string]string {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("error %v is not a *ValidationError", err)
+	}
+	if !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("error %v does not wrap ErrInvalidArgument", err)
+	}
+	fields := make(map[string]string, len(verr.Errors))
+	for _, fe := range verr.Errors {
+		fields[fe.Field] = fe.Code
+	}
+	return fields
+}
+
+func TestValidateCreateContainer(t *testing.T) {
+	rt := newValidateRuntime(t)
+
+	hostDir := t.TempDir()
+	hostFile := filepath.Join(hostDir, "file")
+	if err := os.WriteFile(hostFile, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// 监听中的端口不能映射
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	listening := strconv.Itoa(ln.Addr().(*net.TCPAddr).Port)
+
+	tests := []struct {
+		name   string
+		modify func(req *CreateContainerRequest)
+		// want 期望的字段错误码，nil 表示校验通过
+		want map[string]string
+	}{
+		{
+			name:   "valid",
+			modify: func(req *CreateContainerRequest) {},
+		},
+		{
+			name: "valid with all options",
+			modify: func(req *CreateContainerRequest) {
+				req.Name = "api-1.v2"
+				req.Entrypoint = NewCommandLine("/bin/sh", "-c")
+				req.Command = NewCommandLine("echo $HOME")
+				req.Workdir = "/app"
+				req.Volume = hostDir + ":/data"
+				req.Memory = "512m"
+				req.CpuShare = "512"
+				req.CpuSet = "0"
+				req.Network = "br0"
+				req.PortMapping = []string{"38081:80"}
+				req.Environment = map[string]string{"APP_ENV": "prod", "_X": ""}
+				req.Labels = map[string]string{"team": "a", "app.kubernetes.io/name": "api"}
+				req.RestartPolicy = "on-failure:3"
+			},
+		},
+		{
+			name: "missing image and command",
+			modify: func(req *CreateContainerRequest) {
+				req.Image = ""
+				req.Command = CommandLine{}
+			},
+			want: map[string]string{"image": ValidationRequired, "command": ValidationRequired},
+		},
+		{
+			name:   "unknown image",
+			modify: func(req *CreateContainerRequest) { req.Image = "alpine" },
+			want:   map[string]string{"image": ValidationNotFound},
+		},
+		{
+			name:   "invalid name",
+			modify: func(req *CreateContainerRequest) { req.Name = "-web" },
+			want:   map[string]string{"name": ValidationInvalid},
+		},
+		{
+			name:   "name too long",
+			modify: func(req *CreateContainerRequest) { req.Name = strings.Repeat("a", 65) },
+			want:   map[string]string{"name": ValidationInvalid},
+		},
+		{
+			name:   "name exists",
+			modify: func(req *CreateContainerRequest) { req.Name = "web" },
+			want:   map[string]string{"name": ValidationConflict},
+		},
+		{
+			name: "command split error",
+			modify: func(req *CreateContainerRequest) {
+				_ = req.Command.UnmarshalJSON([]byte(`"echo 'open"`))
+			},
+			want: map[string]string{"command": ValidationInvalid},
+		},
+		{
+			name:   "entrypoint only",
+			modify: func(req *CreateContainerRequest) { req.Entrypoint, req.Command = NewCommandLine("top"), CommandLine{} },
+		},
+		{
+			name:   "empty executable",
+			modify: func(req *CreateContainerRequest) { req.Command = NewCommandLine("", "x") },
+			want:   map[string]string{"command[0]": ValidationInvalid},
+		},
+		{
+			name: "NUL in entrypoint and command",
+			modify: func(req *CreateContainerRequest) {
+				req.Entrypoint = NewCommandLine("sh", "a\x00b")
+				req.Command = NewCommandLine("c\x00d")
+			},
+			want: map[string]string{"entrypoint[1]": ValidationInvalid, "command[0]": ValidationInvalid},
+		},
+		{
+			name:   "relative workdir",
+			modify: func(req *CreateContainerRequest) { req.Workdir = "app" },
+			want:   map[string]string{"workdir": ValidationInvalid},
+		},
+		{
+			name: "invalid resources",
+			modify: func(req *CreateContainerRequest) {
+				req.Memory = "1x"
+				req.CpuShare = "abc"
+				req.CpuSet = "2-1"
+			},
+			want: map[string]string{"memory": ValidationInvalid, "cpu_share": ValidationInvalid, "cpu_set": ValidationInvalid},
+		},
+		{
+			name: "resources out of range",
+			modify: func(req *CreateContainerRequest) {
+				req.Memory = "1m"
+				req.CpuShare = "1"
+				req.CpuSet = "0,100000"
+			},
+			want: map[string]string{"memory": ValidationOutOfRange, "cpu_share": ValidationOutOfRange, "cpu_set": ValidationOutOfRange},
+		},
+		{
+			name:   "volume without target",
+			modify: func(req *CreateContainerRequest) { req.Volume = hostDir },
+			want:   map[string]string{"volume": ValidationInvalid},
+		},
+		{
+			name:   "volume relative host path",
+			modify: func(req *CreateContainerRequest) { req.Volume = "data:/data" },
+			want:   map[string]string{"volume": ValidationInvalid},
+		},
+		{
+			name:   "volume with dot dot",
+			modify: func(req *CreateContainerRequest) { req.Volume = hostDir + "/../etc:/data" },
+			want:   map[string]string{"volume": ValidationInvalid},
+		},
+		{
+			name:   "volume host root",
+			modify: func(req *CreateContainerRequest) { req.Volume = "/:/host" },
+			want:   map[string]string{"volume": ValidationInvalid},
+		},
+		{
+			name:   "volume container root",
+			modify: func(req *CreateContainerRequest) { req.Volume = hostDir + ":/" },
+			want:   map[string]string{"volume": ValidationInvalid},
+		},
+		{
+			name:   "volume zdocker work dir",
+			modify: func(req *CreateContainerRequest) { req.Volume = "/root/writeLayer/web:/data" },
+			want:   map[string]string{"volume": ValidationInvalid},
+		},
+		{
+			name:   "volume host file",
+			modify: func(req *CreateContainerRequest) { req.Volume = hostFile + ":/data" },
+			want:   map[string]string{"volume": ValidationInvalid},
+		},
+		{
+			name: "invalid environment",
+			modify: func(req *CreateContainerRequest) {
+				req.Environment = map[string]string{"1ABC": "x", "OK": "a\x00b", "GOOD": "y"}
+			},
+			want: map[string]string{"environment.1ABC": ValidationInvalid, "environment.OK": ValidationInvalid},
+		},
+		{
+			name: "invalid labels",
+			modify: func(req *CreateContainerRequest) {
+				req.Labels = map[string]string{"-team": "a", "app": strings.Repeat("v", 257)}
+			},
+			want: map[string]string{"labels.-team": ValidationInvalid, "labels.app": ValidationInvalid},
+		},
+		{
+			name:   "unknown network",
+			modify: func(req *CreateContainerRequest) { req.Network = "missing" },
+			want:   map[string]string{"network": ValidationNotFound},
+		},
+		{
+			name:   "port mapping without network",
+			modify: func(req *CreateContainerRequest) { req.PortMapping = []string{"38081:80"} },
+			want:   map[string]string{"port_mapping": ValidationRequired},
+		},
+		{
+			name: "port mapping errors",
+			modify: func(req *CreateContainerRequest) {
+				req.Network = "br0"
+				req.PortMapping = []string{"80", "38082:80/udp", "38083:80", "38083:81", "38080:80", listening + ":80"}
+			},
+			want: map[string]string{
+				"port_mapping[0]": ValidationInvalid,
+				"port_mapping[1]": ValidationUnsupported,
+				"port_mapping[3]": ValidationConflict,
+				"port_mapping[4]": ValidationConflict,
+				"port_mapping[5]": ValidationConflict,
+			},
+		},
+		{
+			name:   "invalid restart policy",
+			modify: func(req *CreateContainerRequest) { req.RestartPolicy = "always:3" },
+			want:   map[string]string{"restart_policy": ValidationInvalid},
+		},
+	}
+	for _, tt := range tests {
+		req := CreateContainerRequest{Image: "busybox", Command: NewCommandLine("sleep", "100")}
+		tt.modify(&req)
+		got := validationFields(t, ValidateCreateContainer(rt, req))
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: errors = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseRestartPolicy(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    RestartPolicy
+		wantErr bool
+	}{
+		{in: "", want: RestartPolicy{Name: RestartNo}},
+		{in: "no", want: RestartPolicy{Name: RestartNo}},
+		{in: "always", want: RestartPolicy{Name: RestartAlways}},
+		{in: "unless-stopped", want: RestartPolicy{Name: RestartUnlessStopped}},
+		{in: "on-failure", want: RestartPolicy{Name: RestartOnFailure}},
+		{in: "on-failure:5", want: RestartPolicy{Name: RestartOnFailure, MaxRetries: 5}},
+		{in: "on-failure:-1", wantErr: true},
+		{in: "on-failure:x", wantErr: true},
+		{in: "always:2", wantErr: true},
+		{in: "sometimes", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseRestartPolicy(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseRestartPolicy(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if err == nil && got != tt.want {
+			t.Errorf("ParseRestartPolicy(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+import api from './index'
+
+export interface AuditEntry {
+  time: string
+  user: string
+  token_id?: string
+  client_ip: string
+  method: string
+  route: string
+  path: string
+  action: string
+  target?: string
+  // 请求体，敏感字段已被替换为 ***
+  request?: unknown
+  status: number
+  result: 'success' | 'failure'
+  error?: string
+  duration_ms: number
+}
+
+export interface AuditQuery {
+  user?: string
+  // container 匹配所有容器操作
+  action?: string
+  target?: string
+  result?: string
+  // RFC3339 时间
+  since?: string
+  until?: string
+  limit?: number
+}
+
+// 查询审计日志，从新到旧返回
+export const getAuditEntries = (query: AuditQuery = {}) => {
+  const params = Object.fromEntries(Object.entries(query).filter(([, v]) => v !== undefined && v !== ''))
+  return api.get('/audit', { params })
+}
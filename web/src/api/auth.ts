@@ -0,0 +1,56 @@
+import api, { clearTokens, setTokens, type TokenPair } from './index'
+
+export interface UserInfo {
+  username: string
+  disabled: boolean
+  roles: string[]
+  created_at: string
+}
+
+export interface Role {
+  name: string
+  description?: string
+  permissions: string[]
+  containers?: string[]
+  labels?: Record<string, string>
+  builtin?: boolean
+}
+
+// 当前用户、角色和展开后的权限
+export interface CurrentUser {
+  user: UserInfo
+  roles: Role[]
+  permissions: string[]
+}
+
+// 登录并保存令牌
+export const login = async (username: string, password: string) => {
+  const response = await api.post('/auth/login', { username, password })
+  const data = response.data as { tokens: TokenPair; user: UserInfo }
+  setTokens(data.tokens)
+  return data.user
+}
+
+// 注销当前会话，服务端失败时也清除本地令牌
+export const logout = async () => {
+  try {
+    await api.post('/auth/logout')
+  } finally {
+    clearTokens()
+  }
+}
+
+// 获取当前登录的用户
+export const getCurrentUser = () => {
+  return api.get('/auth/me')
+}
+
+// 获取所有角色
+export const getRoles = () => {
+  return api.get('/roles')
+}
+
+// 修改当前用户的密码，该用户的其他登录会被注销
+export const changePassword = (oldPassword: string, newPassword: string) => {
+  return api.put('/auth/password', { old_password: oldPassword, new_password: newPassword })
+}
@@ -1,4 +1,4 @@
-import api from './index'
+import api, { authHeaders, withAccessToken } from './index'
 
 export interface Container {
   id: string
@@ -10,11 +10,15 @@ export interface Container {
   pid: string
   volume: string
   port_mapping: string
+  labels?: Record<string, string>
 }
 
 export interface CreateContainerRequest {
   image: string
-  command: string
+  // 数组按原样作为 argv；字符串按 shell 的引号和转义规则拆分，不做变量展开
+  command: string | string[]
+  entrypoint?: string | string[]
+  workdir?: string
   name?: string
   detach?: boolean
   tty?: boolean
@@ -24,9 +28,18 @@ export interface CreateContainerRequest {
   cpu_set?: string
   network?: string
   environment?: Record<string, string>
+  // 标签用于按角色限制可操作的容器
+  labels?: Record<string, string>
   port_mapping?: string[]
 }
 
+// 创建容器校验失败时 422 响应中的字段错误
+export interface FieldError {
+  field: string
+  code: 'required' | 'invalid' | 'out_of_range' | 'conflict' | 'not_found' | 'unsupported'
+  message: string
+}
+
 export interface ExecRequest {
   command: string[]
 }
@@ -41,6 +54,40 @@ export const getContainer = (id: string) => {
   return api.get(`/containers/${id}`)
 }
 
+export interface ContainerInspect {
+  id: string
+  name: string
+  image: string
+  status: string
+  running: boolean
+  created: string
+  started_at?: string
+  uptime_seconds: number
+  pid: number
+  args: string[]
+  env: string[]
+  resources: {
+    source: 'cgroup' | 'config'
+    memory_limit: number
+    cpu_shares?: number
+    cpu_weight?: number
+    cpuset: string
+    pids_limit: number
+  }
+  rootfs: { lower: string; upper: string; merged: string; mounted: boolean }
+  mounts: { type: string; source: string; destination: string }[]
+  network?: { name: string; ip_addresses: string[] }
+  ports: { host: number; container: number; proto: string }[]
+  namespaces: Record<string, number>
+  restart_policy: string
+  restart_count: number
+}
+
+// 获取容器的完整信息，包括进程、资源限制、网络、端口映射和命名空间
+export const inspectContainer = (id: string) => {
+  return api.get(`/containers/${id}/inspect`)
+}
+
 // 创建容器
 export const createContainer = (data: CreateContainerRequest) => {
   return api.post('/containers', data)
@@ -66,7 +113,191 @@ export const getContainerLogs = (name: string) => {
   return api.get(`/containers/logs/${name}`)
 }
 
+export interface LogLine {
+  time: string
+  line: string
+  offset: number
+}
+
+// 跟随容器日志，先推送最后 tail 行再推送新日志；日志被截断时调用 onTruncated，
+// 容器被删除时调用 onEnd。返回停止跟随的函数
+export const followContainerLogs = (
+  name: string,
+  tail: number,
+  handlers: {
+    onLine: (line: LogLine) => void
+    onTruncated?: () => void
+    onEnd?: (reason: string) => void
+  }
+) => {
+  const source = new EventSource(withAccessToken(`${api.defaults.baseURL}/containers/logs/${name}?follow=true&tail=${tail}`))
+  source.addEventListener('log', (e: MessageEvent) => handlers.onLine(JSON.parse(e.data)))
+  source.addEventListener('truncated', () => handlers.onTruncated?.())
+  source.addEventListener('end', (e: MessageEvent) => {
+    source.close()
+    handlers.onEnd?.(JSON.parse(e.data).reason)
+  })
+  return () => source.close()
+}
+
+export interface ContainerStats {
+  id: string
+  name: string
+  read: string
+  cgroup_version: number
+  cpu: {
+    usage_nanos: number
+    user_nanos: number
+    system_nanos: number
+    online_cpus: number
+    percent?: number
+    periods: number
+    throttled_periods: number
+    throttled_nanos: number
+  }
+  memory: { usage: number; raw_usage: number; cache: number; limit: number; percent: number }
+  pids: { current: number; limit: number }
+  networks: Record<string, { rx_bytes: number; tx_bytes: number; rx_packets: number; tx_packets: number }>
+}
+
+// 获取容器资源使用情况的单次采样
+export const getContainerStats = (id: string) => {
+  return api.get(`/containers/${id}/stats`)
+}
+
+// 获取所有运行中容器的资源使用情况，按 CPU 使用率排序
+export const getAllContainerStats = () => {
+  return api.get('/containers/stats')
+}
+
+// 持续接收容器资源使用情况，容器停止或删除后调用 onEnd。返回停止接收的函数
+export const streamContainerStats = (
+  id: string,
+  onStats: (stats: ContainerStats) => void,
+  onEnd?: (reason: string) => void
+) => {
+  const source = new EventSource(withAccessToken(`${api.defaults.baseURL}/containers/${id}/stats?stream=true`))
+  source.addEventListener('stats', (e: MessageEvent) => onStats(JSON.parse(e.data)))
+  source.addEventListener('end', (e: MessageEvent) => {
+    source.close()
+    onEnd?.(JSON.parse(e.data).reason)
+  })
+  return () => source.close()
+}
+
 // 在容器中执行命令
 export const execContainer = (id: string, data: ExecRequest) => {
   return api.post(`/containers/${id}/exec`, data)
 }
+
+export interface CommitProgress {
+  entries: number
+  bytes: number
+  total_bytes: number
+}
+
+// 将容器文件系统提交为新镜像，通过 SSE 接收打包进度；EventSource 不支持 POST，使用 fetch 读取事件流
+export const commitContainer = async (
+  id: string,
+  options: { image: string; pause?: boolean },
+  onProgress?: (progress: CommitProgress) => void
+) => {
+  const response = await fetch(`${api.defaults.baseURL}/containers/${id}/commit`, {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json', Accept: 'text/event-stream', ...authHeaders() },
+    body: JSON.stringify(options)
+  })
+  if (!response.ok || !response.body) {
+    const body = await response.json().catch(() => ({}))
+    throw new Error(body.error || '提交容器失败')
+  }
+
+  const reader = response.body.pipeThrough(new TextDecoderStream()).getReader()
+  let buffer = ''
+  for (;;) {
+    const { value, done } = await reader.read()
+    if (done) break
+    buffer += value
+    let index
+    while ((index = buffer.indexOf('\n\n')) >= 0) {
+      const block = buffer.slice(0, index)
+      buffer = buffer.slice(index + 2)
+      const event = block.match(/^event: (.*)$/m)?.[1]
+      const data = block.match(/^data: (.*)$/m)?.[1]
+      if (!data) continue
+      const payload = JSON.parse(data)
+      if (event === 'progress') onProgress?.(payload)
+      if (event === 'error') throw new Error(payload.error)
+      if (event === 'done') return payload
+    }
+  }
+  throw new Error('提交容器失败: 连接中断')
+}
+
+export interface FileChange {
+  path: string
+  kind: 'added' | 'modified' | 'deleted'
+  is_dir: boolean
+  size: number
+}
+
+export interface ContainerChanges {
+  changes: FileChange[]
+  truncated: boolean
+  added: number
+  modified: number
+  deleted: number
+  added_bytes: number
+  modified_bytes: number
+  deleted_bytes: number
+}
+
+// 获取容器文件系统相对镜像的变化，path 只返回该路径及其下的变化
+export const getContainerChanges = (id: string, path?: string) => {
+  return api.get(`/containers/${id}/changes`, { params: path ? { path } : {} })
+}
+
+export interface ContainerFile {
+  name: string
+  path: string
+  type: 'file' | 'dir' | 'symlink' | 'char' | 'block' | 'fifo' | 'socket'
+  size: number
+  mode: string
+  uid: number
+  gid: number
+  mod_time: string
+  link_target?: string
+}
+
+// 列出容器内目录的内容
+export const listContainerFiles = (id: string, path: string) => {
+  return api.get(`/containers/${id}/files`, { params: { path } })
+}
+
+// 容器内文件的下载地址，目录下载为 tar 包，由浏览器直接下载
+export const containerFileDownloadUrl = (id: string, path: string) => {
+  return withAccessToken(`${api.defaults.baseURL}/containers/${encodeURIComponent(id)}/files/download?path=${encodeURIComponent(path)}`)
+}
+
+// 上传文件到容器内的 path，mode 为八进制权限，owner 为 用户[:组]
+export const uploadContainerFile = (
+  id: string,
+  path: string,
+  file: File,
+  options: { mode?: string; owner?: string } = {},
+  onProgress?: (percent: number) => void
+) => {
+  const params: Record<string, string> = { path }
+  if (options.mode) params.mode = options.mode
+  if (options.owner) params.owner = options.owner
+  return api.put(`/containers/${id}/files`, file, {
+    params,
+    timeout: 0,
+    headers: { 'Content-Type': 'application/octet-stream' },
+    onUploadProgress: event => {
+      if (onProgress && event.total) {
+        onProgress(Math.round((event.loaded / event.total) * 100))
+      }
+    }
+  })
+}
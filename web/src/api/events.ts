@@ -0,0 +1,66 @@
+import api, { withAccessToken } from './index'
+
+export type EventType =
+  | 'container.created'
+  | 'container.started'
+  | 'container.stopped'
+  | 'container.exited'
+  | 'container.removed'
+  | 'container.restarted'
+  | 'network.created'
+  | 'network.removed'
+  | 'image.created'
+  | 'image.removed'
+
+export interface LifecycleEvent {
+  // 格式为 <启动标识>-<序号>
+  id: string
+  type: EventType
+  time: string
+  actor: string
+  container_id?: string
+  container_name?: string
+  network?: string
+  image?: string
+  exit_code?: number
+  restart_count?: number
+}
+
+export interface EventFilter {
+  // 事件类型，可用 container / network / image 匹配一类事件
+  type?: string[]
+  container?: string
+}
+
+const eventTypes: EventType[] = [
+  'container.created',
+  'container.started',
+  'container.stopped',
+  'container.exited',
+  'container.removed',
+  'container.restarted',
+  'network.created',
+  'network.removed',
+  'image.created',
+  'image.removed',
+]
+
+// 订阅生命周期事件，断线后浏览器会带着 Last-Event-ID 自动重连；
+// 服务重启等原因无法补发断线期间的事件时，服务端推送 resync，调用 onResync 重新加载全部状态。返回取消订阅函数
+export const subscribeEvents = (
+  onEvent: (event: LifecycleEvent) => void,
+  filter: EventFilter = {},
+  onResync?: () => void,
+) => {
+  const params = new URLSearchParams()
+  if (filter.type?.length) params.set('type', filter.type.join(','))
+  if (filter.container) params.set('container', filter.container)
+
+  const query = params.toString()
+  const source = new EventSource(withAccessToken(`${api.defaults.baseURL}/events${query ? `?${query}` : ''}`))
+  const handler = (e: MessageEvent) => onEvent(JSON.parse(e.data))
+  eventTypes.forEach(type => source.addEventListener(type, handler))
+  if (onResync) source.addEventListener('resync', () => onResync())
+
+  return () => source.close()
+}
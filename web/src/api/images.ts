@@ -0,0 +1,53 @@
+import api, { withAccessToken } from './index'
+
+export interface ImageInfo {
+  name: string
+  size: number
+  tar_path?: string
+  tar_size: number
+  rootfs_path?: string
+  rootfs_size: number
+  mod_time: string
+  containers: string[]
+}
+
+// 获取镜像列表
+export const getImages = () => {
+  return api.get('/images')
+}
+
+// 获取镜像详情
+export const getImage = (name: string) => {
+  return api.get(`/images/${name}`)
+}
+
+// 删除镜像，被已停止容器使用的镜像需要 force
+export const removeImage = (name: string, force = false) => {
+  return api.delete(`/images/${name}`, { params: force ? { force: true } : {} })
+}
+
+// 上传 tar 包作为新镜像，name 和 sha256 必须位于 file 之前；大文件上传不设置超时
+export const uploadImage = (
+  name: string,
+  file: File,
+  sha256?: string,
+  onProgress?: (percent: number) => void
+) => {
+  const form = new FormData()
+  form.append('name', name)
+  if (sha256) form.append('sha256', sha256)
+  form.append('file', file)
+  return api.post('/images', form, {
+    timeout: 0,
+    onUploadProgress: event => {
+      if (onProgress && event.total) {
+        onProgress(Math.round((event.loaded / event.total) * 100))
+      }
+    }
+  })
+}
+
+// 镜像 tar 包的下载地址，由浏览器直接下载，不经过 axios 缓存到内存
+export const imageDownloadUrl = (name: string) => {
+  return withAccessToken(`${api.defaults.baseURL}/images/${encodeURIComponent(name)}/tar`)
+}
@@ -1,14 +1,106 @@
-import axios from 'axios'
+import axios, { type InternalAxiosRequestConfig } from 'axios'
 
 const api = axios.create({
   baseURL: 'http://localhost:8080/api/v1',
   timeout: 10000,
 })
 
-// 响应拦截器
+export interface TokenPair {
+  access_token: string
+  refresh_token: string
+  token_type: string
+  expires_in: number
+  refresh_expires_in: number
+}
+
+const ACCESS_TOKEN_KEY = 'zdocker.access_token'
+const REFRESH_TOKEN_KEY = 'zdocker.refresh_token'
+
+export const getAccessToken = () => localStorage.getItem(ACCESS_TOKEN_KEY)
+
+export const setTokens = (tokens: TokenPair) => {
+  localStorage.setItem(ACCESS_TOKEN_KEY, tokens.access_token)
+  localStorage.setItem(REFRESH_TOKEN_KEY, tokens.refresh_token)
+}
+
+export const clearTokens = () => {
+  localStorage.removeItem(ACCESS_TOKEN_KEY)
+  localStorage.removeItem(REFRESH_TOKEN_KEY)
+}
+
+// EventSource、WebSocket 和浏览器直接下载的链接无法设置请求头，通过 access_token 查询参数传递令牌
+export const withAccessToken = (url: string) => {
+  const token = getAccessToken()
+  if (!token) return url
+  return `${url}${url.includes('?') ? '&' : '?'}access_token=${encodeURIComponent(token)}`
+}
+
+// fetch 请求使用的认证头
+export const authHeaders = (): Record<string, string> => {
+  const token = getAccessToken()
+  return token ? { Authorization: `Bearer ${token}` } : {}
+}
+
+// 跳转到登录页，登录后回到当前页面
+const redirectToLogin = () => {
+  clearTokens()
+  if (window.location.pathname !== '/login') {
+    const redirect = encodeURIComponent(window.location.pathname + window.location.search)
+    window.location.href = `/login?redirect=${redirect}`
+  }
+}
+
+// 登录和刷新接口返回 401 时不刷新令牌，由调用方处理
+const skipRefresh = ['/auth/login', '/auth/refresh']
+
+// 同时有多个请求返回 401 时只刷新一次令牌
+let refreshing: Promise<string> | null = null
+
+// refreshAccessToken 用刷新令牌换取新的令牌，刷新令牌只能使用一次
+export const refreshAccessToken = () => {
+  if (!refreshing) {
+    const refreshToken = localStorage.getItem(REFRESH_TOKEN_KEY)
+    refreshing = (refreshToken
+      ? axios.post(`${api.defaults.baseURL}/auth/refresh`, { refresh_token: refreshToken })
+          .then(response => {
+            setTokens(response.data.data.tokens)
+            return response.data.data.tokens.access_token as string
+          })
+      : Promise.reject(new Error('没有刷新令牌'))
+    ).finally(() => {
+      refreshing = null
+    })
+  }
+  return refreshing
+}
+
+// 请求拦截器，携带访问令牌
+api.interceptors.request.use(config => {
+  const token = getAccessToken()
+  if (token) {
+    config.headers.Authorization = `Bearer ${token}`
+  }
+  return config
+})
+
+// 响应拦截器，访问令牌过期时刷新后重试一次，刷新失败跳转到登录页
 api.interceptors.response.use(
   response => response.data,
-  error => {
+  async error => {
+    const config = error.config as (InternalAxiosRequestConfig & { _retried?: boolean }) | undefined
+    if (error.response?.status === 401 && config && !skipRefresh.includes(config.url || '')) {
+      if (config._retried) {
+        redirectToLogin()
+      } else {
+        config._retried = true
+        try {
+          await refreshAccessToken()
+          return api(config)
+        } catch {
+          redirectToLogin()
+        }
+      }
+    }
     console.error('API请求失败:', error)
     return Promise.reject(error)
   }
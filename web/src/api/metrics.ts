@@ -0,0 +1,32 @@
+import api from './index'
+
+export interface MetricPoint {
+  t: number
+  v: number
+}
+
+export interface MetricSeries {
+  target: string
+  points: MetricPoint[]
+}
+
+export interface MetricQueryResult {
+  metric: string
+  step: string
+  start: number
+  end: number
+  series: MetricSeries[]
+}
+
+export interface MetricQuery {
+  metric: string
+  container?: string
+  range?: string
+  step?: string
+  end?: string
+}
+
+// 查询服务端保存的历史指标
+export const queryMetrics = (query: MetricQuery) => {
+  return api.get('/metrics/query', { params: query })
+}
@@ -0,0 +1,50 @@
+import api, { withAccessToken } from './index'
+
+export interface TerminalHandlers {
+  onOutput: (data: string) => void
+  onExit?: (exitCode: number) => void
+  onClose?: (reason: string) => void
+}
+
+export interface TerminalSession {
+  send: (data: string) => void
+  resize: (rows: number, cols: number) => void
+  close: () => void
+}
+
+// 打开容器的交互式终端，command 为空时启动 /bin/sh
+export const openTerminal = (
+  id: string,
+  handlers: TerminalHandlers,
+  options: { command?: string[]; rows?: number; cols?: number } = {}
+): TerminalSession => {
+  const params = new URLSearchParams()
+  options.command?.forEach(arg => params.append('command', arg))
+  if (options.rows) params.set('rows', String(options.rows))
+  if (options.cols) params.set('cols', String(options.cols))
+
+  const base = (api.defaults.baseURL || '').replace(/^http/, 'ws')
+  const ws = new WebSocket(withAccessToken(`${base}/containers/${id}/exec/ws?${params.toString()}`))
+  ws.binaryType = 'arraybuffer'
+  const decoder = new TextDecoder()
+
+  ws.onmessage = (e: MessageEvent) => {
+    if (typeof e.data === 'string') {
+      const msg = JSON.parse(e.data)
+      if (msg.type === 'exit') handlers.onExit?.(msg.exit_code)
+      return
+    }
+    handlers.onOutput(decoder.decode(e.data, { stream: true }))
+  }
+  ws.onclose = (e: CloseEvent) => handlers.onClose?.(e.reason)
+
+  const sendControl = (msg: object) => {
+    if (ws.readyState === WebSocket.OPEN) ws.send(JSON.stringify(msg))
+  }
+
+  return {
+    send: data => sendControl({ type: 'input', data }),
+    resize: (rows, cols) => sendControl({ type: 'resize', rows, cols }),
+    close: () => ws.close()
+  }
+}
@@ -0,0 +1,36 @@
+import api from './index'
+
+export interface APITokenInfo {
+  id: string
+  name: string
+  username: string
+  // 令牌的开头部分，只用于辨认
+  prefix: string
+  scopes: string[]
+  created_at: string
+  expires_at?: string
+  last_used_at?: string
+  expired: boolean
+}
+
+export interface CreateAPITokenRequest {
+  name: string
+  scopes: string[]
+  // 为空时永不过期
+  expires_at?: string
+}
+
+// 获取当前用户的 API 令牌
+export const getAPITokens = () => {
+  return api.get('/tokens')
+}
+
+// 创建 API 令牌，返回的明文令牌只能查看这一次
+export const createAPIToken = (data: CreateAPITokenRequest) => {
+  return api.post('/tokens', data)
+}
+
+// 撤销 API 令牌
+export const revokeAPIToken = (id: string) => {
+  return api.delete(`/tokens/${id}`)
+}
@@ -1,8 +1,15 @@
 import { createRouter, createWebHistory } from 'vue-router'
+import { getAccessToken } from '@/api/index'
 
 const router = createRouter({
   history: createWebHistory(import.meta.env.BASE_URL),
   routes: [
+    {
+      path: '/login',
+      name: 'login',
+      component: () => import('../views/LoginView.vue'),
+      meta: { public: true },
+    },
     {
       path: '/',
       name: 'dashboard',
@@ -33,7 +40,24 @@ const router = createRouter({
       name: 'logs',
       component: () => import('../views/LogsView.vue'),
     },
+    {
+      path: '/tokens',
+      name: 'tokens',
+      component: () => import('../views/TokensView.vue'),
+    },
+    {
+      path: '/audit',
+      name: 'audit',
+      component: () => import('../views/AuditView.vue'),
+    },
   ],
 })
 
+// 未登录时跳转到登录页，登录后回到原页面；令牌过期由 api 的响应拦截器刷新
+router.beforeEach(to => {
+  if (!to.meta.public && !getAccessToken()) {
+    return { name: 'login', query: { redirect: to.fullPath } }
+  }
+})
+
 export default router
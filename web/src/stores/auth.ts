@@ -0,0 +1,31 @@
+import { ref } from 'vue'
+import { defineStore } from 'pinia'
+import { getCurrentUser, type CurrentUser, type UserInfo } from '@/api/auth'
+
+// 当前登录用户及其权限，页面据此隐藏没有权限的操作；服务端仍会逐个接口校验
+export const useAuthStore = defineStore('auth', () => {
+  const user = ref<UserInfo | null>(null)
+  const roles = ref<CurrentUser['roles']>([])
+  const permissions = ref<string[]>([])
+
+  async function load() {
+    const response = await getCurrentUser()
+    const data = response.data as CurrentUser
+    user.value = data.user
+    roles.value = data.roles || []
+    permissions.value = data.permissions || []
+  }
+
+  function reset() {
+    user.value = null
+    roles.value = []
+    permissions.value = []
+  }
+
+  // 是否有权限，不考虑角色的容器范围；范围外的容器不会出现在列表中
+  function can(permission: string) {
+    return permissions.value.includes(permission)
+  }
+
+  return { user, roles, permissions, load, reset, can }
+})